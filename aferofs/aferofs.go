@@ -0,0 +1,214 @@
+// Package aferofs bridges vfs and github.com/spf13/afero.  ToAfero exposes
+// a vfs.FileSystem as an afero.Fs and FromAfero exposes an afero.Fs as a
+// vfs.FileSystem, allowing code written against either API to be migrated
+// incrementally and afero-only backends to be used with vfs utilities such
+// as Walk, Glob and Watch.
+package aferofs
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/mh-orange/vfs"
+	"github.com/spf13/afero"
+)
+
+// toOsErr converts vfs errors into their os equivalents so that afero callers
+// can continue to use os.IsNotExist and friends
+func toOsErr(err error) error {
+	switch e := err.(type) {
+	case *vfs.PathError:
+		return &os.PathError{Op: e.Op, Path: e.Path, Err: toOsErr(e.Cause)}
+	case *vfs.LinkError:
+		return &os.LinkError{Op: e.Op, Old: e.Old, New: e.New, Err: toOsErr(e.Cause)}
+	}
+
+	switch err {
+	case vfs.ErrNotExist:
+		err = os.ErrNotExist
+	case vfs.ErrExist:
+		err = os.ErrExist
+	case vfs.ErrClosed:
+		err = os.ErrClosed
+	case vfs.ErrPermission:
+		err = os.ErrPermission
+	}
+	return err
+}
+
+// aferoFs is an afero.Fs backed by a vfs.FileSystem
+type aferoFs struct {
+	fs vfs.FileSystem
+}
+
+// ToAfero returns an afero.Fs that performs all operations on fs
+func ToAfero(fs vfs.FileSystem) afero.Fs {
+	return &aferoFs{fs: fs}
+}
+
+func (afs *aferoFs) file(f vfs.File, err error) (afero.File, error) {
+	if err != nil {
+		return nil, toOsErr(err)
+	}
+	return &aferoFile{File: f}, nil
+}
+
+func (afs *aferoFs) Create(name string) (afero.File, error) {
+	return afs.file(afs.fs.Create(name))
+}
+
+func (afs *aferoFs) Mkdir(name string, perm os.FileMode) error {
+	return toOsErr(afs.fs.Mkdir(name, perm))
+}
+
+func (afs *aferoFs) MkdirAll(path string, perm os.FileMode) error {
+	return toOsErr(vfs.MkdirAll(afs.fs, path, perm))
+}
+
+func (afs *aferoFs) Open(name string) (afero.File, error) {
+	return afs.file(afs.fs.Open(name))
+}
+
+func (afs *aferoFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	return afs.file(afs.fs.OpenFile(name, vfs.OpenFlag(flag), perm))
+}
+
+func (afs *aferoFs) Remove(name string) error {
+	return toOsErr(afs.fs.Remove(name))
+}
+
+func (afs *aferoFs) RemoveAll(path string) error {
+	return toOsErr(vfs.RemoveAll(afs.fs, path))
+}
+
+func (afs *aferoFs) Rename(oldname, newname string) error {
+	return toOsErr(afs.fs.Rename(oldname, newname))
+}
+
+func (afs *aferoFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := afs.fs.Stat(name)
+	return fi, toOsErr(err)
+}
+
+// LstatIfPossible satisfies afero.Lstater, every vfs.FileSystem
+// supports Lstat
+func (afs *aferoFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fi, err := afs.fs.Lstat(name)
+	return fi, true, toOsErr(err)
+}
+
+func (afs *aferoFs) Name() string { return "vfs" }
+
+func (afs *aferoFs) Chmod(name string, mode os.FileMode) error {
+	return toOsErr(afs.fs.Chmod(name, mode))
+}
+
+// Chown is not supported by vfs
+func (afs *aferoFs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: vfs.ErrNotSupported}
+}
+
+// Chtimes is not supported by vfs
+func (afs *aferoFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: vfs.ErrNotSupported}
+}
+
+// aferoFile is an afero.File backed by a vfs.File
+type aferoFile struct {
+	vfs.File
+}
+
+func (f *aferoFile) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return toOsErr(closer.Close())
+	}
+	return nil
+}
+
+// Sync commits the file to stable storage if the underlying
+// file supports it, otherwise it does nothing
+func (f *aferoFile) Sync() error {
+	if syncer, ok := f.File.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+func (f *aferoFile) Truncate(size int64) error {
+	if truncater, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		return truncater.Truncate(size)
+	}
+	return &os.PathError{Op: "truncate", Path: f.Name(), Err: vfs.ErrNotSupported}
+}
+
+func (f *aferoFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// fromAfero is a vfs.FileSystem backed by an afero.Fs
+type fromAfero struct {
+	fs afero.Fs
+}
+
+// FromAfero returns a vfs.FileSystem that performs all operations on fs.  afero
+// has no notion of file watching so the returned FileSystem's Watcher returns
+// vfs.ErrNotSupported
+func FromAfero(fs afero.Fs) vfs.FileSystem {
+	return &fromAfero{fs: fs}
+}
+
+func (fa *fromAfero) file(f afero.File, err error) (vfs.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fa *fromAfero) Chmod(filename string, mode os.FileMode) error {
+	return fa.fs.Chmod(filename, mode)
+}
+
+func (fa *fromAfero) Create(filename string) (vfs.File, error) {
+	return fa.file(fa.fs.Create(filename))
+}
+
+func (fa *fromAfero) Open(filename string) (vfs.File, error) {
+	return fa.file(fa.fs.Open(filename))
+}
+
+func (fa *fromAfero) OpenFile(filename string, flag vfs.OpenFlag, perm os.FileMode) (vfs.File, error) {
+	return fa.file(fa.fs.OpenFile(filename, int(flag), perm))
+}
+
+func (fa *fromAfero) Mkdir(name string, perm os.FileMode) error {
+	return fa.fs.Mkdir(name, perm)
+}
+
+func (fa *fromAfero) Remove(name string) error {
+	return fa.fs.Remove(name)
+}
+
+func (fa *fromAfero) Rename(oldpath, newpath string) error {
+	return fa.fs.Rename(oldpath, newpath)
+}
+
+// Lstat uses afero.Lstater when the afero.Fs supports it and
+// falls back to Stat otherwise
+func (fa *fromAfero) Lstat(filename string) (os.FileInfo, error) {
+	if lstater, ok := fa.fs.(afero.Lstater); ok {
+		fi, _, err := lstater.LstatIfPossible(filename)
+		return fi, err
+	}
+	return fa.fs.Stat(filename)
+}
+
+func (fa *fromAfero) Stat(filename string) (os.FileInfo, error) {
+	return fa.fs.Stat(filename)
+}
+
+func (fa *fromAfero) Close() error { return nil }
+
+func (fa *fromAfero) Watcher(chan<- vfs.Event) (vfs.Watcher, error) {
+	return nil, vfs.ErrNotSupported
+}
@@ -0,0 +1,82 @@
+package aferofs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+	"github.com/spf13/afero"
+)
+
+func TestToAfero(t *testing.T) {
+	afs := ToAfero(vfs.NewMemFs())
+	err := afs.MkdirAll("/one/two", 0755)
+	if err == nil {
+		err = afero.WriteFile(afs, "/one/two/foo.txt", []byte("hello world"), 0644)
+	}
+
+	if err == nil {
+		var got []byte
+		got, err = afero.ReadFile(afs, "/one/two/foo.txt")
+		if err == nil && string(got) != "hello world" {
+			t.Errorf("Wanted %q got %q", "hello world", string(got))
+		}
+	}
+
+	if err == nil {
+		var paths []string
+		err = afero.Walk(afs, "/", func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+		want := []string{"/", "/one", "/one/two", "/one/two/foo.txt"}
+		if err == nil && !reflect.DeepEqual(want, paths) {
+			t.Errorf("Wanted paths %v got %v", want, paths)
+		}
+	}
+
+	if err == nil {
+		err = afs.RemoveAll("/one")
+		if _, err1 := afs.Stat("/one"); !os.IsNotExist(err1) {
+			t.Errorf("Expected os.IsNotExist to be true for a removed path, got %v", err1)
+		}
+	}
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestFromAfero(t *testing.T) {
+	fs := FromAfero(afero.NewMemMapFs())
+	err := vfs.MkdirAll(fs, "/one/two", 0755)
+	if err == nil {
+		err = vfs.WriteFile(fs, "/one/two/foo.txt", []byte("hello world"), 0644)
+	}
+
+	if err == nil {
+		var got []byte
+		got, err = vfs.ReadFile(fs, "/one/two/foo.txt")
+		if err == nil && string(got) != "hello world" {
+			t.Errorf("Wanted %q got %q", "hello world", string(got))
+		}
+	}
+
+	if err == nil {
+		var matches []string
+		matches, err = vfs.Glob(fs, "/one/*/*.txt")
+		want := []string{"/one/two/foo.txt"}
+		if err == nil && !reflect.DeepEqual(want, matches) {
+			t.Errorf("Wanted matches %v got %v", want, matches)
+		}
+	}
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if _, err := fs.Watcher(nil); err != vfs.ErrNotSupported {
+		t.Errorf("Wanted error %v got %v", vfs.ErrNotSupported, err)
+	}
+}
@@ -0,0 +1,267 @@
+package vfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveFormat selects the kind of archive written by Archive
+type ArchiveFormat int
+
+const (
+	// TarFormat is an uncompressed tar stream
+	TarFormat ArchiveFormat = iota
+
+	// TarGzFormat is a gzip compressed tar stream
+	TarGzFormat
+
+	// ZipFormat is a zip archive with deflated file contents
+	ZipFormat
+)
+
+// Archive writes the tree rooted at root to w in the given format.  Entry
+// names are relative to root and directories, permissions, modification
+// times and symbolic links are preserved.  The archive is complete when
+// Archive returns, but w itself is not closed.  Unknown formats fail with
+// ErrNotSupported
+func Archive(fs FileSystem, root string, w io.Writer, format ArchiveFormat) (err error) {
+	switch format {
+	case TarFormat:
+		err = writeTarStream(fs, root, w)
+	case TarGzFormat:
+		zw := gzip.NewWriter(w)
+		if err = writeTarStream(fs, root, zw); err == nil {
+			err = zw.Close()
+		}
+	case ZipFormat:
+		err = WriteZip(fs, root, w)
+	default:
+		err = &PathError{Op: "archive", Path: root, Cause: ErrNotSupported}
+	}
+	return fixErr(err)
+}
+
+// writeTarStream writes the tree rooted at root to w as a complete tar stream
+func writeTarStream(fs FileSystem, root string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := WriteTar(fs, root, tw)
+	if err == nil {
+		err = tw.Close()
+	}
+	return err
+}
+
+// Unarchive extracts an archive in the given format from r into the
+// directory root, creating it if needed.  Directories, permissions and
+// symbolic links are recreated and existing files are replaced.  Entries
+// with absolute names or names that leave root, symbolic links that point
+// outside of root and entries that would be written through a symbolic link
+// fail with ErrInsecurePath.  Symbolic links fail with ErrNotSupported when
+// fs cannot create them, while hard links, devices, pipes and sockets are
+// skipped.  Zip archives are read into memory before they are extracted.
+// Unarchive stops at the first error, leaving root partially extracted
+func Unarchive(fs FileSystem, root string, r io.Reader, format ArchiveFormat) error {
+	x := &extractor{fs: fs, root: root}
+	err := MkdirAll(fs, root, 0755)
+	if err == nil {
+		switch format {
+		case TarFormat:
+			err = x.tar(r)
+		case TarGzFormat:
+			var zr *gzip.Reader
+			if zr, err = gzip.NewReader(r); err == nil {
+				err = x.tar(zr)
+			}
+		case ZipFormat:
+			err = x.zip(r)
+		default:
+			err = &PathError{Op: "unarchive", Path: root, Cause: ErrNotSupported}
+		}
+	}
+
+	if err == nil {
+		// directories are only made read only once nothing else needs to be
+		// created in them, deepest first
+		for i := len(x.dirs) - 1; i >= 0 && err == nil; i-- {
+			err = fs.Chmod(x.dirs[i].name, x.dirs[i].perm)
+		}
+	}
+	return fixErr(err)
+}
+
+// extractedDir is a directory whose permissions are set once extraction
+// has finished
+type extractedDir struct {
+	name string
+	perm os.FileMode
+}
+
+// extractor holds the state of an Unarchive call
+type extractor struct {
+	fs   FileSystem
+	root string
+	dirs []extractedDir
+}
+
+func (x *extractor) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err = x.extract(hdr.Name, hdr.FileInfo().Mode(), hdr.Linkname, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extractor) zip(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if f.Mode()&os.ModeSymlink != 0 {
+			// zip stores the target of a symbolic link as its content
+			var target []byte
+			target, err = io.ReadAll(rc)
+			link = string(target)
+		}
+
+		if err == nil {
+			err = x.extract(f.Name, f.Mode(), link, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryName returns the name of an archive entry relative to the root,
+// or ErrInsecurePath if it does not stay within the root
+func entryName(name string) (string, error) {
+	rel := path.Clean(name)
+	if path.IsAbs(name) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", &PathError{Op: "unarchive", Path: name, Cause: ErrInsecurePath}
+	}
+	return rel, nil
+}
+
+// checkParents makes sure none of the directories leading to rel are
+// symbolic links, which could redirect the entry outside of the root
+func (x *extractor) checkParents(rel string) error {
+	dir := x.root
+	for _, elem := range strings.Split(path.Dir(rel), PathSeparator) {
+		if elem == "." {
+			break
+		}
+
+		dir = path.Join(dir, elem)
+		info, err := x.fs.Lstat(dir)
+		if IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			return &PathError{Op: "unarchive", Path: rel, Cause: ErrInsecurePath}
+		}
+	}
+	return nil
+}
+
+// extract creates a single archive entry
+func (x *extractor) extract(name string, mode os.FileMode, link string, content io.Reader) error {
+	rel, err := entryName(name)
+	if err != nil || rel == "." {
+		return err
+	}
+
+	if err = x.checkParents(rel); err != nil {
+		return err
+	}
+
+	filename := path.Join(x.root, rel)
+	if err = MkdirAll(x.fs, path.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	current, err := x.fs.Lstat(filename)
+	if err == nil && (current.Mode().Type() != mode.Type() || mode&os.ModeSymlink != 0) {
+		// replace entries that changed type and links, which cannot be
+		// written through
+		current, err = nil, RemoveAll(x.fs, filename)
+	} else if IsNotExist(err) {
+		current, err = nil, nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mode.IsDir():
+		if current == nil {
+			// keep the directory writable until everything in it exists
+			err = x.fs.Mkdir(filename, mode.Perm()|0700)
+		}
+		x.dirs = append(x.dirs, extractedDir{filename, mode.Perm()})
+	case mode&os.ModeSymlink != 0:
+		linker, ok := x.fs.(symlinker)
+		if !ok {
+			return &LinkError{Op: "symlink", Old: link, New: filename, Cause: ErrNotSupported}
+		}
+
+		target := path.Join(path.Dir(rel), link)
+		if path.IsAbs(link) || target == ".." || strings.HasPrefix(target, "../") {
+			return &PathError{Op: "unarchive", Path: name, Cause: ErrInsecurePath}
+		}
+		err = linker.Symlink(link, filename)
+	case mode.IsRegular():
+		err = extractFile(x.fs, filename, mode.Perm(), content)
+	}
+	return err
+}
+
+// extractFile writes the contents of a file read from an archive
+func extractFile(fs FileSystem, filename string, perm os.FileMode, content io.Reader) error {
+	w, err := fs.OpenFile(filename, WrOnlyFlag|CreateFlag|TruncFlag, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, content)
+	if closer, ok := w.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+
+	if err == nil {
+		err = fs.Chmod(filename, perm)
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package vfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	src := NewMemFs()
+	MkdirAll(src, "/root/dir", 0750)
+	WriteFile(src, "/root/one.txt", []byte("one"), 0640)
+	WriteFile(src, "/root/dir/two.txt", []byte("two"), 0600)
+	src.(*memfs).Symlink("dir/two.txt", "/root/link")
+
+	readTar := func(data []byte) (FileSystem, error) {
+		return NewTarFs(bytes.NewReader(data), int64(len(data)))
+	}
+
+	tests := []struct {
+		name   string
+		format ArchiveFormat
+		read   func([]byte) (FileSystem, error)
+	}{
+		{"tar", TarFormat, readTar},
+		{"tar.gz", TarGzFormat, func(data []byte) (FileSystem, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			if data, err = io.ReadAll(zr); err != nil {
+				return nil, err
+			}
+			return readTar(data)
+		}},
+		{"zip", ZipFormat, func(data []byte) (FileSystem, error) {
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			return FromIoFS(zr), err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := Archive(src, "/root", buf, test.format); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			fs, err := test.read(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
+				if err != nil {
+					t.Errorf("%s: unexpected error: %v", filename, err)
+					return err
+				}
+
+				if filename != "/" {
+					want, _ := src.Lstat("/root" + filename)
+					// archive/zip reports every directory as read only
+					if info.Mode() != want.Mode() && !(info.IsDir() && test.format == ZipFormat) {
+						t.Errorf("%s: wanted mode %v got %v", filename, want.Mode(), info.Mode())
+					}
+
+					// tar rounds modification times to the second
+					if d := info.ModTime().Sub(want.ModTime()); !info.IsDir() && (d <= -time.Second || d >= time.Second) {
+						t.Errorf("%s: wanted modtime %v got %v", filename, want.ModTime(), info.ModTime())
+					}
+				}
+				got = append(got, filename)
+				return nil
+			})
+
+			want := []string{"/", "/dir", "/dir/two.txt", "/link", "/one.txt"}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Wanted %v got %v", want, got)
+			}
+
+			if data, _ := ReadFile(fs, "/one.txt"); string(data) != "one" {
+				t.Errorf("Wanted one got %q", data)
+			}
+		})
+	}
+
+	if err := Archive(src, "/root", &bytes.Buffer{}, ArchiveFormat(-1)); !IsError(ErrNotSupported, err) {
+		t.Errorf("Wanted ErrNotSupported got %v", err)
+	}
+}
+
+func TestUnarchive(t *testing.T) {
+	src := NewMemFs()
+	MkdirAll(src, "/root/dir/ro", 0750)
+	WriteFile(src, "/root/one.txt", []byte("one"), 0640)
+	WriteFile(src, "/root/dir/ro/two.txt", []byte("two"), 0600)
+	src.Chmod("/root/dir/ro", 0550)
+	src.(*memfs).Symlink("dir/ro/two.txt", "/root/link")
+
+	for _, format := range []ArchiveFormat{TarFormat, TarGzFormat, ZipFormat} {
+		buf := &bytes.Buffer{}
+		if err := Archive(src, "/root", buf, format); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		dst := NewMemFs()
+		WriteFile(dst, "/out/one.txt", []byte("old contents"), 0666)
+		if err := Unarchive(dst, "/out", buf, format); err != nil {
+			t.Fatalf("format %d: unexpected error: %v", format, err)
+		}
+
+		var got []string
+		Walk(dst, "/out", func(filename string, info os.FileInfo, err error) error {
+			want, _ := src.Lstat("/root" + filename[len("/out"):])
+			if filename != "/out" && info.Mode() != want.Mode() {
+				t.Errorf("format %d: %s wanted mode %v got %v", format, filename, want.Mode(), info.Mode())
+			}
+			got = append(got, filename)
+			return err
+		})
+
+		want := []string{"/out", "/out/dir", "/out/dir/ro", "/out/dir/ro/two.txt", "/out/link", "/out/one.txt"}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("format %d: wanted %v got %v", format, want, got)
+		}
+
+		if data, _ := ReadFile(dst, "/out/link"); string(data) != "two" {
+			t.Errorf("format %d: wanted two got %q", format, data)
+		}
+
+		if data, _ := ReadFile(dst, "/out/one.txt"); string(data) != "one" {
+			t.Errorf("format %d: wanted one got %q", format, data)
+		}
+	}
+}
+
+func TestUnarchiveInsecure(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{"parent", []tar.Header{{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}}},
+		{"nested parent", []tar.Header{{Name: "dir/../../evil", Typeflag: tar.TypeReg, Mode: 0644}}},
+		{"absolute", []tar.Header{{Name: "/evil", Typeflag: tar.TypeReg, Mode: 0644}}},
+		{"absolute link", []tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}}},
+		{"escaping link", []tar.Header{{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}}},
+		{"through link", []tar.Header{
+			{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+			{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			tw := tar.NewWriter(buf)
+			for _, hdr := range test.entries {
+				hdr := hdr
+				tw.WriteHeader(&hdr)
+			}
+			tw.Close()
+
+			fs := NewMemFs()
+			if err := Unarchive(fs, "/out/root", buf, TarFormat); !IsError(ErrInsecurePath, err) {
+				t.Errorf("Wanted ErrInsecurePath got %v", err)
+			}
+
+			if found, _ := Exists(fs, "/out/evil"); found {
+				t.Errorf("Wanted /out/evil not to exist")
+			}
+
+			if found, _ := Exists(fs, "/out/root/dir/evil"); found {
+				t.Errorf("Wanted /out/root/dir/evil not to exist")
+			}
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	zw.Create("../evil")
+	zw.Close()
+	if err := Unarchive(NewMemFs(), "/out", buf, ZipFormat); !IsError(ErrInsecurePath, err) {
+		t.Errorf("Wanted ErrInsecurePath got %v", err)
+	}
+}
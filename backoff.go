@@ -0,0 +1,50 @@
+package vfs
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes an exponential backoff with optional jitter used when
+// retrying failed operations
+type Backoff struct {
+	// Retries is the number of times an operation is retried after the
+	// first attempt fails
+	Retries int
+
+	// Initial is the delay before the first retry
+	Initial time.Duration
+
+	// Max caps the delay between retries, zero means no cap
+	Max time.Duration
+
+	// Multiplier is applied to the delay after each retry.  Values less
+	// than 1 are treated as 2
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction (0 to 1) of the
+	// delay so that many clients do not retry in lock step
+	Jitter float64
+}
+
+// DefaultBackoff retries three times starting at 100ms and doubling up to 2s
+var DefaultBackoff = Backoff{Retries: 3, Initial: 100 * time.Millisecond, Max: 2 * time.Second, Multiplier: 2, Jitter: 0.2}
+
+// Delay returns how long to wait before the given retry (starting at 0)
+func (b Backoff) Delay(retry int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(retry))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,174 @@
+// Package billyfs adapts a vfs.FileSystem to the go-billy Filesystem
+// interface used by go-git.  This allows repositories to be cloned and
+// manipulated directly inside a memfs or any other vfs backend.
+package billyfs
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/chroot"
+	"github.com/mh-orange/vfs"
+)
+
+// billyFs is a billy.Filesystem backed by a vfs.FileSystem
+type billyFs struct {
+	fs vfs.FileSystem
+}
+
+// New returns a billy.Filesystem that performs all operations on fs
+func New(fs vfs.FileSystem) billy.Filesystem {
+	return &billyFs{fs: fs}
+}
+
+func (bfs *billyFs) file(f vfs.File, err error) (billy.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &billyFile{File: f}, nil
+}
+
+func (bfs *billyFs) Create(filename string) (billy.File, error) {
+	return bfs.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (bfs *billyFs) Open(filename string) (billy.File, error) {
+	return bfs.file(bfs.fs.Open(filename))
+}
+
+// OpenFile opens the named file, creating any missing parent directories when
+// os.O_CREATE is given as go-git expects
+func (bfs *billyFs) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if flag&os.O_CREATE != 0 {
+		if err := vfs.MkdirAll(bfs.fs, path.Dir(filename), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return bfs.file(bfs.fs.OpenFile(filename, vfs.OpenFlag(flag), perm))
+}
+
+func (bfs *billyFs) Stat(filename string) (os.FileInfo, error) {
+	return bfs.fs.Stat(filename)
+}
+
+func (bfs *billyFs) Rename(oldpath, newpath string) error {
+	if err := vfs.MkdirAll(bfs.fs, path.Dir(newpath), 0755); err != nil {
+		return err
+	}
+	return bfs.fs.Rename(oldpath, newpath)
+}
+
+func (bfs *billyFs) Remove(filename string) error {
+	return bfs.fs.Remove(filename)
+}
+
+func (bfs *billyFs) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// TempFile creates a new file in dir with a name beginning with prefix.  The
+// file is created exclusively so concurrent callers never share a file
+func (bfs *billyFs) TempFile(dir, prefix string) (billy.File, error) {
+	if err := vfs.MkdirAll(bfs.fs, dir, 0755); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 10000; i++ {
+		name := path.Join(dir, fmt.Sprintf("%s%d", prefix, rand.Uint32()))
+		f, err := bfs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if !vfs.IsExist(err) {
+			return f, err
+		}
+	}
+	return nil, &vfs.PathError{Op: "tempfile", Path: path.Join(dir, prefix), Cause: vfs.ErrExist}
+}
+
+// ReadDir returns the entries of the named directory sorted by name
+func (bfs *billyFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	f, err := bfs.fs.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := f.Readdir(-1)
+	if closer, ok := f.(io.Closer); ok {
+		closer.Close()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, err
+}
+
+func (bfs *billyFs) MkdirAll(filename string, perm os.FileMode) error {
+	return vfs.MkdirAll(bfs.fs, filename, perm)
+}
+
+func (bfs *billyFs) Lstat(filename string) (os.FileInfo, error) {
+	return bfs.fs.Lstat(filename)
+}
+
+// Symlink creates a symbolic link if the underlying FileSystem supports it
+func (bfs *billyFs) Symlink(target, link string) error {
+	if linker, ok := bfs.fs.(interface{ Symlink(string, string) error }); ok {
+		return linker.Symlink(target, link)
+	}
+	return &vfs.LinkError{Op: "symlink", Old: target, New: link, Cause: vfs.ErrNotSupported}
+}
+
+// Readlink returns the target of a symbolic link if the underlying
+// FileSystem supports it
+func (bfs *billyFs) Readlink(link string) (string, error) {
+	if reader, ok := bfs.fs.(interface{ Readlink(string) (string, error) }); ok {
+		return reader.Readlink(link)
+	}
+	return "", &vfs.PathError{Op: "readlink", Path: link, Cause: vfs.ErrNotSupported}
+}
+
+// Chroot returns a new billy.Filesystem rooted at dir
+func (bfs *billyFs) Chroot(dir string) (billy.Filesystem, error) {
+	return chroot.New(bfs, dir), nil
+}
+
+// Root returns the root of the filesystem which is always "/"
+func (bfs *billyFs) Root() string {
+	return vfs.PathSeparator
+}
+
+func (bfs *billyFs) Chmod(name string, mode os.FileMode) error {
+	return bfs.fs.Chmod(name, mode)
+}
+
+// Capabilities reports that the filesystem can read, write and seek.  Files
+// cannot be locked and are only truncatable if the underlying File supports it
+func (bfs *billyFs) Capabilities() billy.Capability {
+	return billy.ReadCapability | billy.WriteCapability | billy.ReadAndWriteCapability | billy.SeekCapability
+}
+
+// billyFile is a billy.File backed by a vfs.File
+type billyFile struct {
+	vfs.File
+}
+
+func (f *billyFile) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Lock does nothing, vfs files cannot be locked
+func (f *billyFile) Lock() error { return nil }
+
+// Unlock does nothing, vfs files cannot be locked
+func (f *billyFile) Unlock() error { return nil }
+
+func (f *billyFile) Truncate(size int64) error {
+	if truncater, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		return truncater.Truncate(size)
+	}
+	return &vfs.PathError{Op: "truncate", Path: f.Name(), Cause: vfs.ErrNotSupported}
+}
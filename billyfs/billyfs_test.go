@@ -0,0 +1,73 @@
+package billyfs
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/mh-orange/vfs"
+)
+
+func TestBillyFs(t *testing.T) {
+	bfs := New(vfs.NewMemFs())
+	err := util.WriteFile(bfs, "/repo/.git/HEAD", []byte("ref: refs/heads/master\n"), 0644)
+	if err == nil {
+		var got []byte
+		got, err = util.ReadFile(bfs, "/repo/.git/HEAD")
+		if err == nil && string(got) != "ref: refs/heads/master\n" {
+			t.Errorf("Wanted %q got %q", "ref: refs/heads/master\n", string(got))
+		}
+	}
+
+	if err == nil {
+		var paths []string
+		err = util.Walk(bfs, "/repo", func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+		want := []string{"/repo", "/repo/.git", "/repo/.git/HEAD"}
+		if err == nil && !reflect.DeepEqual(want, paths) {
+			t.Errorf("Wanted paths %v got %v", want, paths)
+		}
+	}
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestBillyFsChroot(t *testing.T) {
+	fs := vfs.NewMemFs()
+	vfs.MkdirAll(fs, "/repo", 0755)
+	bfs, _ := New(fs).Chroot("/repo")
+
+	f, err := bfs.TempFile("objects", "tmp_")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.Write([]byte("hello world"))
+	f.Close()
+
+	if !strings.HasPrefix(f.Name(), "objects/tmp_") {
+		t.Errorf("Wanted temp file in objects got %q", f.Name())
+	}
+
+	// the file should be visible outside of the chroot
+	got, err := vfs.ReadFile(fs, "/repo/"+f.Name())
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("Wanted %q got %q (err %v)", "hello world", string(got), err)
+	}
+}
+
+func TestBillyFsSymlink(t *testing.T) {
+	bfs := New(vfs.NewMemFs())
+	if err := bfs.Symlink("/target", "/link"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if target, err := bfs.Readlink("/link"); err != nil || target != "/target" {
+		t.Errorf("Wanted %q got %q (%v)", "/target", target, err)
+	}
+}
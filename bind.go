@@ -0,0 +1,162 @@
+package vfs
+
+import "io"
+
+// Bind makes the file or directory at source visible at target as well, like
+// a bind mount.  target must already exist and be a directory when source is
+// one and a file otherwise.  Whatever target held is hidden until Unbind is
+// called.  Both paths name the same inode, so changes made through one are
+// seen through the other and watchers of either path are notified.  Mount
+// points and bound entries cannot be removed or replaced, which fails with
+// ErrBusy, and binding a directory inside itself fails with ErrLoop.  The
+// FileSystem returned by NewMemFs can be asserted to
+// interface{ Bind(string, string) error } to reach it
+func (fs *memfs) Bind(source, target string) error {
+	if fs.readOnly.Load() {
+		return &LinkError{Op: "bind", Old: source, New: target, Cause: ErrReadOnly}
+	}
+
+	src, err := fs.resolve(source)
+	var point memInodeNum
+	if err == nil {
+		point, err = fs.entry(target)
+	}
+
+	if err == nil {
+		if dst := fs.inode(point); src.IsDir() && !dst.IsDir() {
+			err = ErrNotDir
+		} else if !src.IsDir() && dst.IsDir() {
+			err = ErrIsDir
+		} else if fs.reaches(src.num, point) {
+			err = ErrLoop
+		}
+	}
+
+	if err == nil {
+		fs.Lock()
+		if _, found := fs.mounts[point]; found {
+			err = ErrBusy
+		} else {
+			if fs.mounts == nil {
+				fs.mounts = make(map[memInodeNum]memInodeNum)
+			}
+			fs.mounts[point] = src.num
+		}
+		fs.Unlock()
+	}
+
+	if err != nil {
+		return &LinkError{Op: "bind", Old: source, New: target, Cause: err}
+	}
+	return nil
+}
+
+// Unbind removes the bind mount at target, uncovering what it held before.
+// ErrNotExist is returned when nothing is bound at target
+func (fs *memfs) Unbind(target string) error {
+	if fs.readOnly.Load() {
+		return &PathError{Op: "unbind", Path: target, Cause: ErrReadOnly}
+	}
+
+	point, err := fs.entry(target)
+	if err == nil {
+		fs.Lock()
+		if _, found := fs.mounts[point]; found {
+			delete(fs.mounts, point)
+		} else {
+			err = ErrNotExist
+		}
+		fs.Unlock()
+	}
+
+	if err != nil {
+		return &PathError{Op: "unbind", Path: target, Cause: err}
+	}
+	return nil
+}
+
+// entry returns the inode number held by the directory entry for name,
+// which is the mount point itself when something is bound there.  The root
+// has no directory entry and cannot be a mount point
+func (fs *memfs) entry(name string) (memInodeNum, error) {
+	dirname, filename := Split(name)
+	if filename == "" {
+		return 0, ErrBusy
+	}
+
+	parent, err := fs.resolve(dirname)
+	if err != nil {
+		return 0, err
+	} else if !parent.IsDir() {
+		return 0, ErrNotDir
+	}
+
+	num, err := fs.dir(parent).find(filename)
+	if err == io.EOF {
+		err = ErrNotExist
+	}
+	return num, err
+}
+
+// mounted returns the inode shown at a directory entry holding num, which
+// differs from num at mount points
+func (fs *memfs) mounted(num memInodeNum) memInodeNum {
+	fs.Lock()
+	defer fs.Unlock()
+	if source, found := fs.mounts[num]; found {
+		return source
+	}
+	return num
+}
+
+// mountPoints returns the mount points num is bound at
+func (fs *memfs) mountPoints(num memInodeNum) (points []memInodeNum) {
+	fs.Lock()
+	defer fs.Unlock()
+	for point, source := range fs.mounts {
+		if source == num {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// isMountPoint reports whether something is bound at num
+func (fs *memfs) isMountPoint(num memInodeNum) bool {
+	fs.Lock()
+	defer fs.Unlock()
+	_, found := fs.mounts[num]
+	return found
+}
+
+// isBound reports whether num is bound at a mount point
+func (fs *memfs) isBound(num memInodeNum) bool {
+	return len(fs.mountPoints(num)) > 0
+}
+
+// reaches reports whether num can be reached from the directory dir, either
+// directly or through mount points
+func (fs *memfs) reaches(dir, num memInodeNum) bool {
+	pending := []memInodeNum{num}
+	seen := map[memInodeNum]bool{num: true}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if current == dir {
+			return true
+		}
+
+		next := fs.mountPoints(current)
+		if current != 0 {
+			next = append(next, fs.inode(current).Parent())
+		}
+
+		for _, n := range next {
+			if !seen[n] {
+				seen[n] = true
+				pending = append(pending, n)
+			}
+		}
+	}
+	return false
+}
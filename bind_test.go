@@ -0,0 +1,138 @@
+package vfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+type binder interface {
+	Bind(source, target string) error
+	Unbind(target string) error
+}
+
+func TestMemBind(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/src/sub", 0755)
+	MkdirAll(fs, "/mnt", 0755)
+	MkdirAll(fs, "/other", 0755)
+	WriteFile(fs, "/src/file", []byte("source"), 0644)
+	WriteFile(fs, "/mnt/hidden", nil, 0644)
+	WriteFile(fs, "/file", nil, 0644)
+
+	b := fs.(binder)
+	if err := b.Bind("/src", "/mnt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(fs, "/mnt/file"); string(got) != "source" {
+		t.Errorf("Wanted source got %q", got)
+	}
+
+	if _, err := fs.Stat("/mnt/hidden"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+
+	WriteFile(fs, "/mnt/new", []byte("new"), 0644)
+	if got, _ := ReadFile(fs, "/src/new"); string(got) != "new" {
+		t.Errorf("Wanted new got %q", got)
+	}
+
+	src, _ := fs.Stat("/src")
+	mnt, _ := fs.Lstat("/mnt")
+	if !SameFile(src, mnt) {
+		t.Errorf("Wanted /src and /mnt to be the same inode")
+	}
+
+	infos, _ := readDir(fs, "/")
+	for _, info := range infos {
+		if info.Name() == "mnt" && !SameFile(src, info) {
+			t.Errorf("Wanted the directory entry of /mnt to describe /src")
+		}
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"remove mount point", func() error { return fs.Remove("/mnt") }, ErrBusy},
+		{"remove source", func() error { return fs.Remove("/src") }, ErrBusy},
+		{"rename mount point", func() error { return fs.Rename("/mnt", "/moved") }, ErrBusy},
+		{"replace source", func() error { return fs.Rename("/other", "/src") }, ErrBusy},
+		{"bind twice", func() error { return b.Bind("/other", "/mnt") }, ErrBusy},
+		{"bind inside itself", func() error { return b.Bind("/src", "/src/sub") }, ErrLoop},
+		{"bind through mount", func() error { return b.Bind("/src", "/mnt/sub") }, ErrLoop},
+		{"bind dir on file", func() error { return b.Bind("/src", "/file") }, ErrNotDir},
+		{"bind file on dir", func() error { return b.Bind("/file", "/other") }, ErrIsDir},
+		{"bind root", func() error { return b.Bind("/src", "/") }, ErrBusy},
+		{"unbind missing", func() error { return b.Unbind("/other") }, ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.op(); !IsError(test.want, err) {
+				t.Errorf("Wanted %v got %v", test.want, err)
+			}
+		})
+	}
+
+	if err := fs.Remove("/src/new"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := b.Unbind("/mnt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := fs.Stat("/mnt/hidden"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if err = fs.Remove("/src/file"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestMemBindWatch(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/src", 0755)
+	MkdirAll(fs, "/outer/mnt", 0755)
+	fs.(binder).Bind("/src", "/outer/mnt")
+
+	srcEvents, mntEvents, outerEvents := make(chan Event, 10), make(chan Event, 10), make(chan Event, 10)
+	srcWatcher, _ := fs.Watcher(srcEvents)
+	mntWatcher, _ := fs.Watcher(mntEvents)
+	outerWatcher, _ := fs.Watcher(outerEvents)
+	srcWatcher.Watch("/src")
+	mntWatcher.Watch("/outer/mnt")
+	if err := outerWatcher.(RecursiveWatcher).WatchRecursive("/outer"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	f, _ := fs.Create("/src/file")
+	closeFile(f)
+	srcWatcher.Close()
+	mntWatcher.Close()
+	outerWatcher.Close()
+
+	tests := []struct {
+		name   string
+		events chan Event
+		want   []Event
+	}{
+		{"source", srcEvents, []Event{{CreateEvent, "/src/file", nil}}},
+		{"mount point", mntEvents, []Event{{CreateEvent, "/outer/mnt/file", nil}}},
+		{"recursive", outerEvents, []Event{{CreateEvent, "/outer/mnt/file", nil}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []Event
+			for event := range test.events {
+				got = append(got, event)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
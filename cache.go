@@ -0,0 +1,306 @@
+package vfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a file that has been, or is being, copied into the cache
+type cacheEntry struct {
+	done     chan struct{}
+	err      error
+	size     int64
+	lastUsed time.Time
+}
+
+// CacheFs is a read-through cache in front of a slow FileSystem.  The first
+// time a regular file is opened for reading it is copied into a fast cache
+// FileSystem and every read after that is served from the cache.  Listings,
+// Stat and all modifications go to the backing FileSystem, modifications
+// made through CacheFs invalidate the cached copy.  Changes made to the
+// backing FileSystem by other means are not detected and must be reported
+// with Invalidate
+type CacheFs struct {
+	FileSystem
+	cache FileSystem
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// NewCacheFs returns a CacheFs reading from base and caching file contents
+// in cache.  The cache should be empty and dedicated to the CacheFs since
+// files in it are removed as they are invalidated.  WithClock sets the clock
+// used to track when cached files were last used
+func NewCacheFs(base, cache FileSystem, opts ...Option) *CacheFs {
+	cfs := &CacheFs{FileSystem: base, cache: cache, clock: SystemClock, entries: make(map[string]*cacheEntry)}
+	for _, opt := range opts {
+		opt(cfs)
+	}
+	return cfs
+}
+
+// fetch makes sure the named file is in the cache, copying it from the
+// backing FileSystem if necessary.  Concurrent fetches of the same file share
+// a single copy
+func (cfs *CacheFs) fetch(name string) error {
+	cfs.mu.Lock()
+	entry, found := cfs.entries[name]
+	if !found {
+		entry = &cacheEntry{done: make(chan struct{})}
+		cfs.entries[name] = entry
+	}
+	entry.lastUsed = cfs.clock.Now()
+	cfs.mu.Unlock()
+
+	if found {
+		<-entry.done
+		return entry.err
+	}
+
+	entry.size, entry.err = cfs.populate(name)
+	if entry.err != nil {
+		cfs.mu.Lock()
+		if cfs.entries[name] == entry {
+			delete(cfs.entries, name)
+		}
+		cfs.mu.Unlock()
+	}
+	close(entry.done)
+	return entry.err
+}
+
+// populate copies a file from the backing FileSystem into the cache
+func (cfs *CacheFs) populate(name string) (int64, error) {
+	info, err := cfs.FileSystem.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = MkdirAll(cfs.cache, path.Dir(name), 0755); err != nil {
+		return 0, err
+	}
+
+	dst, err := cfs.cache.OpenFile(name, WrOnlyFlag|CreateFlag|TruncFlag, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	err = copyTo(dst, cfs.FileSystem, name)
+	if closer, ok := dst.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if err != nil {
+		cfs.cache.Remove(name)
+	}
+	return info.Size(), err
+}
+
+// Invalidate removes the named file from the cache so that it is read from
+// the backing FileSystem the next time it is opened.  Invalidating a
+// directory invalidates every cached file beneath it
+func (cfs *CacheFs) Invalidate(name string) error {
+	name = Clean(name)
+	cfs.mu.Lock()
+	var names []string
+	for cached := range cfs.entries {
+		if cached == name || name == PathSeparator || strings.HasPrefix(cached, name+PathSeparator) {
+			names = append(names, cached)
+		}
+	}
+	cfs.mu.Unlock()
+	return cfs.evict(names...)
+}
+
+// InvalidateAll empties the cache
+func (cfs *CacheFs) InvalidateAll() error {
+	return cfs.Invalidate(PathSeparator)
+}
+
+// evict removes files from the cache and returns the first error
+func (cfs *CacheFs) evict(names ...string) (err error) {
+	for _, name := range names {
+		cfs.mu.Lock()
+		entry, found := cfs.entries[name]
+		delete(cfs.entries, name)
+		cfs.mu.Unlock()
+
+		if !found {
+			continue
+		}
+
+		// wait for an in progress copy so it is not left behind
+		<-entry.done
+		if entry.err == nil {
+			if err1 := cfs.cache.Remove(name); err == nil && !IsNotExist(err1) {
+				err = err1
+			}
+		}
+	}
+	return err
+}
+
+// Cached reports whether the named file is currently held in the cache
+func (cfs *CacheFs) Cached(name string) bool {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	_, found := cfs.entries[Clean(name)]
+	return found
+}
+
+func (cfs *CacheFs) Chmod(name string, mode os.FileMode) error {
+	cfs.Invalidate(name)
+	return cfs.FileSystem.Chmod(name, mode)
+}
+
+func (cfs *CacheFs) Create(name string) (File, error) {
+	return cfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (cfs *CacheFs) Open(name string) (File, error) {
+	return cfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+// OpenFile serves regular files opened for reading from the cache.  Files
+// opened for writing are opened on the backing FileSystem and are
+// invalidated both when they are opened and when they are closed
+func (cfs *CacheFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	name = Clean(name)
+	if flag.accessMode() != RdOnlyFlag || flag.has(CreateFlag) || flag.has(TruncFlag) {
+		cfs.Invalidate(name)
+		f, err := cfs.FileSystem.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return &cacheFile{File: f, fs: cfs, name: name}, nil
+	}
+
+	if !cfs.Cached(name) {
+		info, err := cfs.FileSystem.Stat(name)
+		if err != nil {
+			return nil, err
+		} else if !info.Mode().IsRegular() {
+			return cfs.FileSystem.OpenFile(name, flag, perm)
+		}
+	}
+
+	if err := cfs.fetch(name); err != nil {
+		return nil, err
+	}
+	return cfs.cache.OpenFile(name, flag, perm)
+}
+
+func (cfs *CacheFs) Remove(name string) error {
+	cfs.Invalidate(name)
+	return cfs.FileSystem.Remove(name)
+}
+
+func (cfs *CacheFs) Rename(oldpath, newpath string) error {
+	cfs.Invalidate(oldpath)
+	cfs.Invalidate(newpath)
+	return cfs.FileSystem.Rename(oldpath, newpath)
+}
+
+// Close empties the cache and closes both the backing and cache
+// FileSystems
+func (cfs *CacheFs) Close() error {
+	cfs.InvalidateAll()
+	err := cfs.FileSystem.Close()
+	if err1 := cfs.cache.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// Unwrap returns the backing and cache FileSystems
+func (cfs *CacheFs) Unwrap() []FileSystem {
+	return []FileSystem{cfs.FileSystem, cfs.cache}
+}
+
+// GC evicts cached files, least recently used first.  Files used within
+// policy.MinAge are kept and eviction stops once the cache holds no more than
+// policy.TargetBytes
+func (cfs *CacheFs) GC(ctx context.Context, policy GCPolicy) (report GCReport, err error) {
+	type candidate struct {
+		name     string
+		size     int64
+		lastUsed time.Time
+	}
+
+	cfs.mu.Lock()
+	var (
+		candidates []candidate
+		total      int64
+	)
+	now := cfs.clock.Now()
+	for name, entry := range cfs.entries {
+		select {
+		case <-entry.done:
+		default:
+			// still being copied
+			continue
+		}
+
+		total += entry.size
+		if policy.MinAge == 0 || now.Sub(entry.lastUsed) >= policy.MinAge {
+			candidates = append(candidates, candidate{name, entry.size, entry.lastUsed})
+		}
+	}
+	cfs.mu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+
+	for _, c := range candidates {
+		if policy.TargetBytes > 0 && total <= policy.TargetBytes {
+			break
+		} else if err = ctx.Err(); err != nil {
+			break
+		}
+
+		if !policy.DryRun {
+			if err = cfs.evict(c.name); err != nil {
+				break
+			}
+		}
+		total -= c.size
+		report.Items = append(report.Items, GCItem{Layer: "cache", Path: c.name, Bytes: c.size})
+		report.Bytes += c.size
+	}
+	return report, err
+}
+
+// cacheFile is a file opened for writing on the backing FileSystem
+type cacheFile struct {
+	File
+	fs   *CacheFs
+	name string
+}
+
+// Close closes the file and invalidates any copy cached while it was open
+func (f *cacheFile) Close() (err error) {
+	if closer, ok := f.File.(io.Closer); ok {
+		err = closer.Close()
+	}
+	f.fs.Invalidate(f.name)
+	return err
+}
+
+// Truncate changes the size of the file if the underlying file supports it
+func (f *cacheFile) Truncate(size int64) error {
+	if truncater, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		return truncater.Truncate(size)
+	}
+	return &PathError{Op: "truncate", Path: f.Name(), Cause: ErrNotSupported}
+}
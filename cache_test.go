@@ -0,0 +1,184 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingFs counts the files opened on a FileSystem
+type countingFs struct {
+	FileSystem
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (cfs *countingFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	cfs.mu.Lock()
+	cfs.opens[name]++
+	cfs.mu.Unlock()
+	return cfs.FileSystem.OpenFile(name, flag, perm)
+}
+
+func (cfs *countingFs) Open(name string) (File, error) {
+	return cfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+func (cfs *countingFs) count(name string) int {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	return cfs.opens[name]
+}
+
+func TestCacheFs(t *testing.T) {
+	base := &countingFs{FileSystem: NewMemFs(), opens: make(map[string]int)}
+	base.Mkdir("/dir", 0755)
+	WriteFile(base.FileSystem, "/dir/file", []byte("original"), 0644)
+
+	cache := NewTempFs()
+	fs := NewCacheFs(base, cache)
+	defer fs.Close()
+
+	tests := []struct {
+		name      string
+		change    func() error
+		want      string
+		wantOpens int
+	}{
+		{"first read", func() error { return nil }, "original", 1},
+		{"cached read", func() error { return nil }, "original", 1},
+		{"external change", func() error { return WriteFile(base.FileSystem, "/dir/file", []byte("changed"), 0644) }, "original", 1},
+		{"invalidate", func() error { return fs.Invalidate("/dir") }, "changed", 2},
+		{"write through", func() error { return WriteFile(fs, "/dir/file", []byte("written"), 0644) }, "written", 4},
+		{"invalidate all", fs.InvalidateAll, "written", 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.change(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got, err := ReadFile(fs, "/dir/file"); err != nil || string(got) != test.want {
+				t.Errorf("Wanted %q got %q (%v)", test.want, got, err)
+			}
+
+			if got := base.count("/dir/file"); got != test.wantOpens {
+				t.Errorf("Wanted %d opens of the backing file got %d", test.wantOpens, got)
+			}
+
+			if !fs.Cached("/dir/file") {
+				t.Errorf("Expected file to be cached")
+			}
+		})
+	}
+
+	if err := fs.Remove("/dir/file"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := cache.Stat("/dir/file"); !IsNotExist(err) {
+		t.Errorf("Expected the cached copy to be removed got %v", err)
+	}
+}
+
+func TestCacheFsGC(t *testing.T) {
+	base := NewMemFs()
+	WriteFile(base, "/old", []byte("old"), 0644)
+	WriteFile(base, "/new", []byte("new!"), 0644)
+
+	clock := &testClock{now: time.Unix(0, 0)}
+	fs := NewCacheFs(base, NewTempFs(), WithClock(clock))
+	defer fs.Close()
+
+	ReadFile(fs, "/old")
+	clock.advance(time.Hour)
+	ReadFile(fs, "/new")
+
+	tests := []struct {
+		name   string
+		policy GCPolicy
+		want   []string
+	}{
+		{"dry run", GCPolicy{DryRun: true}, []string{"/old", "/new"}},
+		{"min age", GCPolicy{DryRun: true, MinAge: time.Minute}, []string{"/old"}},
+		{"target", GCPolicy{DryRun: true, TargetBytes: 4}, []string{"/old"}},
+		{"evict", GCPolicy{}, []string{"/old", "/new"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := fs.GC(context.Background(), test.policy)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, item := range report.Items {
+				got = append(got, item.Path)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+
+	if fs.Cached("/old") || fs.Cached("/new") {
+		t.Errorf("Expected the cache to be empty")
+	}
+}
+
+// testClock is a Clock that only moves when told to.  Timers fire when the
+// test calls fire
+type testClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	funcs []func()
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *testClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.funcs = append(c.funcs, f)
+	return &testTimer{clock: c, f: f}
+}
+
+// fire runs every scheduled timer
+func (c *testClock) fire() {
+	c.mu.Lock()
+	funcs := c.funcs
+	c.funcs = nil
+	c.mu.Unlock()
+
+	for _, f := range funcs {
+		f()
+	}
+}
+
+type testTimer struct {
+	clock *testClock
+	f     func()
+}
+
+func (t *testTimer) Stop() bool { return true }
+
+func (t *testTimer) Reset(d time.Duration) bool {
+	t.clock.AfterFunc(d, t.f)
+	return true
+}
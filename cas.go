@@ -0,0 +1,848 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// casRef is the name of the file in the object store recording the digest
+// of the last committed root directory
+const casRef = "/ref"
+
+// casStaged numbers the files being written so that CASFs sharing a store
+// never write to the same staging file
+var casStaged int64
+
+// casNode is a file, directory or symbolic link of a CASFs.  The contents
+// of a file are the object named by hash.  A directory is the Manifest named
+// by hash, its children are only loaded once they are needed and its hash is
+// cleared when it changes, until it is committed again
+type casNode struct {
+	parent   *casNode
+	mode     os.FileMode
+	size     int64
+	hash     string
+	link     string
+	modTime  time.Time
+	children map[string]*casNode
+}
+
+// CASFs is a content-addressable FileSystem.  File contents are kept in an
+// object store, which is any other FileSystem such as an osfs or s3fs, named
+// by the sha256 digest of the contents, so identical files share storage.
+// Directories are stored the same way as Manifests listing their entries,
+// which makes the digest of the root directory identify the whole tree:
+// taking a snapshot is a matter of calling Commit and keeping the digest.
+// Objects stay in the store until GC removes those that neither the last
+// committed tree nor the tree as it is now refer to, so a tree committed
+// earlier stays available to Checkout until the store is collected.
+//
+// Changes to a file become visible when the file is closed.  Modification
+// times are not stored, entries loaded from the store report the zero time
+type CASFs struct {
+	store FileSystem
+
+	// gcMu keeps GC from sweeping while objects are being stored and not
+	// yet referred to by the tree
+	gcMu sync.RWMutex
+
+	mu   sync.Mutex
+	root *casNode
+}
+
+// NewCASFs returns a CASFs keeping its objects in store and starting from
+// the tree last committed to it, or from an empty tree for a new store
+func NewCASFs(store FileSystem) (*CASFs, error) {
+	cfs := &CASFs{store: store}
+
+	// files are created as the empty object
+	if _, err := cfs.put(nil); err != nil {
+		return nil, err
+	}
+
+	ref, err := ReadFile(store, casRef)
+	if IsNotExist(err) {
+		cfs.root = &casNode{mode: os.ModeDir | 0755, children: make(map[string]*casNode)}
+		return cfs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = cfs.Checkout(strings.TrimSpace(string(ref))); err != nil {
+		return nil, err
+	}
+	return cfs, nil
+}
+
+// casEmpty is the digest of an empty file
+var casEmpty = casDigest(sha256.New().Sum(nil))
+
+func casDigest(sum []byte) string {
+	return "sha256:" + hex.EncodeToString(sum)
+}
+
+// objectPath returns the name of the object with the given digest, or an
+// empty string if the digest is malformed
+func objectPath(digest string) string {
+	sum := strings.TrimPrefix(digest, "sha256:")
+	if len(sum) != 2*sha256.Size || len(sum) == len(digest) {
+		return ""
+	} else if _, err := hex.DecodeString(sum); err != nil {
+		return ""
+	}
+	return path.Join("/objects", sum[:2], sum[2:])
+}
+
+// stage creates a new staging file in the store
+func (cfs *CASFs) stage(flag OpenFlag) (File, error) {
+	name := fmt.Sprintf("/staging/%d-%d", os.Getpid(), atomic.AddInt64(&casStaged, 1))
+	if err := MkdirAll(cfs.store, path.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	return cfs.store.OpenFile(name, flag|CreateFlag|ExclFlag, 0644)
+}
+
+// put stores data as an object and returns its digest
+func (cfs *CASFs) put(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	if found, err := Exists(cfs.store, objectPath(casDigest(sum[:]))); found || err != nil {
+		return casDigest(sum[:]), err
+	}
+
+	f, err := cfs.stage(WrOnlyFlag)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(data)
+	if closer, ok := f.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+
+	if err != nil {
+		cfs.store.Remove(f.Name())
+		return "", err
+	}
+
+	digest, _, err := cfs.commitStaged(f.Name())
+	return digest, err
+}
+
+// commitStaged moves a closed staging file to where its contents belong in
+// the store, or removes it when the store already holds the same contents
+func (cfs *CASFs) commitStaged(name string) (digest string, size int64, err error) {
+	sum, err := HashFile(cfs.store, name, sha256.New)
+	if err == nil {
+		var info os.FileInfo
+		if info, err = cfs.store.Stat(name); err == nil {
+			digest, size = casDigest(sum), info.Size()
+		}
+	}
+
+	if err != nil {
+		cfs.store.Remove(name)
+		return "", 0, err
+	}
+
+	object := objectPath(digest)
+	found, err := Exists(cfs.store, object)
+	if err == nil && found {
+		err = cfs.store.Remove(name)
+	} else if err == nil {
+		if err = MkdirAll(cfs.store, path.Dir(object), 0755); err == nil {
+			err = cfs.store.Rename(name, object)
+		}
+	}
+	return digest, size, err
+}
+
+// load reads the entries of a directory from its manifest
+func (cfs *CASFs) load(node *casNode) error {
+	if node.children != nil {
+		return nil
+	}
+
+	data, err := ReadFile(cfs.store, objectPath(node.hash))
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ImportManifest(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	children := make(map[string]*casNode, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		mode, err := entry.FileMode()
+		if err != nil {
+			return err
+		}
+		children[entry.Path] = &casNode{parent: node, mode: mode, size: entry.Size, hash: entry.Hash, link: entry.Link}
+	}
+	node.children = children
+	return nil
+}
+
+// changed marks a directory and every directory above it as needing to be
+// committed
+func (node *casNode) changed() {
+	for dir := node; dir != nil && dir.hash != ""; dir = dir.parent {
+		dir.hash = ""
+	}
+}
+
+// find looks up name following symbolic links in every component and, when
+// follow is set, in the final one.  The directory holding the final
+// component is returned along with its base name and the node found there,
+// which is nil when the final component does not exist.  The root directory
+// has no directory holding it.  The tree must be locked
+func (cfs *CASFs) find(name string, follow bool) (dir *casNode, base string, node *casNode, err error) {
+	current, node := PathSeparator, cfs.root
+	components := splitPath(name)
+	for links := 0; len(components) > 0; {
+		if !node.mode.IsDir() {
+			return nil, "", nil, ErrNotDir
+		} else if err = cfs.load(node); err != nil {
+			return nil, "", nil, err
+		}
+
+		dir, base, components = node, components[0], components[1:]
+		node = dir.children[base]
+		if node == nil {
+			if len(components) > 0 {
+				return nil, "", nil, ErrNotExist
+			}
+			return dir, base, nil, nil
+		}
+
+		if node.mode&os.ModeSymlink != 0 && (len(components) > 0 || follow) {
+			if links++; links > maxLinks {
+				return nil, "", nil, ErrLoop
+			}
+
+			target := node.link
+			if !path.IsAbs(target) {
+				target = path.Join(current, target)
+			}
+			components = append(splitPath(target), components...)
+			current, dir, base, node = PathSeparator, nil, "", cfs.root
+			continue
+		}
+		current = path.Join(current, base)
+	}
+	return dir, base, node, nil
+}
+
+// info describes node, which is named base
+func (node *casNode) info(base string) os.FileInfo {
+	if base == "" {
+		base = PathSeparator
+	}
+	return &httpFileInfo{name: base, size: node.size, mode: node.mode, modTime: node.modTime}
+}
+
+// Commit writes the manifests of every directory changed since the last
+// commit to the store and records the root directory as the current tree.
+// The digest of the root directory is returned and can be passed to
+// Checkout to return to the tree as it is now
+func (cfs *CASFs) Commit() (string, error) {
+	cfs.gcMu.RLock()
+	defer cfs.gcMu.RUnlock()
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	digest, err := cfs.commit(cfs.root)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := cfs.stage(WrOnlyFlag)
+	if err == nil {
+		_, err = io.WriteString(f, digest+"\n")
+		if closer, ok := f.(io.Closer); ok {
+			if err1 := closer.Close(); err == nil {
+				err = err1
+			}
+		}
+
+		if err == nil {
+			err = cfs.store.Rename(f.Name(), casRef)
+		}
+	}
+	return digest, err
+}
+
+// commit stores the manifest of a changed directory after those of its
+// changed subdirectories and returns its digest
+func (cfs *CASFs) commit(node *casNode) (string, error) {
+	if node.hash != "" {
+		return node.hash, nil
+	}
+
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifest := &Manifest{Entries: make([]ManifestEntry, 0, len(names))}
+	for _, name := range names {
+		child := node.children[name]
+		entry := ManifestEntry{Path: name, Mode: child.mode.String(), Link: child.link}
+		switch {
+		case child.mode.IsDir():
+			digest, err := cfs.commit(child)
+			if err != nil {
+				return "", err
+			}
+			entry.Hash = digest
+		case child.mode.IsRegular():
+			entry.Size, entry.Hash = child.size, child.hash
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	var buf bytes.Buffer
+	if _, err := manifest.WriteTo(&buf); err != nil {
+		return "", err
+	}
+
+	digest, err := cfs.put(buf.Bytes())
+	if err == nil {
+		node.hash = digest
+	}
+	return digest, err
+}
+
+// Checkout replaces the tree with the one whose root directory has the
+// given digest, as returned by Commit.  Changes made since the last commit
+// are discarded
+func (cfs *CASFs) Checkout(digest string) error {
+	object := objectPath(digest)
+	if object == "" {
+		return &PathError{Op: "checkout", Path: digest, Cause: ErrNotExist}
+	}
+
+	root := &casNode{mode: os.ModeDir | 0755, hash: digest}
+	if err := cfs.load(root); err != nil {
+		return &PathError{Op: "checkout", Path: digest, Cause: err}
+	}
+
+	cfs.mu.Lock()
+	cfs.root = root
+	cfs.mu.Unlock()
+	return nil
+}
+
+func (cfs *CASFs) Open(filename string) (File, error) {
+	return cfs.OpenFile(filename, RdOnlyFlag, 0)
+}
+
+func (cfs *CASFs) Create(filename string) (File, error) {
+	return cfs.OpenFile(filename, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+// OpenFile opens the named file.  Files opened for writing are copied to a
+// staging file in the store, which replaces the contents of the file when
+// it is closed
+func (cfs *CASFs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if err := flag.check(); err != nil {
+		return nil, &PathError{Op: "open", Path: filename, Cause: err}
+	}
+
+	writable := flag.accessMode() != RdOnlyFlag
+	cfs.mu.Lock()
+	dir, base, node, err := cfs.find(filename, true)
+	if err == nil && node == nil {
+		if flag.has(CreateFlag) {
+			node = &casNode{parent: dir, mode: perm & os.ModePerm, hash: casEmpty, modTime: time.Now()}
+			dir.children[base] = node
+			dir.changed()
+		} else {
+			err = ErrNotExist
+		}
+	} else if err == nil && flag.has(CreateFlag) && flag.has(ExclFlag) {
+		err = ErrExist
+	} else if err == nil && node.mode.IsDir() && (writable || flag.has(CreateFlag) || flag.has(TruncFlag)) {
+		err = ErrIsDir
+	}
+
+	if err == nil && flag.has(TruncFlag) && node.hash != casEmpty {
+		node.hash, node.size, node.modTime = casEmpty, 0, time.Now()
+		node.parent.changed()
+	}
+
+	var infos []os.FileInfo
+	if err == nil && node.mode.IsDir() {
+		if err = cfs.load(node); err == nil {
+			for name, child := range node.children {
+				infos = append(infos, child.info(name))
+			}
+			sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		}
+	}
+
+	var digest string
+	if node != nil {
+		digest = node.hash
+	}
+	cfs.mu.Unlock()
+
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: filename, Cause: err}
+	} else if node.mode.IsDir() {
+		return &cowDir{name: filename, info: node.info(path.Base(filename)), infos: infos}, nil
+	}
+
+	f := &casFile{fs: cfs, name: filename, node: node}
+	if !writable {
+		f.File, err = cfs.store.Open(objectPath(digest))
+	} else {
+		f.staging = true
+		if f.File, err = cfs.stage(flag.accessMode() | flag&AppendFlag); err == nil && digest != casEmpty {
+			err = f.fill(digest)
+		}
+	}
+
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: filename, Cause: fixCause(err)}
+	}
+	return f, nil
+}
+
+func (cfs *CASFs) Mkdir(name string, perm os.FileMode) error {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	dir, base, node, err := cfs.find(name, false)
+	if err == nil && (node != nil || dir == nil) {
+		err = ErrExist
+	}
+
+	if err != nil {
+		return &PathError{Op: "mkdir", Path: name, Cause: err}
+	}
+
+	dir.children[base] = &casNode{
+		parent:   dir,
+		mode:     os.ModeDir | perm&os.ModePerm,
+		modTime:  time.Now(),
+		children: make(map[string]*casNode),
+	}
+	dir.changed()
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname
+func (cfs *CASFs) Symlink(oldname, newname string) error {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	dir, base, node, err := cfs.find(newname, false)
+	if err == nil && (node != nil || dir == nil) {
+		err = ErrExist
+	}
+
+	if err != nil {
+		return &LinkError{Op: "symlink", Old: oldname, New: newname, Cause: err}
+	}
+
+	dir.children[base] = &casNode{parent: dir, mode: os.ModeSymlink | 0777, link: oldname, modTime: time.Now()}
+	dir.changed()
+	return nil
+}
+
+// Readlink returns the target of the named symbolic link
+func (cfs *CASFs) Readlink(name string) (string, error) {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	_, _, node, err := cfs.find(name, false)
+	if err == nil && (node == nil || node.mode&os.ModeSymlink == 0) {
+		err = ErrNotExist
+	}
+
+	if err != nil {
+		return "", &PathError{Op: "readlink", Path: name, Cause: err}
+	}
+	return node.link, nil
+}
+
+func (cfs *CASFs) Chmod(name string, mode os.FileMode) error {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	_, _, node, err := cfs.find(name, true)
+	if err == nil && node == nil {
+		err = ErrNotExist
+	}
+
+	if err != nil {
+		return &PathError{Op: "chmod", Path: name, Cause: err}
+	}
+
+	node.mode = node.mode&^os.ModePerm | mode&os.ModePerm
+	node.parent.changed()
+	return nil
+}
+
+// Remove removes the named file or empty directory from the tree.  Its
+// contents stay in the store
+func (cfs *CASFs) Remove(name string) error {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	dir, base, node, err := cfs.find(name, false)
+	if err == nil && node == nil {
+		err = ErrNotExist
+	} else if err == nil && dir == nil {
+		err = ErrBusy
+	} else if err == nil && node.mode.IsDir() {
+		if err = cfs.load(node); err == nil && len(node.children) > 0 {
+			err = ErrNotEmpty
+		}
+	}
+
+	if err != nil {
+		return &PathError{Op: "remove", Path: name, Cause: err}
+	}
+
+	delete(dir.children, base)
+	node.parent = nil
+	dir.changed()
+	return nil
+}
+
+func (cfs *CASFs) Rename(oldpath, newpath string) error {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	err := cfs.rename(oldpath, newpath)
+	if err != nil {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: err}
+	}
+	return nil
+}
+
+func (cfs *CASFs) rename(oldpath, newpath string) error {
+	odir, obase, node, err := cfs.find(oldpath, false)
+	if err != nil {
+		return err
+	} else if node == nil {
+		return ErrNotExist
+	} else if odir == nil {
+		return ErrBusy
+	}
+
+	ndir, nbase, displaced, err := cfs.find(newpath, false)
+	if err != nil {
+		return err
+	} else if ndir == nil {
+		return ErrBusy
+	} else if displaced == node {
+		return nil
+	}
+
+	for dir := ndir; dir != nil; dir = dir.parent {
+		if dir == node {
+			// a directory cannot be moved inside itself
+			return ErrBusy
+		}
+	}
+
+	if displaced != nil {
+		if displaced.mode.IsDir() {
+			if !node.mode.IsDir() {
+				return ErrIsDir
+			} else if err = cfs.load(displaced); err != nil {
+				return err
+			} else if len(displaced.children) > 0 {
+				return ErrNotEmpty
+			}
+		} else if node.mode.IsDir() {
+			return ErrNotDir
+		}
+		displaced.parent = nil
+	}
+
+	delete(odir.children, obase)
+	odir.changed()
+	ndir.children[nbase] = node
+	node.parent = ndir
+	ndir.changed()
+	return nil
+}
+
+func (cfs *CASFs) Lstat(name string) (os.FileInfo, error) {
+	return cfs.stat("lstat", name, false)
+}
+
+func (cfs *CASFs) Stat(name string) (os.FileInfo, error) {
+	return cfs.stat("stat", name, true)
+}
+
+func (cfs *CASFs) stat(op, name string, follow bool) (os.FileInfo, error) {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	_, base, node, err := cfs.find(name, follow)
+	if err == nil && node == nil {
+		err = ErrNotExist
+	}
+
+	if err != nil {
+		return nil, &PathError{Op: op, Path: name, Cause: err}
+	}
+	return node.info(base), nil
+}
+
+// Close commits the tree and closes the store
+func (cfs *CASFs) Close() error {
+	_, err := cfs.Commit()
+	if err1 := cfs.store.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// mark adds the objects making up the directory with the given digest, its
+// manifest and everything it lists, to reachable
+func (cfs *CASFs) mark(digest string, reachable map[string]bool) error {
+	if reachable[digest] {
+		return nil
+	}
+	reachable[digest] = true
+
+	data, err := ReadFile(cfs.store, objectPath(digest))
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ImportManifest(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range manifest.Entries {
+		if mode, err := entry.FileMode(); err != nil {
+			return err
+		} else if mode.IsDir() {
+			err = cfs.mark(entry.Hash, reachable)
+		} else if entry.Hash != "" {
+			reachable[entry.Hash] = true
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markNode adds the objects the tree beneath node refers to, including
+// those not committed yet, to reachable.  The tree must be locked
+func (cfs *CASFs) markNode(node *casNode, reachable map[string]bool) error {
+	if !node.mode.IsDir() {
+		if node.hash != "" {
+			reachable[node.hash] = true
+		}
+		return nil
+	} else if node.children == nil {
+		return cfs.mark(node.hash, reachable)
+	} else if node.hash != "" {
+		reachable[node.hash] = true
+	}
+
+	for _, child := range node.children {
+		if err := cfs.markNode(child, reachable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GC removes the objects that neither the tree last committed to the store
+// nor the tree as it is now refer to, oldest first.  Trees committed before
+// the last one can no longer be checked out once their objects are gone.
+// Objects modified within policy.MinAge are kept, which also protects the
+// trees of other CASFs sharing the store while they are being written
+func (cfs *CASFs) GC(ctx context.Context, policy GCPolicy) (report GCReport, err error) {
+	cfs.gcMu.Lock()
+	defer cfs.gcMu.Unlock()
+
+	reachable := map[string]bool{casEmpty: true}
+	ref, err := ReadFile(cfs.store, casRef)
+	if err == nil {
+		err = cfs.mark(strings.TrimSpace(string(ref)), reachable)
+	} else if IsNotExist(err) {
+		err = nil
+	}
+
+	if err == nil {
+		cfs.mu.Lock()
+		err = cfs.markNode(cfs.root, reachable)
+		cfs.mu.Unlock()
+	}
+
+	if err != nil {
+		return report, err
+	}
+
+	type candidate struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+
+	var (
+		candidates []candidate
+		total      int64
+	)
+	now := time.Now()
+	err = Walk(cfs.store, "/objects", func(name string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		total += info.Size()
+		digest := "sha256:" + path.Base(path.Dir(name)) + path.Base(name)
+		if !reachable[digest] && (policy.MinAge == 0 || now.Sub(info.ModTime()) >= policy.MinAge) {
+			candidates = append(candidates, candidate{name, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return report, err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].modTime.Before(candidates[j].modTime)
+	})
+
+	for _, c := range candidates {
+		if policy.TargetBytes > 0 && total <= policy.TargetBytes {
+			break
+		} else if err = ctx.Err(); err != nil {
+			break
+		}
+
+		if !policy.DryRun {
+			if err = cfs.store.Remove(c.name); err != nil {
+				break
+			}
+		}
+		total -= c.size
+		report.Items = append(report.Items, GCItem{Layer: "cas", Path: c.name, Bytes: c.size})
+		report.Bytes += c.size
+	}
+	return report, err
+}
+
+// Unwrap returns the object store
+func (cfs *CASFs) Unwrap() []FileSystem {
+	return []FileSystem{cfs.store}
+}
+
+// Watcher is not supported by CASFs
+func (cfs *CASFs) Watcher(chan<- Event) (Watcher, error) {
+	return nil, ErrNotSupported
+}
+
+// casFile is an open file of a CASFs.  Files opened for reading read the
+// object directly, files opened for writing are written to a staging file
+type casFile struct {
+	File
+	fs      *CASFs
+	name    string
+	node    *casNode
+	staging bool
+	closed  bool
+}
+
+func (f *casFile) Name() string { return f.name }
+
+// fill copies the current contents of the file into the staging file
+func (f *casFile) fill(digest string) error {
+	err := copyTo(f.File, f.fs.store, objectPath(digest))
+	if err == nil {
+		_, err = f.File.Seek(0, io.SeekStart)
+	}
+	return err
+}
+
+func (f *casFile) Write(p []byte) (int, error) {
+	if !f.staging {
+		return 0, &PathError{Op: "write", Path: f.name, Cause: ErrReadOnly}
+	}
+	return f.File.Write(p)
+}
+
+func (f *casFile) WriteAt(p []byte, off int64) (int, error) {
+	if !f.staging {
+		return 0, &PathError{Op: "write", Path: f.name, Cause: ErrReadOnly}
+	}
+	return f.File.WriteAt(p, off)
+}
+
+// Stat describes the file, including the size of what has been written so
+// far
+func (f *casFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	info := f.node.info(path.Base(f.name)).(*httpFileInfo)
+	f.fs.mu.Unlock()
+	if f.staging {
+		staged, err := f.File.Stat()
+		if err != nil {
+			return nil, err
+		}
+		info.size = staged.Size()
+	}
+	return info, nil
+}
+
+// Truncate changes the size of a file open for writing
+func (f *casFile) Truncate(size int64) error {
+	truncater, ok := f.File.(interface{ Truncate(int64) error })
+	if !f.staging {
+		return &PathError{Op: "truncate", Path: f.name, Cause: ErrReadOnly}
+	} else if !ok {
+		return &PathError{Op: "truncate", Path: f.name, Cause: ErrNotSupported}
+	}
+	return truncater.Truncate(size)
+}
+
+// Close closes the file and, when it was open for writing, stores what was
+// written as the new contents of the file
+func (f *casFile) Close() error {
+	var err error
+	if closer, ok := f.File.(io.Closer); ok {
+		err = closer.Close()
+	}
+
+	if err != nil || !f.staging || f.closed {
+		return err
+	}
+	f.closed = true
+
+	f.fs.gcMu.RLock()
+	defer f.fs.gcMu.RUnlock()
+	digest, size, err := f.fs.commitStaged(f.File.Name())
+	if err != nil {
+		return &PathError{Op: "close", Path: f.name, Cause: fixCause(err)}
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if digest != f.node.hash || size != f.node.size {
+		f.node.hash, f.node.size, f.node.modTime = digest, size, time.Now()
+		f.node.parent.changed()
+	}
+	return nil
+}
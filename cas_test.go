@@ -0,0 +1,210 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// countObjects returns the number of objects in a CASFs store
+func countObjects(t *testing.T, store FileSystem) (n int) {
+	err := Walk(store, "/objects", func(name string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			n++
+		}
+		return err
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return n
+}
+
+func TestCASFs(t *testing.T) {
+	store := NewMemFs()
+	fs, err := NewCASFs(store)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	before := countObjects(t, store)
+	fs.Mkdir("/dir", 0755)
+	for _, name := range []string{"/a", "/dir/b", "/dir/c"} {
+		if err = WriteFile(fs, name, []byte("same contents"), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if got := countObjects(t, store) - before; got != 1 {
+		t.Errorf("Wanted identical files to share 1 object got %d", got)
+	}
+
+	snapshot, err := fs.Commit()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if again, _ := fs.Commit(); again != snapshot {
+		t.Errorf("Wanted an unchanged tree to keep digest %s got %s", snapshot, again)
+	}
+
+	WriteFile(fs, "/dir/b", []byte("changed"), 0644)
+	fs.Remove("/a")
+	fs.Rename("/dir/c", "/d")
+	fs.Symlink("dir/b", "/link")
+	if got, _ := ReadFile(fs, "/link"); string(got) != "changed" {
+		t.Errorf("Wanted %q got %q", "changed", got)
+	}
+
+	// a second CASFs on the same store starts from the last commit
+	changed, err := fs.Commit()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reopened, err := NewCASFs(store)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"d", "dir", "link"}
+	if got := readDirNames(t, reopened, "/"); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	if target, _ := reopened.Readlink("/link"); target != "dir/b" {
+		t.Errorf("Wanted link to %q got %q", "dir/b", target)
+	}
+
+	// checking out the snapshot restores the tree as it was
+	if err = reopened.Checkout(snapshot); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name, want := range map[string]string{"/a": "same contents", "/dir/b": "same contents", "/dir/c": "same contents"} {
+		if got, err := ReadFile(reopened, name); err != nil || string(got) != want {
+			t.Errorf("Wanted %s to contain %q got %q: %v", name, want, got, err)
+		}
+	}
+
+	if _, err = reopened.Stat("/d"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+
+	if err = reopened.Checkout(changed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(reopened, "/d"); string(got) != "same contents" {
+		t.Errorf("Wanted %q got %q", "same contents", got)
+	}
+
+	if err = reopened.Checkout("sha256:missing"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
+
+func TestCASFsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func(fs *CASFs) error
+		wantErr error
+	}{
+		{"mkdir existing", func(fs *CASFs) error { return fs.Mkdir("/dir", 0755) }, ErrExist},
+		{"mkdir root", func(fs *CASFs) error { return fs.Mkdir("/", 0755) }, ErrExist},
+		{"remove missing", func(fs *CASFs) error { return fs.Remove("/missing") }, ErrNotExist},
+		{"remove non-empty", func(fs *CASFs) error { return fs.Remove("/dir") }, ErrNotEmpty},
+		{"remove root", func(fs *CASFs) error { return fs.Remove("/") }, ErrBusy},
+		{"rename into itself", func(fs *CASFs) error { return fs.Rename("/dir", "/dir/sub") }, ErrBusy},
+		{"rename over directory", func(fs *CASFs) error { return fs.Rename("/dir/file", "/empty") }, ErrIsDir},
+		{"open missing", func(fs *CASFs) error { _, err := fs.Open("/missing"); return err }, ErrNotExist},
+		{"file as directory", func(fs *CASFs) error { _, err := fs.Open("/dir/file/x"); return err }, ErrNotDir},
+		{"write read only", func(fs *CASFs) error {
+			f, _ := fs.Open("/dir/file")
+			defer closeFile(f)
+			_, err := f.Write([]byte("x"))
+			return err
+		}, ErrReadOnly},
+		{"link loop", func(fs *CASFs) error {
+			fs.Symlink("/loop", "/loop")
+			_, err := fs.Stat("/loop")
+			return err
+		}, ErrLoop},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs, err := NewCASFs(NewMemFs())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			fs.Mkdir("/dir", 0755)
+			fs.Mkdir("/empty", 0755)
+			WriteFile(fs, "/dir/file", []byte("file"), 0644)
+
+			if err = test.op(fs); !IsError(test.wantErr, err) {
+				t.Errorf("Wanted %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCASFsGC(t *testing.T) {
+	store := NewMemFs()
+	fs, _ := NewCASFs(store)
+	WriteFile(fs, "/a", []byte("one"), 0644)
+	first, _ := fs.Commit()
+	WriteFile(fs, "/a", []byte("two"), 0644)
+	fs.Commit()
+	WriteFile(fs, "/b", []byte("uncommitted"), 0644)
+	before := countObjects(t, store)
+
+	// casItems returns the objects in a report
+	casItems := func(report GCReport) (items []GCItem) {
+		for _, item := range report.Items {
+			if item.Layer == "cas" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+
+	report, err := GC(context.Background(), fs, GCPolicy{MinAge: time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if items := casItems(report); len(items) != 0 {
+		t.Errorf("Wanted new objects to be kept got %v", items)
+	}
+
+	// the first version of /a and the first root directory are only
+	// reachable from the first commit
+	report, err = GC(context.Background(), fs, GCPolicy{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if items := casItems(report); len(items) != 2 {
+		t.Errorf("Wanted 2 objects reported got %v", items)
+	}
+
+	if got := countObjects(t, store); got != before {
+		t.Errorf("Wanted a dry run to keep %d objects got %d", before, got)
+	}
+
+	if _, err = GC(context.Background(), fs, GCPolicy{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := countObjects(t, store); got != before-2 {
+		t.Errorf("Wanted %d objects got %d", before-2, got)
+	}
+
+	for name, want := range map[string]string{"/a": "two", "/b": "uncommitted"} {
+		if got, err := ReadFile(fs, name); err != nil || string(got) != want {
+			t.Errorf("Wanted %q got %q (err %v)", want, got, err)
+		}
+	}
+
+	if err = fs.Checkout(first); !IsNotExist(err) {
+		t.Errorf("Wanted the collected tree to be gone got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package vfs
+
+import "time"
+
+// Clock is the source of time for code that waits on timers, such as
+// debouncing watcher events.  Accepting a Clock instead of calling the time
+// package directly allows tests to drive that code deterministically
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine once d has elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event scheduled with a Clock
+type Timer interface {
+	// Stop prevents the Timer from firing and reports whether it was
+	// still pending
+	Stop() bool
+
+	// Reset changes the timer to fire after d and reports whether it
+	// was still pending
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is the Clock backed by the time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,332 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Dialer establishes a new connection to a (typically remote) FileSystem
+type Dialer func() (FileSystem, error)
+
+// isDisconnect reports whether err indicates the connection to a
+// backend was lost
+func isDisconnect(err error) bool {
+	err = errorCause(err)
+
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
+
+// connfs manages the connection lifecycle of a FileSystem created by a Dialer
+type connfs struct {
+	mu       sync.Mutex
+	dial     Dialer
+	conn     FileSystem
+	refs     int
+	lastUsed time.Time
+	closed   bool
+
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	keepalive   time.Duration
+	pingTimer   *time.Timer
+	backoff     Backoff
+}
+
+// NewConnFs returns a FileSystem that manages connections made by dial.  The
+// connection is not made until the FileSystem is first used.  If an operation
+// fails because the connection was lost the connection is closed, re-dialed and
+// the operation retried according to the WithReconnect backoff (DefaultBackoff
+// if not given).  Once the retries are exhausted the operation fails with
+// ErrDisconnected.  Exclusive creates and renames are never retried since the
+// first attempt may have succeeded.  Mkdir and Remove are retried, a retry
+// finding that the directory already exists, or that the file is already
+// gone, is taken to mean the lost attempt succeeded.
+//
+// WithIdleTimeout closes the connection after it has been unused for the given
+// duration, it is transparently re-dialed on next use.  Connections are never
+// closed for being idle while Files or Watchers obtained from them are open.
+// WithKeepalive periodically checks the connection so that a lost connection is
+// noticed, and dropped, before the next operation
+func NewConnFs(dial Dialer, opts ...Option) FileSystem {
+	fs := &connfs{dial: dial, backoff: DefaultBackoff}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
+}
+
+// acquire returns the current connection, dialing if needed, and takes a
+// reference on it
+func (c *connfs) acquire() (FileSystem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	if c.conn == nil {
+		conn, err := c.dial()
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+		c.schedulePing()
+	}
+	c.refs++
+	return c.conn, nil
+}
+
+// release drops a reference taken by acquire.  If err shows the connection
+// was lost, the connection is closed so the next acquire re-dials
+func (c *connfs) release(conn FileSystem, err error, used bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs--
+	if isDisconnect(err) && c.conn == conn {
+		c.drop()
+	}
+
+	if used {
+		c.lastUsed = time.Now()
+	}
+	c.scheduleIdle()
+}
+
+// drop closes the current connection, the lock must be held
+func (c *connfs) drop() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *connfs) scheduleIdle() {
+	if c.idleTimeout <= 0 || c.conn == nil || c.refs > 0 {
+		return
+	}
+
+	if c.idleTimer == nil {
+		c.idleTimer = time.AfterFunc(c.idleTimeout, c.idle)
+	} else {
+		c.idleTimer.Reset(c.idleTimeout)
+	}
+}
+
+func (c *connfs) idle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refs == 0 && time.Since(c.lastUsed) >= c.idleTimeout {
+		c.drop()
+	} else {
+		c.scheduleIdle()
+	}
+}
+
+func (c *connfs) schedulePing() {
+	if c.keepalive <= 0 {
+		return
+	}
+
+	if c.pingTimer == nil {
+		c.pingTimer = time.AfterFunc(c.keepalive, c.ping)
+	} else {
+		c.pingTimer.Reset(c.keepalive)
+	}
+}
+
+// ping checks that the connection is still alive without counting as use
+func (c *connfs) ping() {
+	c.mu.Lock()
+	conn := c.conn
+	if conn == nil || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.refs++
+	c.mu.Unlock()
+
+	_, err := conn.Stat(PathSeparator)
+	c.release(conn, err, false)
+
+	c.mu.Lock()
+	if c.conn != nil && !c.closed {
+		c.schedulePing()
+	}
+	c.mu.Unlock()
+}
+
+// do runs fn against a connection, reconnecting and retrying as needed
+func (c *connfs) do(op, name string, idempotent bool, fn func(FileSystem) error) error {
+	for retry := 0; ; retry++ {
+		conn, err := c.acquire()
+		if err == ErrClosed {
+			return &PathError{Op: op, Path: name, Cause: err}
+		}
+
+		if err == nil {
+			err = fn(conn)
+			c.release(conn, err, true)
+			if !isDisconnect(err) {
+				return err
+			}
+
+			if !idempotent {
+				break
+			}
+		}
+
+		if retry >= c.backoff.Retries {
+			break
+		}
+		time.Sleep(c.backoff.Delay(retry))
+	}
+	return &PathError{Op: op, Path: name, Cause: ErrDisconnected}
+}
+
+// connFile holds a reference on the connection until it is closed
+type connFile struct {
+	File
+	c    *connfs
+	conn FileSystem
+	once sync.Once
+}
+
+func (f *connFile) Close() (err error) {
+	if closer, ok := f.File.(io.Closer); ok {
+		err = closer.Close()
+	}
+	f.once.Do(func() { f.c.release(f.conn, err, true) })
+	return err
+}
+
+// open opens a file and keeps the connection referenced while it is open
+func (c *connfs) open(op, filename string, idempotent bool, open func(FileSystem) (File, error)) (file File, err error) {
+	err = c.do(op, filename, idempotent, func(conn FileSystem) error {
+		f, err := open(conn)
+		if err == nil {
+			c.mu.Lock()
+			c.refs++
+			c.mu.Unlock()
+			file = &connFile{File: f, c: c, conn: conn}
+		}
+		return err
+	})
+	return file, err
+}
+
+func (c *connfs) Chmod(filename string, mode os.FileMode) error {
+	return c.do("chmod", filename, true, func(conn FileSystem) error { return conn.Chmod(filename, mode) })
+}
+
+func (c *connfs) Create(filename string) (File, error) {
+	return c.open("create", filename, true, func(conn FileSystem) (File, error) { return conn.Create(filename) })
+}
+
+func (c *connfs) Open(filename string) (File, error) {
+	return c.open("open", filename, true, func(conn FileSystem) (File, error) { return conn.Open(filename) })
+}
+
+func (c *connfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	idempotent := !(flag.has(CreateFlag) && flag.has(ExclFlag))
+	return c.open("open", filename, idempotent, func(conn FileSystem) (File, error) { return conn.OpenFile(filename, flag, perm) })
+}
+
+// Mkdir creates the directory, a retry finding it already exists succeeds
+// since the attempt that lost the connection may have created it
+func (c *connfs) Mkdir(name string, perm os.FileMode) error {
+	retry := false
+	return c.do("mkdir", name, true, func(conn FileSystem) error {
+		err := conn.Mkdir(name, perm)
+		if retry && IsExist(err) {
+			return nil
+		}
+		retry = true
+		return err
+	})
+}
+
+// Remove removes the file, a retry finding it is already gone succeeds since
+// the attempt that lost the connection may have removed it
+func (c *connfs) Remove(name string) error {
+	retry := false
+	return c.do("remove", name, true, func(conn FileSystem) error {
+		err := conn.Remove(name)
+		if retry && IsNotExist(err) {
+			return nil
+		}
+		retry = true
+		return err
+	})
+}
+
+func (c *connfs) Rename(oldpath, newpath string) error {
+	return c.do("rename", oldpath, false, func(conn FileSystem) error { return conn.Rename(oldpath, newpath) })
+}
+
+func (c *connfs) Lstat(filename string) (fi os.FileInfo, err error) {
+	err = c.do("lstat", filename, true, func(conn FileSystem) (err error) { fi, err = conn.Lstat(filename); return err })
+	return fi, err
+}
+
+func (c *connfs) Stat(filename string) (fi os.FileInfo, err error) {
+	err = c.do("stat", filename, true, func(conn FileSystem) (err error) { fi, err = conn.Stat(filename); return err })
+	return fi, err
+}
+
+// Close closes the current connection, if any.  The FileSystem
+// cannot be used after it is closed
+func (c *connfs) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+
+	if c.pingTimer != nil {
+		c.pingTimer.Stop()
+	}
+
+	var err error
+	if c.conn != nil {
+		err = c.conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+// connWatcher holds a reference on the connection until it is closed
+type connWatcher struct {
+	Watcher
+	c    *connfs
+	conn FileSystem
+	once sync.Once
+}
+
+func (w *connWatcher) Close() error {
+	err := w.Watcher.Close()
+	w.once.Do(func() { w.c.release(w.conn, err, true) })
+	return err
+}
+
+func (c *connfs) Watcher(events chan<- Event) (watcher Watcher, err error) {
+	err = c.do("watch", "", true, func(conn FileSystem) error {
+		w, err := conn.Watcher(events)
+		if err == nil {
+			c.mu.Lock()
+			c.refs++
+			c.mu.Unlock()
+			watcher = &connWatcher{Watcher: w, c: c, conn: conn}
+		}
+		return err
+	})
+	return watcher, err
+}
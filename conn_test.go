@@ -0,0 +1,266 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyFs fails Stat with a disconnect error while fail is positive
+type flakyFs struct {
+	FileSystem
+	mu     sync.Mutex
+	fail   int
+	closed bool
+}
+
+func (ff *flakyFs) Stat(filename string) (os.FileInfo, error) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if ff.fail > 0 {
+		ff.fail--
+		return nil, io.ErrUnexpectedEOF
+	}
+	return ff.FileSystem.Stat(filename)
+}
+
+func (ff *flakyFs) isClosed() bool {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	return ff.closed
+}
+
+func (ff *flakyFs) Close() error {
+	ff.mu.Lock()
+	ff.closed = true
+	ff.mu.Unlock()
+	return ff.FileSystem.Close()
+}
+
+// testDialer hands out flakyFs connections, the first fail of which
+// lose their connection on the first Stat
+type testDialer struct {
+	mu    sync.Mutex
+	dials int
+	fail  int
+	conns []*flakyFs
+}
+
+func (td *testDialer) dial() (FileSystem, error) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.dials++
+	ff := &flakyFs{FileSystem: NewMemFs()}
+	if td.fail > 0 {
+		ff.fail = 1
+		td.fail--
+	}
+	td.conns = append(td.conns, ff)
+	return ff, nil
+}
+
+func (td *testDialer) count() int {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	return td.dials
+}
+
+func (td *testDialer) last() *flakyFs {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	return td.conns[len(td.conns)-1]
+}
+
+func TestConnFsReconnect(t *testing.T) {
+	noDelay := Backoff{Retries: 2}
+	tests := []struct {
+		name      string
+		fail      int
+		wantDials int
+		wantErr   error
+	}{
+		{"no failures", 0, 1, nil},
+		{"reconnects", 1, 2, nil},
+		{"retries exhausted", 5, 3, ErrDisconnected},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			td := &testDialer{fail: test.fail}
+			fs := NewConnFs(td.dial, WithReconnect(noDelay))
+			defer fs.Close()
+			if td.count() != 0 {
+				t.Fatalf("Expected no dial before first use")
+			}
+
+			_, err := fs.Stat("/")
+			if pe, ok := err.(*PathError); ok {
+				err = pe.Cause
+			}
+
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if td.count() != test.wantDials {
+				t.Errorf("Wanted %d dials got %d", test.wantDials, td.count())
+			}
+		})
+	}
+}
+
+func TestConnFsExclusiveCreate(t *testing.T) {
+	td := &testDialer{}
+	fs := NewConnFs(td.dial, WithReconnect(Backoff{Retries: 2}))
+	defer fs.Close()
+
+	f, err := fs.OpenFile("/file", CreateFlag|ExclFlag|WrOnlyFlag, 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.(io.Closer).Close()
+
+	if _, err := fs.OpenFile("/file", CreateFlag|ExclFlag|WrOnlyFlag, 0644); !IsExist(err) {
+		t.Errorf("Wanted ErrExist got %v", err)
+	}
+}
+
+// lossyFs is a connection to a shared FileSystem that loses the connection
+// right after applying the first drop changes made through it
+type lossyFs struct {
+	FileSystem
+	drop *int
+}
+
+func (lf *lossyFs) lose(err error) error {
+	if err == nil && *lf.drop > 0 {
+		*lf.drop--
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (lf *lossyFs) Mkdir(name string, perm os.FileMode) error {
+	return lf.lose(lf.FileSystem.Mkdir(name, perm))
+}
+
+func (lf *lossyFs) Remove(name string) error {
+	return lf.lose(lf.FileSystem.Remove(name))
+}
+
+func (lf *lossyFs) Rename(oldpath, newpath string) error {
+	return lf.lose(lf.FileSystem.Rename(oldpath, newpath))
+}
+
+// Close leaves the shared FileSystem open for the next connection
+func (lf *lossyFs) Close() error { return nil }
+
+func TestConnFsLostAfterApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		op        func(FileSystem) error
+		wantErr   error
+		wantDials int
+		exists    string
+		missing   string
+	}{
+		{"mkdir", func(fs FileSystem) error { return fs.Mkdir("/dir", 0755) }, nil, 2, "/dir", ""},
+		{"remove", func(fs FileSystem) error { return fs.Remove("/file") }, nil, 2, "", "/file"},
+		{"rename", func(fs FileSystem) error { return fs.Rename("/file", "/renamed") }, ErrDisconnected, 1, "/renamed", "/file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shared := NewMemFs()
+			WriteFile(shared, "/file", nil, 0644)
+			drop, dials := 1, 0
+			fs := NewConnFs(func() (FileSystem, error) {
+				dials++
+				return &lossyFs{FileSystem: shared, drop: &drop}, nil
+			}, WithReconnect(Backoff{Retries: 2}))
+			defer fs.Close()
+
+			err := test.op(fs)
+			if pe, ok := err.(*PathError); ok {
+				err = pe.Cause
+			}
+
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if dials != test.wantDials {
+				t.Errorf("Wanted %d dials got %d", test.wantDials, dials)
+			}
+
+			if _, err := shared.Stat(test.exists); test.exists != "" && err != nil {
+				t.Errorf("Wanted %s to exist got %v", test.exists, err)
+			}
+
+			if _, err := shared.Stat(test.missing); test.missing != "" && !IsNotExist(err) {
+				t.Errorf("Wanted %s to be gone got %v", test.missing, err)
+			}
+		})
+	}
+}
+
+func TestConnFsIdleTimeout(t *testing.T) {
+	td := &testDialer{}
+	fs := NewConnFs(td.dial, WithIdleTimeout(20*time.Millisecond))
+	defer fs.Close()
+
+	f, err := fs.Create("/file")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if td.last().isClosed() {
+		t.Errorf("Connection closed while a file was open")
+	}
+
+	f.(io.Closer).Close()
+	time.Sleep(60 * time.Millisecond)
+	if !td.last().isClosed() {
+		t.Errorf("Expected idle connection to be closed")
+	}
+
+	if _, err := fs.Stat("/"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if td.count() != 2 {
+		t.Errorf("Wanted 2 dials got %d", td.count())
+	}
+}
+
+func TestConnFsKeepalive(t *testing.T) {
+	td := &testDialer{}
+	fs := NewConnFs(td.dial, WithKeepalive(10*time.Millisecond))
+	defer fs.Close()
+
+	if _, err := fs.Stat("/"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn := td.last()
+	conn.mu.Lock()
+	conn.fail = 1
+	conn.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	if !conn.isClosed() {
+		t.Errorf("Expected keepalive to drop the lost connection")
+	}
+}
+
+func TestConnFsClosed(t *testing.T) {
+	td := &testDialer{}
+	fs := NewConnFs(td.dial)
+	fs.Close()
+	if _, err := fs.Stat("/"); err == nil || err.(*PathError).Cause != ErrClosed {
+		t.Errorf("Wanted ErrClosed got %v", err)
+	}
+}
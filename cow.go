@@ -0,0 +1,495 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+// cowLayer is one layer of a CowFs.  Only the top layer of a branch is
+// modified, the layers beneath it are frozen and may be shared by several
+// branches
+type cowLayer struct {
+	fs FileSystem
+
+	// whiteouts are paths removed in this layer that still exist in
+	// the layers beneath it
+	whiteouts map[string]bool
+
+	// opaque paths were replaced in this layer, nothing beneath them
+	// in lower layers is visible
+	opaque map[string]bool
+
+	dirty bool
+}
+
+func newCowLayer() *cowLayer {
+	return &cowLayer{fs: NewMemFs(), whiteouts: make(map[string]bool), opaque: make(map[string]bool)}
+}
+
+// hides reports whether name is hidden from the layers beneath this one
+func (layer *cowLayer) hides(name string) bool {
+	if layer.whiteouts[name] {
+		return true
+	}
+
+	for dir := name; dir != PathSeparator; {
+		dir = path.Dir(dir)
+		if layer.whiteouts[dir] || layer.opaque[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// CowFs is a copy-on-write FileSystem layered over a base FileSystem that is
+// never modified.  Files are copied into an in-memory layer the first time
+// they are opened for writing and removals are recorded as whiteouts, so
+// branches produced by Fork share every file that neither of them changed
+type CowFs struct {
+	mu sync.RWMutex
+
+	// layers are ordered from the top, the only writable layer, down to
+	// the base
+	layers []*cowLayer
+}
+
+// NewCowFs returns a copy-on-write FileSystem over base.  The base is only
+// ever read, so a single fixture tree can back any number of CowFs branches
+func NewCowFs(base FileSystem) *CowFs {
+	return &CowFs{layers: []*cowLayer{newCowLayer(), {fs: base}}}
+}
+
+// Fork returns an independent writable branch of the FileSystem.  The
+// current contents are frozen and shared by both branches, changes made to
+// either branch afterwards are not visible in the other.  Files opened for
+// writing before the fork keep writing to the shared contents and should be
+// closed first
+func (cfs *CowFs) Fork() *CowFs {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+
+	frozen := cfs.layers
+	if !frozen[0].dirty {
+		frozen = frozen[1:]
+	} else {
+		cfs.layers = append([]*cowLayer{newCowLayer()}, frozen...)
+	}
+	return &CowFs{layers: append([]*cowLayer{newCowLayer()}, frozen...)}
+}
+
+func (cfs *CowFs) top() *cowLayer { return cfs.layers[0] }
+
+// Unwrap returns the base FileSystem
+func (cfs *CowFs) Unwrap() []FileSystem {
+	return []FileSystem{cfs.layers[len(cfs.layers)-1].fs}
+}
+
+// find returns the layer holding name along with its FileInfo
+func (cfs *CowFs) find(op, name string) (*cowLayer, os.FileInfo, error) {
+	for _, layer := range cfs.layers {
+		info, err := layer.fs.Lstat(name)
+		if err == nil {
+			return layer, info, nil
+		} else if !IsNotExist(err) {
+			return nil, nil, &PathError{Op: op, Path: name, Cause: unwrapCause(err)}
+		} else if layer.hides(name) {
+			break
+		}
+	}
+	return nil, nil, &PathError{Op: op, Path: name, Cause: ErrNotExist}
+}
+
+// unwrapCause returns the cause of a PathError so that it can be reported
+// with the path given to the CowFs
+func unwrapCause(err error) error {
+	if pe, ok := fixErr(err).(*PathError); ok {
+		return pe.Cause
+	}
+	return err
+}
+
+// readDir returns the merged, sorted, contents of a directory
+func (cfs *CowFs) readDir(dirname string) ([]os.FileInfo, error) {
+	names := make(map[string]bool)
+	for _, layer := range cfs.layers {
+		if infos, err := readDir(layer.fs, dirname); err == nil {
+			for _, info := range infos {
+				names[info.Name()] = true
+			}
+		}
+
+		if layer.opaque[dirname] || layer.hides(dirname) {
+			break
+		}
+	}
+
+	infos := make([]os.FileInfo, 0, len(names))
+	for name := range names {
+		if _, info, err := cfs.find("readdir", path.Join(dirname, name)); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// copyUpDirs creates dirname and any missing parents in the top layer with
+// the modes they have in the merged view
+func (cfs *CowFs) copyUpDirs(dirname string) error {
+	if _, err := cfs.top().fs.Lstat(dirname); err == nil {
+		return nil
+	}
+
+	if err := cfs.copyUpDirs(path.Dir(dirname)); err != nil {
+		return err
+	}
+
+	_, info, err := cfs.find("mkdir", dirname)
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return &PathError{Op: "mkdir", Path: dirname, Cause: ErrNotDir}
+	}
+	cfs.top().dirty = true
+	return cfs.top().fs.Mkdir(dirname, info.Mode().Perm())
+}
+
+// copyUp copies a file, or an entire directory tree, from a lower layer
+// into the top layer.  The contents of regular files are only copied when
+// data is set
+func (cfs *CowFs) copyUp(name string, data bool) error {
+	layer, info, err := cfs.find("open", name)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err = cfs.copyUpDirs(name); err != nil {
+			return err
+		}
+
+		infos, _ := cfs.readDir(name)
+		for _, child := range infos {
+			if err = cfs.copyUp(path.Join(name, child.Name()), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if layer == cfs.top() {
+		return nil
+	}
+
+	if err = cfs.copyUpDirs(path.Dir(name)); err != nil {
+		return err
+	}
+
+	cfs.top().dirty = true
+	dst, err := cfs.top().fs.OpenFile(name, WrOnlyFlag|CreateFlag|TruncFlag, info.Mode().Perm())
+	if err == nil && data {
+		err = copyTo(dst, layer.fs, name)
+	}
+
+	if closer, ok := dst.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// created records that name was created in the top layer, hiding anything
+// that was removed from beneath it
+func (cfs *CowFs) created(name string) {
+	top := cfs.top()
+	top.dirty = true
+	if top.whiteouts[name] {
+		delete(top.whiteouts, name)
+		top.opaque[name] = true
+	}
+}
+
+// removed records that name was removed from the top layer, adding a
+// whiteout if it is still visible in a lower layer
+func (cfs *CowFs) removed(name string) {
+	top := cfs.top()
+	top.dirty = true
+	delete(top.opaque, name)
+	if _, _, err := cfs.find("remove", name); err == nil {
+		top.whiteouts[name] = true
+	}
+}
+
+// Chmod copies the named file into the top layer and changes its mode
+func (cfs *CowFs) Chmod(name string, mode os.FileMode) error {
+	name = Clean(name)
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+
+	_, info, err := cfs.find("chmod", name)
+	if err == nil {
+		if info.IsDir() {
+			err = cfs.copyUpDirs(name)
+		} else {
+			err = cfs.copyUp(name, true)
+		}
+	}
+
+	if err == nil {
+		err = cfs.top().fs.Chmod(name, mode)
+	}
+	return err
+}
+
+// Create creates the named file with mode 0666 (before umask), truncating
+// it if it already exists
+func (cfs *CowFs) Create(name string) (File, error) {
+	return cfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+// Open opens the named file for reading
+func (cfs *CowFs) Open(name string) (File, error) {
+	return cfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+// OpenFile opens the named file.  Files opened for reading are served from
+// whichever layer holds them while files opened for writing are first copied
+// into the top layer
+func (cfs *CowFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	name = Clean(name)
+	if err := flag.check(); err != nil {
+		return nil, &PathError{Op: "open", Path: name, Cause: err}
+	}
+
+	if flag.accessMode() == RdOnlyFlag && !flag.has(CreateFlag) && !flag.has(TruncFlag) {
+		cfs.mu.RLock()
+		defer cfs.mu.RUnlock()
+		layer, info, err := cfs.find("open", name)
+		if err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			infos, _ := cfs.readDir(name)
+			return &cowDir{name: name, info: info, infos: infos}, nil
+		}
+		return layer.fs.OpenFile(name, flag, perm)
+	}
+
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	_, info, err := cfs.find("open", name)
+	if err == nil {
+		if flag.has(CreateFlag) && flag.has(ExclFlag) {
+			return nil, &PathError{Op: "open", Path: name, Cause: ErrExist}
+		} else if info.IsDir() {
+			return nil, &PathError{Op: "open", Path: name, Cause: ErrIsDir}
+		}
+		err = cfs.copyUp(name, !flag.has(TruncFlag))
+	} else if IsNotExist(err) && flag.has(CreateFlag) {
+		if err = cfs.copyUpDirs(path.Dir(name)); err == nil {
+			cfs.created(name)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	cfs.top().dirty = true
+	return cfs.top().fs.OpenFile(name, flag, perm)
+}
+
+// Mkdir creates a new directory in the top layer
+func (cfs *CowFs) Mkdir(name string, perm os.FileMode) error {
+	name = Clean(name)
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+
+	if _, _, err := cfs.find("mkdir", name); err == nil {
+		return &PathError{Op: "mkdir", Path: name, Cause: ErrExist}
+	} else if !IsNotExist(err) {
+		return err
+	}
+
+	err := cfs.copyUpDirs(path.Dir(name))
+	if err == nil {
+		err = cfs.top().fs.Mkdir(name, perm)
+	}
+
+	if err == nil {
+		cfs.created(name)
+	}
+	return err
+}
+
+// Remove removes the named file or empty directory.  Files that exist in
+// a lower layer are hidden by a whiteout rather than removed
+func (cfs *CowFs) Remove(name string) error {
+	name = Clean(name)
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+
+	layer, info, err := cfs.find("remove", name)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if infos, _ := cfs.readDir(name); len(infos) > 0 {
+			return &PathError{Op: "remove", Path: name, Cause: ErrNotEmpty}
+		}
+	}
+
+	if layer == cfs.top() {
+		if err = layer.fs.Remove(name); err != nil {
+			return err
+		}
+	}
+	cfs.removed(name)
+	return nil
+}
+
+// Rename moves oldpath to newpath.  Directories are renamed by copying
+// their entire tree into the top layer
+func (cfs *CowFs) Rename(oldpath, newpath string) error {
+	oldpath = Clean(oldpath)
+	newpath = Clean(newpath)
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+
+	_, info, err := cfs.find("rename", oldpath)
+	if err != nil || oldpath == newpath {
+		return err
+	}
+
+	if layer, existing, err := cfs.find("rename", newpath); err == nil {
+		if existing.IsDir() != info.IsDir() {
+			cause := ErrIsDir
+			if !existing.IsDir() {
+				cause = ErrNotDir
+			}
+			return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: cause}
+		} else if infos, _ := cfs.readDir(newpath); len(infos) > 0 {
+			return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrNotEmpty}
+		} else if layer == cfs.top() {
+			if err = layer.fs.Remove(newpath); err != nil {
+				return err
+			}
+		}
+		cfs.top().whiteouts[newpath] = true
+	} else if !IsNotExist(err) {
+		return err
+	}
+
+	if err = cfs.copyUp(oldpath, true); err == nil {
+		err = cfs.copyUpDirs(path.Dir(newpath))
+	}
+
+	if err == nil {
+		err = cfs.top().fs.Rename(oldpath, newpath)
+	}
+
+	if err == nil {
+		cfs.removed(oldpath)
+		cfs.created(newpath)
+		if info.IsDir() {
+			cfs.top().opaque[newpath] = true
+		}
+	}
+	return err
+}
+
+// Lstat returns a FileInfo describing the named file from the layer that
+// holds it
+func (cfs *CowFs) Lstat(name string) (os.FileInfo, error) {
+	cfs.mu.RLock()
+	defer cfs.mu.RUnlock()
+	_, info, err := cfs.find("lstat", Clean(name))
+	return info, err
+}
+
+// Stat returns a FileInfo describing the named file from the layer that
+// holds it.  Symbolic links are followed within that layer
+func (cfs *CowFs) Stat(name string) (os.FileInfo, error) {
+	name = Clean(name)
+	cfs.mu.RLock()
+	defer cfs.mu.RUnlock()
+	layer, info, err := cfs.find("stat", name)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		info, err = layer.fs.Stat(name)
+	}
+	return info, err
+}
+
+// Close releases the top layer.  The base and any layers shared with other
+// branches are left untouched
+func (cfs *CowFs) Close() error {
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	return cfs.top().fs.Close()
+}
+
+// Watcher is not supported by CowFs
+func (cfs *CowFs) Watcher(chan<- Event) (Watcher, error) {
+	return nil, ErrNotSupported
+}
+
+// cowDir is an open directory of a CowFs listing the merged contents of
+// every layer
+type cowDir struct {
+	name   string
+	info   os.FileInfo
+	infos  []os.FileInfo
+	offset int
+}
+
+func (dir *cowDir) Name() string               { return dir.name }
+func (dir *cowDir) Stat() (os.FileInfo, error) { return dir.info, nil }
+func (dir *cowDir) Close() error               { return nil }
+
+func (dir *cowDir) Read(p []byte) (int, error) {
+	return 0, &PathError{Op: "read", Path: dir.name, Cause: ErrIsDir}
+}
+
+func (dir *cowDir) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &PathError{Op: "read", Path: dir.name, Cause: ErrIsDir}
+}
+
+func (dir *cowDir) Write(p []byte) (int, error) {
+	return 0, &PathError{Op: "write", Path: dir.name, Cause: ErrIsDir}
+}
+
+func (dir *cowDir) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &PathError{Op: "write", Path: dir.name, Cause: ErrIsDir}
+}
+
+// Seek rewinds the directory when given offset 0 and io.SeekStart.  The
+// entries listed again are those the directory held when it was opened
+func (dir *cowDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		dir.offset = 0
+		return 0, nil
+	}
+	return 0, &PathError{Op: "seek", Path: dir.name, Cause: ErrIsDir}
+}
+
+func (dir *cowDir) Readdir(n int) (infos []os.FileInfo, err error) {
+	infos = dir.infos[dir.offset:]
+	if n > 0 && len(infos) > n {
+		infos = infos[:n]
+	}
+	dir.offset += len(infos)
+
+	if n > 0 && len(infos) == 0 {
+		err = io.EOF
+	}
+	return infos, err
+}
+
+func (dir *cowDir) Readdirnames(n int) (names []string, err error) {
+	infos, err := dir.Readdir(n)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, err
+}
@@ -0,0 +1,178 @@
+package vfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newCowFixture(t *testing.T) FileSystem {
+	base := NewMemFs()
+	for _, dir := range []string{"/fixture", "/fixture/dir"} {
+		if err := base.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	for name, content := range map[string]string{"/fixture/a.txt": "a", "/fixture/dir/b.txt": "b"} {
+		if err := WriteFile(base, name, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return base
+}
+
+func readDirNames(t *testing.T, fs FileSystem, dirname string) (names []string) {
+	infos, err := readDir(fs, dirname)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestCowFs(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(fs FileSystem) error
+		wantNames map[string][]string
+		wantFiles map[string]string
+	}{
+		{
+			name:      "write",
+			change:    func(fs FileSystem) error { return WriteFile(fs, "/fixture/a.txt", []byte("changed"), 0644) },
+			wantNames: map[string][]string{"/fixture": {"a.txt", "dir"}},
+			wantFiles: map[string]string{"/fixture/a.txt": "changed", "/fixture/dir/b.txt": "b"},
+		},
+		{
+			name:      "create",
+			change:    func(fs FileSystem) error { return WriteFile(fs, "/fixture/dir/c.txt", []byte("c"), 0644) },
+			wantNames: map[string][]string{"/fixture/dir": {"b.txt", "c.txt"}},
+			wantFiles: map[string]string{"/fixture/dir/b.txt": "b", "/fixture/dir/c.txt": "c"},
+		},
+		{
+			name:      "remove",
+			change:    func(fs FileSystem) error { return fs.Remove("/fixture/a.txt") },
+			wantNames: map[string][]string{"/fixture": {"dir"}},
+		},
+		{
+			name: "remove and recreate dir",
+			change: func(fs FileSystem) error {
+				if err := fs.Remove("/fixture/dir/b.txt"); err != nil {
+					return err
+				} else if err = fs.Remove("/fixture/dir"); err != nil {
+					return err
+				}
+				return fs.Mkdir("/fixture/dir", 0755)
+			},
+			wantNames: map[string][]string{"/fixture": {"a.txt", "dir"}, "/fixture/dir": nil},
+		},
+		{
+			name:      "rename dir",
+			change:    func(fs FileSystem) error { return fs.Rename("/fixture/dir", "/fixture/moved") },
+			wantNames: map[string][]string{"/fixture": {"a.txt", "moved"}, "/fixture/moved": {"b.txt"}},
+			wantFiles: map[string]string{"/fixture/moved/b.txt": "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := newCowFixture(t)
+			fs := NewCowFs(base)
+			if err := test.change(fs); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for dirname, want := range test.wantNames {
+				if got := readDirNames(t, fs, dirname); !reflect.DeepEqual(want, got) {
+					t.Errorf("Wanted %s to contain %v got %v", dirname, want, got)
+				}
+			}
+
+			for filename, want := range test.wantFiles {
+				if got, err := ReadFile(fs, filename); err != nil || string(got) != want {
+					t.Errorf("Wanted %s to contain %q got %q (%v)", filename, want, got, err)
+				}
+			}
+
+			if got := readDirNames(t, base, "/fixture"); !reflect.DeepEqual([]string{"a.txt", "dir"}, got) {
+				t.Errorf("Base was modified: %v", got)
+			}
+
+			if got, _ := ReadFile(base, "/fixture/a.txt"); string(got) != "a" {
+				t.Errorf("Base was modified: %q", got)
+			}
+		})
+	}
+}
+
+func TestCowFsErrors(t *testing.T) {
+	fs := NewCowFs(newCowFixture(t))
+	fs.Remove("/fixture/a.txt")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"open removed", openErr(fs.Open("/fixture/a.txt")), ErrNotExist},
+		{"remove not empty", fs.Remove("/fixture/dir"), ErrNotEmpty},
+		{"mkdir exists", fs.Mkdir("/fixture/dir", 0755), ErrExist},
+		{"exclusive create", openErr(fs.OpenFile("/fixture/dir/b.txt", WrOnlyFlag|CreateFlag|ExclFlag, 0644)), ErrExist},
+		{"create in file", openErr(fs.Create("/fixture/dir/b.txt/c.txt")), ErrNotDir},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !IsError(test.want, test.err) {
+				t.Errorf("Wanted %v got %v", test.want, test.err)
+			}
+		})
+	}
+}
+
+func openErr(f File, err error) error { return err }
+
+func TestCowFsFork(t *testing.T) {
+	parent := NewCowFs(newCowFixture(t))
+	WriteFile(parent, "/fixture/a.txt", []byte("parent"), 0644)
+
+	child := parent.Fork()
+	WriteFile(child, "/fixture/a.txt", []byte("child"), 0644)
+	child.Remove("/fixture/dir/b.txt")
+	WriteFile(parent, "/fixture/dir/c.txt", []byte("c"), 0644)
+
+	tests := []struct {
+		fs        *CowFs
+		wantA     string
+		wantNames []string
+	}{
+		{parent, "parent", []string{"b.txt", "c.txt"}},
+		{child, "child", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.wantA, func(t *testing.T) {
+			if got, err := ReadFile(test.fs, "/fixture/a.txt"); err != nil || string(got) != test.wantA {
+				t.Errorf("Wanted %q got %q (%v)", test.wantA, got, err)
+			}
+
+			if got := readDirNames(t, test.fs, "/fixture/dir"); !reflect.DeepEqual(test.wantNames, got) {
+				t.Errorf("Wanted %v got %v", test.wantNames, got)
+			}
+		})
+	}
+
+	// forking an unmodified branch does not add layers to it
+	fork := child.Fork()
+	want := len(fork.layers)
+	for i := 0; i < 3; i++ {
+		fork.Fork()
+	}
+
+	if len(fork.layers) != want {
+		t.Errorf("Wanted %d layers got %d", want, len(fork.layers))
+	}
+}
@@ -0,0 +1,670 @@
+package vfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// cryptMagic identifies a file written by an encrypting FileSystem
+var cryptMagic = [4]byte{'V', 'F', 'S', 'C'}
+
+const (
+	cryptVersion = byte(1)
+
+	// cryptHeaderSize is the size of the file header: the magic number,
+	// the version, three reserved bytes and the salt the file key is
+	// derived from
+	cryptHeaderSize = 32
+	cryptSaltSize   = 24
+
+	// cryptBlockSize is the number of plaintext bytes in a block.  Each
+	// block is sealed on its own, behind a random nonce, so that any part of
+	// a file can be read or rewritten without touching the rest
+	cryptBlockSize     = 4096
+	cryptNonceSize     = 12
+	cryptOverhead      = cryptNonceSize + 16
+	cryptDiskBlockSize = cryptBlockSize + cryptOverhead
+)
+
+// cryptfs encrypts the contents, and optionally the names, of the files in
+// another FileSystem
+type cryptfs struct {
+	FileSystem
+	key   []byte
+	names bool
+
+	// nameKey and nameAEAD encrypt names.  Names are encrypted
+	// deterministically so that they can be looked up
+	nameKey  []byte
+	nameAEAD cipher.AEAD
+}
+
+// NewCryptFs returns a FileSystem that encrypts everything written to base
+// with AES-256-GCM.  Every file gets its own key, derived from the 32 byte
+// master key and a random salt kept in the file's header.  File contents are
+// sealed in blocks so that Seek, ReadAt and WriteAt work without decrypting
+// the whole file.  WithEncryptedNames encrypts file and directory names as
+// well.  Files that are truncated by someone else behind a block boundary
+// cannot be detected, every other modification of the encrypted data is
+// reported as ErrDecrypt
+func NewCryptFs(base FileSystem, key []byte, opts ...Option) (FileSystem, error) {
+	if len(key) != 32 {
+		return nil, ErrKeySize
+	}
+
+	cfs := &cryptfs{FileSystem: base, key: append([]byte(nil), key...)}
+	for _, opt := range opts {
+		opt(cfs)
+	}
+
+	var err error
+	cfs.nameKey = cfs.deriveKey("name", nil)
+	cfs.nameAEAD, err = newCryptAEAD(cfs.deriveKey("name cipher", nil))
+	return cfs, err
+}
+
+func newCryptAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives a key for a single purpose from the master key
+func (cfs *cryptfs) deriveKey(label string, salt []byte) []byte {
+	mac := hmac.New(sha256.New, cfs.key)
+	mac.Write([]byte(label))
+	mac.Write(salt)
+	return mac.Sum(nil)
+}
+
+func (cfs *cryptfs) encryptName(name string) string {
+	mac := hmac.New(sha256.New, cfs.nameKey)
+	mac.Write([]byte(name))
+	nonce := mac.Sum(nil)[:cryptNonceSize]
+	return base64.RawURLEncoding.EncodeToString(cfs.nameAEAD.Seal(nonce, nonce, []byte(name), nil))
+}
+
+func (cfs *cryptfs) decryptName(name string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(name)
+	if err != nil || len(sealed) < cryptOverhead {
+		return "", ErrDecrypt
+	}
+
+	plain, err := cfs.nameAEAD.Open(nil, sealed[:cryptNonceSize], sealed[cryptNonceSize:], nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plain), nil
+}
+
+// path converts a name into the name of the file in the backing FileSystem
+func (cfs *cryptfs) path(name string) string {
+	name = Clean(name)
+	if !cfs.names || name == PathSeparator {
+		return name
+	}
+
+	elements := strings.Split(name[1:], PathSeparator)
+	for i, element := range elements {
+		elements[i] = cfs.encryptName(element)
+	}
+	return PathSeparator + strings.Join(elements, PathSeparator)
+}
+
+// rel converts the name of a file in the backing FileSystem back into the
+// name it was given
+func (cfs *cryptfs) rel(name string) (string, bool) {
+	name = Clean(name)
+	if !cfs.names || name == PathSeparator {
+		return name, true
+	}
+
+	elements := strings.Split(name[1:], PathSeparator)
+	for i, element := range elements {
+		var err error
+		if elements[i], err = cfs.decryptName(element); err != nil {
+			return name, false
+		}
+	}
+	return PathSeparator + strings.Join(elements, PathSeparator), true
+}
+
+// fixErr rewrites the path of a PathError so that encrypted names are not
+// reported
+func (cfs *cryptfs) fixErr(name string, err error) error {
+	switch pe := err.(type) {
+	case *PathError:
+		return &PathError{Op: pe.Op, Path: name, Cause: pe.Cause}
+	case *os.PathError:
+		return &os.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
+
+// info describes a file of the backing FileSystem by its decrypted name and
+// size
+func (cfs *cryptfs) info(info os.FileInfo) os.FileInfo {
+	name := info.Name()
+	if cfs.names {
+		if plain, err := cfs.decryptName(name); err == nil {
+			name = plain
+		}
+	}
+
+	size := info.Size()
+	if info.Mode().IsRegular() {
+		size = cryptPlainSize(size)
+	}
+	return &cryptFileInfo{FileInfo: info, name: name, size: size}
+}
+
+// cryptPlainSize computes the size of the plaintext stored in an encrypted
+// file of the given size
+func cryptPlainSize(size int64) int64 {
+	if size <= cryptHeaderSize {
+		return 0
+	}
+
+	size -= cryptHeaderSize
+	plain := size / cryptDiskBlockSize * cryptBlockSize
+	if rem := size % cryptDiskBlockSize; rem > cryptOverhead {
+		plain += rem - cryptOverhead
+	}
+	return plain
+}
+
+// cryptDiskSize computes the size of the encrypted file holding size bytes of
+// plaintext
+func cryptDiskSize(size int64) int64 {
+	disk := cryptHeaderSize + size/cryptBlockSize*cryptDiskBlockSize
+	if rem := size % cryptBlockSize; rem > 0 {
+		disk += rem + cryptOverhead
+	}
+	return disk
+}
+
+func (cfs *cryptfs) Chmod(name string, mode os.FileMode) error {
+	return cfs.fixErr(name, cfs.FileSystem.Chmod(cfs.path(name), mode))
+}
+
+func (cfs *cryptfs) Create(name string) (File, error) {
+	return cfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (cfs *cryptfs) Open(name string) (File, error) {
+	return cfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+// OpenFile opens the named file.  Files opened write only are opened for
+// reading and writing in the backing FileSystem since writing part of a
+// block means decrypting the rest of it
+func (cfs *cryptfs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if err := flag.check(); err != nil {
+		return nil, &PathError{Op: "open", Path: name, Cause: err}
+	}
+
+	baseFlag := flag &^ AppendFlag
+	if flag.accessMode() == WrOnlyFlag {
+		baseFlag = baseFlag&^WrOnlyFlag | RdWrFlag
+	}
+
+	f, err := cfs.FileSystem.OpenFile(cfs.path(name), baseFlag, perm)
+	if err != nil {
+		return nil, cfs.fixErr(name, err)
+	}
+	return &cryptFile{File: f, fs: cfs, name: name, flag: flag}, nil
+}
+
+func (cfs *cryptfs) Mkdir(name string, perm os.FileMode) error {
+	return cfs.fixErr(name, cfs.FileSystem.Mkdir(cfs.path(name), perm))
+}
+
+func (cfs *cryptfs) Remove(name string) error {
+	return cfs.fixErr(name, cfs.FileSystem.Remove(cfs.path(name)))
+}
+
+func (cfs *cryptfs) Rename(oldpath, newpath string) error {
+	return cfs.fixErr(oldpath, cfs.FileSystem.Rename(cfs.path(oldpath), cfs.path(newpath)))
+}
+
+func (cfs *cryptfs) Lstat(name string) (os.FileInfo, error) {
+	info, err := cfs.FileSystem.Lstat(cfs.path(name))
+	if err != nil {
+		return nil, cfs.fixErr(name, err)
+	}
+	return cfs.info(info), nil
+}
+
+func (cfs *cryptfs) Stat(name string) (os.FileInfo, error) {
+	info, err := cfs.FileSystem.Stat(cfs.path(name))
+	if err != nil {
+		return nil, cfs.fixErr(name, err)
+	}
+	return cfs.info(info), nil
+}
+
+// Watcher returns a Watcher reporting events by their decrypted names.
+// Events for files whose names cannot be decrypted are dropped
+func (cfs *cryptfs) Watcher(events chan<- Event) (Watcher, error) {
+	if !cfs.names {
+		return cfs.FileSystem.Watcher(events)
+	}
+
+	in := make(chan Event, cap(events))
+	watcher, err := cfs.FileSystem.Watcher(in)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range in {
+			if event.Type != ErrorEvent {
+				var ok bool
+				if event.Path, ok = cfs.rel(event.Path); !ok {
+					continue
+				}
+			}
+			events <- event
+		}
+		close(events)
+	}()
+	return &cryptWatcher{Watcher: watcher, fs: cfs, done: done}, nil
+}
+
+// Unwrap returns the backing FileSystem
+func (cfs *cryptfs) Unwrap() []FileSystem { return []FileSystem{cfs.FileSystem} }
+
+type cryptWatcher struct {
+	Watcher
+	fs   *cryptfs
+	done chan struct{}
+}
+
+// Close closes the underlying watcher and returns once the events channel
+// has been closed
+func (cw *cryptWatcher) Close() error {
+	err := cw.Watcher.Close()
+	if err == nil {
+		<-cw.done
+	}
+	return err
+}
+
+func (cw *cryptWatcher) Watch(name string) error {
+	return cw.fs.fixErr(name, cw.Watcher.Watch(cw.fs.path(name)))
+}
+
+func (cw *cryptWatcher) Remove(name string) error {
+	return cw.fs.fixErr(name, cw.Watcher.Remove(cw.fs.path(name)))
+}
+
+type cryptFileInfo struct {
+	os.FileInfo
+	name string
+	size int64
+}
+
+func (fi *cryptFileInfo) Name() string { return fi.name }
+func (fi *cryptFileInfo) Size() int64  { return fi.size }
+
+// cryptFile is a file of a cryptfs.  Directories pass straight through to
+// the backing file apart from having their entries decrypted
+type cryptFile struct {
+	File
+	fs   *cryptfs
+	name string
+	flag OpenFlag
+
+	mu     sync.Mutex
+	offset int64
+
+	// aead seals the blocks of the file, it is nil until the header has
+	// been read or written
+	aead cipher.AEAD
+}
+
+func (f *cryptFile) Name() string { return f.name }
+
+// size returns the size of the plaintext
+func (f *cryptFile) size() (int64, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return 0, err
+	} else if info.IsDir() {
+		return 0, ErrIsDir
+	}
+	return cryptPlainSize(info.Size()), nil
+}
+
+// header reads the file header and sets up the file's cipher.  An empty
+// file has no header, in which case a new one is written if create is set
+// and io.EOF is returned otherwise
+func (f *cryptFile) header(create bool) error {
+	if f.aead != nil {
+		return nil
+	}
+
+	header := make([]byte, cryptHeaderSize)
+	n, err := f.File.ReadAt(header, 0)
+	if n == 0 && (err == nil || err == io.EOF) {
+		if !create {
+			return io.EOF
+		}
+
+		copy(header, cryptMagic[:])
+		header[len(cryptMagic)] = cryptVersion
+		if _, err = rand.Read(header[cryptHeaderSize-cryptSaltSize:]); err != nil {
+			return err
+		}
+
+		if _, err = f.File.WriteAt(header, 0); err != nil {
+			return err
+		}
+	} else if n < cryptHeaderSize || !hmac.Equal(header[:len(cryptMagic)], cryptMagic[:]) || header[len(cryptMagic)] != cryptVersion {
+		return &PathError{Op: "read", Path: f.name, Cause: ErrDecrypt}
+	}
+
+	f.aead, err = newCryptAEAD(f.fs.deriveKey("file", header[cryptHeaderSize-cryptSaltSize:]))
+	return err
+}
+
+// blockData is the additional data of a block, it binds each block to its
+// position in the file
+func blockData(block int64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(block))
+	return data
+}
+
+// readBlock returns the plaintext of a block, io.EOF is returned for
+// blocks past the end of the file
+func (f *cryptFile) readBlock(block int64) ([]byte, error) {
+	if err := f.header(false); err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, cryptDiskBlockSize)
+	n, err := f.File.ReadAt(sealed, cryptHeaderSize+block*cryptDiskBlockSize)
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	} else if err != nil && err != io.EOF {
+		return nil, err
+	} else if n <= cryptOverhead {
+		return nil, &PathError{Op: "read", Path: f.name, Cause: ErrDecrypt}
+	}
+
+	plain, err := f.aead.Open(nil, sealed[:cryptNonceSize], sealed[cryptNonceSize:n], blockData(block))
+	if err != nil {
+		return nil, &PathError{Op: "read", Path: f.name, Cause: ErrDecrypt}
+	}
+	return plain, nil
+}
+
+// writeBlock seals a block behind a fresh nonce and writes it
+func (f *cryptFile) writeBlock(block int64, plain []byte) error {
+	nonce := make([]byte, cryptNonceSize, cryptDiskBlockSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	_, err := f.File.WriteAt(f.aead.Seal(nonce, nonce, plain, blockData(block)), cryptHeaderSize+block*cryptDiskBlockSize)
+	return err
+}
+
+func (f *cryptFile) readAt(p []byte, off int64) (n int, err error) {
+	if f.flag.accessMode() == WrOnlyFlag {
+		return 0, ErrWriteOnly
+	} else if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	for n < len(p) {
+		plain, err := f.readBlock(off / cryptBlockSize)
+		if err != nil {
+			return n, err
+		}
+
+		start := int(off % cryptBlockSize)
+		if start >= len(plain) {
+			return n, io.EOF
+		}
+
+		copied := copy(p[n:], plain[start:])
+		n += copied
+		off += int64(copied)
+		if len(plain) < cryptBlockSize && n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// writeAt writes p at off, filling any gap between the end of the file and
+// off with zeros
+func (f *cryptFile) writeAt(p []byte, off int64) (n int, err error) {
+	if f.flag.accessMode() == RdOnlyFlag {
+		return 0, ErrReadOnly
+	} else if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	size, err := f.size()
+	if err != nil {
+		return 0, err
+	} else if size == 0 {
+		// the file may have been truncated by another handle
+		f.aead = nil
+	}
+
+	if err = f.header(true); err != nil {
+		return 0, err
+	}
+
+	if off > size {
+		if _, err = f.write(make([]byte, off-size), size, size); err != nil {
+			return 0, err
+		}
+		size = off
+	}
+	return f.write(p, off, size)
+}
+
+func (f *cryptFile) write(p []byte, off, size int64) (n int, err error) {
+	for n < len(p) {
+		block := off / cryptBlockSize
+		var plain []byte
+		if block*cryptBlockSize < size {
+			if plain, err = f.readBlock(block); err != nil && err != io.EOF {
+				return n, err
+			}
+		}
+
+		start := int(off % cryptBlockSize)
+		end := start + len(p) - n
+		if end > cryptBlockSize {
+			end = cryptBlockSize
+		}
+
+		if len(plain) < end {
+			plain = append(plain, make([]byte, end-len(plain))...)
+		}
+
+		copied := copy(plain[start:end], p[n:])
+		if err = f.writeBlock(block, plain); err != nil {
+			return n, err
+		}
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+func (f *cryptFile) Read(p []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err = f.readAt(p, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt decrypts len(p) bytes starting at byte offset off of the plaintext
+func (f *cryptFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readAt(p, off)
+}
+
+func (f *cryptFile) Write(p []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flag.has(AppendFlag) {
+		if f.offset, err = f.size(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt encrypts and writes len(p) bytes starting at byte offset off of
+// the plaintext
+func (f *cryptFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeAt(p, off)
+}
+
+func (f *cryptFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		size, err := f.size()
+		if err != nil {
+			return f.offset, err
+		}
+		offset += size
+	default:
+		return f.offset, ErrWhence
+	}
+
+	if offset < 0 {
+		return f.offset, ErrInvalidSeek
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Truncate changes the size of the plaintext.  Shrinking a file requires the
+// backing file to support Truncate
+func (f *cryptFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flag.accessMode() == RdOnlyFlag {
+		return ErrReadOnly
+	} else if size < 0 {
+		return ErrSize
+	}
+
+	current, err := f.size()
+	if err != nil {
+		return err
+	} else if size > current {
+		_, err = f.writeAt(nil, size)
+		return err
+	} else if size == current {
+		return nil
+	}
+
+	truncater, ok := f.File.(interface{ Truncate(int64) error })
+	if !ok {
+		return &PathError{Op: "truncate", Path: f.name, Cause: ErrNotSupported}
+	}
+
+	if rem := int(size % cryptBlockSize); rem > 0 {
+		block := size / cryptBlockSize
+		plain, err := f.readBlock(block)
+		if err != nil {
+			return err
+		} else if err = f.writeBlock(block, plain[:rem]); err != nil {
+			return err
+		}
+	}
+	return truncater.Truncate(cryptDiskSize(size))
+}
+
+// Readdirnames returns the decrypted names of the directory entries.
+// Entries whose names cannot be decrypted are skipped
+func (f *cryptFile) Readdirnames(n int) (names []string, err error) {
+	names, err = f.File.Readdirnames(n)
+	if !f.fs.names {
+		return names, err
+	}
+
+	plain := names[:0]
+	for _, name := range names {
+		if name, err1 := f.fs.decryptName(name); err1 == nil {
+			plain = append(plain, name)
+		}
+	}
+	return plain, err
+}
+
+// Readdir describes the directory entries by their decrypted names and
+// sizes.  Entries whose names cannot be decrypted are skipped
+func (f *cryptFile) Readdir(n int) (infos []os.FileInfo, err error) {
+	infos, err = f.File.Readdir(n)
+	plain := infos[:0]
+	for _, info := range infos {
+		if f.fs.names {
+			if _, err1 := f.fs.decryptName(info.Name()); err1 != nil {
+				continue
+			}
+		}
+		plain = append(plain, f.fs.info(info))
+	}
+	return plain, err
+}
+
+func (f *cryptFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	info = f.fs.info(info)
+	return &cryptFileInfo{FileInfo: info, name: path.Base(f.name), size: info.Size()}, nil
+}
+
+// Close closes the backing file if it can be closed
+func (f *cryptFile) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
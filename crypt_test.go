@@ -0,0 +1,166 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+var testCryptKey = bytes.Repeat([]byte{0x42}, 32)
+
+func TestCryptFs(t *testing.T) {
+	base := NewTempFs()
+	defer base.Close()
+
+	fs, err := NewCryptFs(base, testCryptKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	secret := []byte("the password is swordfish")
+	if err = WriteFile(fs, "/secret", secret, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if raw, _ := ReadFile(base, "/secret"); bytes.Contains(raw, secret) {
+		t.Errorf("Wanted the backing file to be encrypted")
+	}
+
+	if got, err := ReadFile(fs, "/secret"); err != nil || !bytes.Equal(secret, got) {
+		t.Errorf("Wanted %q got %q (%v)", secret, got, err)
+	}
+
+	if info, err := fs.Stat("/secret"); err != nil || info.Size() != int64(len(secret)) {
+		t.Errorf("Wanted size %d got %v (%v)", len(secret), info, err)
+	}
+
+	other, _ := NewCryptFs(base, bytes.Repeat([]byte{0x24}, 32))
+	if _, err = ReadFile(other, "/secret"); !IsError(ErrDecrypt, err) {
+		t.Errorf("Wanted %v with the wrong key got %v", ErrDecrypt, err)
+	}
+
+	f, _ := base.OpenFile("/secret", RdWrFlag, 0)
+	f.WriteAt([]byte{0xff}, cryptHeaderSize+cryptNonceSize)
+	f.(io.Closer).Close()
+	if _, err = ReadFile(fs, "/secret"); !IsError(ErrDecrypt, err) {
+		t.Errorf("Wanted %v after tampering got %v", ErrDecrypt, err)
+	}
+
+	if _, err = NewCryptFs(base, []byte("short")); err != ErrKeySize {
+		t.Errorf("Wanted %v got %v", ErrKeySize, err)
+	}
+}
+
+func TestCryptFile(t *testing.T) {
+	base := NewTempFs()
+	defer base.Close()
+	fs, _ := NewCryptFs(base, testCryptKey)
+
+	want := make([]byte, 3*cryptBlockSize+100)
+	for i := range want {
+		want[i] = byte(i % 251)
+	}
+
+	f, err := fs.Create("/file")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer f.(io.Closer).Close()
+	f.Write(want)
+
+	tests := []struct {
+		name  string
+		write []byte
+		off   int64
+	}{
+		{"overwrite within a block", []byte("hello"), 10},
+		{"overwrite across blocks", []byte("boundary"), cryptBlockSize - 4},
+		{"extend", []byte("tail"), int64(len(want)) - 2},
+		{"sparse", []byte("far"), 5 * cryptBlockSize},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := f.WriteAt(test.write, test.off); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if end := test.off + int64(len(test.write)); end > int64(len(want)) {
+				want = append(want, make([]byte, end-int64(len(want)))...)
+			}
+			copy(want[test.off:], test.write)
+
+			got, err := ReadFile(fs, "/file")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else if !bytes.Equal(want, got) {
+				t.Errorf("Wanted %d bytes got %d bytes that differ", len(want), len(got))
+			}
+		})
+	}
+
+	if _, err = f.Seek(cryptBlockSize-4, io.SeekStart); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := make([]byte, 8)
+	if _, err = io.ReadFull(f, got); err != nil || string(got) != "boundary" {
+		t.Errorf("Wanted %q got %q (%v)", "boundary", got, err)
+	}
+
+	if err = f.(interface{ Truncate(int64) error }).Truncate(cryptBlockSize + 10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if end, _ := f.Seek(0, io.SeekEnd); end != cryptBlockSize+10 {
+		t.Errorf("Wanted size %d got %d", cryptBlockSize+10, end)
+	}
+
+	if got, _ := ReadFile(fs, "/file"); !bytes.Equal(want[:cryptBlockSize+10], got) {
+		t.Errorf("Wanted the truncated contents got %d bytes", len(got))
+	}
+
+	if info, _ := base.Stat("/file"); info.Size() != cryptDiskSize(cryptBlockSize+10) {
+		t.Errorf("Wanted backing size %d got %d", cryptDiskSize(cryptBlockSize+10), info.Size())
+	}
+
+	a, _ := fs.OpenFile("/file", WrOnlyFlag|AppendFlag, 0)
+	a.Write([]byte("appended"))
+	a.(io.Closer).Close()
+	if got, _ := ReadFile(fs, "/file"); !bytes.HasSuffix(got, []byte("appended")) {
+		t.Errorf("Wanted the file to end with %q", "appended")
+	}
+}
+
+func TestCryptFsNames(t *testing.T) {
+	base := NewTempFs()
+	defer base.Close()
+	fs, _ := NewCryptFs(base, testCryptKey, WithEncryptedNames())
+
+	if err := fs.Mkdir("/dir", 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if err = WriteFile(fs, "/dir/secret", []byte("content"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := base.Stat("/dir"); !IsNotExist(err) {
+		t.Errorf("Wanted the directory name to be encrypted got %v", err)
+	}
+
+	if err := fs.Rename("/dir/secret", "/dir/renamed"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	infos, err := readDir(fs, "/dir")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(infos) != 1 || infos[0].Name() != "renamed" || infos[0].Size() != 7 {
+		t.Errorf("Wanted renamed with 7 bytes got %v", infos)
+	}
+
+	if _, err = fs.Stat("/dir/missing"); !IsNotExist(err) {
+		t.Errorf("Wanted not exist got %v", err)
+	} else if pe, ok := err.(*PathError); !ok || pe.Path != "/dir/missing" {
+		t.Errorf("Wanted the error to report the plain name got %v", err)
+	}
+}
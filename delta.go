@@ -0,0 +1,327 @@
+package vfs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path"
+)
+
+// DefaultBlockSize is the block size used by DeltaSync when none is given
+const DefaultBlockSize = 8 * 1024
+
+// BlockSignature identifies a single block of a file by a weak rolling
+// checksum and a strong digest
+type BlockSignature struct {
+	Weak   uint32
+	Strong [sha256.Size]byte
+}
+
+// Signature describes the blocks of a file so that another copy of the file
+// can be expressed in terms of them
+type Signature struct {
+	BlockSize int
+	Size      int64
+	Blocks    []BlockSignature
+}
+
+// blockLen returns the length of the given block, only the last block may be
+// shorter than BlockSize
+func (sig *Signature) blockLen(block int) int {
+	if block == len(sig.Blocks)-1 && sig.Size%int64(sig.BlockSize) != 0 {
+		return int(sig.Size % int64(sig.BlockSize))
+	}
+	return sig.BlockSize
+}
+
+// DeltaOp is a single instruction for rebuilding a file.  The range of the
+// source file from Offset to Offset+Length is either found in Block of the
+// signed file or, when Block is -1, must be read from the source
+type DeltaOp struct {
+	Block  int
+	Offset int64
+	Length int64
+}
+
+// DeltaSource is implemented by FileSystems that can compute a delta next to
+// the data, such as a remote server.  Without it DeltaSync computes the delta
+// by reading the source file
+type DeltaSource interface {
+	Delta(name string, sig *Signature) ([]DeltaOp, error)
+}
+
+// DeltaStats reports how much of a file DeltaSync reused and how much it
+// read from the source
+type DeltaStats struct {
+	Matched     int64
+	Transferred int64
+}
+
+// rollsum is the rsync rolling checksum of a window of bytes
+type rollsum struct {
+	a, b uint32
+	n    uint32
+}
+
+func (r *rollsum) add(c byte) {
+	r.a += uint32(c)
+	r.b += r.a
+	r.n++
+}
+
+func (r *rollsum) remove(c byte) {
+	r.a -= uint32(c)
+	r.b -= r.n * uint32(c)
+	r.n--
+}
+
+func (r *rollsum) digest() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+// ComputeSignature reads the named file and returns its block signatures
+func ComputeSignature(fs FileSystem, name string, blockSize int) (*Signature, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := f.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	sig := &Signature{BlockSize: blockSize}
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			var sum rollsum
+			for _, c := range buf[:n] {
+				sum.add(c)
+			}
+			sig.Blocks = append(sig.Blocks, BlockSignature{Weak: sum.digest(), Strong: sha256.Sum256(buf[:n])})
+			sig.Size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ComputeDelta reads the named file and expresses it as blocks from sig and
+// ranges that must be copied from the file itself
+func ComputeDelta(fs FileSystem, name string, sig *Signature) (ops []DeltaOp, err error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := f.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	index := make(map[uint32][]int)
+	for i, block := range sig.Blocks {
+		index[block.Weak] = append(index[block.Weak], i)
+	}
+
+	literal := func(offset int64) {
+		if n := len(ops) - 1; n >= 0 && ops[n].Block == -1 && ops[n].Offset+ops[n].Length == offset {
+			ops[n].Length++
+		} else {
+			ops = append(ops, DeltaOp{Block: -1, Offset: offset, Length: 1})
+		}
+	}
+
+	r := bufio.NewReader(f)
+	var (
+		window []byte
+		sum    rollsum
+		offset int64
+		eof    bool
+	)
+
+	for {
+		for !eof && len(window) < sig.BlockSize {
+			c, err := r.ReadByte()
+			if err == io.EOF {
+				eof = true
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			window = append(window, c)
+			sum.add(c)
+		}
+
+		if len(window) == 0 {
+			return ops, nil
+		}
+
+		if block := sig.match(index, sum.digest(), window); block >= 0 {
+			ops = append(ops, DeltaOp{Block: block, Offset: offset, Length: int64(len(window))})
+			offset += int64(len(window))
+			window, sum = window[:0], rollsum{}
+			continue
+		}
+
+		literal(offset)
+		sum.remove(window[0])
+		window = window[1:]
+		offset++
+	}
+}
+
+// match returns the block whose signature matches window or -1
+func (sig *Signature) match(index map[uint32][]int, weak uint32, window []byte) int {
+	candidates := index[weak]
+	if len(candidates) == 0 {
+		return -1
+	}
+
+	strong := sha256.Sum256(window)
+	for _, block := range candidates {
+		if sig.blockLen(block) == len(window) && sig.Blocks[block].Strong == strong {
+			return block
+		}
+	}
+	return -1
+}
+
+// DeltaSync makes the named file in dst match the one in src while reading
+// only the ranges of src that are not already present in dst.  Block
+// signatures of the dst file are matched against src using a rolling
+// checksum, by src itself if it implements DeltaSource.  When every matched
+// block is still at the same offset the dst file is patched in place,
+// otherwise the new contents are assembled in a temporary file that is then
+// renamed over the dst file
+func DeltaSync(dst, src FileSystem, name string, blockSize int) (stats DeltaStats, err error) {
+	srcInfo, err := src.Stat(name)
+	if err != nil {
+		return stats, err
+	}
+
+	sig, err := ComputeSignature(dst, name, blockSize)
+	if IsNotExist(err) {
+		sig, err = &Signature{BlockSize: blockSize}, nil
+		if blockSize <= 0 {
+			sig.BlockSize = DefaultBlockSize
+		}
+	}
+
+	if err != nil {
+		return stats, err
+	}
+
+	var ops []DeltaOp
+	if ds, ok := src.(DeltaSource); ok {
+		ops, err = ds.Delta(name, sig)
+	} else {
+		ops, err = ComputeDelta(src, name, sig)
+	}
+
+	if err != nil {
+		return stats, err
+	}
+
+	inPlace := srcInfo.Size() >= sig.Size
+	for _, op := range ops {
+		if op.Block >= 0 && int64(op.Block)*int64(sig.BlockSize) != op.Offset {
+			inPlace = false
+		}
+	}
+
+	srcFile, err := src.Open(name)
+	if err != nil {
+		return stats, err
+	}
+	if closer, ok := srcFile.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if inPlace {
+		return patchInPlace(dst, name, srcFile, srcInfo, sig, ops)
+	}
+	return patchRename(dst, name, srcFile, srcInfo, sig, ops)
+}
+
+// patchInPlace writes only the literal ranges of ops into the dst file
+func patchInPlace(dst FileSystem, name string, src File, srcInfo os.FileInfo, sig *Signature, ops []DeltaOp) (stats DeltaStats, err error) {
+	f, err := dst.OpenFile(name, RdWrFlag|CreateFlag, srcInfo.Mode().Perm())
+	if err != nil {
+		return stats, err
+	}
+
+	for _, op := range ops {
+		if op.Block >= 0 {
+			stats.Matched += op.Length
+			continue
+		}
+
+		if _, err = io.Copy(io.NewOffsetWriter(f, op.Offset), io.NewSectionReader(src, op.Offset, op.Length)); err != nil {
+			break
+		}
+		stats.Transferred += op.Length
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return stats, err
+}
+
+// patchRename assembles the new contents in a temporary file next to the dst
+// file and renames it into place
+func patchRename(dst FileSystem, name string, src File, srcInfo os.FileInfo, sig *Signature, ops []DeltaOp) (stats DeltaStats, err error) {
+	old, err := dst.Open(name)
+	if err != nil {
+		return stats, err
+	}
+	if closer, ok := old.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	dir, file := path.Split(name)
+	tmpname := path.Join(dir, "."+file+".delta")
+	f, err := dst.OpenFile(tmpname, WrOnlyFlag|CreateFlag|TruncFlag, srcInfo.Mode().Perm())
+	if err != nil {
+		return stats, err
+	}
+
+	for _, op := range ops {
+		if op.Block >= 0 {
+			_, err = io.Copy(f, io.NewSectionReader(old, int64(op.Block)*int64(sig.BlockSize), op.Length))
+			stats.Matched += op.Length
+		} else {
+			_, err = io.Copy(f, io.NewSectionReader(src, op.Offset, op.Length))
+			stats.Transferred += op.Length
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if err == nil {
+		err = dst.Rename(tmpname, name)
+	}
+
+	if err != nil {
+		dst.Remove(tmpname)
+	}
+	return stats, err
+}
@@ -0,0 +1,62 @@
+package vfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeltaSync(t *testing.T) {
+	base := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	modified := append([]byte{}, base...)
+	copy(modified[300:], "changed")
+
+	tests := []struct {
+		name            string
+		dst             []byte
+		src             []byte
+		wantTransferred int64
+	}{
+		{"identical", base, base, 0},
+		{"appended", base, append(append([]byte{}, base...), "tail"...), 4},
+		{"modified", base, modified, 64},
+		{"prepended", base, append([]byte("head"), base...), 4},
+		{"truncated", base, base[:512], 0},
+		{"new file", nil, base, int64(len(base))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := NewTempFs()
+			defer dst.Close()
+			src := NewTempFs()
+			defer src.Close()
+
+			if test.dst != nil {
+				WriteFile(dst, "/file", test.dst, 0644)
+			}
+			WriteFile(src, "/file", test.src, 0644)
+
+			stats, err := DeltaSync(dst, src, "/file", 64)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got, _ := ReadFile(dst, "/file")
+			if !bytes.Equal(test.src, got) {
+				t.Errorf("Wanted %q got %q", test.src, got)
+			}
+
+			if stats.Transferred != test.wantTransferred {
+				t.Errorf("Wanted %d bytes transferred got %d", test.wantTransferred, stats.Transferred)
+			}
+
+			if stats.Matched+stats.Transferred != int64(len(test.src)) {
+				t.Errorf("Wanted stats to cover %d bytes got %+v", len(test.src), stats)
+			}
+
+			if _, err := dst.Stat("/.file.delta"); !IsNotExist(err) {
+				t.Errorf("Expected temporary file to be removed got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// chtimer is implemented by FileSystems that can change the times of a file
+type chtimer interface {
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// copiedDir is a directory whose mode and time are set once its contents
+// have been copied
+type copiedDir struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// CopyFromDisk copies the directory tree at osPath on the operating system
+// filesystem to dstRoot in dst, which is created if needed.  Modes and
+// modification times are preserved, the latter when dst has a Chtimes
+// method, as memfs does.  Symbolic links are copied as links, with their
+// targets unchanged, and fail with ErrNotSupported if dst cannot create
+// them.  Devices, pipes and sockets are skipped.  This makes fixtures kept
+// in testdata safe to change from a test:
+//
+//	fs := vfs.NewMemFs()
+//	err := vfs.CopyFromDisk(fs, "/", "testdata/fixture")
+func CopyFromDisk(dst FileSystem, dstRoot, osPath string) error {
+	dstRoot = Clean(dstRoot)
+	var dirs []copiedDir
+	err := filepath.Walk(osPath, func(osName string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(osPath, osName)
+		if err != nil {
+			return err
+		}
+
+		name := path.Join(dstRoot, filepath.ToSlash(rel))
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err = MkdirAll(dst, name, mode.Perm()|0700); err == nil {
+				dirs = append(dirs, copiedDir{name, mode.Perm(), info.ModTime()})
+			}
+		case mode&os.ModeSymlink != 0:
+			err = copyLinkFromDisk(dst, name, osName)
+		case mode.IsRegular():
+			if err = copyFileFromDisk(dst, name, osName, mode.Perm()); err == nil {
+				err = setModTime(dst, name, info.ModTime())
+			}
+		}
+		return err
+	})
+
+	for i := len(dirs) - 1; i >= 0 && err == nil; i-- {
+		if err = dst.Chmod(dirs[i].name, dirs[i].mode); err == nil {
+			err = setModTime(dst, dirs[i].name, dirs[i].modTime)
+		}
+	}
+	return fixErr(err)
+}
+
+// copyFileFromDisk copies the contents of the operating system file osName
+// to name in dst
+func copyFileFromDisk(dst FileSystem, name, osName string, perm os.FileMode) error {
+	r, err := os.Open(osName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := dst.OpenFile(name, WrOnlyFlag|CreateFlag|TruncFlag, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	if closer, ok := w.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+
+	if err == nil {
+		err = dst.Chmod(name, perm)
+	}
+	return err
+}
+
+// copyLinkFromDisk recreates the operating system symbolic link osName as
+// name in dst
+func copyLinkFromDisk(dst FileSystem, name, osName string) error {
+	linker, ok := dst.(symlinker)
+	if !ok {
+		return &LinkError{Op: "symlink", Old: osName, New: name, Cause: ErrNotSupported}
+	}
+
+	target, err := os.Readlink(osName)
+	if err == nil {
+		if _, err = dst.Lstat(name); err == nil {
+			err = dst.Remove(name)
+		} else if IsNotExist(err) {
+			err = nil
+		}
+	}
+
+	if err == nil {
+		err = linker.Symlink(filepath.ToSlash(target), name)
+	}
+	return err
+}
+
+// setModTime sets the modification time of name if fs supports it
+func setModTime(fs FileSystem, name string, modTime time.Time) error {
+	if chtimer, ok := fs.(chtimer); ok {
+		return chtimer.Chtimes(name, modTime, modTime)
+	}
+	return nil
+}
+
+// CopyToDisk copies the tree rooted at srcRoot in src to the directory
+// osPath on the operating system filesystem, which is created if needed.  It
+// is the inverse of CopyFromDisk: modes and modification times are preserved
+// and symbolic links are recreated, with their targets unchanged, when src
+// can read them.  Files already at osPath are overwritten and entries of a
+// different type are replaced.  Nothing is written through symbolic links
+// already on disk
+func CopyToDisk(src FileSystem, srcRoot, osPath string) error {
+	srcRoot = Clean(srcRoot)
+	var dirs []copiedDir
+	err := Walk(src, srcRoot, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel := Rel(srcRoot, name)
+		osName := filepath.Join(osPath, filepath.FromSlash(rel))
+		mode := info.Mode()
+		if err = replaceOnDisk(osName, mode); err != nil {
+			return err
+		}
+
+		switch {
+		case mode.IsDir():
+			if err = os.MkdirAll(osName, mode.Perm()|0700); err == nil {
+				dirs = append(dirs, copiedDir{osName, mode.Perm(), info.ModTime()})
+			}
+		case mode&os.ModeSymlink != 0:
+			if reader, ok := src.(linkReader); ok {
+				var target string
+				if target, err = reader.Readlink(name); err == nil {
+					err = os.Symlink(filepath.FromSlash(target), osName)
+				}
+			}
+		case mode.IsRegular():
+			if err = copyFileToDisk(src, name, osName, mode.Perm()); err == nil {
+				err = os.Chtimes(osName, info.ModTime(), info.ModTime())
+			}
+		}
+		return err
+	})
+
+	for i := len(dirs) - 1; i >= 0 && err == nil; i-- {
+		if err = os.Chmod(dirs[i].name, dirs[i].mode); err == nil {
+			err = os.Chtimes(dirs[i].name, dirs[i].modTime, dirs[i].modTime)
+		}
+	}
+	return fixErr(err)
+}
+
+// replaceOnDisk removes whatever is at osName unless it can be reused for
+// an entry of the given mode, which only directories and regular files can
+func replaceOnDisk(osName string, mode os.FileMode) error {
+	current, err := os.Lstat(osName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if current.Mode().Type() == mode.Type() && (mode.IsDir() || mode.IsRegular()) {
+		return nil
+	}
+	return os.RemoveAll(osName)
+}
+
+// copyFileToDisk copies the contents of name in src to the operating system
+// file osName
+func copyFileToDisk(src FileSystem, name, osName string, perm os.FileMode) error {
+	w, err := os.OpenFile(osName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm|0200)
+	if err != nil {
+		return err
+	}
+
+	err = copyTo(w, src, name)
+	if err1 := w.Close(); err == nil {
+		err = err1
+	}
+
+	if err == nil {
+		err = os.Chmod(osName, perm)
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// diskFixture creates a small tree in a temporary directory
+func diskFixture(t *testing.T) (string, time.Time) {
+	dir := t.TempDir()
+	modTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0755)
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0600)
+	os.WriteFile(filepath.Join(dir, "sub", "child.txt"), []byte("child"), 0644)
+	if err := os.Symlink("sub/child.txt", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+	os.Chtimes(filepath.Join(dir, "file.txt"), modTime, modTime)
+	os.Chtimes(filepath.Join(dir, "sub"), modTime, modTime)
+	os.Chmod(filepath.Join(dir, "sub"), 0750)
+	return dir, modTime
+}
+
+func TestCopyFromDisk(t *testing.T) {
+	dir, modTime := diskFixture(t)
+	fs := NewMemFs()
+	if err := CopyFromDisk(fs, "/fixture", dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		wantMode os.FileMode
+		wantData string
+		wantTime time.Time
+	}{
+		{"/fixture/file.txt", 0600, "hello", modTime},
+		{"/fixture/sub", os.ModeDir | 0750, "", modTime},
+		{"/fixture/sub/empty", os.ModeDir | 0755, "", time.Time{}},
+		{"/fixture/sub/child.txt", 0644, "child", time.Time{}},
+		{"/fixture/link", os.ModeSymlink, "", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := fs.Lstat(test.name)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := info.Mode(); got&os.ModeType != test.wantMode&os.ModeType || (got&os.ModeSymlink == 0 && got != test.wantMode) {
+				t.Errorf("Wanted mode %v got %v", test.wantMode, got)
+			}
+
+			if !test.wantTime.IsZero() && !info.ModTime().Equal(test.wantTime) {
+				t.Errorf("Wanted time %v got %v", test.wantTime, info.ModTime())
+			}
+
+			if info.Mode().IsRegular() {
+				if data, _ := ReadFile(fs, test.name); string(data) != test.wantData {
+					t.Errorf("Wanted %q got %q", test.wantData, data)
+				}
+			}
+		})
+	}
+
+	if data, _ := ReadFile(fs, "/fixture/link"); string(data) != "child" {
+		t.Errorf("Wanted the link to resolve to %q got %q", "child", data)
+	}
+}
+
+func TestCopyFromDiskMissing(t *testing.T) {
+	err := CopyFromDisk(NewMemFs(), "/", filepath.Join(t.TempDir(), "missing"))
+	if !IsError(ErrNotExist, err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
+
+func TestCopyToDisk(t *testing.T) {
+	modTime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	fs, err := NewMemFsFromMap(map[string]*MapFile{
+		"/out/file.txt":      {Data: []byte("hello"), Mode: 0600, ModTime: modTime},
+		"/out/sub":           {Mode: os.ModeDir | 0750, ModTime: modTime},
+		"/out/sub/child.txt": {Data: []byte("child"), Mode: 0444},
+		"/out/link":          {Data: []byte("sub/child.txt"), Mode: os.ModeSymlink | 0777},
+		"/other":             {Data: []byte("not copied")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	os.WriteFile(victim, []byte("untouched"), 0644)
+	os.Mkdir(filepath.Join(dir, "out"), 0755)
+	if err := os.Symlink(victim, filepath.Join(dir, "out", "file.txt")); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+
+	if err = CopyToDisk(fs, "/out", filepath.Join(dir, "out")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		wantMode os.FileMode
+		wantData string
+		wantTime time.Time
+	}{
+		{"file.txt", 0600, "hello", modTime},
+		{"sub", os.ModeDir | 0750, "", modTime},
+		{"sub/child.txt", 0444, "child", time.Time{}},
+		{"link", os.ModeSymlink, "", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			osName := filepath.Join(dir, "out", filepath.FromSlash(test.name))
+			info, err := os.Lstat(osName)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := info.Mode(); got&os.ModeType != test.wantMode&os.ModeType || (got&os.ModeSymlink == 0 && got != test.wantMode) {
+				t.Errorf("Wanted mode %v got %v", test.wantMode, got)
+			}
+
+			if !test.wantTime.IsZero() && !info.ModTime().Equal(test.wantTime) {
+				t.Errorf("Wanted time %v got %v", test.wantTime, info.ModTime())
+			}
+
+			if info.Mode().IsRegular() {
+				if data, _ := os.ReadFile(osName); string(data) != test.wantData {
+					t.Errorf("Wanted %q got %q", test.wantData, data)
+				}
+			}
+		})
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "out", "link")); string(data) != "child" {
+		t.Errorf("Wanted the link to resolve to %q got %q", "child", data)
+	}
+
+	if data, _ := os.ReadFile(victim); string(data) != "untouched" {
+		t.Errorf("Wanted the existing link not to be written through got %q", data)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "other")); !os.IsNotExist(err) {
+		t.Errorf("Wanted only the subtree to be copied got %v", err)
+	}
+}
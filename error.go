@@ -3,9 +3,25 @@ package vfs
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 )
 
+// vfsError is a sentinel error that also matches the equivalent error of
+// the standard library with errors.Is, so that callers can check for
+// fs.ErrNotExist and friends regardless of the FileSystem in use
+type vfsError struct {
+	msg string
+	std error
+}
+
+func newError(msg string, std error) error { return &vfsError{msg: msg, std: std} }
+
+func (e *vfsError) Error() string { return e.msg }
+
+// Is reports whether target is the standard library equivalent of e
+func (e *vfsError) Is(target error) bool { return target == e.std }
+
 var (
 	// ErrInvalidFlags indicates that the OpenFlags are set to an invalid combination.  For instance,
 	// the O_WRONLY and O_RDWR flags were both set
@@ -27,10 +43,10 @@ var (
 	ErrWhence = errors.New("invalid value for whence")
 
 	// ErrExist is returned when a file exists but an exclusive create was attempted
-	ErrExist = errors.New("file already exists")
+	ErrExist = newError("file already exists", fs.ErrExist)
 
 	// ErrNotExist indicates a file was not found
-	ErrNotExist = errors.New("no such file or directory")
+	ErrNotExist = newError("no such file or directory", fs.ErrNotExist)
 
 	// ErrNotDir indicates a file is not a directory when a directory operation was
 	// called (such as Readdirnames)
@@ -40,6 +56,10 @@ var (
 	// by directories when file I/O operations (read, write, seek) are called
 	ErrIsDir = errors.New("The path specified is a directory")
 
+	// ErrNotEmpty is returned when removing, or renaming over, a directory
+	// that still has entries
+	ErrNotEmpty = errors.New("directory not empty")
+
 	// ErrBadPattern indicates a pattern was malformed.
 	ErrBadPattern = errors.New("syntax error in pattern")
 
@@ -48,33 +68,121 @@ var (
 	ErrSize = errors.New("invalid size")
 
 	// ErrClosed indicates a file was already closed and cannot be closed again
-	ErrClosed = errors.New("file already closed")
+	ErrClosed = newError("file already closed", fs.ErrClosed)
+
+	// ErrImageFormat is returned when loading a filesystem image that is not
+	// recognized or was written by an unsupported version
+	ErrImageFormat = errors.New("unrecognized filesystem image")
+
+	// ErrChecksum indicates the contents of a filesystem image do not match
+	// the digest recorded in the image
+	ErrChecksum = errors.New("filesystem image checksum mismatch")
+
+	// ErrSignature indicates a filesystem image signature is missing or could
+	// not be verified with the given public key
+	ErrSignature = errors.New("filesystem image signature verification failed")
+
+	// ErrDisconnected is returned by connection managed filesystems when the
+	// connection to the backend was lost and could not be re-established
+	ErrDisconnected = errors.New("filesystem disconnected")
+
+	// ErrKeySize is returned when an encryption key is not the required length
+	ErrKeySize = errors.New("invalid key size")
+
+	// ErrDecrypt indicates that an encrypted file or name could not be
+	// decrypted, either because the wrong key was used or because it was
+	// modified
+	ErrDecrypt = errors.New("file could not be decrypted")
+
+	// ErrPermission indicates the permission bits of a file or directory do
+	// not allow the attempted operation
+	ErrPermission = newError("permission denied", fs.ErrPermission)
+
+	// ErrNoSpace is returned when a FileSystem has reached its capacity
+	ErrNoSpace = errors.New("no space left on device")
+
+	// ErrNotSupported is returned when a FileSystem or File does not implement
+	// the requested operation
+	ErrNotSupported = newError("operation not supported", errors.ErrUnsupported)
+
+	// ErrInsecurePath is returned when an archive entry or symbolic link
+	// would be extracted outside of the destination directory
+	ErrInsecurePath = errors.New("insecure path in archive")
+
+	// ErrBusy is returned when removing or replacing a memfs entry that a
+	// bind mount depends on
+	ErrBusy = errors.New("device or resource busy")
+
+	// ErrLoop is returned when following symbolic links leads back to a
+	// directory that is already being visited, or when resolving a path
+	// takes more symbolic links than are followed before giving up
+	ErrLoop = errors.New("too many levels of symbolic links")
+
+	// ErrFileTooLarge is returned when a write would grow a file past the
+	// largest size allowed
+	ErrFileTooLarge = errors.New("file too large")
+
+	// ErrInvalidName is returned when a NameValidator rejects the name of a
+	// file being created
+	ErrInvalidName = errors.New("invalid file name")
+
+	// ErrNameTooLong is returned when the name of a file is longer than
+	// allowed
+	ErrNameTooLong = errors.New("file name too long")
+
+	// ErrBrokenPipe is returned when writing to a named pipe that nobody has
+	// open for reading
+	ErrBrokenPipe = errors.New("broken pipe")
+
+	// ErrInvalid is returned for an invalid argument, such as renaming a
+	// directory into its own subtree
+	ErrInvalid = newError("invalid argument", fs.ErrInvalid)
 )
 
 // IsExist returns a boolean indicating whether the error is known to report
 // that a file or directory already exists. It is satisfied by ErrExist as
 // well as some syscall errors.
 func IsExist(err error) bool {
-	// accomodate OsFs
-	return IsError(ErrExist, err) || os.IsExist(err)
+	// accomodate OsFs, whose syscall errors match the fs errors
+	return errors.Is(err, fs.ErrExist) || os.IsExist(err)
 }
 
 // IsNotExist returns a boolean indicating whether the error is known to
 // report that a file or directory does not exist. It is satisfied by
 // ErrNotExist as well as some syscall errors.
 func IsNotExist(err error) bool {
-	// accomodate OsFs
-	return IsError(ErrNotExist, err) || os.IsNotExist(err)
+	// accomodate OsFs, whose syscall errors match the fs errors
+	return errors.Is(err, fs.ErrNotExist) || os.IsNotExist(err)
+}
+
+// IsPermission returns a boolean indicating whether the error is known to
+// report that permission is denied. It is satisfied by ErrPermission as
+// well as some syscall errors.
+func IsPermission(err error) bool {
+	// accomodate OsFs, whose syscall errors match the fs errors
+	return errors.Is(err, fs.ErrPermission) || os.IsPermission(err)
 }
 
 // IsError will check to see if got is the same type of
-// error as want.  If got is a *PathError then IsError will
-// compare the underlying *PathError.Cause
+// error as want.  If got is a *PathError, *LinkError or any other error
+// wrapping a cause then IsError will compare the underlying cause.  It is
+// equivalent to errors.Is(got, want)
 func IsError(want, got error) bool {
-	if pe, ok := got.(*PathError); ok {
-		got = pe.cause()
+	return errors.Is(got, want)
+}
+
+// errorCause strips any *PathError and *LinkError wrapping from err
+func errorCause(err error) error {
+	for {
+		switch e := err.(type) {
+		case *PathError:
+			err = e.Cause
+		case *LinkError:
+			err = e.Cause
+		default:
+			return err
+		}
 	}
-	return want == got
 }
 
 // PathError represents an error that occured while performing an operation
@@ -95,10 +203,29 @@ func (pe *PathError) Error() string {
 	return fmt.Sprintf("%s %s: %v", pe.Op, pe.Path, pe.Cause)
 }
 
-func (pe *PathError) cause() error {
-	err := pe.Cause
-	if pe, ok := err.(*PathError); ok {
-		err = pe.cause()
-	}
-	return err
+// Unwrap returns the cause of the error for use with errors.Is and errors.As
+func (pe *PathError) Unwrap() error { return pe.Cause }
+
+// LinkError records an error that occurred during an operation involving
+// two paths, such as Rename or Symlink
+type LinkError struct {
+	// Op is the name of the operation where the error occurred
+	Op string
+
+	// Old is the existing path, or the target of a symbolic link
+	Old string
+
+	// New is the path being created
+	New string
+
+	// Cause is the underlying error that occurred (ErrExist, ErrNotDir, etc)
+	Cause error
+}
+
+// Error returns information about the operation and paths where an error occurred
+func (le *LinkError) Error() string {
+	return fmt.Sprintf("%s %s %s: %v", le.Op, le.Old, le.New, le.Cause)
 }
+
+// Unwrap returns the cause of the error for use with errors.Is and errors.As
+func (le *LinkError) Unwrap() error { return le.Cause }
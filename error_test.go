@@ -1,8 +1,11 @@
 package vfs
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"syscall"
 	"testing"
 )
 
@@ -18,6 +21,9 @@ func TestIsError(t *testing.T) {
 		{"multi-indirect match", ErrExist, &PathError{Cause: &PathError{Cause: ErrExist}}, true},
 		{"no direct match", ErrExist, ErrNotExist, false},
 		{"no indirect match", ErrExist, &PathError{Cause: ErrNotExist}, false},
+		{"link match", ErrExist, &LinkError{Cause: ErrExist}, true},
+		{"link in path match", ErrExist, &PathError{Cause: &LinkError{Cause: ErrExist}}, true},
+		{"no link match", ErrExist, &LinkError{Cause: ErrNotExist}, false},
 	}
 
 	for _, test := range tests {
@@ -43,6 +49,8 @@ func TestIsExist(t *testing.T) {
 		{"IsNotExist(ErrNotExist)", ErrNotExist, IsNotExist, true},
 		{"IsNotExist(os.ErrNotExist)", os.ErrNotExist, IsNotExist, true},
 		{"IsNotExist(ErrExist)", ErrExist, IsNotExist, false},
+		{"IsNotExist(wrapped ENOENT)", &PathError{Cause: syscall.ENOENT}, IsNotExist, true},
+		{"IsPermission(wrapped ErrPermission)", fmt.Errorf("open: %w", &PathError{Cause: ErrPermission}), IsPermission, true},
 	}
 
 	for _, test := range tests {
@@ -55,6 +63,40 @@ func TestIsExist(t *testing.T) {
 	}
 }
 
+func TestStdErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"ErrNotExist", ErrNotExist, fs.ErrNotExist, true},
+		{"ErrExist", ErrExist, fs.ErrExist, true},
+		{"ErrPermission", ErrPermission, fs.ErrPermission, true},
+		{"ErrClosed", ErrClosed, fs.ErrClosed, true},
+		{"ErrNotSupported", ErrNotSupported, errors.ErrUnsupported, true},
+		{"ErrNotExist is not ErrExist", ErrNotExist, fs.ErrExist, false},
+		{"PathError", &PathError{Cause: ErrNotExist}, ErrNotExist, true},
+		{"PathError std", &PathError{Cause: ErrNotExist}, fs.ErrNotExist, true},
+		{"LinkError", &LinkError{Cause: &PathError{Cause: ErrIsDir}}, ErrIsDir, true},
+		{"wrapped", fmt.Errorf("copying: %w", &PathError{Cause: ErrNoSpace}), ErrNoSpace, true},
+		{"memfs", func() error { _, err := NewMemFs().Open("/missing"); return err }(), fs.ErrNotExist, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := errors.Is(test.err, test.target); got != test.want {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+
+	var le *LinkError
+	if err := fmt.Errorf("wrapped: %w", &LinkError{Op: "rename"}); !errors.As(err, &le) || le.Op != "rename" {
+		t.Errorf("Wanted errors.As to find the *LinkError in %v", err)
+	}
+}
+
 func TestPathErrorString(t *testing.T) {
 	err := &PathError{Op: "mkdir", Path: "/foo/bar", Cause: ErrNotExist}
 	want := fmt.Sprintf("mkdir /foo/bar: no such file or directory")
@@ -62,3 +104,54 @@ func TestPathErrorString(t *testing.T) {
 		t.Errorf("Wanted error string %q got %q", want, err.Error())
 	}
 }
+
+func TestLinkErrorString(t *testing.T) {
+	err := &LinkError{Op: "rename", Old: "/foo", New: "/bar", Cause: ErrNotExist}
+	want := "rename /foo /bar: no such file or directory"
+	if err.Error() != want {
+		t.Errorf("Wanted error string %q got %q", want, err.Error())
+	}
+}
+
+func TestLinkErrorOps(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/file", nil, 0644)
+	fs.Mkdir("/dir", 0755)
+	WriteFile(fs, "/dir/child", nil, 0644)
+
+	tests := []struct {
+		name  string
+		op    func() error
+		old   string
+		new   string
+		cause error
+	}{
+		{"rename missing", func() error { return fs.Rename("/missing", "/other") }, "/missing", "/other", ErrNotExist},
+		{"rename over dir", func() error { return fs.Rename("/file", "/dir") }, "/file", "/dir", ErrIsDir},
+		{"rename missing parent", func() error { return fs.Rename("/file", "/nodir/file") }, "/file", "/nodir/file", ErrNotExist},
+		{"symlink exists", func() error { return fs.(*memfs).Symlink("/target", "/file") }, "/target", "/file", ErrExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.op()
+			le, ok := err.(*LinkError)
+			if !ok {
+				t.Fatalf("Wanted *LinkError got %T %v", err, err)
+			}
+
+			if le.Old != test.old || le.New != test.new {
+				t.Errorf("Wanted paths %s %s got %s %s", test.old, test.new, le.Old, le.New)
+			}
+
+			if !IsError(test.cause, err) {
+				t.Errorf("Wanted %v got %v", test.cause, err)
+			}
+		})
+	}
+
+	err := fixErr(&os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: os.ErrNotExist})
+	if le, ok := err.(*LinkError); !ok || le.Old != "/a" || le.New != "/b" || !IsError(ErrNotExist, err) {
+		t.Errorf("Wanted *LinkError with ErrNotExist got %T %v", err, err)
+	}
+}
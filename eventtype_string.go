@@ -14,6 +14,7 @@ func _() {
 	_ = x[RenameEvent-8]
 	_ = x[AttributeEvent-16]
 	_ = x[ErrorEvent-32]
+	_ = x[OverflowEvent-64]
 }
 
 const (
@@ -22,6 +23,7 @@ const (
 	_EventType_name_2 = "RenameEvent"
 	_EventType_name_3 = "AttributeEvent"
 	_EventType_name_4 = "ErrorEvent"
+	_EventType_name_5 = "OverflowEvent"
 )
 
 var (
@@ -41,6 +43,8 @@ func (i EventType) String() string {
 		return _EventType_name_3
 	case i == 32:
 		return _EventType_name_4
+	case i == 64:
+		return _EventType_name_5
 	default:
 		return "EventType(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
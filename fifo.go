@@ -0,0 +1,194 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sync"
+)
+
+// fifoBuffer is how much a named pipe holds before writers block
+const fifoBuffer = 64 * 1024
+
+// fifoAtomic is the size up to which writes to a named pipe are never
+// interleaved with those of other writers, as with PIPE_BUF
+const fifoAtomic = 4096
+
+// memFifo is the pipe shared by the open handles of a named pipe
+type memFifo struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+
+	// readers and writers count the handles open for each end, opens counts
+	// every open of each end so that an open waiting for the other end also
+	// notices one that came and went in the meantime
+	readers    int
+	writers    int
+	readOpens  int
+	writeOpens int
+}
+
+// Mkfifo creates a named pipe with the given permission bits (before umask).
+// Opening a named pipe for reading blocks until it is opened for writing and
+// the other way around, a handle opened with RdWrFlag does not block.  Reads
+// block until there is data and return io.EOF once every writer has closed
+// the pipe, writes block while the pipe is full and fail with ErrBrokenPipe
+// once every reader has closed it.  ReadAt, WriteAt and Seek fail with
+// ErrNotSupported.  The FileSystem returned by NewMemFs can be asserted to
+// interface{ Mkfifo(string, os.FileMode) error } to reach it
+func (fs *memfs) Mkfifo(name string, perm os.FileMode) error {
+	name = Clean(name)
+	if fs.readOnly.Load() {
+		return &PathError{"mkfifo", name, ErrReadOnly}
+	}
+
+	if _, err := fs.find(name); err == nil {
+		return &PathError{"mkfifo", name, ErrExist}
+	}
+
+	parent, err := fs.resolve(path.Dir(name))
+	if err != nil {
+		return &PathError{"mkfifo", name, err}
+	} else if !parent.IsDir() {
+		return &PathError{"mkfifo", name, ErrNotDir}
+	} else if err = fs.access(parent, permWrite|permExec); err != nil {
+		return &PathError{"mkfifo", name, err}
+	}
+
+	if _, _, err = fs.create(path.Base(name), parent, os.ModeNamedPipe|perm&os.ModePerm); err != nil {
+		return &PathError{"mkfifo", name, err}
+	}
+	return nil
+}
+
+// openFifo turns file into a handle of the named pipe it refers to, waiting
+// for the other end to be opened
+func openFifo(file *memFile, flag OpenFlag) *memFifoFile {
+	inode := file.inode
+	inode.Lock()
+	if inode.fifo == nil {
+		inode.fifo = &memFifo{}
+		inode.fifo.cond = sync.NewCond(&inode.fifo.mu)
+	}
+	fifo := inode.fifo
+	inode.Unlock()
+
+	read, write := flag.accessMode() != WrOnlyFlag, flag.accessMode() != RdOnlyFlag
+	fifo.mu.Lock()
+	defer fifo.mu.Unlock()
+	if read {
+		fifo.readers++
+		fifo.readOpens++
+	}
+
+	if write {
+		fifo.writers++
+		fifo.writeOpens++
+	}
+	fifo.cond.Broadcast()
+
+	if read && !write {
+		for opens := fifo.writeOpens; fifo.writers == 0 && fifo.writeOpens == opens; {
+			fifo.cond.Wait()
+		}
+	} else if write && !read {
+		for opens := fifo.readOpens; fifo.readers == 0 && fifo.readOpens == opens; {
+			fifo.cond.Wait()
+		}
+	}
+	return &memFifoFile{memFile: file, fifo: fifo}
+}
+
+// memFifoFile is an open handle of a named pipe
+type memFifoFile struct {
+	*memFile
+	fifo *memFifo
+}
+
+func (f *memFifoFile) Read(p []byte) (n int, err error) {
+	if err = f.check(); err != nil {
+		return 0, err
+	} else if f.writeOnly {
+		return 0, ErrWriteOnly
+	} else if len(p) == 0 {
+		return 0, nil
+	}
+
+	f.fifo.mu.Lock()
+	defer f.fifo.mu.Unlock()
+	for len(f.fifo.buf) == 0 {
+		if f.fifo.writers == 0 {
+			return 0, io.EOF
+		}
+		f.fifo.cond.Wait()
+	}
+
+	n = copy(p, f.fifo.buf)
+	f.fifo.buf = f.fifo.buf[:copy(f.fifo.buf, f.fifo.buf[n:])]
+	f.fifo.cond.Broadcast()
+	return n, nil
+}
+
+func (f *memFifoFile) Write(p []byte) (n int, err error) {
+	if err = f.check(); err != nil {
+		return 0, err
+	} else if f.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	f.fifo.mu.Lock()
+	defer f.fifo.mu.Unlock()
+	for len(p) > 0 {
+		if f.fifo.readers == 0 {
+			return n, ErrBrokenPipe
+		}
+
+		// small writes wait until they fit as a whole
+		room := fifoBuffer - len(f.fifo.buf)
+		if room == 0 || (len(p) <= fifoAtomic && room < len(p)) {
+			f.fifo.cond.Wait()
+			continue
+		}
+
+		if room > len(p) {
+			room = len(p)
+		}
+		f.fifo.buf = append(f.fifo.buf, p[:room]...)
+		p = p[room:]
+		n += room
+		f.fifo.cond.Broadcast()
+	}
+	return n, nil
+}
+
+func (f *memFifoFile) ReadAt(p []byte, off int64) (int, error)  { return 0, ErrNotSupported }
+func (f *memFifoFile) WriteAt(p []byte, off int64) (int, error) { return 0, ErrNotSupported }
+func (f *memFifoFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// Close releases the handle's end of the pipe, waking up anyone waiting for
+// data or room that will now never come
+func (f *memFifoFile) Close() error {
+	if err := f.memFile.Close(); err != nil {
+		return err
+	}
+
+	f.fifo.mu.Lock()
+	if !f.writeOnly {
+		f.fifo.readers--
+	}
+
+	if !f.readOnly {
+		f.fifo.writers--
+	}
+
+	if f.fifo.readers == 0 && f.fifo.writers == 0 {
+		// like a pipe, what nobody read is gone once nobody has it open
+		f.fifo.buf = nil
+	}
+	f.fifo.cond.Broadcast()
+	f.fifo.mu.Unlock()
+	return nil
+}
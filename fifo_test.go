@@ -0,0 +1,123 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// mkfifoer reaches the Mkfifo method of memfs
+type mkfifoer interface {
+	Mkfifo(name string, perm os.FileMode) error
+}
+
+func newFifo(t *testing.T) FileSystem {
+	fs := NewMemFs()
+	if err := fs.(mkfifoer).Mkfifo("/fifo", 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return fs
+}
+
+func TestMemFsMkfifo(t *testing.T) {
+	fs := newFifo(t)
+	mkfifo := fs.(mkfifoer).Mkfifo
+	WriteFile(fs, "/file", nil, 0644)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{"exists", "/fifo", ErrExist},
+		{"missing parent", "/missing/fifo", ErrNotExist},
+		{"parent not a directory", "/file/fifo", ErrNotDir},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := mkfifo(test.path, 0644); !IsError(test.wantErr, err) {
+				t.Errorf("Wanted %v got %v", test.wantErr, err)
+			}
+		})
+	}
+
+	info, err := fs.Stat("/fifo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if want := os.ModeNamedPipe | 0644; info.Mode() != want {
+		t.Errorf("Wanted mode %v got %v", want, info.Mode())
+	}
+
+	snapshot := fs.(interface{ Snapshot() FileSystem }).Snapshot()
+	if err = snapshot.(mkfifoer).Mkfifo("/other", 0644); !IsError(ErrReadOnly, err) {
+		t.Errorf("Wanted %v got %v", ErrReadOnly, err)
+	}
+}
+
+func TestMemFsFifo(t *testing.T) {
+	fs := newFifo(t)
+	want := bytes.Repeat([]byte("0123456789"), 2*fifoBuffer/10)
+
+	// opening either end waits for the other
+	opened := make(chan File)
+	go func() {
+		f, _ := fs.Open("/fifo")
+		opened <- f
+	}()
+
+	select {
+	case <-opened:
+		t.Fatalf("Wanted the reader to wait for a writer")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	w, err := fs.OpenFile("/fifo", WrOnlyFlag, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := <-opened
+
+	// the writer blocks once the pipe is full and carries on as it is read
+	written := make(chan error)
+	go func() {
+		_, err := w.Write(want)
+		closeFile(w)
+		written <- err
+	}()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if !bytes.Equal(want, got) {
+		t.Errorf("Wanted %d bytes got %d", len(want), len(got))
+	}
+
+	if err = <-written; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if _, err = r.ReadAt(make([]byte, 1), 0); !IsError(ErrNotSupported, err) {
+		t.Errorf("Wanted %v got %v", ErrNotSupported, err)
+	}
+	closeFile(r)
+}
+
+func TestMemFsFifoBrokenPipe(t *testing.T) {
+	fs := newFifo(t)
+
+	// a handle opened for reading and writing opens without waiting
+	rw, err := fs.OpenFile("/fifo", RdWrFlag, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	w, _ := fs.OpenFile("/fifo", WrOnlyFlag, 0)
+	closeFile(rw)
+	if _, err = w.Write([]byte("nobody reads this")); !IsError(ErrBrokenPipe, err) {
+		t.Errorf("Wanted %v got %v", ErrBrokenPipe, err)
+	}
+	closeFile(w)
+}
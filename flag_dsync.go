@@ -0,0 +1,8 @@
+//go:build linux || darwin
+
+package vfs
+
+import "syscall"
+
+// dsyncFlag is the platform's O_DSYNC
+const dsyncFlag = syscall.O_DSYNC
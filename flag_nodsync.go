@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package vfs
+
+import "os"
+
+// dsyncFlag falls back to O_SYNC on platforms without O_DSYNC, since
+// synchronizing the metadata as well gives at least the same guarantee
+const dsyncFlag = os.O_SYNC
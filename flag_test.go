@@ -2,6 +2,7 @@ package vfs
 
 import (
 	"fmt"
+	"io"
 	"testing"
 )
 
@@ -14,11 +15,11 @@ func TestOpenFlagCheck(t *testing.T) {
 		{WrOnlyFlag, nil},
 		{RdWrFlag, nil},
 		{WrOnlyFlag | RdWrFlag, ErrInvalidFlags},
-		{RdOnlyFlag | AppendFlag, ErrInvalidFlags},
-		{RdOnlyFlag | CreateFlag, ErrInvalidFlags},
-		{RdOnlyFlag | ExclFlag, ErrInvalidFlags},
-		{RdOnlyFlag | TruncFlag, ErrInvalidFlags},
-		{RdOnlyFlag | AppendFlag | CreateFlag, ErrInvalidFlags},
+		{RdOnlyFlag | AppendFlag, nil},
+		{RdOnlyFlag | CreateFlag, nil},
+		{RdOnlyFlag | ExclFlag, nil},
+		{RdOnlyFlag | TruncFlag, nil},
+		{RdOnlyFlag | AppendFlag | CreateFlag, nil},
 		{RdWrFlag | AppendFlag, nil},
 		{RdWrFlag | CreateFlag, nil},
 		{RdWrFlag | ExclFlag, nil},
@@ -29,6 +30,11 @@ func TestOpenFlagCheck(t *testing.T) {
 		{WrOnlyFlag | ExclFlag, nil},
 		{WrOnlyFlag, nil},
 		{WrOnlyFlag | TruncFlag, nil},
+		{RdOnlyFlag | SyncFlag, nil},
+		{WrOnlyFlag | SyncFlag, nil},
+		{RdWrFlag | DsyncFlag, nil},
+		{RdOnlyFlag | CreateFlag | ExclFlag | SyncFlag, nil},
+		{WrOnlyFlag | RdWrFlag | SyncFlag, ErrInvalidFlags},
 	}
 
 	for i, test := range tests {
@@ -40,3 +46,133 @@ func TestOpenFlagCheck(t *testing.T) {
 		})
 	}
 }
+
+// errClass reduces an error to the categories that are comparable
+// between backends
+func errClass(err error) string {
+	switch {
+	case err == nil:
+		return "nil"
+	case IsExist(err):
+		return "exist"
+	case IsNotExist(err):
+		return "not exist"
+	}
+	return "error"
+}
+
+func TestOpenFlagParity(t *testing.T) {
+	flags := []OpenFlag{
+		RdOnlyFlag,
+		WrOnlyFlag,
+		RdWrFlag,
+		RdOnlyFlag | AppendFlag,
+		RdOnlyFlag | CreateFlag,
+		RdOnlyFlag | ExclFlag,
+		RdOnlyFlag | TruncFlag,
+		RdOnlyFlag | CreateFlag | ExclFlag,
+		WrOnlyFlag | ExclFlag,
+		WrOnlyFlag | TruncFlag,
+		WrOnlyFlag | CreateFlag | ExclFlag,
+		RdWrFlag | CreateFlag | TruncFlag,
+		RdWrFlag | AppendFlag,
+		RdOnlyFlag | SyncFlag,
+		WrOnlyFlag | CreateFlag | SyncFlag,
+		RdWrFlag | CreateFlag | DsyncFlag,
+	}
+
+	type result struct {
+		open  string
+		read  string
+		write string
+		size  int64
+	}
+
+	run := func(fs FileSystem, filename string, flag OpenFlag, exists bool) (r result) {
+		if exists {
+			WriteFile(fs, filename, []byte("data"), 0644)
+		}
+
+		f, err := fs.OpenFile(filename, flag, 0644)
+		r.open = errClass(err)
+		if err == nil {
+			_, err = f.Read(make([]byte, 1))
+			if err == io.EOF {
+				err = nil
+			}
+			r.read = errClass(err)
+			f.Seek(0, io.SeekEnd)
+			_, err = f.Write([]byte("x"))
+			r.write = errClass(err)
+			f.(io.Closer).Close()
+		}
+
+		r.size = -1
+		if fi, err := fs.Stat(filename); err == nil {
+			r.size = fi.Size()
+		}
+		return r
+	}
+
+	for i, flag := range flags {
+		for _, exists := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%d exists=%v", i, exists), func(t *testing.T) {
+				filename := fmt.Sprintf("/file%d", i)
+				mfs := NewMemFs()
+				tfs := NewTempFs()
+				defer tfs.Close()
+
+				want := run(tfs, filename, flag, exists)
+				got := run(mfs, filename, flag, exists)
+				if want != got {
+					t.Errorf("flag %x: wanted %+v got %+v", flag, want, got)
+				}
+			})
+		}
+	}
+
+	for i, flag := range []OpenFlag{RdOnlyFlag, RdOnlyFlag | AppendFlag, WrOnlyFlag, RdOnlyFlag | CreateFlag, RdOnlyFlag | TruncFlag, RdOnlyFlag | CreateFlag | ExclFlag, RdOnlyFlag | ExclFlag, RdOnlyFlag | SyncFlag} {
+		t.Run(fmt.Sprintf("dir %d", i), func(t *testing.T) {
+			mfs := NewMemFs()
+			tfs := NewTempFs()
+			defer tfs.Close()
+			mfs.Mkdir("/dir", 0755)
+			tfs.Mkdir("/dir", 0755)
+
+			_, want := tfs.OpenFile("/dir", flag, 0)
+			_, got := mfs.OpenFile("/dir", flag, 0)
+			if errClass(want) != errClass(got) {
+				t.Errorf("flag %x: wanted %v got %v", flag, want, got)
+			}
+		})
+	}
+}
+
+func TestOpenFlagString(t *testing.T) {
+	tests := []struct {
+		flag OpenFlag
+		want string
+	}{
+		{RdOnlyFlag, "O_RDONLY"},
+		{WrOnlyFlag | AppendFlag, "O_WRONLY|O_APPEND"},
+		{RdWrFlag | CreateFlag | ExclFlag, "O_RDWR|O_CREATE|O_EXCL"},
+		{WrOnlyFlag | RdWrFlag | TruncFlag, "O_WRONLY|O_RDWR|O_TRUNC"},
+		{RdWrFlag | SyncFlag, "O_RDWR|O_SYNC"},
+		{WrOnlyFlag | SyncFlag | DsyncFlag, "O_WRONLY|O_SYNC"},
+	}
+
+	if DsyncFlag != SyncFlag {
+		tests = append(tests, struct {
+			flag OpenFlag
+			want string
+		}{WrOnlyFlag | DsyncFlag, "O_WRONLY|O_DSYNC"})
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := test.flag.String(); got != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+// Package fusefs mounts a vfs.FileSystem with FUSE using
+// github.com/hanwen/go-fuse.  Once mounted, a memfs or any other backend can
+// be browsed and modified with ordinary OS tools.  When the FileSystem
+// supports watching, changes made through vfs are pushed to the kernel so
+// that its caches stay coherent.
+package fusefs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/mh-orange/vfs"
+)
+
+// toErrno converts a vfs error into the errno reported to the kernel
+func toErrno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+	case vfs.IsNotExist(err):
+		return syscall.ENOENT
+	case vfs.IsExist(err):
+		return syscall.EEXIST
+	case vfs.IsError(vfs.ErrNotDir, err):
+		return syscall.ENOTDIR
+	case vfs.IsError(vfs.ErrIsDir, err):
+		return syscall.EISDIR
+	case vfs.IsError(vfs.ErrReadOnly, err), vfs.IsError(vfs.ErrWriteOnly, err), vfs.IsError(vfs.ErrClosed, err):
+		return syscall.EBADF
+	case vfs.IsError(vfs.ErrInvalidSeek, err), vfs.IsError(vfs.ErrInvalidFlags, err), vfs.IsError(vfs.ErrInvalid, err):
+		return syscall.EINVAL
+	case vfs.IsError(vfs.ErrNotSupported, err):
+		return syscall.ENOTSUP
+	}
+
+	if pe, ok := err.(*vfs.PathError); ok {
+		err = pe.Cause
+	}
+	return gofs.ToErrno(err)
+}
+
+// toMode converts an os.FileMode into the mode bits of a stat structure
+func toMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		bits |= syscall.S_IFDIR
+	case mode&os.ModeSymlink != 0:
+		bits |= syscall.S_IFLNK
+	case mode&os.ModeNamedPipe != 0:
+		bits |= syscall.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		bits |= syscall.S_IFSOCK
+	case mode&os.ModeCharDevice != 0:
+		bits |= syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		bits |= syscall.S_IFBLK
+	default:
+		bits |= syscall.S_IFREG
+	}
+
+	if mode&os.ModeSetuid != 0 {
+		bits |= syscall.S_ISUID
+	}
+
+	if mode&os.ModeSetgid != 0 {
+		bits |= syscall.S_ISGID
+	}
+
+	if mode&os.ModeSticky != 0 {
+		bits |= syscall.S_ISVTX
+	}
+	return bits
+}
+
+// fillAttr copies a FileInfo into a FUSE attribute
+func fillAttr(info os.FileInfo, attr *fuse.Attr) {
+	attr.Mode = toMode(info.Mode())
+	attr.Size = uint64(info.Size())
+	attr.Blocks = (attr.Size + 511) / 512
+	modTime := info.ModTime()
+	attr.SetTimes(&modTime, &modTime, &modTime)
+}
+
+// linkReader is implemented by FileSystems that can read symbolic links
+type linkReader interface {
+	Readlink(name string) (string, error)
+}
+
+// mount is shared by every node of a mounted FileSystem
+type mount struct {
+	fs      vfs.FileSystem
+	root    *node
+	mu      sync.Mutex
+	watcher vfs.Watcher
+	watched map[string]bool
+}
+
+// node is a file or directory in the mounted FileSystem
+type node struct {
+	gofs.Inode
+	mount *mount
+}
+
+// NewRoot returns the root node of fs for use with go-fuse's fs.Mount or
+// fs.NewNodeFS.  Most callers should use Mount instead, the kernel is only
+// notified of changes made outside of the mount when it is used
+func NewRoot(fs vfs.FileSystem) gofs.InodeEmbedder {
+	m := &mount{fs: fs, watched: map[string]bool{vfs.PathSeparator: false}}
+	m.root = &node{mount: m}
+	return m.root
+}
+
+// Server is a mounted FileSystem
+type Server struct {
+	*fuse.Server
+	mount *mount
+}
+
+// Mount mounts fs at dir.  The returned Server must be unmounted with
+// Unmount, which also stops watching fs for changes
+func Mount(fs vfs.FileSystem, dir string, options *gofs.Options) (*Server, error) {
+	root := NewRoot(fs).(*node)
+	server, err := gofs.Mount(dir, root, options)
+	if err != nil {
+		return nil, err
+	}
+	root.mount.start()
+	return &Server{Server: server, mount: root.mount}, nil
+}
+
+// Unmount unmounts the FileSystem and stops watching it for changes
+func (s *Server) Unmount() error {
+	err := s.Server.Unmount()
+	s.mount.close()
+	return err
+}
+
+var (
+	_ = (gofs.NodeGetattrer)((*node)(nil))
+	_ = (gofs.NodeSetattrer)((*node)(nil))
+	_ = (gofs.NodeLookuper)((*node)(nil))
+	_ = (gofs.NodeReaddirer)((*node)(nil))
+	_ = (gofs.NodeOpener)((*node)(nil))
+	_ = (gofs.NodeCreater)((*node)(nil))
+	_ = (gofs.NodeMkdirer)((*node)(nil))
+	_ = (gofs.NodeUnlinker)((*node)(nil))
+	_ = (gofs.NodeRmdirer)((*node)(nil))
+	_ = (gofs.NodeRenamer)((*node)(nil))
+	_ = (gofs.NodeReadlinker)((*node)(nil))
+)
+
+// path returns the vfs path of the node
+func (n *node) path() string {
+	return path.Join(vfs.PathSeparator, n.Path(n.Root()))
+}
+
+// newChild creates the inode for a child described by info
+func (n *node) newChild(ctx context.Context, name string, info os.FileInfo, out *fuse.EntryOut) *gofs.Inode {
+	fillAttr(info, &out.Attr)
+	if info.IsDir() {
+		n.mount.watch(path.Join(n.path(), name))
+	}
+	child := &node{mount: n.mount}
+	return n.NewInode(ctx, child, gofs.StableAttr{Mode: toMode(info.Mode()) & syscall.S_IFMT})
+}
+
+func (n *node) Getattr(ctx context.Context, fh gofs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := n.mount.fs.Lstat(n.path())
+	if err != nil {
+		return toErrno(err)
+	}
+	fillAttr(info, &out.Attr)
+	return 0
+}
+
+// Setattr supports changing the mode and truncating.  Truncating to a size
+// other than zero requires the vfs.File to have a Truncate method
+func (n *node) Setattr(ctx context.Context, fh gofs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if mode, ok := in.GetMode(); ok {
+		if err := n.mount.fs.Chmod(n.path(), os.FileMode(mode).Perm()); err != nil {
+			return toErrno(err)
+		}
+	}
+
+	if size, ok := in.GetSize(); ok {
+		if errno := n.truncate(fh, int64(size)); errno != 0 {
+			return errno
+		}
+	}
+	return n.Getattr(ctx, fh, out)
+}
+
+func (n *node) truncate(fh gofs.FileHandle, size int64) syscall.Errno {
+	type truncater interface{ Truncate(int64) error }
+	if h, ok := fh.(*handle); ok {
+		if t, ok := h.file.(truncater); ok {
+			return toErrno(t.Truncate(size))
+		}
+	}
+
+	flag := vfs.WrOnlyFlag
+	if size == 0 {
+		flag |= vfs.TruncFlag
+	}
+
+	f, err := n.mount.fs.OpenFile(n.path(), flag, 0)
+	if err != nil {
+		return toErrno(err)
+	}
+	defer closeFile(f)
+
+	if t, ok := f.(truncater); ok {
+		return toErrno(t.Truncate(size))
+	} else if size != 0 {
+		return syscall.ENOTSUP
+	}
+	return 0
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	info, err := n.mount.fs.Lstat(path.Join(n.path(), name))
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, name, info, out), 0
+}
+
+func (n *node) Readdir(ctx context.Context) (gofs.DirStream, syscall.Errno) {
+	dir, err := n.mount.fs.Open(n.path())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	defer closeFile(dir)
+
+	infos, err := dir.Readdir(-1)
+	if err != nil && err != io.EOF {
+		return nil, toErrno(err)
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fuse.DirEntry{Name: info.Name(), Mode: toMode(info.Mode())})
+	}
+	return gofs.NewListDirStream(entries), 0
+}
+
+// openFlag converts open(2) flags into a vfs.OpenFlag, dropping flags
+// that only concern the kernel
+func openFlag(flags uint32) vfs.OpenFlag {
+	return vfs.OpenFlag(flags & (syscall.O_ACCMODE | syscall.O_APPEND | syscall.O_CREAT | syscall.O_EXCL | syscall.O_TRUNC))
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (gofs.FileHandle, uint32, syscall.Errno) {
+	f, err := n.mount.fs.OpenFile(n.path(), openFlag(flags), 0)
+	if err != nil {
+		return nil, 0, toErrno(err)
+	}
+	return &handle{file: f}, 0, 0
+}
+
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*gofs.Inode, gofs.FileHandle, uint32, syscall.Errno) {
+	filename := path.Join(n.path(), name)
+	f, err := n.mount.fs.OpenFile(filename, openFlag(flags)|vfs.CreateFlag, os.FileMode(mode).Perm())
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+
+	info, err := n.mount.fs.Lstat(filename)
+	if err != nil {
+		closeFile(f)
+		return nil, nil, 0, toErrno(err)
+	}
+	return n.newChild(ctx, name, info, out), &handle{file: f}, 0, 0
+}
+
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	dirname := path.Join(n.path(), name)
+	if err := n.mount.fs.Mkdir(dirname, os.FileMode(mode).Perm()); err != nil {
+		return nil, toErrno(err)
+	}
+
+	info, err := n.mount.fs.Lstat(dirname)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, name, info, out), 0
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	return toErrno(n.mount.fs.Remove(path.Join(n.path(), name)))
+}
+
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	dirname := path.Join(n.path(), name)
+	n.mount.unwatch(dirname)
+	return toErrno(n.mount.fs.Remove(dirname))
+}
+
+func (n *node) Rename(ctx context.Context, name string, newParent gofs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if flags != 0 {
+		return syscall.ENOTSUP
+	}
+
+	parent := newParent.(*node)
+	return toErrno(n.mount.fs.Rename(path.Join(n.path(), name), path.Join(parent.path(), newName)))
+}
+
+func (n *node) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	reader, ok := n.mount.fs.(linkReader)
+	if !ok {
+		return nil, syscall.ENOTSUP
+	}
+
+	target, err := reader.Readlink(n.path())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return []byte(target), 0
+}
+
+// handle is an open vfs.File
+type handle struct {
+	mu   sync.Mutex
+	file vfs.File
+}
+
+var (
+	_ = (gofs.FileReader)((*handle)(nil))
+	_ = (gofs.FileWriter)((*handle)(nil))
+	_ = (gofs.FileFsyncer)((*handle)(nil))
+	_ = (gofs.FileReleaser)((*handle)(nil))
+)
+
+func (h *handle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.file.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, toErrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *handle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.file.WriteAt(data, off)
+	return uint32(n), toErrno(err)
+}
+
+// Fsync calls Sync on files that support it
+func (h *handle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if syncer, ok := h.file.(interface{ Sync() error }); ok {
+		return toErrno(syncer.Sync())
+	}
+	return 0
+}
+
+func (h *handle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return toErrno(closeFile(h.file))
+}
+
+func closeFile(f vfs.File) error {
+	if closer, ok := f.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// start creates the watcher and watches every directory the kernel has
+// looked up so far.  FileSystems that cannot be watched are silently ignored
+func (m *mount) start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := make(chan vfs.Event, 64)
+	watcher, err := m.fs.Watcher(events)
+	if err != nil {
+		return
+	}
+	m.watcher = watcher
+	go m.notify(events)
+
+	for dirname := range m.watched {
+		m.watched[dirname] = watcher.Watch(dirname) == nil
+	}
+}
+
+// watch records a directory known to the kernel and watches it for changes
+// once the watcher has been started
+func (m *mount) watch(dirname string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watched == nil || m.watched[dirname] {
+		return
+	}
+
+	m.watched[dirname] = m.watcher != nil && m.watcher.Watch(dirname) == nil
+}
+
+func (m *mount) unwatch(dirname string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watched[dirname] {
+		m.watcher.Remove(dirname)
+	}
+	delete(m.watched, dirname)
+}
+
+func (m *mount) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watcher != nil {
+		m.watcher.Close()
+		m.watcher = nil
+	}
+	m.watched = nil
+}
+
+// lookup returns the inode for a vfs path if the kernel knows about it
+func (m *mount) lookup(filename string) *gofs.Inode {
+	inode := m.root.EmbeddedInode()
+	for _, name := range splitPath(filename) {
+		if inode = inode.GetChild(name); inode == nil {
+			return nil
+		}
+	}
+	return inode
+}
+
+func splitPath(filename string) (names []string) {
+	for filename = path.Clean(filename); filename != vfs.PathSeparator && filename != "."; filename = path.Dir(filename) {
+		names = append([]string{path.Base(filename)}, names...)
+	}
+	return names
+}
+
+// notify invalidates kernel caches for changes made outside of the mount
+func (m *mount) notify(events <-chan vfs.Event) {
+	for event := range events {
+		if event.Type == vfs.ErrorEvent {
+			continue
+		}
+
+		if parent := m.lookup(path.Dir(event.Path)); parent != nil {
+			parent.NotifyEntry(path.Base(event.Path))
+		}
+
+		if event.Type&(vfs.ModifyEvent|vfs.AttributeEvent) != 0 {
+			if inode := m.lookup(event.Path); inode != nil {
+				inode.NotifyContent(0, 0)
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package fusefs
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/mh-orange/vfs"
+)
+
+func TestToErrno(t *testing.T) {
+	tests := []struct {
+		name  string
+		input error
+		want  syscall.Errno
+	}{
+		{"nil", nil, 0},
+		{"not exist", &vfs.PathError{Op: "open", Path: "/foo", Cause: vfs.ErrNotExist}, syscall.ENOENT},
+		{"exist", &vfs.PathError{Op: "open", Path: "/foo", Cause: vfs.ErrExist}, syscall.EEXIST},
+		{"not dir", &vfs.PathError{Op: "open", Path: "/foo", Cause: vfs.ErrNotDir}, syscall.ENOTDIR},
+		{"is dir", &vfs.PathError{Op: "read", Path: "/foo", Cause: vfs.ErrIsDir}, syscall.EISDIR},
+		{"read only", &vfs.PathError{Op: "write", Path: "/foo", Cause: vfs.ErrReadOnly}, syscall.EBADF},
+		{"not supported", vfs.ErrNotSupported, syscall.ENOTSUP},
+		{"syscall", &vfs.PathError{Op: "open", Path: "/foo", Cause: syscall.EACCES}, syscall.EACCES},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := toErrno(test.input); got != test.want {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestToMode(t *testing.T) {
+	tests := []struct {
+		input os.FileMode
+		want  uint32
+	}{
+		{0644, syscall.S_IFREG | 0644},
+		{os.ModeDir | 0755, syscall.S_IFDIR | 0755},
+		{os.ModeSymlink | 0777, syscall.S_IFLNK | 0777},
+		{os.ModeDir | os.ModeSticky | 0777, syscall.S_IFDIR | syscall.S_ISVTX | 0777},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input.String(), func(t *testing.T) {
+			if got := toMode(test.input); got != test.want {
+				t.Errorf("Wanted %o got %o", test.want, got)
+			}
+		})
+	}
+}
+
+// newTestRoot returns the root node of fs attached to a go-fuse bridge
+// without mounting it
+func newTestRoot(t *testing.T, fs vfs.FileSystem) *node {
+	root := NewRoot(fs).(*node)
+	gofs.NewNodeFS(root, &gofs.Options{})
+	t.Cleanup(root.mount.close)
+	return root
+}
+
+func TestNode(t *testing.T) {
+	ctx := context.Background()
+	fs := vfs.NewMemFs()
+	fs.Mkdir("/dir", 0755)
+	vfs.WriteFile(fs, "/dir/hello.txt", []byte("hello"), 0644)
+	root := newTestRoot(t, fs)
+
+	var entry fuse.EntryOut
+	inode, errno := root.Lookup(ctx, "dir", &entry)
+	if errno != 0 {
+		t.Fatalf("Unexpected errno: %v", errno)
+	} else if entry.Attr.Mode&syscall.S_IFDIR == 0 {
+		t.Errorf("Wanted a directory got mode %o", entry.Attr.Mode)
+	}
+	// the kernel bridge links looked up inodes into the tree
+	root.AddChild("dir", inode, false)
+	dir := inode.Operations().(*node)
+
+	if _, errno = root.Lookup(ctx, "missing", &entry); errno != syscall.ENOENT {
+		t.Errorf("Wanted ENOENT got %v", errno)
+	}
+
+	stream, errno := dir.Readdir(ctx)
+	if errno != 0 {
+		t.Fatalf("Unexpected errno: %v", errno)
+	}
+
+	var names []string
+	for stream.HasNext() {
+		e, _ := stream.Next()
+		names = append(names, e.Name)
+	}
+
+	if len(names) != 1 || names[0] != "hello.txt" {
+		t.Errorf("Wanted [hello.txt] got %v", names)
+	}
+
+	inode, fh, _, errno := dir.Create(ctx, "new.txt", syscall.O_RDWR, 0600, &entry)
+	if errno != 0 {
+		t.Fatalf("Unexpected errno: %v", errno)
+	}
+
+	dir.AddChild("new.txt", inode, false)
+
+	if n, errno := fh.(gofs.FileWriter).Write(ctx, []byte("new content"), 0); errno != 0 || n != 11 {
+		t.Errorf("Wanted 11 bytes written got %d (%v)", n, errno)
+	}
+
+	buf := make([]byte, 3)
+	result, errno := fh.(gofs.FileReader).Read(ctx, buf, 4)
+	if errno != 0 {
+		t.Fatalf("Unexpected errno: %v", errno)
+	}
+
+	if got, _ := result.Bytes(buf); string(got) != "con" {
+		t.Errorf("Wanted %q got %q", "con", got)
+	}
+	fh.(gofs.FileReleaser).Release(ctx)
+
+	var attr fuse.AttrOut
+	if errno = inode.Operations().(*node).Getattr(ctx, nil, &attr); errno != 0 {
+		t.Fatalf("Unexpected errno: %v", errno)
+	} else if attr.Size != 11 || attr.Mode != syscall.S_IFREG|0600 {
+		t.Errorf("Wanted size 11 mode %o got size %d mode %o", syscall.S_IFREG|0600, attr.Size, attr.Mode)
+	}
+
+	if errno = dir.Rename(ctx, "new.txt", root, "renamed.txt", 0); errno != 0 {
+		t.Fatalf("Unexpected errno: %v", errno)
+	}
+
+	if content, err := vfs.ReadFile(fs, "/renamed.txt"); err != nil || string(content) != "new content" {
+		t.Errorf("Wanted %q got %q (%v)", "new content", content, err)
+	}
+
+	if errno = root.Unlink(ctx, "renamed.txt"); errno != 0 {
+		t.Errorf("Unexpected errno: %v", errno)
+	}
+
+	if _, err := fs.Stat("/renamed.txt"); !vfs.IsNotExist(err) {
+		t.Errorf("Wanted not exist error got %v", err)
+	}
+
+	if _, errno = root.Mkdir(ctx, "empty", 0755, &entry); errno != 0 {
+		t.Fatalf("Unexpected errno: %v", errno)
+	} else if info, err := fs.Stat("/empty"); err != nil || !info.IsDir() {
+		t.Errorf("Wanted a directory got %v (%v)", info, err)
+	}
+
+	if errno = root.Rmdir(ctx, "empty"); errno != 0 {
+		t.Errorf("Unexpected errno: %v", errno)
+	}
+
+	if _, err := fs.Stat("/empty"); !vfs.IsNotExist(err) {
+		t.Errorf("Wanted not exist error got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// GCPolicy controls what a garbage collection pass may reclaim
+type GCPolicy struct {
+	// DryRun reports what would be reclaimed without reclaiming anything
+	DryRun bool
+
+	// MinAge, if non-zero, limits reclamation to items that have not
+	// been used for at least this long
+	MinAge time.Duration
+
+	// TargetBytes, if non-zero, stops reclamation once a layer's
+	// retained size has been reduced to TargetBytes or fewer
+	TargetBytes int64
+}
+
+// GCItem describes a single item that was (or in a dry run would be) reclaimed
+type GCItem struct {
+	// Layer names the subsystem that holds the item, for instance "cache"
+	Layer string
+
+	// Path is the path, object key or other identifier of the item
+	Path string
+
+	// Bytes is the amount of storage the item holds
+	Bytes int64
+}
+
+// GCReport summarizes a garbage collection pass
+type GCReport struct {
+	// DryRun is true if nothing was actually reclaimed
+	DryRun bool
+
+	// Items lists everything that was reclaimed
+	Items []GCItem
+
+	// Bytes is the total of all Items
+	Bytes int64
+}
+
+// add appends the items from another report
+func (report *GCReport) add(other GCReport) {
+	report.Items = append(report.Items, other.Items...)
+	report.Bytes += other.Bytes
+}
+
+// String returns a human readable summary of the report
+func (report GCReport) String() string {
+	verb := "reclaimed"
+	if report.DryRun {
+		verb = "would reclaim"
+	}
+	return fmt.Sprintf("gc %s %d items (%d bytes)", verb, len(report.Items), report.Bytes)
+}
+
+// Collector is implemented by FileSystems that hold reclaimable storage.
+// CacheFs evicts cached files, CASFs sweeps unreachable objects, TrashFs
+// empties old trash entries, VersionFs prunes old versions and memfs
+// releases free blocks.  GC must honor policy.DryRun and ctx cancellation
+type Collector interface {
+	GC(ctx context.Context, policy GCPolicy) (GCReport, error)
+}
+
+// Unwrapper is implemented by FileSystems that wrap one or more other
+// FileSystems.  It allows utilities such as GC to reach every layer of a
+// composed FileSystem
+type Unwrapper interface {
+	Unwrap() []FileSystem
+}
+
+// GC runs a garbage collection pass over fs and every layer beneath it.  Each
+// layer that implements Collector is asked to reclaim storage according to
+// policy and the results are combined into a single report.  Layers are
+// collected from the outermost inward and collection stops at the first error
+func GC(ctx context.Context, fs FileSystem, policy GCPolicy) (report GCReport, err error) {
+	report.DryRun = policy.DryRun
+	err = gc(ctx, fs, policy, &report, make(map[FileSystem]bool))
+	return report, err
+}
+
+func gc(ctx context.Context, fs FileSystem, policy GCPolicy, report *GCReport, seen map[FileSystem]bool) error {
+	// FileSystems whose dynamic type cannot be a map key, such as struct
+	// values holding a slice, are collected each time they are reached
+	if t := reflect.TypeOf(fs); t != nil && t.Comparable() {
+		if seen[fs] {
+			return nil
+		}
+		seen[fs] = true
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if collector, ok := fs.(Collector); ok {
+		layer, err := collector.GC(ctx, policy)
+		report.add(layer)
+		if err != nil {
+			return err
+		}
+	}
+
+	if unwrapper, ok := fs.(Unwrapper); ok {
+		for _, inner := range unwrapper.Unwrap() {
+			if err := gc(ctx, inner, policy, report, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package vfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// testCollector is a FileSystem layer with reclaimable items
+type testCollector struct {
+	FileSystem
+	name   string
+	items  map[string]int64
+	inner  []FileSystem
+	policy GCPolicy
+}
+
+func (tc *testCollector) Unwrap() []FileSystem { return tc.inner }
+
+func (tc *testCollector) GC(ctx context.Context, policy GCPolicy) (report GCReport, err error) {
+	tc.policy = policy
+	for _, key := range []string{"a", "b"} {
+		if size, found := tc.items[key]; found {
+			report.Items = append(report.Items, GCItem{Layer: tc.name, Path: key, Bytes: size})
+			report.Bytes += size
+			if !policy.DryRun {
+				delete(tc.items, key)
+			}
+		}
+	}
+	return report, nil
+}
+
+func TestGC(t *testing.T) {
+	base := NewMemFs()
+	inner := &testCollector{FileSystem: base, name: "inner", items: map[string]int64{"a": 10}, inner: []FileSystem{base}}
+	outer := &testCollector{FileSystem: inner, name: "outer", items: map[string]int64{"a": 1, "b": 2}, inner: []FileSystem{inner}}
+
+	want := []GCItem{{"outer", "a", 1}, {"outer", "b", 2}, {"inner", "a", 10}}
+	report, err := GC(context.Background(), outer, GCPolicy{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(want, report.Items) || report.Bytes != 13 || !report.DryRun {
+		t.Errorf("Wanted dry run of %v (13 bytes) got %v", want, report)
+	}
+
+	if len(outer.items) != 2 || len(inner.items) != 1 {
+		t.Errorf("Dry run should not reclaim anything")
+	}
+
+	report, _ = GC(context.Background(), outer, GCPolicy{})
+	if report.Bytes != 13 || len(outer.items) != 0 || len(inner.items) != 0 {
+		t.Errorf("Expected everything to be reclaimed, got %v", report)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GC(ctx, outer, GCPolicy{}); err != context.Canceled {
+		t.Errorf("Wanted error %v got %v", context.Canceled, err)
+	}
+}
+
+// layersFs is a wrapper whose value cannot be compared
+type layersFs struct {
+	FileSystem
+	layers []FileSystem
+}
+
+func (lfs layersFs) Unwrap() []FileSystem { return lfs.layers }
+
+func TestGCNotComparable(t *testing.T) {
+	base := NewMemFs()
+	inner := &testCollector{FileSystem: base, name: "inner", items: map[string]int64{"a": 10}}
+	fs := layersFs{FileSystem: inner, layers: []FileSystem{inner, inner}}
+
+	// the comparable layer reached twice is still collected once
+	want := []GCItem{{"inner", "a", 10}}
+	report, err := GC(context.Background(), layersFs{FileSystem: fs, layers: []FileSystem{fs}}, GCPolicy{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if !reflect.DeepEqual(want, report.Items) {
+		t.Errorf("Wanted %v got %v", want, report.Items)
+	}
+}
+
+func TestGCLayers(t *testing.T) {
+	cas, err := NewCASFs(NewMemFs())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	versions := NewVersionFs(cas, NewMemFs())
+	fs := NewCacheFs(NewTrashFs(versions), NewMemFs())
+
+	WriteFile(fs, "/a", []byte("one"), 0644)
+	WriteFile(fs, "/b", []byte("removed"), 0644)
+	cas.Commit()
+	WriteFile(fs, "/a", []byte("two"), 0644)
+	cas.Commit()
+	fs.Remove("/b")
+	ReadFile(fs, "/a")
+
+	report, err := GC(context.Background(), fs, GCPolicy{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	layers := make(map[string]bool)
+	for _, item := range report.Items {
+		layers[item.Layer] = true
+	}
+
+	for _, layer := range []string{"cache", "trash", "version", "cas"} {
+		if !layers[layer] {
+			t.Errorf("Wanted the %s layer to be collected got %v", layer, report.Items)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// HashFile streams the contents of the named file through a hash created
+// by newHash and returns the digest.  A nil newHash uses SHA-256
+func HashFile(opener Opener, name string, newHash func() hash.Hash) ([]byte, error) {
+	if newHash == nil {
+		newHash = sha256.New
+	}
+
+	f, err := opener.Open(name)
+	if err != nil {
+		return nil, fixErr(err)
+	}
+
+	h := newHash()
+	_, err = io.Copy(h, f)
+	if closer, ok := f.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+
+	if err != nil {
+		return nil, fixErr(err)
+	}
+	return h.Sum(nil), nil
+}
+
+// HashTree returns a digest of the tree rooted at root computed with a hash
+// created by newHash, SHA-256 when newHash is nil.  The digest covers the
+// path of every entry relative to root, its type and permissions, the
+// contents of regular files and the targets of symbolic links.  Modification
+// times and ownership are not included, so identical trees on different
+// FileSystems have the same digest
+func HashTree(fs FileSystem, root string, newHash func() hash.Hash) ([]byte, error) {
+	if newHash == nil {
+		newHash = sha256.New
+	}
+
+	h := newHash()
+	reader, _ := fs.(linkReader)
+	err := Walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, path.Clean(root)), PathSeparator)
+		var content []byte
+		switch mode := info.Mode(); {
+		case mode.IsRegular():
+			content, err = HashFile(fs, name, newHash)
+		case mode&os.ModeSymlink != 0 && reader != nil:
+			var target string
+			target, err = reader.Readlink(name)
+			content = []byte(target)
+		}
+
+		if err == nil {
+			// every field is length prefixed so that different trees
+			// cannot produce the same stream
+			writeHashField(h, []byte(rel))
+			writeHashField(h, []byte(info.Mode().String()))
+			writeHashField(h, content)
+		}
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func writeHashField(w io.Writer, field []byte) {
+	binary.Write(w, binary.BigEndian, uint64(len(field)))
+	w.Write(field)
+}
@@ -0,0 +1,79 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestHashFile(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/file", []byte("hello world"), 0644)
+
+	got, err := HashFile(fs, "/file", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if want := sha256.Sum256([]byte("hello world")); !bytes.Equal(want[:], got) {
+		t.Errorf("Wanted %x got %x", want, got)
+	}
+
+	got, _ = HashFile(fs, "/file", md5.New)
+	if want := "5eb63bbbe01eeed093cb22bb8f5acdc3"; hex.EncodeToString(got) != want {
+		t.Errorf("Wanted %s got %x", want, got)
+	}
+
+	if _, err = HashFile(fs, "/missing", nil); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	build := func(fs FileSystem, root string) {
+		MkdirAll(fs, root+"/dir", 0755)
+		WriteFile(fs, root+"/dir/file", []byte("file"), 0644)
+		WriteFile(fs, root+"/other", []byte("other"), 0644)
+	}
+
+	memfs := NewMemFs()
+	build(memfs, "/a")
+	tempfs := NewTempFs()
+	defer tempfs.Close()
+	build(tempfs, "/b")
+
+	want, err := HashTree(memfs, "/a", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(fs FileSystem)
+		same   bool
+	}{
+		{"same tree elsewhere", func(fs FileSystem) {}, true},
+		{"contents", func(fs FileSystem) { WriteFile(fs, "/b/other", []byte("changed"), 0644) }, false},
+		{"permissions", func(fs FileSystem) { fs.Chmod("/b/other", 0600) }, false},
+		{"renamed", func(fs FileSystem) { fs.Rename("/b/other", "/b/renamed") }, false},
+		{"added", func(fs FileSystem) { fs.Mkdir("/b/empty", 0755) }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs()
+			build(fs, "/b")
+			test.change(fs)
+			got, err := HashTree(fs, "/b", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else if bytes.Equal(want, got) != test.same {
+				t.Errorf("Wanted same digest %v for %x and %x", test.same, want, got)
+			}
+		})
+	}
+
+	if got, _ := HashTree(tempfs, "/b", nil); !bytes.Equal(want, got) {
+		t.Errorf("Wanted osfs digest %x got %x", want, got)
+	}
+}
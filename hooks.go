@@ -0,0 +1,294 @@
+package vfs
+
+import (
+	"io"
+	"os"
+)
+
+// Hooks are called around the operations performed through a FileSystem
+// returned by WithHooks and on the files it opens.  Operations are described
+// by an Op as for Observe and any of the hooks may be nil.  A hook returning
+// an error stops the operation before it starts and the error is returned in
+// its place, wrapped in a PathError or, for a rename, a LinkError.  Hooks
+// are called from every goroutine using the FileSystem and must be safe for
+// concurrent use
+type Hooks struct {
+	// Before is called before every operation and After once it is done,
+	// with the number of bytes read or written or the number of directory
+	// entries read
+	Before func(op Op) error
+	After  func(op Op, n int, err error)
+
+	// BeforeOpen and AfterOpen are called around Create, Open and OpenFile
+	BeforeOpen func(op Op) error
+	AfterOpen  func(op Op, err error)
+
+	// BeforeRead and AfterRead are called around Read and ReadAt
+	BeforeRead func(op Op) error
+	AfterRead  func(op Op, n int, err error)
+
+	// BeforeWrite and AfterWrite are called around Write and WriteAt with
+	// the data being written
+	BeforeWrite func(op Op, p []byte) error
+	AfterWrite  func(op Op, p []byte, n int, err error)
+
+	// AfterClose is called once a file has been closed, for instance to
+	// scan what was written to it
+	AfterClose func(op Op, err error)
+}
+
+// before calls the Before hook and then the specific one, if any
+func (h *Hooks) before(op Op, specific func(Op) error) error {
+	var err error
+	if h.Before != nil {
+		err = h.Before(op)
+	}
+
+	if err == nil && specific != nil {
+		err = specific(op)
+	}
+
+	if err == nil {
+		return nil
+	} else if op.Name == "rename" {
+		return &LinkError{Op: op.Name, Old: op.Path, New: op.NewPath, Cause: err}
+	}
+	return &PathError{Op: op.Name, Path: op.Path, Cause: err}
+}
+
+// after calls the After hook
+func (h *Hooks) after(op Op, n int, err error) {
+	if h.After != nil {
+		h.After(op, n, err)
+	}
+}
+
+// hookedfs calls hooks around the operations on the FileSystem it wraps
+type hookedfs struct {
+	FileSystem
+	hooks Hooks
+}
+
+// WithHooks returns a FileSystem that calls hooks around every operation on
+// fs and on the files it opens, so that authorization, auditing and the like
+// can be added to any FileSystem.  Wrapping the result again with other
+// Hooks composes them, the outer hooks being called first
+func WithHooks(fs FileSystem, hooks Hooks) FileSystem {
+	return &hookedfs{FileSystem: fs, hooks: hooks}
+}
+
+// open runs an operation opening a file between the hooks
+func (hfs *hookedfs) open(op Op, open func() (File, error)) (File, error) {
+	if err := hfs.hooks.before(op, hfs.hooks.BeforeOpen); err != nil {
+		return nil, err
+	}
+
+	f, err := open()
+	if hfs.hooks.AfterOpen != nil {
+		hfs.hooks.AfterOpen(op, err)
+	}
+	hfs.hooks.after(op, 0, err)
+
+	if err != nil {
+		return nil, err
+	}
+	return &hookedFile{File: f, hooks: &hfs.hooks}, nil
+}
+
+// run runs an operation that only the Before and After hooks apply to
+func (hfs *hookedfs) run(op Op, fn func() error) error {
+	if err := hfs.hooks.before(op, nil); err != nil {
+		return err
+	}
+
+	err := fn()
+	hfs.hooks.after(op, 0, err)
+	return err
+}
+
+func (hfs *hookedfs) Chmod(filename string, mode os.FileMode) error {
+	return hfs.run(Op{Name: "chmod", Path: filename, Mode: mode}, func() error {
+		return hfs.FileSystem.Chmod(filename, mode)
+	})
+}
+
+func (hfs *hookedfs) Create(filename string) (File, error) {
+	return hfs.open(Op{Name: "create", Path: filename}, func() (File, error) {
+		return hfs.FileSystem.Create(filename)
+	})
+}
+
+func (hfs *hookedfs) Open(filename string) (File, error) {
+	return hfs.open(Op{Name: "open", Path: filename}, func() (File, error) {
+		return hfs.FileSystem.Open(filename)
+	})
+}
+
+func (hfs *hookedfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	return hfs.open(Op{Name: "openfile", Path: filename, Flag: flag, Mode: perm}, func() (File, error) {
+		return hfs.FileSystem.OpenFile(filename, flag, perm)
+	})
+}
+
+func (hfs *hookedfs) Mkdir(name string, perm os.FileMode) error {
+	return hfs.run(Op{Name: "mkdir", Path: name, Mode: perm}, func() error {
+		return hfs.FileSystem.Mkdir(name, perm)
+	})
+}
+
+func (hfs *hookedfs) Remove(name string) error {
+	return hfs.run(Op{Name: "remove", Path: name}, func() error {
+		return hfs.FileSystem.Remove(name)
+	})
+}
+
+func (hfs *hookedfs) Rename(oldpath, newpath string) error {
+	return hfs.run(Op{Name: "rename", Path: oldpath, NewPath: newpath}, func() error {
+		return hfs.FileSystem.Rename(oldpath, newpath)
+	})
+}
+
+func (hfs *hookedfs) Lstat(filename string) (fi os.FileInfo, err error) {
+	err = hfs.run(Op{Name: "lstat", Path: filename}, func() error {
+		fi, err = hfs.FileSystem.Lstat(filename)
+		return err
+	})
+	return fi, err
+}
+
+func (hfs *hookedfs) Stat(filename string) (fi os.FileInfo, err error) {
+	err = hfs.run(Op{Name: "stat", Path: filename}, func() error {
+		fi, err = hfs.FileSystem.Stat(filename)
+		return err
+	})
+	return fi, err
+}
+
+// Unwrap returns the FileSystem the hooks are called around
+func (hfs *hookedfs) Unwrap() []FileSystem {
+	return []FileSystem{hfs.FileSystem}
+}
+
+// hookedFile calls the hooks around the operations on a file opened by a
+// hookedfs
+type hookedFile struct {
+	File
+	hooks *Hooks
+}
+
+func (f *hookedFile) read(read func() (int, error)) (int, error) {
+	op := Op{Name: "read", Path: f.Name()}
+	if err := f.hooks.before(op, f.hooks.BeforeRead); err != nil {
+		return 0, err
+	}
+
+	n, err := read()
+	if f.hooks.AfterRead != nil {
+		f.hooks.AfterRead(op, n, err)
+	}
+	f.hooks.after(op, n, err)
+	return n, err
+}
+
+func (f *hookedFile) write(p []byte, write func() (int, error)) (int, error) {
+	op := Op{Name: "write", Path: f.Name()}
+	var specific func(Op) error
+	if f.hooks.BeforeWrite != nil {
+		specific = func(op Op) error { return f.hooks.BeforeWrite(op, p) }
+	}
+
+	if err := f.hooks.before(op, specific); err != nil {
+		return 0, err
+	}
+
+	n, err := write()
+	if f.hooks.AfterWrite != nil {
+		f.hooks.AfterWrite(op, p, n, err)
+	}
+	f.hooks.after(op, n, err)
+	return n, err
+}
+
+func (f *hookedFile) Read(p []byte) (int, error) {
+	return f.read(func() (int, error) { return f.File.Read(p) })
+}
+
+func (f *hookedFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.read(func() (int, error) { return f.File.ReadAt(p, off) })
+}
+
+func (f *hookedFile) Write(p []byte) (int, error) {
+	return f.write(p, func() (int, error) { return f.File.Write(p) })
+}
+
+func (f *hookedFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.write(p, func() (int, error) { return f.File.WriteAt(p, off) })
+}
+
+func (f *hookedFile) Seek(offset int64, whence int) (int64, error) {
+	op := Op{Name: "seek", Path: f.Name()}
+	if err := f.hooks.before(op, nil); err != nil {
+		return 0, err
+	}
+
+	pos, err := f.File.Seek(offset, whence)
+	f.hooks.after(op, 0, err)
+	return pos, err
+}
+
+func (f *hookedFile) Readdir(n int) (infos []os.FileInfo, err error) {
+	op := Op{Name: "readdir", Path: f.Name()}
+	if err = f.hooks.before(op, nil); err != nil {
+		return nil, err
+	}
+
+	infos, err = f.File.Readdir(n)
+	f.hooks.after(op, len(infos), err)
+	return infos, err
+}
+
+func (f *hookedFile) Readdirnames(n int) (names []string, err error) {
+	op := Op{Name: "readdir", Path: f.Name()}
+	if err = f.hooks.before(op, nil); err != nil {
+		return nil, err
+	}
+
+	names, err = f.File.Readdirnames(n)
+	f.hooks.after(op, len(names), err)
+	return names, err
+}
+
+// Truncate changes the size of the file if the underlying file supports it
+func (f *hookedFile) Truncate(size int64) error {
+	op := Op{Name: "truncate", Path: f.Name()}
+	if err := f.hooks.before(op, nil); err != nil {
+		return err
+	}
+
+	err := error(&PathError{Op: "truncate", Path: f.Name(), Cause: ErrNotSupported})
+	if truncater, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		err = truncater.Truncate(size)
+	}
+	f.hooks.after(op, 0, err)
+	return err
+}
+
+// Close closes the underlying file if it can be closed.  The hooks cannot
+// keep a file from being closed
+func (f *hookedFile) Close() error {
+	op := Op{Name: "close", Path: f.Name()}
+	if f.hooks.Before != nil {
+		f.hooks.Before(op)
+	}
+
+	var err error
+	if closer, ok := f.File.(io.Closer); ok {
+		err = closer.Close()
+	}
+
+	if f.hooks.AfterClose != nil {
+		f.hooks.AfterClose(op, err)
+	}
+	f.hooks.after(op, 0, err)
+	return err
+}
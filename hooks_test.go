@@ -0,0 +1,89 @@
+package vfs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithHooks(t *testing.T) {
+	base := NewMemFs()
+	base.Mkdir("/secret", 0755)
+	WriteFile(base, "/secret/key", []byte("key"), 0644)
+
+	errDenied := errors.New("denied")
+	var mu sync.Mutex
+	var audit []string
+	fs := WithHooks(base, Hooks{
+		BeforeOpen: func(op Op) error {
+			if strings.HasPrefix(op.Path, "/secret/") {
+				return errDenied
+			}
+			return nil
+		},
+		BeforeWrite: func(op Op, p []byte) error {
+			if strings.Contains(string(p), "virus") {
+				return errDenied
+			}
+			return nil
+		},
+		After: func(op Op, n int, err error) {
+			mu.Lock()
+			audit = append(audit, op.Name)
+			mu.Unlock()
+		},
+	})
+
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr error
+	}{
+		{"denied open", func() error { _, err := fs.Open("/secret/key"); return err }, errDenied},
+		{"write", func() error { return WriteFile(fs, "/file", []byte("clean"), 0644) }, nil},
+		{"scanned write", func() error { return WriteFile(fs, "/file", []byte("virus"), 0644) }, errDenied},
+		{"read", func() error { _, err := ReadFile(fs, "/file"); return err }, nil},
+		{"rename", func() error { return fs.Rename("/file", "/moved") }, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.op(); !errors.Is(err, test.wantErr) {
+				t.Errorf("Wanted %v got %v", test.wantErr, err)
+			}
+		})
+	}
+
+	// the vetoed write left the file truncated and the denied open never
+	// reached the After hook
+	want := []string{"openfile", "write", "close", "openfile", "close", "open", "read", "close", "rename"}
+	if !reflect.DeepEqual(want, audit) {
+		t.Errorf("Wanted %v got %v", want, audit)
+	}
+
+	if data, _ := ReadFile(base, "/moved"); len(data) != 0 {
+		t.Errorf("Wanted the rejected write to be skipped got %q", data)
+	}
+}
+
+func TestWithHooksComposed(t *testing.T) {
+	var calls []string
+	hooks := func(name string) Hooks {
+		return Hooks{
+			Before: func(op Op) error { calls = append(calls, name+" before"); return nil },
+			After:  func(op Op, n int, err error) { calls = append(calls, name+" after") },
+		}
+	}
+
+	fs := WithHooks(WithHooks(NewMemFs(), hooks("inner")), hooks("outer"))
+	if err := fs.Mkdir("/dir", 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"outer before", "inner before", "inner after", "outer after"}
+	if !reflect.DeepEqual(want, calls) {
+		t.Errorf("Wanted %v got %v", want, calls)
+	}
+}
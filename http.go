@@ -0,0 +1,371 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpfs is a read-only FileSystem serving files from a base URL
+type httpfs struct {
+	base   *url.URL
+	client *http.Client
+	index  string
+
+	once     sync.Once
+	entries  map[string]*httpFileInfo
+	children map[string][]string
+	indexErr error
+}
+
+// NewHttpFs returns a read-only FileSystem rooted at the base URL.  Open
+// issues GET requests (with Range headers for ReadAt and Seek) and Stat issues
+// HEAD requests.  Plain HTTP has no directory listings, so directories only
+// exist when an index is configured with WithIndexManifest.  The index is a
+// Manifest, as written by ExportManifest and WriteTo, served relative to the
+// base URL.  Any operation that would modify the filesystem returns
+// ErrReadOnly and Watcher returns ErrNotSupported
+func NewHttpFs(baseURL string, opts ...Option) (FileSystem, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(base.Path, PathSeparator) {
+		base.Path += PathSeparator
+	}
+
+	fs := &httpfs{base: base, client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs, nil
+}
+
+// url returns the URL of a vfs path
+func (hfs *httpfs) url(filename string) string {
+	rel := strings.TrimPrefix(Clean(filename), PathSeparator)
+	return hfs.base.ResolveReference(&url.URL{Path: rel}).String()
+}
+
+// loadIndex fetches and indexes the manifest the first time it is needed
+func (hfs *httpfs) loadIndex() error {
+	hfs.once.Do(func() {
+		hfs.entries = map[string]*httpFileInfo{PathSeparator: {name: PathSeparator, mode: os.ModeDir | 0555}}
+		hfs.children = make(map[string][]string)
+		resp, err := hfs.get(hfs.index, "")
+		if err != nil {
+			hfs.indexErr = err
+			return
+		}
+		defer resp.Body.Close()
+
+		manifest, err := ImportManifest(resp.Body)
+		if err != nil {
+			hfs.indexErr = &PathError{Op: "index", Path: hfs.index, Cause: err}
+			return
+		}
+
+		for _, entry := range manifest.Entries {
+			mode, err := entry.FileMode()
+			if err != nil {
+				hfs.indexErr = &PathError{Op: "index", Path: entry.Path, Cause: err}
+				return
+			}
+
+			filename := Clean(entry.Path)
+			dir := path.Dir(filename)
+			hfs.entries[filename] = &httpFileInfo{name: path.Base(filename), size: entry.Size, mode: mode}
+			hfs.children[dir] = append(hfs.children[dir], path.Base(filename))
+		}
+
+		for _, names := range hfs.children {
+			sort.Strings(names)
+		}
+	})
+	return hfs.indexErr
+}
+
+// statusError converts an unsuccessful response into an error
+func statusError(op, filename string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return &PathError{Op: op, Path: filename, Cause: ErrNotExist}
+	}
+	return &PathError{Op: op, Path: filename, Cause: fmt.Errorf("unexpected response %s", resp.Status)}
+}
+
+// get issues a GET request for filename with an optional Range header
+func (hfs *httpfs) get(filename, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, hfs.url(filename), nil)
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: filename, Cause: err}
+	}
+
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+
+	resp, err := hfs.client.Do(req)
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: filename, Cause: err}
+	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, statusError("open", filename, resp)
+	}
+	return resp, nil
+}
+
+func (hfs *httpfs) Chmod(filename string, mode os.FileMode) error {
+	return &PathError{Op: "chmod", Path: filename, Cause: ErrReadOnly}
+}
+
+func (hfs *httpfs) Create(filename string) (File, error) {
+	return nil, &PathError{Op: "create", Path: filename, Cause: ErrReadOnly}
+}
+
+func (hfs *httpfs) Open(filename string) (File, error) {
+	return hfs.OpenFile(filename, RdOnlyFlag, 0)
+}
+
+// OpenFile opens the named file for reading.  The file's contents are not
+// requested until the first read
+func (hfs *httpfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if flag.accessMode() != RdOnlyFlag || flag.has(CreateFlag) || flag.has(TruncFlag) {
+		return nil, &PathError{Op: "open", Path: filename, Cause: ErrReadOnly}
+	}
+
+	info, err := hfs.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{fs: hfs, name: filename, info: info.(*httpFileInfo)}, nil
+}
+
+func (hfs *httpfs) Mkdir(name string, perm os.FileMode) error {
+	return &PathError{Op: "mkdir", Path: name, Cause: ErrReadOnly}
+}
+
+func (hfs *httpfs) Remove(name string) error {
+	return &PathError{Op: "remove", Path: name, Cause: ErrReadOnly}
+}
+
+func (hfs *httpfs) Rename(oldpath, newpath string) error {
+	return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrReadOnly}
+}
+
+// Lstat is the same as Stat since HTTP has no symbolic links
+func (hfs *httpfs) Lstat(filename string) (os.FileInfo, error) {
+	return hfs.Stat(filename)
+}
+
+// Stat returns the FileInfo recorded in the index, if there is one,
+// otherwise it issues a HEAD request
+func (hfs *httpfs) Stat(filename string) (os.FileInfo, error) {
+	if hfs.index != "" {
+		if err := hfs.loadIndex(); err != nil {
+			return nil, err
+		}
+
+		if info, found := hfs.entries[Clean(filename)]; found {
+			return info, nil
+		}
+		return nil, &PathError{Op: "stat", Path: filename, Cause: ErrNotExist}
+	} else if Clean(filename) == PathSeparator {
+		return &httpFileInfo{name: PathSeparator, mode: os.ModeDir | 0555}, nil
+	}
+
+	resp, err := hfs.client.Head(hfs.url(filename))
+	if err != nil {
+		return nil, &PathError{Op: "stat", Path: filename, Cause: err}
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("stat", filename, resp)
+	}
+
+	info := &httpFileInfo{name: path.Base(Clean(filename)), size: resp.ContentLength, mode: 0444}
+	info.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (hfs *httpfs) Close() error { return nil }
+
+func (hfs *httpfs) Watcher(chan<- Event) (Watcher, error) {
+	return nil, ErrNotSupported
+}
+
+type httpFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *httpFileInfo) Name() string       { return fi.name }
+func (fi *httpFileInfo) Size() int64        { return fi.size }
+func (fi *httpFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *httpFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *httpFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *httpFileInfo) Sys() interface{}   { return nil }
+
+// httpFile is an open remote file or indexed directory
+type httpFile struct {
+	fs     *httpfs
+	name   string
+	info   *httpFileInfo
+	offset int64
+	body   io.ReadCloser
+	closed bool
+}
+
+func (f *httpFile) Name() string { return f.name }
+
+func (f *httpFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+func (f *httpFile) check(op string) error {
+	if f.closed {
+		return &PathError{Op: op, Path: f.name, Cause: ErrClosed}
+	} else if f.info.IsDir() {
+		return &PathError{Op: op, Path: f.name, Cause: ErrIsDir}
+	}
+	return nil
+}
+
+func (f *httpFile) Read(p []byte) (n int, err error) {
+	if err = f.check("read"); err != nil {
+		return 0, err
+	}
+
+	if f.body == nil {
+		resp, err := f.fs.get(f.name, fmt.Sprintf("bytes=%d-", f.offset))
+		if err != nil {
+			return 0, err
+		}
+
+		f.body = resp.Body
+		if resp.StatusCode == http.StatusOK && f.offset > 0 {
+			// the server ignored the range
+			if _, err = io.CopyN(io.Discard, f.body, f.offset); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err = f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *httpFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if err = f.check("read"); err != nil {
+		return 0, err
+	} else if off < 0 {
+		return 0, &PathError{Op: "read", Path: f.name, Cause: ErrInvalidSeek}
+	} else if len(p) == 0 {
+		return 0, nil
+	}
+
+	resp, err := f.fs.get(f.name, fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		if _, err = io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return 0, io.EOF
+		}
+	}
+
+	n, err = io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *httpFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek"); err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	default:
+		return 0, &PathError{Op: "seek", Path: f.name, Cause: ErrWhence}
+	}
+
+	if offset < 0 {
+		return 0, &PathError{Op: "seek", Path: f.name, Cause: ErrInvalidSeek}
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *httpFile) Write(p []byte) (int, error) {
+	return 0, &PathError{Op: "write", Path: f.name, Cause: ErrReadOnly}
+}
+
+func (f *httpFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &PathError{Op: "write", Path: f.name, Cause: ErrReadOnly}
+}
+
+// Readdir returns the entries recorded in the index for a directory
+func (f *httpFile) Readdir(n int) (infos []os.FileInfo, err error) {
+	if !f.info.IsDir() {
+		return nil, &PathError{Op: "readdir", Path: f.name, Cause: ErrNotDir}
+	}
+
+	dir := Clean(f.name)
+	names := f.fs.children[dir][f.offset:]
+	if n > 0 && len(names) > n {
+		names = names[:n]
+	}
+
+	for _, name := range names {
+		infos = append(infos, f.fs.entries[path.Join(dir, name)])
+	}
+	f.offset += int64(len(names))
+
+	if n > 0 && len(infos) == 0 {
+		err = io.EOF
+	}
+	return infos, err
+}
+
+func (f *httpFile) Readdirnames(n int) (names []string, err error) {
+	infos, err := f.Readdir(n)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, err
+}
+
+func (f *httpFile) Close() error {
+	if f.closed {
+		return &PathError{Op: "close", Path: f.name, Cause: ErrClosed}
+	}
+	f.closed = true
+
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
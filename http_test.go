@@ -0,0 +1,113 @@
+package vfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testHttpServer(t *testing.T) *httptest.Server {
+	dir := t.TempDir()
+	fs := NewOsFs(dir)
+	MkdirAll(fs, "/assets/css", 0755)
+	WriteFile(fs, "/config.json", []byte(`{"key": "value"}`), 0644)
+	WriteFile(fs, "/assets/css/site.css", []byte("body {}"), 0644)
+
+	manifest, err := ExportManifest(fs, "/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	f, _ := fs.Create("/index.json")
+	manifest.WriteTo(f)
+	f.(io.Closer).Close()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHttpFs(t *testing.T) {
+	server := testHttpServer(t)
+	for _, opts := range [][]Option{nil, {WithIndexManifest("index.json")}} {
+		fs, err := NewHttpFs(server.URL, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if data, err := ReadFile(fs, "/assets/css/site.css"); err != nil || string(data) != "body {}" {
+			t.Errorf("Unexpected read %q %v", data, err)
+		}
+
+		if fi, err := fs.Stat("/config.json"); err != nil || fi.Size() != 16 {
+			t.Errorf("Unexpected stat %v %v", fi, err)
+		}
+
+		if _, err := fs.Stat("/missing.json"); !IsNotExist(err) {
+			t.Errorf("Wanted ErrNotExist got %v", err)
+		}
+
+		f, _ := fs.Open("/config.json")
+		buf := make([]byte, 5)
+		if n, err := f.ReadAt(buf, 9); n != 5 || err != nil || string(buf) != "value" {
+			t.Errorf("Unexpected ReadAt %d %q %v", n, buf, err)
+		}
+
+		f.Seek(2, io.SeekStart)
+		if data, _ := io.ReadAll(f); string(data) != `key": "value"}` {
+			t.Errorf("Unexpected read after seek %q", data)
+		}
+
+		if _, err := fs.Create("/new"); !IsError(ErrReadOnly, err) {
+			t.Errorf("Wanted ErrReadOnly got %v", err)
+		}
+	}
+}
+
+func TestHttpFsIndex(t *testing.T) {
+	server := testHttpServer(t)
+	fs, _ := NewHttpFs(server.URL+"/", WithIndexManifest("index.json"))
+
+	d, err := fs.Open("/assets")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	names, _ := d.Readdirnames(-1)
+	if want := []string{"css"}; !reflect.DeepEqual(want, names) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+
+	var got []string
+	Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
+		got = append(got, filename)
+		return err
+	})
+
+	want := []string{"/", "/assets", "/assets/css", "/assets/css/site.css", "/config.json"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+}
+
+func TestHttpFsIgnoredRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "0123456789")
+	}))
+	defer server.Close()
+
+	fs, _ := NewHttpFs(server.URL)
+	f, _ := fs.Open("/file")
+	buf := make([]byte, 3)
+	if n, err := f.ReadAt(buf, 4); n != 3 || err != nil || string(buf) != "456" {
+		t.Errorf("Unexpected ReadAt %d %q %v", n, buf, err)
+	}
+
+	f.Seek(7, io.SeekStart)
+	if data, _ := io.ReadAll(f); string(data) != "789" {
+		t.Errorf("Wanted 789 got %q", data)
+	}
+}
@@ -0,0 +1,304 @@
+package vfs
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// imageMagic identifies a memfs image
+var imageMagic = [8]byte{'V', 'F', 'S', 'I', 'M', 'A', 'G', 'E'}
+
+const imageVersion = uint16(1)
+
+// maxImageLink is the longest symbolic link target an image may hold
+const maxImageLink = 4096
+
+// ImageOption controls how filesystem images are written and read
+type ImageOption func(*imageConfig)
+
+type imageConfig struct {
+	signingKey ed25519.PrivateKey
+	verifyKey  ed25519.PublicKey
+}
+
+// WithSigningKey signs the image digest with key when saving an image
+func WithSigningKey(key ed25519.PrivateKey) ImageOption {
+	return func(config *imageConfig) { config.signingKey = key }
+}
+
+// WithVerify requires a loaded image to carry a signature that verifies
+// with key.  Images that are unsigned or signed by another key are
+// rejected with ErrSignature
+func WithVerify(key ed25519.PublicKey) ImageOption {
+	return func(config *imageConfig) { config.verifyKey = key }
+}
+
+func newImageConfig(opts []ImageOption) *imageConfig {
+	config := &imageConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// imageWriter writes big endian values while hashing everything written
+type imageWriter struct {
+	w   io.Writer
+	h   hash.Hash
+	err error
+}
+
+func (iw *imageWriter) write(v interface{}) {
+	if iw.err == nil {
+		iw.err = binary.Write(io.MultiWriter(iw.w, iw.h), binary.BigEndian, v)
+	}
+}
+
+func (iw *imageWriter) writeBytes(data []byte) {
+	iw.write(int64(len(data)))
+	iw.write(data)
+}
+
+// imageReader reads big endian values while hashing everything read
+type imageReader struct {
+	r   io.Reader
+	h   hash.Hash
+	err error
+}
+
+func (ir *imageReader) read(v interface{}) {
+	if ir.err == nil {
+		ir.err = binary.Read(io.TeeReader(ir.r, ir.h), binary.BigEndian, v)
+	}
+}
+
+// SaveImage writes the complete contents of a memfs (inode table, directory
+// entries and file data) to w.  The image ends with a sha256 digest of its
+// contents and, when WithSigningKey is given, an ed25519 signature of that
+// digest.  SaveImage returns ErrNotSupported for any other FileSystem
+func SaveImage(fs FileSystem, w io.Writer, opts ...ImageOption) error {
+	mfs, ok := fs.(*memfs)
+	if !ok {
+		return ErrNotSupported
+	}
+	return mfs.save(w, newImageConfig(opts))
+}
+
+// Save writes the complete contents of the memfs to w in the same format as
+// SaveImage.  The FileSystem returned by NewMemFs can be asserted to
+// interface{ Save(io.Writer) error } to reach it
+func (fs *memfs) Save(w io.Writer) error {
+	return fs.save(w, newImageConfig(nil))
+}
+
+func (fs *memfs) save(w io.Writer, config *imageConfig) error {
+	fs.Lock()
+	inodes := append([]*memInode(nil), fs.inodes...)
+	free := make(map[memInodeNum]bool)
+	for _, num := range fs.freeInodes {
+		free[num] = true
+	}
+	fs.Unlock()
+
+	iw := &imageWriter{w: w, h: sha256.New()}
+	iw.write(imageMagic)
+	iw.write(imageVersion)
+	iw.write(int64(len(inodes)))
+	for _, inode := range inodes {
+		inode.Lock()
+		num, parent, mode, modTime, link, size := inode.num, inode.parent, inode.mode, inode.modTime, inode.link, inode.size
+		if inode.unlinked {
+			// removed while open, the image has no handles to keep it for
+			free[num] = true
+			parent, mode, modTime, link, size = 0, 0, time.Time{}, "", 0
+		}
+		inode.Unlock()
+
+		iw.write(int64(num))
+		iw.write(free[num])
+		iw.write(int64(parent))
+		iw.write(uint32(mode))
+		iw.write(modTime.UnixNano())
+		iw.writeBytes([]byte(link))
+
+		data := make([]byte, size)
+		if size > 0 {
+			file := &memFile{inode: inode}
+			if _, err := file.readAt(data, 0); err != nil && err != io.EOF {
+				return err
+			}
+		}
+		iw.writeBytes(data)
+	}
+
+	if iw.err != nil {
+		return iw.err
+	}
+
+	digest := iw.h.Sum(nil)
+	var signature []byte
+	if config.signingKey != nil {
+		signature = ed25519.Sign(config.signingKey, digest)
+	}
+
+	_, err := w.Write(digest)
+	if err == nil {
+		err = binary.Write(w, binary.BigEndian, uint16(len(signature)))
+	}
+
+	if err == nil {
+		_, err = w.Write(signature)
+	}
+	return err
+}
+
+// LoadMemFs creates a new memfs from an image written by Save or SaveImage.
+// It is the same as NewMemFsFromImage
+func LoadMemFs(r io.Reader, opts ...ImageOption) (FileSystem, error) {
+	return NewMemFsFromImage(r, opts...)
+}
+
+// NewMemFsFromImage creates a new memfs from an image written by SaveImage.
+// The image digest is always checked and ErrChecksum is returned if the image
+// has been corrupted.  Use WithVerify to also require a valid signature
+func NewMemFsFromImage(r io.Reader, opts ...ImageOption) (FileSystem, error) {
+	config := newImageConfig(opts)
+	fs := NewMemFs().(*memfs)
+	ir := &imageReader{r: r, h: sha256.New()}
+
+	var magic [8]byte
+	var version uint16
+	ir.read(&magic)
+	ir.read(&version)
+	if ir.err == nil && (magic != imageMagic || version != imageVersion) {
+		return nil, ErrImageFormat
+	}
+
+	count := int64(0)
+	ir.read(&count)
+	fs.inodes = nil
+	for i := int64(0); i < count && ir.err == nil; i++ {
+		var num, parent, modTime, length int64
+		var mode uint32
+		var free bool
+		ir.read(&num)
+		ir.read(&free)
+		ir.read(&parent)
+		ir.read(&mode)
+		ir.read(&modTime)
+		ir.read(&length)
+		if ir.err != nil {
+			break
+		}
+
+		if num != i || parent < 0 || parent >= count || length < 0 || length > maxImageLink {
+			return nil, ErrImageFormat
+		}
+
+		// the link is read through a limited reader so that no more is
+		// allocated than the image actually holds
+		link, err := io.ReadAll(io.LimitReader(io.TeeReader(ir.r, ir.h), length))
+		if err == nil && int64(len(link)) != length {
+			err = ErrImageFormat
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		inode := &memInode{
+			fs:      fs,
+			num:     memInodeNum(num),
+			parent:  memInodeNum(parent),
+			mode:    os.FileMode(mode),
+			modTime: time.Unix(0, modTime),
+			link:    string(link),
+		}
+		fs.inodes = append(fs.inodes, inode)
+		if free {
+			fs.freeInodes = append(fs.freeInodes, inode.num)
+		}
+
+		ir.read(&length)
+		if ir.err == nil && length > 0 {
+			file := &memFile{notifier: fs, inode: inode}
+			_, ir.err = io.CopyN(io.NewOffsetWriter(file, 0), io.TeeReader(ir.r, ir.h), length)
+		}
+	}
+
+	if ir.err != nil {
+		if ir.err == io.EOF || ir.err == io.ErrUnexpectedEOF {
+			ir.err = ErrImageFormat
+		}
+		return nil, ir.err
+	}
+
+	if len(fs.inodes) == 0 || !fs.inodes[0].IsDir() || !fs.checkDirs() {
+		return nil, ErrImageFormat
+	}
+
+	digest := make([]byte, sha256.Size)
+	signatureLen := uint16(0)
+	_, err := io.ReadFull(r, digest)
+	if err == nil {
+		err = binary.Read(r, binary.BigEndian, &signatureLen)
+	}
+
+	if err == nil && signatureLen != 0 && signatureLen != ed25519.SignatureSize {
+		err = ErrImageFormat
+	}
+
+	signature := make([]byte, signatureLen)
+	if err == nil {
+		_, err = io.ReadFull(r, signature)
+	}
+
+	if err != nil {
+		return nil, ErrImageFormat
+	}
+
+	if string(digest) != string(ir.h.Sum(nil)) {
+		return nil, ErrChecksum
+	}
+
+	if config.verifyKey != nil && (len(signature) == 0 || !ed25519.Verify(config.verifyKey, digest, signature)) {
+		return nil, ErrSignature
+	}
+	return fs, nil
+}
+
+// checkDirs reports whether every directory of a loaded image holds well
+// formed entries referring to inodes in the image, and whether the
+// directories form a tree, each being the entry of at most one directory
+// and the root of none, so that a corrupt image cannot loop
+func (fs *memfs) checkDirs() bool {
+	linked := make(map[memInodeNum]bool)
+	for _, inode := range fs.inodes {
+		if !inode.IsDir() {
+			continue
+		}
+
+		dir := &memDir{fs: fs, file: &memFile{notifier: fs, inode: inode}}
+		ent, err := dir.next()
+		for ; err == nil; ent, err = dir.next() {
+			if ent.inode < 0 || int(ent.inode) >= len(fs.inodes) {
+				return false
+			} else if fs.inodes[ent.inode].IsDir() {
+				if ent.inode == 0 || linked[ent.inode] {
+					return false
+				}
+				linked[ent.inode] = true
+			}
+		}
+
+		if err != io.EOF {
+			return false
+		}
+	}
+	return true
+}
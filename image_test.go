@@ -0,0 +1,204 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+)
+
+func testImageFs() FileSystem {
+	fs := NewMemFs()
+	MkdirAll(fs, "/one/two", 0750)
+	WriteFile(fs, "/one/foo.txt", []byte("hello world"), 0644)
+	WriteFile(fs, "/one/two/big.bin", bytes.Repeat([]byte{42}, 3*int(blocksize)+10), 0600)
+	fs.Create("/removed.txt")
+	fs.Remove("/removed.txt")
+	return fs
+}
+
+func TestImageRoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := SaveImage(testImageFs(), buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fs, err := NewMemFsFromImage(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := ReadFile(fs, "/one/foo.txt")
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("Wanted %q got %q (err %v)", "hello world", string(got), err)
+	}
+
+	got, err = ReadFile(fs, "/one/two/big.bin")
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte{42}, 3*int(blocksize)+10)) {
+		t.Errorf("Big file did not round trip (err %v)", err)
+	}
+
+	fi, err := fs.Stat("/one/two")
+	if err != nil || fi.Mode().Perm() != 0750 || !fi.IsDir() {
+		t.Errorf("Wanted directory with mode 0750 got %v (err %v)", fi, err)
+	}
+
+	if _, err := fs.Stat("/removed.txt"); !IsNotExist(err) {
+		t.Errorf("Wanted ErrNotExist got %v", err)
+	}
+
+	// the freed inode should be reused
+	mfs := fs.(*memfs)
+	if len(mfs.freeInodes) != 1 {
+		t.Errorf("Wanted 1 free inode got %d", len(mfs.freeInodes))
+	}
+}
+
+func TestMemFsSave(t *testing.T) {
+	buf := &bytes.Buffer{}
+	saver, ok := testImageFs().(interface{ Save(io.Writer) error })
+	if !ok {
+		t.Fatalf("Wanted memfs to implement Save")
+	} else if err := saver.Save(buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fs, err := LoadMemFs(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, err := ReadFile(fs, "/one/foo.txt"); err != nil || string(got) != "hello world" {
+		t.Errorf("Wanted %q got %q (err %v)", "hello world", string(got), err)
+	}
+
+	if _, err = LoadMemFs(bytes.NewReader([]byte("not an image"))); err != ErrImageFormat {
+		t.Errorf("Wanted %v got %v", ErrImageFormat, err)
+	}
+}
+
+func TestImageVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+
+	signed := &bytes.Buffer{}
+	SaveImage(testImageFs(), signed, WithSigningKey(priv))
+	unsigned := &bytes.Buffer{}
+	SaveImage(testImageFs(), unsigned)
+	corrupt := append([]byte(nil), signed.Bytes()...)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	tests := []struct {
+		name    string
+		image   []byte
+		opts    []ImageOption
+		wantErr error
+	}{
+		{"signed", signed.Bytes(), []ImageOption{WithVerify(pub)}, nil},
+		{"signed no verify", signed.Bytes(), nil, nil},
+		{"wrong key", signed.Bytes(), []ImageOption{WithVerify(otherPub)}, ErrSignature},
+		{"unsigned", unsigned.Bytes(), []ImageOption{WithVerify(pub)}, ErrSignature},
+		{"corrupt", corrupt, []ImageOption{WithVerify(pub)}, ErrChecksum},
+		{"truncated", signed.Bytes()[:100], nil, ErrImageFormat},
+		{"not an image", []byte("hello world"), nil, ErrImageFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewMemFsFromImage(bytes.NewReader(test.image), test.opts...)
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+// imageInode is an inode record for building crafted images
+type imageInode struct {
+	parent int64
+	mode   os.FileMode
+	link   int64
+	data   []byte
+}
+
+// craftImage builds an image holding inodes, each link being given only a
+// length with a single byte of data behind it
+func craftImage(inodes []imageInode, signatureLen uint16) []byte {
+	buf := &bytes.Buffer{}
+	iw := &imageWriter{w: buf, h: sha256.New()}
+	iw.write(imageMagic)
+	iw.write(imageVersion)
+	iw.write(int64(len(inodes)))
+	for i, inode := range inodes {
+		iw.write(int64(i))
+		iw.write(false)
+		iw.write(inode.parent)
+		iw.write(uint32(inode.mode))
+		iw.write(int64(0))
+		iw.write(inode.link)
+		if inode.link > 0 {
+			iw.write([]byte{'x'})
+		}
+		iw.writeBytes(inode.data)
+	}
+	buf.Write(iw.h.Sum(nil))
+	binary.Write(buf, binary.BigEndian, signatureLen)
+	return buf.Bytes()
+}
+
+func TestImageCorrupt(t *testing.T) {
+	dirent := func(inode memInodeNum, name string) []byte {
+		buf := &bytes.Buffer{}
+		(&dirent{inode: inode, name: name}).write(buf)
+		return buf.Bytes()
+	}
+
+	root := imageInode{mode: os.ModeDir | 0755}
+	tests := []struct {
+		name    string
+		image   []byte
+		wantErr error
+	}{
+		{"valid", craftImage([]imageInode{root}, 0), nil},
+		{"huge link", craftImage([]imageInode{root, {link: 1 << 40}}, 0), ErrImageFormat},
+		{"link past end", craftImage([]imageInode{root, {link: 4000}}, 0), ErrImageFormat},
+		{"negative link", craftImage([]imageInode{root, {link: -1}}, 0), ErrImageFormat},
+		{"parent out of range", craftImage([]imageInode{root, {parent: 2}}, 0), ErrImageFormat},
+		{"negative parent", craftImage([]imageInode{root, {parent: -1}}, 0), ErrImageFormat},
+		{"entry out of range", craftImage([]imageInode{{mode: os.ModeDir | 0755, data: dirent(5, "foo")}}, 0), ErrImageFormat},
+		{"bad entry", craftImage([]imageInode{{mode: os.ModeDir | 0755, data: []byte{1, 2, 3}}}, 0), ErrImageFormat},
+		{"directory loop", craftImage([]imageInode{{mode: os.ModeDir | 0755, data: dirent(1, "a")}, {mode: os.ModeDir | 0755, data: dirent(1, "self")}}, 0), ErrImageFormat},
+		{"root entry", craftImage([]imageInode{{mode: os.ModeDir | 0755, data: dirent(0, "root")}}, 0), ErrImageFormat},
+		{"signature length", craftImage([]imageInode{root}, 1000), ErrImageFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewMemFsFromImage(bytes.NewReader(test.image))
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func FuzzLoadMemFs(f *testing.F) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/one/two", 0750)
+	WriteFile(fs, "/one/foo.txt", []byte("hello world"), 0644)
+	fs.(interface{ Symlink(string, string) error }).Symlink("/one/foo.txt", "/link")
+	buf := &bytes.Buffer{}
+	SaveImage(fs, buf)
+	f.Add(buf.Bytes())
+	f.Add(craftImage([]imageInode{{mode: os.ModeDir | 0755}}, 0))
+
+	f.Fuzz(func(t *testing.T, image []byte) {
+		fs, err := LoadMemFs(bytes.NewReader(image))
+		if err == nil {
+			Walk(fs, "/", func(string, os.FileInfo, error) error { return nil })
+		}
+	})
+}
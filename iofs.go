@@ -0,0 +1,143 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// ioFS is a read-only FileSystem backed by an io/fs.FS
+type ioFS struct {
+	fsys fs.FS
+}
+
+// FromIoFS returns a read-only FileSystem that serves files from fsys.  This
+// allows values such as embed.FS or a zip.Reader to be used anywhere a
+// FileSystem is expected.  Any operation that would modify the filesystem
+// returns ErrReadOnly and Watcher returns ErrNotSupported
+func FromIoFS(fsys fs.FS) FileSystem {
+	return &ioFS{fsys: fsys}
+}
+
+// name converts a vfs path (rooted at "/") into the unrooted form
+// required by io/fs
+func (ifs *ioFS) name(filename string) string {
+	filename = strings.TrimPrefix(Clean(filename), PathSeparator)
+	if filename == "" {
+		filename = "."
+	}
+	return filename
+}
+
+func (ifs *ioFS) Chmod(filename string, mode os.FileMode) error {
+	return &PathError{Op: "chmod", Path: filename, Cause: ErrReadOnly}
+}
+
+func (ifs *ioFS) Create(filename string) (File, error) {
+	return nil, &PathError{Op: "create", Path: filename, Cause: ErrReadOnly}
+}
+
+func (ifs *ioFS) Open(filename string) (File, error) {
+	return ifs.OpenFile(filename, RdOnlyFlag, 0)
+}
+
+// OpenFile opens the named file for reading.  Any flags other than RdOnlyFlag
+// (with the exception of AppendFlag which has no effect on a read-only file)
+// result in ErrReadOnly
+func (ifs *ioFS) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if flag.accessMode() != RdOnlyFlag || flag.has(CreateFlag) || flag.has(TruncFlag) {
+		return nil, &PathError{Op: "open", Path: filename, Cause: ErrReadOnly}
+	}
+
+	f, err := ifs.fsys.Open(ifs.name(filename))
+	if err != nil {
+		return nil, fixErr(err)
+	}
+	return &ioFile{File: f, name: filename}, nil
+}
+
+func (ifs *ioFS) Mkdir(name string, perm os.FileMode) error {
+	return &PathError{Op: "mkdir", Path: name, Cause: ErrReadOnly}
+}
+
+func (ifs *ioFS) Remove(name string) error {
+	return &PathError{Op: "remove", Path: name, Cause: ErrReadOnly}
+}
+
+func (ifs *ioFS) Rename(oldpath, newpath string) error {
+	return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrReadOnly}
+}
+
+// Lstat returns a FileInfo describing the named file.  io/fs has no notion
+// of symbolic links so this is the same as Stat
+func (ifs *ioFS) Lstat(filename string) (os.FileInfo, error) {
+	return ifs.Stat(filename)
+}
+
+func (ifs *ioFS) Stat(filename string) (os.FileInfo, error) {
+	fi, err := fs.Stat(ifs.fsys, ifs.name(filename))
+	return fi, fixErr(err)
+}
+
+func (ifs *ioFS) Close() error { return nil }
+
+func (ifs *ioFS) Watcher(chan<- Event) (Watcher, error) {
+	return nil, ErrNotSupported
+}
+
+// ioFile adapts an fs.File to the File interface.  Seek and ReadAt are
+// only available if the underlying fs.File supports them
+type ioFile struct {
+	fs.File
+	name string
+}
+
+func (f *ioFile) Name() string { return f.name }
+
+func (f *ioFile) Write(p []byte) (int, error) {
+	return 0, &PathError{Op: "write", Path: f.name, Cause: ErrReadOnly}
+}
+
+func (f *ioFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &PathError{Op: "write", Path: f.name, Cause: ErrReadOnly}
+}
+
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	if seeker, ok := f.File.(io.Seeker); ok {
+		return seeker.Seek(offset, whence)
+	}
+	return 0, &PathError{Op: "seek", Path: f.name, Cause: ErrNotSupported}
+}
+
+func (f *ioFile) ReadAt(p []byte, off int64) (int, error) {
+	if readerAt, ok := f.File.(io.ReaderAt); ok {
+		return readerAt.ReadAt(p, off)
+	}
+	return 0, &PathError{Op: "read", Path: f.name, Cause: ErrNotSupported}
+}
+
+func (f *ioFile) Readdir(n int) (infos []os.FileInfo, err error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &PathError{Op: "readdir", Path: f.name, Cause: ErrNotDir}
+	}
+
+	entries, err := dir.ReadDir(n)
+	for _, entry := range entries {
+		info, err1 := entry.Info()
+		if err1 != nil {
+			return infos, fixErr(err1)
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (f *ioFile) Readdirnames(n int) (names []string, err error) {
+	infos, err := f.Readdir(n)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, err
+}
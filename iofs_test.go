@@ -0,0 +1,69 @@
+package vfs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIoFS(t *testing.T) {
+	fs := FromIoFS(fstest.MapFS{
+		"foo.txt":         {Data: []byte("hello world")},
+		"dir/bar.txt":     {Data: []byte("bar")},
+		"dir/sub/baz.txt": {Data: []byte("baz")},
+	})
+
+	got, err := ReadFile(fs, "/foo.txt")
+	if err == nil {
+		if string(got) != "hello world" {
+			t.Errorf("Wanted %q got %q", "hello world", string(got))
+		}
+	} else {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	var paths []string
+	err = Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		paths = append(paths, path)
+		return err
+	})
+	want := []string{"/", "/dir", "/dir/bar.txt", "/dir/sub", "/dir/sub/baz.txt", "/foo.txt"}
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if !reflect.DeepEqual(want, paths) {
+		t.Errorf("Wanted paths %v got %v", want, paths)
+	}
+
+	if _, err := fs.Stat("/missing"); !IsNotExist(err) {
+		t.Errorf("Wanted ErrNotExist got %v", err)
+	}
+}
+
+func TestIoFSReadOnly(t *testing.T) {
+	fs := FromIoFS(fstest.MapFS{"foo.txt": {Data: []byte("hello world")}})
+	tests := []struct {
+		name string
+		test func() error
+	}{
+		{"Create", func() error { _, err := fs.Create("/bar.txt"); return err }},
+		{"OpenFile", func() error { _, err := fs.OpenFile("/foo.txt", WrOnlyFlag, 0); return err }},
+		{"Mkdir", func() error { return fs.Mkdir("/dir", 0755) }},
+		{"Remove", func() error { return fs.Remove("/foo.txt") }},
+		{"Rename", func() error { return fs.Rename("/foo.txt", "/bar.txt") }},
+		{"Chmod", func() error { return fs.Chmod("/foo.txt", 0755) }},
+		{"Write", func() error {
+			f, _ := fs.Open("/foo.txt")
+			_, err := f.Write([]byte("x"))
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.test(); !IsError(ErrReadOnly, got) {
+				t.Errorf("Wanted error %v got %v", ErrReadOnly, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package vfs
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LatencyConfig describes the delays a FileSystem returned by NewLatencyFs
+// injects
+type LatencyConfig struct {
+	// Delay is added before every operation
+	Delay time.Duration
+
+	// Ops overrides Delay for individual operations, keyed by the names
+	// reported in Op.Name such as "open" or "read"
+	Ops map[string]time.Duration
+
+	// Jitter randomly lengthens or shortens each delay by up to Jitter.
+	// Delays never become negative
+	Jitter time.Duration
+
+	// Seed seeds the jitter so that the delays of a run can be repeated
+	Seed int64
+
+	// BytesPerSecond caps the throughput of every read and write by
+	// delaying its return until the bytes transferred would have taken
+	// that long.  Zero means no cap.  The cap applies to each transfer on
+	// its own, concurrent transfers do not share it
+	BytesPerSecond int64
+
+	// Clock is used to wait out the delays, it defaults to SystemClock.
+	// Tests can use a Clock that does not actually wait
+	Clock Clock
+}
+
+// latencyObserver delays operations of an observed FileSystem
+type latencyObserver struct {
+	config LatencyConfig
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewLatencyFs returns a FileSystem that slows down every operation on fs
+// and on the files it opens as described by config.  It simulates slow
+// disks and network filesystems so that timeouts and retries can be tested
+func NewLatencyFs(fs FileSystem, config LatencyConfig) FileSystem {
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	return Observe(fs, &latencyObserver{config: config, rand: rand.New(rand.NewSource(config.Seed))})
+}
+
+// delay returns the delay for the named operation
+func (lo *latencyObserver) delay(name string) time.Duration {
+	delay, found := lo.config.Ops[name]
+	if !found {
+		delay = lo.config.Delay
+	}
+
+	if lo.config.Jitter > 0 {
+		lo.mu.Lock()
+		delay += time.Duration(lo.rand.Int63n(int64(2*lo.config.Jitter)+1)) - lo.config.Jitter
+		lo.mu.Unlock()
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// sleep waits for d on the configured clock
+func (lo *latencyObserver) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	lo.config.Clock.AfterFunc(d, func() { close(done) })
+	<-done
+}
+
+func (lo *latencyObserver) Begin(op Op) func(n int, err error) {
+	lo.sleep(lo.delay(op.Name))
+	return func(n int, err error) {
+		if lo.config.BytesPerSecond > 0 && (op.Name == "read" || op.Name == "write") {
+			lo.sleep(time.Duration(int64(n) * int64(time.Second) / lo.config.BytesPerSecond))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package vfs
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sleepClock is a Clock that records the durations it is asked to wait and
+// fires immediately
+type sleepClock struct {
+	mu    sync.Mutex
+	slept []time.Duration
+}
+
+func (c *sleepClock) Now() time.Time { return time.Now() }
+
+func (c *sleepClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	c.slept = append(c.slept, d)
+	c.mu.Unlock()
+	return time.AfterFunc(0, f)
+}
+
+func TestLatencyFs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config LatencyConfig
+		want   []time.Duration
+	}{
+		{"delay", LatencyConfig{Delay: time.Millisecond}, []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}},
+		{"per op", LatencyConfig{Delay: time.Millisecond, Ops: map[string]time.Duration{"read": time.Second, "close": 0}}, []time.Duration{time.Millisecond, time.Second}},
+		{"throughput", LatencyConfig{BytesPerSecond: 10}, []time.Duration{500 * time.Millisecond}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := NewMemFs()
+			WriteFile(base, "/file.txt", []byte("hello"), 0644)
+
+			clock := &sleepClock{}
+			test.config.Clock = clock
+			fs := NewLatencyFs(base, test.config)
+
+			f, err := fs.Open("/file.txt")
+			if err == nil {
+				f.Read(make([]byte, 10))
+				err = f.(interface{ Close() error }).Close()
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.want, clock.slept) {
+				t.Errorf("Wanted %v got %v", test.want, clock.slept)
+			}
+		})
+	}
+}
+
+func TestLatencyJitter(t *testing.T) {
+	delays := func(seed int64) []time.Duration {
+		clock := &sleepClock{}
+		fs := NewLatencyFs(NewMemFs(), LatencyConfig{Delay: 10 * time.Millisecond, Jitter: 5 * time.Millisecond, Seed: seed, Clock: clock})
+		for i := 0; i < 10; i++ {
+			fs.Stat("/")
+		}
+		return clock.slept
+	}
+
+	first := delays(1)
+	for _, d := range first {
+		if d < 5*time.Millisecond || d > 15*time.Millisecond {
+			t.Errorf("Wanted delays within the jitter got %v", d)
+		}
+	}
+
+	if second := delays(1); !reflect.DeepEqual(first, second) {
+		t.Errorf("Wanted the same seed to repeat the delays, got %v and %v", first, second)
+	}
+}
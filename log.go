@@ -0,0 +1,57 @@
+package vfs
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Logger receives the records written by a FileSystem returned from
+// NewLogFs.  It is satisfied by *slog.Logger
+type Logger interface {
+	LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+// logObserver writes a record for every operation of an observed FileSystem
+type logObserver struct {
+	logger Logger
+}
+
+// NewLogFs returns a FileSystem that logs every operation on fs, and on the
+// files it opens, to logger.  The message of each record is the name of the
+// operation, such as "open" or "rename", and its attributes are the path,
+// the new path of a rename, the flags and permissions given, the number of
+// bytes or directory entries transferred, the duration and the error.
+// Successful operations are logged at slog.LevelDebug and failures at
+// slog.LevelWarn, reaching the end of a file is not a failure
+func NewLogFs(fs FileSystem, logger Logger) FileSystem {
+	return Observe(fs, logObserver{logger})
+}
+
+func (lo logObserver) Begin(op Op) func(n int, err error) {
+	start := time.Now()
+	return func(n int, err error) {
+		attrs := []slog.Attr{slog.String("path", op.Path)}
+		if op.NewPath != "" {
+			attrs = append(attrs, slog.String("newpath", op.NewPath))
+		}
+
+		switch op.Name {
+		case "openfile":
+			attrs = append(attrs, slog.String("flag", op.Flag.String()), slog.String("mode", op.Mode.String()))
+		case "chmod", "mkdir":
+			attrs = append(attrs, slog.String("mode", op.Mode.String()))
+		case "read", "write", "readdir":
+			attrs = append(attrs, slog.Int("n", n))
+		}
+		attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+
+		level := slog.LevelDebug
+		if err != nil && err != io.EOF {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.Any("error", err))
+		}
+		lo.logger.LogAttrs(context.Background(), level, op.Name, attrs...)
+	}
+}
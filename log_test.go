@@ -0,0 +1,45 @@
+package vfs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogFs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey || attr.Key == "duration" {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+
+	fs := NewLogFs(NewMemFs(), logger)
+	WriteFile(fs, "/file.txt", []byte("hello"), 0644)
+	fs.Rename("/file.txt", "/renamed.txt")
+	fs.Remove("/file.txt")
+
+	want := []string{
+		`level=DEBUG msg=openfile path=/file.txt flag=O_WRONLY|O_CREATE|O_TRUNC mode=-rw-r--r--`,
+		`level=DEBUG msg=write path=/file.txt n=5`,
+		`level=DEBUG msg=close path=/file.txt`,
+		`level=DEBUG msg=rename path=/file.txt newpath=/renamed.txt`,
+		`level=WARN msg=remove path=/file.txt error="remove /file.txt: no such file or directory"`,
+	}
+
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("Wanted %d records got %d:\n%s", len(want), len(got), buf.String())
+	}
+
+	for i, line := range got {
+		if line != want[i] {
+			t.Errorf("Wanted %s got %s", want[i], line)
+		}
+	}
+}
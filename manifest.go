@@ -0,0 +1,167 @@
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ManifestEntry describes a single file, directory or symbolic link.  File
+// content is represented only by its digest
+type ManifestEntry struct {
+	// Path is the slash separated path relative to the manifest root
+	Path string `json:"path"`
+
+	// Mode is the file mode in the form returned by os.FileMode.String
+	Mode string `json:"mode"`
+
+	// Size is the size of a regular file
+	Size int64 `json:"size,omitempty"`
+
+	// Hash is the sha256 digest of a regular file's contents
+	Hash string `json:"hash,omitempty"`
+
+	// Link is the target of a symbolic link
+	Link string `json:"link,omitempty"`
+}
+
+// FileMode parses Mode back into an os.FileMode
+func (entry *ManifestEntry) FileMode() (os.FileMode, error) {
+	const perms = "rwxrwxrwx"
+	const types = "dalTLDpSugct?"
+	if len(entry.Mode) < len(perms) {
+		return 0, fmt.Errorf("invalid file mode %q", entry.Mode)
+	}
+
+	var mode os.FileMode
+	kinds, bits := entry.Mode[:len(entry.Mode)-len(perms)], entry.Mode[len(entry.Mode)-len(perms):]
+	for _, c := range kinds {
+		i := strings.IndexRune(types, c)
+		if c == '-' && len(kinds) == 1 {
+			continue
+		} else if i < 0 {
+			return 0, fmt.Errorf("invalid file mode %q", entry.Mode)
+		}
+		mode |= 1 << uint(32-1-i)
+	}
+
+	for i, c := range bits {
+		if c == rune(perms[i]) {
+			mode |= 1 << uint(len(perms)-1-i)
+		} else if c != '-' {
+			return 0, fmt.Errorf("invalid file mode %q", entry.Mode)
+		}
+	}
+	return mode, nil
+}
+
+// Manifest is a content-free description of a directory tree.  Its JSON form
+// is deterministic (entries are sorted and no timestamps are recorded) so it
+// can be committed alongside code and reviewed as a diff
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// linkReader is implemented by FileSystems that can read symbolic links
+type linkReader interface {
+	Readlink(name string) (string, error)
+}
+
+// ExportManifest walks the tree rooted at root and returns a Manifest
+// describing every entry beneath it
+func ExportManifest(fs FileSystem, root string) (Manifest, error) {
+	manifest := Manifest{Entries: []ManifestEntry{}}
+	err := Walk(fs, root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || filename == root {
+			return err
+		}
+
+		entry := ManifestEntry{
+			Path: Rel(root, filename),
+			Mode: info.Mode().String(),
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if reader, ok := fs.(linkReader); ok {
+				entry.Link, err = reader.Readlink(filename)
+			}
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+			entry.Hash, err = hashFile(fs, filename)
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		return err
+	})
+	return manifest, err
+}
+
+// hashFile returns the hex encoded sha256 digest of a file
+func hashFile(fs FileSystem, filename string) (string, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if closer, ok := f.(io.Closer); ok {
+		closer.Close()
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), err
+}
+
+// ImportManifest reads a Manifest previously written with WriteTo
+func ImportManifest(r io.Reader) (*Manifest, error) {
+	manifest := &Manifest{}
+	err := json.NewDecoder(r).Decode(manifest)
+	return manifest, err
+}
+
+// WriteTo writes the manifest as indented JSON
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// ManifestChange describes a difference between two manifests.  Old is nil
+// for added entries and New is nil for removed entries
+type ManifestChange struct {
+	Path string
+	Old  *ManifestEntry
+	New  *ManifestEntry
+}
+
+// Diff returns the changes required to go from m to other, ordered by path
+func (m *Manifest) Diff(other *Manifest) (changes []ManifestChange) {
+	old := make(map[string]*ManifestEntry)
+	for i := range m.Entries {
+		old[m.Entries[i].Path] = &m.Entries[i]
+	}
+
+	seen := make(map[string]bool)
+	for i := range other.Entries {
+		entry := &other.Entries[i]
+		seen[entry.Path] = true
+		if prev, found := old[entry.Path]; !found || *prev != *entry {
+			changes = append(changes, ManifestChange{Path: entry.Path, Old: prev, New: entry})
+		}
+	}
+
+	for i := range m.Entries {
+		if !seen[m.Entries[i].Path] {
+			changes = append(changes, ManifestChange{Path: m.Entries[i].Path, Old: &m.Entries[i]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
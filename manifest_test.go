@@ -0,0 +1,62 @@
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/out/dir", 0755)
+	WriteFile(fs, "/out/dir/foo.txt", []byte("hello world"), 0644)
+	WriteFile(fs, "/out/bar.txt", []byte("bar"), 0600)
+
+	manifest, err := ExportManifest(fs, "/out")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []ManifestEntry{
+		{Path: "bar.txt", Mode: "-rw-------", Size: 3, Hash: "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"},
+		{Path: "dir", Mode: "drwxr-xr-x"},
+		{Path: "dir/foo.txt", Mode: "-rw-r--r--", Size: 11, Hash: "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+	}
+	if !reflect.DeepEqual(want, manifest.Entries) {
+		t.Errorf("Wanted entries %v got %v", want, manifest.Entries)
+	}
+
+	buf := &bytes.Buffer{}
+	manifest.WriteTo(buf)
+	imported, err := ImportManifest(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if changes := manifest.Diff(imported); len(changes) != 0 {
+		t.Errorf("Wanted no changes after round trip got %v", changes)
+	}
+
+	WriteFile(fs, "/out/dir/foo.txt", []byte("goodbye"), 0644)
+	fs.Create("/out/new.txt")
+	changed, _ := ExportManifest(fs, "/out")
+	changes := manifest.Diff(&changed)
+	if len(changes) != 2 || changes[0].Path != "dir/foo.txt" || changes[1].Path != "new.txt" || changes[1].Old != nil {
+		t.Errorf("Unexpected changes %v", changes)
+	}
+}
+
+func TestManifestEntryFileMode(t *testing.T) {
+	modes := []os.FileMode{0, 0644, 0755 | os.ModeDir, 0777 | os.ModeSymlink, 0755 | os.ModeSetuid | os.ModeSticky}
+	for _, want := range modes {
+		entry := &ManifestEntry{Mode: want.String()}
+		if got, err := entry.FileMode(); err != nil || got != want {
+			t.Errorf("%s: wanted %v got %v %v", entry.Mode, want, got, err)
+		}
+	}
+
+	if _, err := (&ManifestEntry{Mode: "bogus"}).FileMode(); err == nil {
+		t.Errorf("Expected error for invalid mode")
+	}
+}
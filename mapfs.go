@@ -0,0 +1,86 @@
+package vfs
+
+import (
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// MapFile describes a file, directory or symbolic link created by
+// NewMemFsFromMap
+type MapFile struct {
+	// Data is the contents of a regular file or the target of a symbolic
+	// link
+	Data []byte
+
+	// Mode is the type and permissions of the file.  Permissions default
+	// to 0644 for files and 0755 for directories when none are given
+	Mode os.FileMode
+
+	// ModTime is the modification time of the file, it defaults to the
+	// time the file was created
+	ModTime time.Time
+}
+
+// NewMemFsFromMap creates a new memfs holding the given files, keyed by
+// name in the same way as testing/fstest.MapFS.  A nil MapFile is an empty
+// regular file and the parent directories of every name are created as
+// needed with mode 0755.  The options are the same as for NewMemFs
+func NewMemFsFromMap(files map[string]*MapFile, opts ...Option) (FileSystem, error) {
+	fs := NewMemFs(opts...).(*memfs)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := files[name]
+		if file == nil {
+			file = &MapFile{}
+		}
+
+		filename := Clean(name)
+		err := MkdirAll(fs, path.Dir(filename), 0755)
+		switch {
+		case err != nil:
+		case file.Mode.IsDir():
+			err = MkdirAll(fs, filename, 0755)
+		case file.Mode&os.ModeSymlink != 0:
+			err = fs.Symlink(string(file.Data), filename)
+		default:
+			err = WriteFile(fs, filename, file.Data, 0644)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// modes and times are set once everything exists so that restrictive
+	// permissions do not get in the way of creating children and adding
+	// children does not change the time of their directory
+	for _, name := range names {
+		file := files[name]
+		if file == nil {
+			continue
+		}
+
+		inode, err := fs.find(Clean(name))
+		if err != nil {
+			return nil, err
+		}
+
+		if perm := file.Mode.Perm(); perm != 0 {
+			inode.setMode(inode.Mode()&os.ModeType | file.Mode&^os.ModeType)
+		}
+
+		if !file.ModTime.IsZero() {
+			inode.Lock()
+			inode.modTime = file.ModTime
+			inode.Unlock()
+		}
+	}
+	return fs, nil
+}
@@ -0,0 +1,63 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewMemFsFromMap(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fs, err := NewMemFsFromMap(map[string]*MapFile{
+		"a/b/file.txt": {Data: []byte("hello"), Mode: 0600, ModTime: modTime},
+		"a/empty":      nil,
+		"dir":          {Mode: os.ModeDir | 0500, ModTime: modTime},
+		"dir/child":    {Data: []byte("child")},
+		"link":         {Data: []byte("a/b/file.txt"), Mode: os.ModeSymlink | 0777},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		wantMode os.FileMode
+		wantData string
+		wantTime time.Time
+	}{
+		{"/a", os.ModeDir | 0755, "", time.Time{}},
+		{"/a/b", os.ModeDir | 0755, "", time.Time{}},
+		{"/a/b/file.txt", 0600, "hello", modTime},
+		{"/a/empty", 0644, "", time.Time{}},
+		{"/dir", os.ModeDir | 0500, "", modTime},
+		{"/dir/child", 0644, "child", time.Time{}},
+		{"/link", os.ModeSymlink | 0777, "", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := fs.Lstat(test.name)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if info.Mode() != test.wantMode {
+				t.Errorf("Wanted mode %v got %v", test.wantMode, info.Mode())
+			}
+
+			if !test.wantTime.IsZero() && !info.ModTime().Equal(test.wantTime) {
+				t.Errorf("Wanted time %v got %v", test.wantTime, info.ModTime())
+			}
+
+			if info.Mode().IsRegular() {
+				if data, _ := ReadFile(fs, test.name); string(data) != test.wantData {
+					t.Errorf("Wanted %q got %q", test.wantData, data)
+				}
+			}
+		})
+	}
+
+	if data, _ := ReadFile(fs, "/link"); string(data) != "hello" {
+		t.Errorf("Wanted the link to resolve to %q got %q", "hello", data)
+	}
+}
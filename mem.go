@@ -15,22 +15,29 @@
 package vfs
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// blocksize is the default size of the blocks file data is stored in
 const blocksize = int64(1024)
 
 type blockManager interface {
+	blockSize() int64
 	free(...int64)
-	block(int64) []byte
-	alloc() int64
+	readAt(n int64, p []byte, off int64) (int, error)
+	writeAt(n int64, p []byte, off int64) (int, error)
+	alloc() (int64, error)
 }
 
 type memInodeNum int64
@@ -47,41 +54,135 @@ type memInode struct {
 	modTime time.Time
 	link    string // what a symlink points to
 	blocks  []int64
+
+	// fifo is the pipe of a named pipe, created when it is first opened
+	fifo *memFifo
+
+	// opens counts the open handles, an inode that is unlinked while it is
+	// open is only freed once the last of them is closed
+	opens    int
+	unlinked bool
+
+	// appendMu serializes appending writes so that each one lands at the
+	// end of the file
+	appendMu sync.Mutex
+
+	// dirMu guards the entries of a directory.  Lookups and listings share
+	// it while entries are added and removed under the write lock
+	dirMu sync.RWMutex
+
+	// frozen is set by Freeze, nothing changes the inode from then on so
+	// it is read without taking the lock
+	frozen atomic.Bool
+}
+
+// lockRead takes the lock for reading the inode unless it is frozen and
+// reports whether it has to be unlocked
+func (inode *memInode) lockRead() bool {
+	if inode.frozen.Load() {
+		return false
+	}
+	inode.Lock()
+	return true
 }
 
 func (inode *memInode) touch()                   { inode.Lock(); inode.modTime = time.Now(); inode.Unlock() }
-func (inode *memInode) Size() int64              { inode.Lock(); defer inode.Unlock(); return inode.size }
 func (inode *memInode) setMode(mode os.FileMode) { inode.Lock(); inode.mode = mode; inode.Unlock() }
-func (inode *memInode) Mode() os.FileMode        { inode.Lock(); defer inode.Unlock(); return inode.mode }
 func (inode *memInode) IsDir() bool              { return inode.Mode().IsDir() }
 
-func (inode *memInode) ModTime() time.Time {
+func (inode *memInode) Size() int64 {
+	if inode.lockRead() {
+		defer inode.Unlock()
+	}
+	return inode.size
+}
+
+func (inode *memInode) Mode() os.FileMode {
+	if inode.lockRead() {
+		defer inode.Unlock()
+	}
+	return inode.mode
+}
+
+func (inode *memInode) setParent(parent memInodeNum) {
 	inode.Lock()
-	defer inode.Unlock()
+	inode.parent = parent
+	inode.Unlock()
+}
+
+func (inode *memInode) Parent() memInodeNum {
+	if inode.lockRead() {
+		defer inode.Unlock()
+	}
+	return inode.parent
+}
+
+func (inode *memInode) Link() string {
+	if inode.lockRead() {
+		defer inode.Unlock()
+	}
+	return inode.link
+}
+
+func (inode *memInode) ModTime() time.Time {
+	if inode.lockRead() {
+		defer inode.Unlock()
+	}
 	return inode.modTime
 }
 
-func (inode *memInode) trunc(size int64) {
+// trunc shrinks the inode to size.  The rest of the last block is cleared so
+// that bytes past the end of the file always read as zero once the file
+// grows again
+func (inode *memInode) trunc(size int64) error {
+	inode.Lock()
+	defer inode.Unlock()
+	inode.modTime = time.Now()
+
 	// determine number of blocks required for the new size
+	blocksize := inode.fs.blockSize()
 	n := int(size / blocksize)
 	if size%blocksize > 0 {
 		n++
 	}
+
+	if n > len(inode.blocks) {
+		return nil
+	}
+
 	inode.fs.free(inode.blocks[n:]...)
 	inode.size = size
 	inode.blocks = inode.blocks[0:n]
+	if cap(inode.blocks) > 2*n {
+		// let go of the table of a file that shrank a lot
+		inode.blocks = append([]int64(nil), inode.blocks...)
+	}
+	if tail := size % blocksize; tail > 0 {
+		_, err := inode.fs.writeAt(inode.blocks[n-1], make([]byte, blocksize-tail), tail)
+		return err
+	}
+	return nil
+}
+
+func clearBlock(block []byte) {
+	for i := range block {
+		block[i] = 0
+	}
 }
 
 func (inode *memInode) readBlock(block, offset int64, p []byte) (n int, err error) {
-	inode.Lock()
-	defer inode.Unlock()
+	if inode.lockRead() {
+		defer inode.Unlock()
+	}
+	blocksize := inode.fs.blockSize()
 	if (block*blocksize)+offset < inode.size {
 		if inode.size < (block+1)*blocksize {
 			sizeOffset := inode.size - (block * blocksize)
-			n = copy(p, inode.fs.block(inode.blocks[block])[offset:sizeOffset])
-		} else {
-			n = copy(p, inode.fs.block(inode.blocks[block])[offset:])
+			if int64(len(p)) > sizeOffset-offset {
+				p = p[:sizeOffset-offset]
+			}
 		}
+		n, err = inode.fs.readAt(inode.blocks[block], p, offset)
 	} else {
 		err = io.EOF
 	}
@@ -92,16 +193,24 @@ func (inode *memInode) writeBlock(block, offset int64, p []byte) (n int, err err
 	inode.Lock()
 	defer inode.Unlock()
 
-	for {
-		bsize := blocksize * int64(len(inode.blocks))
-		if inode.size < bsize {
-			break
+	// allocate every block up to the one being written, blocks are
+	// allocated cleared so any gap reads as zero
+	for int64(len(inode.blocks)) <= block {
+		allocated, err := inode.fs.alloc()
+		if err != nil {
+			return 0, err
 		}
-		inode.blocks = append(inode.blocks, inode.fs.alloc())
+		inode.blocks = append(inode.blocks, allocated)
+	}
+
+	if n, err = inode.fs.writeAt(inode.blocks[block], p, offset); err != nil {
+		return n, err
 	}
 
-	n = copy(inode.fs.block(inode.blocks[block])[offset:], p)
-	inode.size += int64(n)
+	// the size only grows when writing past the end of the file
+	if end := block*inode.fs.blockSize() + offset + int64(n); end > inode.size {
+		inode.size = end
+	}
 	return
 }
 
@@ -114,27 +223,63 @@ type memFile struct {
 	notifier  memNotifier
 	readOnly  bool
 	writeOnly bool
+	append    bool
 	inode     *memInode
 	offset    int64
-	closed    bool
+	closed    atomic.Bool
 	name      string
+
+	// release is called once the file is closed, to let go of an inode
+	// that was removed while it was open
+	release func()
+
+	// maxSize is the size writes may not grow the file past, zero means
+	// unlimited
+	maxSize int64
 }
 
 func (file *memFile) Name() string {
 	return file.name
 }
 
+// check returns ErrClosed once the file has been closed.  Every operation
+// other than Name fails on a closed file, as it does for an *os.File
+func (file *memFile) check() error {
+	if file.closed.Load() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Stat returns the FileInfo for the inode the file refers to
+func (file *memFile) Stat() (os.FileInfo, error) {
+	if err := file.check(); err != nil {
+		return nil, err
+	}
+	return &memFileInfo{memInode: file.inode, name: path.Base(file.name)}, nil
+}
+
 func (file *memFile) Readdirnames(n int) ([]string, error) {
+	if err := file.check(); err != nil {
+		return nil, err
+	}
 	return nil, ErrNotDir
 }
 
 func (file *memFile) Readdir(n int) ([]os.FileInfo, error) {
+	if err := file.check(); err != nil {
+		return nil, err
+	}
 	return nil, ErrNotDir
 }
 
 func (file *memFile) Seek(offset int64, whence int) (end int64, err error) {
 	file.mu.Lock()
 	defer file.mu.Unlock()
+	if err = file.check(); err != nil {
+		return 0, err
+	}
+
 	if whence == io.SeekStart {
 	} else if whence == io.SeekCurrent {
 		offset = file.offset + offset
@@ -156,84 +301,160 @@ func (file *memFile) Seek(offset int64, whence int) (end int64, err error) {
 func (file *memFile) Read(p []byte) (n int, err error) {
 	file.mu.Lock()
 	defer file.mu.Unlock()
-	if file.writeOnly {
+	if err = file.check(); err != nil {
+		return 0, err
+	} else if file.writeOnly {
+		return 0, ErrWriteOnly
+	}
+
+	n, err = file.readAt(p, file.offset)
+	file.offset += int64(n)
+	return n, err
+}
+
+// ReadAt reads len(p) bytes from the File starting at byte offset off.
+// It returns the number of bytes read and the error, if any. ReadAt
+// always returns a non-nil error when n < len(p). At end of file, that
+// error is io.EOF.  ReadAt does not use or change the file offset
+func (file *memFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if err = file.check(); err != nil {
+		return 0, err
+	} else if file.writeOnly {
 		return 0, ErrWriteOnly
 	}
 
-	maxN := len(p)
-	n = maxN
-	for n > 0 && err == nil {
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+	return file.readAt(p, off)
+}
+
+func (file *memFile) readAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) && err == nil {
 		copied := 0
-		block := file.offset / blocksize
-		offset := file.offset - (block * blocksize)
-		copied, err = file.inode.readBlock(block, offset, p)
-		n -= copied
-		if n > 0 {
-			p = p[copied:]
-		}
-		file.offset += int64(copied)
+		blocksize := file.inode.fs.blockSize()
+		block := off / blocksize
+		offset := off - (block * blocksize)
+		copied, err = file.inode.readBlock(block, offset, p[n:])
+		n += copied
+		off += int64(copied)
 	}
-	return maxN - n, err
+	return n, err
 }
 
 func (file *memFile) Write(p []byte) (n int, err error) {
 	file.mu.Lock()
 	defer file.mu.Unlock()
-	if file.readOnly {
+	if err = file.check(); err != nil {
+		return 0, err
+	} else if file.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if file.append {
+		file.inode.appendMu.Lock()
+		defer file.inode.appendMu.Unlock()
+		file.offset = file.inode.Size()
+	}
+
+	n, err = file.writeAt(p, file.offset)
+	file.offset += int64(n)
+	return n, err
+}
+
+// WriteAt writes len(p) bytes to the File starting at byte offset off.
+// It returns the number of bytes written and an error, if any. WriteAt
+// returns a non-nil error when n != len(p).  WriteAt does not use or
+// change the file offset
+func (file *memFile) WriteAt(p []byte, off int64) (n int, err error) {
+	if err = file.check(); err != nil {
+		return 0, err
+	} else if file.readOnly {
 		return 0, ErrReadOnly
 	}
 
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+	return file.writeAt(p, off)
+}
+
+func (file *memFile) writeAt(p []byte, off int64) (n int, err error) {
+	tooLarge := false
+	if file.maxSize > 0 && off+int64(len(p)) > file.maxSize {
+		keep := file.maxSize - off
+		if keep < 0 {
+			keep = 0
+		}
+		p, tooLarge = p[:keep], true
+	}
+
 	for len(p) > 0 && err == nil {
 		copied := 0
-		block := file.offset / blocksize
-		offset := int64(0)
-		if file.offset < (block+1)*blocksize {
-			offset = file.offset - (block * blocksize)
-		}
+		blocksize := file.inode.fs.blockSize()
+		block := off / blocksize
+		offset := off - (block * blocksize)
 		copied, err = file.inode.writeBlock(block, offset, p)
 		p = p[copied:]
-		file.offset += int64(copied)
+		off += int64(copied)
 		n += copied
 	}
+
+	if n > 0 {
+		file.inode.touch()
+	}
+
 	if !file.inode.IsDir() {
-		file.notifier.notify(ModifyEvent, file.inode.parent, file.name)
+		file.notifier.notify(ModifyEvent, file.inode.Parent(), path.Base(file.name))
 	}
-	return
+
+	if err == nil && tooLarge {
+		err = ErrFileTooLarge
+	}
+	return n, err
 }
 
 func (file *memFile) trunc(size int64) (err error) {
 	file.mu.Lock()
 	defer file.mu.Unlock()
-	if file.readOnly {
+	if err = file.check(); err != nil {
+		return err
+	} else if file.readOnly {
 		return ErrReadOnly
 	}
 	if size < 0 || size > file.inode.Size() {
-		err = ErrSize
+		return ErrSize
 	}
-	file.inode.trunc(size)
-	return
+	return file.inode.trunc(size)
+}
+
+// Sync does nothing since the data is never held anywhere but memory, so
+// SyncFlag and DsyncFlag are accepted and need no further work
+func (file *memFile) Sync() error {
+	return file.check()
 }
 
 func (file *memFile) Close() (err error) {
-	file.mu.Lock()
-	defer file.mu.Unlock()
-	if file.closed {
+	if !file.closed.CompareAndSwap(false, true) {
 		err = ErrClosed
-	} else {
-		file.closed = true
+	} else if file.release != nil {
+		file.release()
 	}
 	return
 }
 
+// flags applies the open flags to the file.  This must only be called once
+// all other checks have passed since it may truncate the file
 func (file *memFile) flags(flag OpenFlag) (err error) {
 	if file.inode.Mode().IsDir() {
-		if flag.has(WrOnlyFlag) || flag.has(RdWrFlag) || flag.has(AppendFlag) || flag.has(CreateFlag) || flag.has(TruncFlag) {
+		if flag.accessMode() != RdOnlyFlag || flag.has(CreateFlag) || flag.has(TruncFlag) {
 			err = ErrIsDir
 		}
 	} else {
-		if flag.has(RdOnlyFlag) {
+		switch flag.accessMode() {
+		case RdOnlyFlag:
 			file.readOnly = true
-		} else if flag.has(WrOnlyFlag) {
+		case WrOnlyFlag:
 			file.writeOnly = true
 		}
 
@@ -242,13 +463,17 @@ func (file *memFile) flags(flag OpenFlag) (err error) {
 		}
 
 		if flag.has(AppendFlag) {
+			file.append = true
 			_, err = file.Seek(0, io.SeekEnd)
 		}
 	}
 	return err
-
 }
 
+// maxNameLen is the longest name a directory entry may have, a longer
+// length read back means the entry is not where it was expected
+const maxNameLen = 4096
+
 type dirent struct {
 	inode memInodeNum
 	name  string
@@ -259,7 +484,9 @@ func (ent *dirent) read(reader io.Reader) error {
 	if err == nil {
 		length := int64(0)
 		err = binary.Read(reader, binary.BigEndian, &length)
-		if err == nil {
+		if err == nil && (length < 0 || length > maxNameLen) {
+			err = ErrNameTooLong
+		} else if err == nil {
 			buf := make([]byte, length)
 			_, err := io.ReadFull(reader, buf)
 			if err == nil {
@@ -294,28 +521,100 @@ func (ent *dirent) size() int64 {
 
 type inodeManager interface {
 	inode(memInodeNum) *memInode
+	mounted(memInodeNum) memInodeNum
 }
 
 type memDir struct {
 	fs   inodeManager
 	file *memFile
+
+	// fold makes name lookups case-insensitive
+	fold bool
+
+	// listing holds the entries read by the first Readdir or ReadDir that
+	// have not been returned yet.  Entries move within the directory as
+	// others are removed, so a handle lists what the directory held when
+	// listing started rather than following the entries around
+	listing []*dirent
+	listed  bool
+}
+
+func (dir *memDir) Name() string                             { return dir.file.Name() }
+func (dir *memDir) Stat() (os.FileInfo, error)               { return dir.file.Stat() }
+func (dir *memDir) Close() error                             { return dir.file.Close() }
+func (dir *memDir) Read(p []byte) (int, error)               { return 0, dir.isDir() }
+func (dir *memDir) Write(p []byte) (int, error)              { return 0, dir.isDir() }
+func (dir *memDir) ReadAt(p []byte, off int64) (int, error)  { return 0, dir.isDir() }
+func (dir *memDir) WriteAt(p []byte, off int64) (int, error) { return 0, dir.isDir() }
+
+// Seek rewinds the directory when given offset 0 and io.SeekStart, so that
+// it can be listed again without reopening it.  Any other seek fails with
+// ErrIsDir
+func (dir *memDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		dir.file.mu.Lock()
+		dir.listing, dir.listed = nil, false
+		dir.file.mu.Unlock()
+		return dir.file.Seek(0, io.SeekStart)
+	}
+	return 0, dir.isDir()
 }
 
-func (dir *memDir) Name() string                                     { return dir.file.Name() }
-func (*memDir) Read(p []byte) (int, error)                           { return 0, ErrIsDir }
-func (*memDir) Write(p []byte) (int, error)                          { return 0, ErrIsDir }
-func (*memDir) Seek(offset int64, whence int) (end int64, err error) { return 0, ErrIsDir }
+// isDir returns the error for file operations on a directory, which is
+// ErrClosed once the directory has been closed and ErrIsDir before
+func (dir *memDir) isDir() error {
+	if err := dir.file.check(); err != nil {
+		return err
+	}
+	return ErrIsDir
+}
 
-// next returns the next directory entry
+// next returns the next directory entry, the directory must be locked
 func (dir *memDir) next() (*dirent, error) {
 	ent := &dirent{}
 	return ent, ent.read(dir.file)
 }
 
+// nextListed returns the next entry of the listing, reading every
+// remaining entry under the read lock of the directory the first time
+func (dir *memDir) nextListed() (*dirent, error) {
+	dir.file.mu.Lock()
+	listed := dir.listed
+	dir.file.mu.Unlock()
+
+	if !listed {
+		var listing []*dirent
+		dir.file.inode.dirMu.RLock()
+		ent, err := dir.next()
+		for ; err == nil; ent, err = dir.next() {
+			listing = append(listing, ent)
+		}
+		dir.file.inode.dirMu.RUnlock()
+
+		if err != io.EOF {
+			return nil, err
+		}
+
+		dir.file.mu.Lock()
+		dir.listing, dir.listed = listing, true
+		dir.file.mu.Unlock()
+	}
+
+	dir.file.mu.Lock()
+	defer dir.file.mu.Unlock()
+	if len(dir.listing) == 0 {
+		return nil, io.EOF
+	}
+	ent := dir.listing[0]
+	dir.listing = dir.listing[1:]
+	return ent, nil
+}
+
+// findEntry looks up the entry for name, the directory must be locked
 func (dir *memDir) findEntry(name string) (ent *dirent, err error) {
 	err = ErrNotExist
 	for ent, err = dir.next(); err == nil; ent, err = dir.next() {
-		if ent.name == name {
+		if ent.name == name || dir.fold && strings.EqualFold(ent.name, name) {
 			err = nil
 			break
 		}
@@ -324,6 +623,8 @@ func (dir *memDir) findEntry(name string) (ent *dirent, err error) {
 }
 
 func (dir *memDir) find(name string) (inode memInodeNum, err error) {
+	dir.file.inode.dirMu.RLock()
+	defer dir.file.inode.dirMu.RUnlock()
 	ent, err := dir.findEntry(name)
 	if err == nil {
 		inode = ent.inode
@@ -332,14 +633,37 @@ func (dir *memDir) find(name string) (inode memInodeNum, err error) {
 }
 
 func (dir *memDir) rename(oldname, newname string) error {
-	ent, err := dir.unlink(oldname)
+	dir.file.inode.dirMu.Lock()
+	ent, err := dir.removeEntry(oldname)
 	if err == nil {
-		err = dir.append(ent.inode, newname)
+		err = dir.addEntry(ent.inode, newname)
+	}
+	dir.file.inode.dirMu.Unlock()
+
+	if err == nil {
+		dir.file.notifier.notify(CreateEvent, dir.file.inode.num, newname)
 	}
 	dir.file.notifier.notify(RenameEvent, dir.file.inode.num, oldname)
 	return err
 }
 
+// replace points the existing entry filename at inode
+func (dir *memDir) replace(filename string, inode memInodeNum) error {
+	dir.file.inode.dirMu.Lock()
+	defer dir.file.inode.dirMu.Unlock()
+	ent, err := dir.findEntry(filename)
+	if err != nil {
+		return err
+	}
+
+	// findEntry leaves the offset just past the entry and the inode number
+	// is the first field of an entry
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(inode))
+	_, err = dir.file.WriteAt(buf, dir.file.offset-ent.size())
+	return err
+}
+
 func (dir *memDir) remove(filename string) (*dirent, error) {
 	ent, err := dir.unlink(filename)
 	if err == nil {
@@ -349,6 +673,14 @@ func (dir *memDir) remove(filename string) (*dirent, error) {
 }
 
 func (dir *memDir) unlink(filename string) (*dirent, error) {
+	dir.file.inode.dirMu.Lock()
+	defer dir.file.inode.dirMu.Unlock()
+	return dir.removeEntry(filename)
+}
+
+// removeEntry drops the entry for filename by moving the entries after it
+// down, the directory must be locked
+func (dir *memDir) removeEntry(filename string) (*dirent, error) {
 	ent, err := dir.findEntry(filename)
 	if err == nil {
 		reader := &memFile{notifier: dir.file.notifier, inode: dir.file.inode, offset: dir.file.offset}
@@ -365,17 +697,42 @@ func (dir *memDir) unlink(filename string) (*dirent, error) {
 }
 
 func (dir *memDir) append(inode memInodeNum, filename string) error {
+	dir.file.inode.dirMu.Lock()
+	_, err := dir.findEntry(filename)
+	if err == nil {
+		// a name is never added twice
+		err = ErrExist
+	} else if err == io.EOF {
+		err = dir.addEntry(inode, filename)
+	}
+	dir.file.inode.dirMu.Unlock()
+
+	if err == nil {
+		dir.file.notifier.notify(CreateEvent, dir.file.inode.num, filename)
+	}
+	return err
+}
+
+// addEntry writes an entry for filename at the end of the directory, the
+// directory must be locked
+func (dir *memDir) addEntry(inode memInodeNum, filename string) error {
+	if len(filename) > maxNameLen {
+		return ErrNameTooLong
+	}
+
 	oldOffset := dir.file.offset
-	_, err := dir.file.Seek(0, io.SeekEnd)
+	size, err := dir.file.Seek(0, io.SeekEnd)
 	if err == nil {
 		ent := &dirent{inode, filename}
-		err = ent.write(dir.file)
+		if err = ent.write(dir.file); err != nil {
+			// drop the partially written entry
+			dir.file.trunc(size)
+		}
 	}
 
 	if err == nil {
 		_, err = dir.file.Seek(oldOffset, io.SeekStart)
 	}
-	dir.file.notifier.notify(CreateEvent, dir.file.inode.num, filename)
 	return err
 }
 
@@ -389,22 +746,65 @@ func (dir *memDir) Readdirnames(n int) (names []string, err error) {
 	return
 }
 
+// Readdir returns up to n entries when n > 0, continuing where the previous
+// call left off, and io.EOF once there are none left.  Otherwise it returns
+// every remaining entry
 func (dir *memDir) Readdir(n int) (entries []os.FileInfo, err error) {
-	for err == nil && n <= 0 {
+	if err = dir.file.check(); err != nil {
+		return nil, err
+	}
+
+	for n <= 0 || len(entries) < n {
 		var ent *dirent
-		ent, err = dir.next()
-		if err == nil {
-			entries = append(entries, &memFileInfo{name: ent.name, memInode: dir.fs.inode(ent.inode)})
-			if n != -1 {
-				n--
-			}
+		if ent, err = dir.nextListed(); err == io.EOF {
+			break
+		} else if err != nil {
+			return entries, err
 		}
+		entries = append(entries, &memFileInfo{name: ent.name, memInode: dir.fs.inode(dir.fs.mounted(ent.inode))})
 	}
 
-	if n == -1 && err == io.EOF {
-		err = nil
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
 	}
-	return
+	return entries, nil
+}
+
+// ReadDir returns the entries of the directory.  The entries refer to the
+// inodes directly, so Info is only computed when it is asked for
+func (dir *memDir) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	if err = dir.file.check(); err != nil {
+		return nil, err
+	}
+
+	for n <= 0 || len(entries) < n {
+		var ent *dirent
+		if ent, err = dir.nextListed(); err == io.EOF {
+			break
+		} else if err != nil {
+			return entries, err
+		}
+		entries = append(entries, &memDirEntry{name: ent.name, inode: dir.fs.inode(dir.fs.mounted(ent.inode))})
+	}
+
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+// memDirEntry is a directory entry returned by memDir.ReadDir
+type memDirEntry struct {
+	name  string
+	inode *memInode
+}
+
+func (ent *memDirEntry) Name() string      { return ent.name }
+func (ent *memDirEntry) IsDir() bool       { return ent.inode.IsDir() }
+func (ent *memDirEntry) Type() fs.FileMode { return ent.inode.Mode().Type() }
+
+func (ent *memDirEntry) Info() (fs.FileInfo, error) {
+	return &memFileInfo{memInode: ent.inode, name: ent.name}, nil
 }
 
 type memFileInfo struct {
@@ -415,32 +815,170 @@ type memFileInfo struct {
 // Name returns the base name of the file
 func (fi *memFileInfo) Name() string { return fi.name }
 
-// Sys returns the underlying data source.  For memfs this is nil
-func (fi *memFileInfo) Sys() interface{} { return nil }
+// Sys returns a *MemStat describing the inode
+func (fi *memFileInfo) Sys() interface{} { return fi.stat() }
+
+// Ino returns the inode number
+func (fi *memFileInfo) Ino() uint64 { return fi.stat().Ino }
+
+// Nlink returns 1, or 2 for directories
+func (fi *memFileInfo) Nlink() uint64 { return fi.stat().Nlink }
+
+// Blocks returns the number of 512 byte units allocated to the file
+func (fi *memFileInfo) Blocks() int64 { return fi.stat().Blocks }
+
+func (fi *memFileInfo) stat() *MemStat {
+	fi.Lock()
+	defer fi.Unlock()
+	stat := &MemStat{
+		Ino:     uint64(fi.num),
+		Nlink:   1,
+		Uid:     owner(os.Getuid()),
+		Gid:     owner(os.Getgid()),
+		Size:    fi.size,
+		Blksize: fi.fs.blockSize(),
+	}
+	stat.Blocks = int64(len(fi.blocks)) * stat.Blksize / 512
+
+	if fi.mode.IsDir() {
+		stat.Nlink = 2
+	}
+	return stat
+}
+
+// MemStat is what Sys returns for the FileInfos of a memfs.  The fields are
+// named after those of syscall.Stat_t so that code inspecting the Sys of an
+// osfs FileInfo is easily adapted
+type MemStat struct {
+	// Ino is the inode number, unique among the live entries of the memfs
+	Ino uint64
+
+	// Nlink is 1, or 2 for directories, since memfs has no hard links
+	Nlink uint64
+
+	// Uid and Gid are those of the process since memfs does not track
+	// ownership
+	Uid uint32
+	Gid uint32
+
+	// Size is the size of the file in bytes
+	Size int64
+
+	// Blksize is the block size of the memfs
+	Blksize int64
+
+	// Blocks is the number of 512 byte units allocated to the file
+	Blocks int64
+}
+
+// owner converts a user or group id to the form used by MemStat, where
+// platforms without ids report zero
+func owner(id int) uint32 {
+	if id < 0 {
+		return 0
+	}
+	return uint32(id)
+}
 
 // memfs is a completely in-memory filesystem.  This filesystem is good for
-// use in unit tests and that is its primary motivation
+// use in unit tests and that is its primary motivation.  The data of each
+// file is guarded by the lock of its inode, so the filesystem locks are only
+// held briefly.  When more than one is needed they are taken in the order
+// inode, filesystem, blocks
 type memfs struct {
+	// the embedded lock guards the inode table and the settings
 	sync.Mutex
 
 	inodes     []*memInode
 	freeInodes []memInodeNum
 
+	// blockMu guards the block table, readers of different files only
+	// share its read lock
+	blockMu    sync.RWMutex
 	freeBlocks []int64
 	blocks     [][]byte
-	watchers   map[memInodeNum]map[*memWatcher]string
+
+	// freeHeld counts the free blocks whose storage has not been released
+	// by compact
+	freeHeld int
+
+	// shared marks the blocks that are shared with a clone or snapshot and
+	// must be copied before they are written
+	shared map[int64]bool
+
+	// watchMu guards the watches and the delivery of their events
+	watchMu  sync.Mutex
+	watchers map[memInodeNum]map[*memWatcher]memWatch
+
+	// recursiveWatches counts the watches covering a whole subtree, events
+	// only need to be matched against ancestor directories when there are
+	// any
+	recursiveWatches int
+
+	// mounts maps bind mount points to the inodes shown at them
+	mounts map[memInodeNum]memInodeNum
+
+	// readOnly is set for snapshots and by Freeze, either way every
+	// modification is rejected
+	readOnly atomic.Bool
+
+	// permissions is set when the permission bits are enforced
+	permissions bool
+
+	// blocksize is the size of the blocks file data is stored in
+	blocksize int64
+
+	// umask is cleared from the permissions of new files and directories
+	umask os.FileMode
+
+	// perms replace the permissions of new files and directories
+	perms defaultPerms
+
+	// caseInsensitive makes name lookups ignore case, names keep the case
+	// they were created with
+	caseInsensitive bool
+
+	// sorted makes directory listings sorted by name
+	sorted bool
+
+	// maxBytes and maxInodes limit the capacity of the filesystem, zero
+	// means unlimited
+	maxBytes  int64
+	maxInodes int
+
+	// maxFileSize limits the size of regular files, zero means unlimited
+	maxFileSize int64
+
+	// overflow is the policy given to new watchers
+	overflow OverflowPolicy
+
+	// mmap is set by WithMmap, arena then provides the block storage
+	mmap  bool
+	arena *mmapArena
+
+	// spill is set by WithSpill and moves cold blocks out of memory
+	spill *memSpill
 }
 
 // NewMemFs will instantiate a new in-memory virtual filesystem
-func NewMemFs() FileSystem {
+func NewMemFs(opts ...Option) FileSystem {
 	fs := &memfs{
-		watchers: make(map[memInodeNum]map[*memWatcher]string),
+		watchers:  make(map[memInodeNum]map[*memWatcher]memWatch),
+		blocksize: blocksize,
+	}
+
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	if fs.mmap {
+		fs.arena = newMmapArena(fs.blocksize)
 	}
 
 	root := &memInode{
 		fs:      fs,
 		num:     0,
-		mode:    os.ModeDir,
+		mode:    os.ModeDir | 0755,
 		modTime: time.Now(),
 	}
 
@@ -448,147 +986,640 @@ func NewMemFs() FileSystem {
 	return fs
 }
 
+// memWatch is a watcher's registration on a directory or file
+type memWatch struct {
+	path      string
+	recursive bool
+}
+
+// notifyTarget is an inode that may be watched for an event and the path
+// of the event relative to it
+type notifyTarget struct {
+	num memInodeNum
+	rel string
+}
+
 func (fs *memfs) notify(t EventType, inode memInodeNum, name string) {
-	fs.Lock()
-	defer fs.Unlock()
-	if watchers, found := fs.watchers[inode]; found {
-		for watcher, dir := range watchers {
-			select {
-			case watcher.events <- Event{Type: t, Path: path.Join(dir, name)}:
-			default:
+	targets := []notifyTarget{{inode, name}}
+	fs.watchMu.Lock()
+	recursive := fs.recursiveWatches > 0
+	fs.watchMu.Unlock()
+
+	if recursive {
+		// the names of the directories between the event and a recursively
+		// watched ancestor are looked up before locking since reading the
+		// directories needs the lock
+		targets = append(targets, fs.ancestors(inode, name)...)
+	}
+
+	fs.watchMu.Lock()
+	defer fs.watchMu.Unlock()
+	sent := make(map[*memWatcher]bool)
+	for i, target := range targets {
+		for watcher, watch := range fs.watchers[target.num] {
+			if (i == 0 || watch.recursive) && !sent[watcher] {
+				sent[watcher] = true
+				watcher.send(Event{Type: t, Path: path.Join(watch.path, target.rel)})
+			}
+		}
+	}
+}
+
+// ancestors returns the directories above inode along with the path of name
+// relative to each.  Directories shown at bind mount points are climbed from
+// each mount point as well
+func (fs *memfs) ancestors(inode memInodeNum, name string) (targets []notifyTarget) {
+	starts := []notifyTarget{{inode, name}}
+	seen := map[memInodeNum]bool{inode: true}
+	for len(starts) > 0 {
+		start := starts[0]
+		starts = starts[1:]
+		rel := start.rel
+		for dir := fs.inode(start.num); ; {
+			for _, point := range fs.mountPoints(dir.num) {
+				if !seen[point] {
+					seen[point] = true
+					starts = append(starts, notifyTarget{point, rel})
+				}
+			}
+
+			if dir.num == 0 {
+				break
+			}
+
+			dirname, err := fs.nameOf(dir)
+			if err != nil {
+				break
 			}
+			rel = path.Join(dirname, rel)
+			dir = fs.inode(dir.Parent())
+			targets = append(targets, notifyTarget{dir.num, rel})
 		}
 	}
+	return targets
 }
 
+// nameOf returns the name of a directory in its parent directory
+func (fs *memfs) nameOf(inode *memInode) (string, error) {
+	dir := fs.dir(fs.inode(inode.Parent()))
+	dir.file.inode.dirMu.RLock()
+	defer dir.file.inode.dirMu.RUnlock()
+	ent, err := dir.next()
+	for ; err == nil; ent, err = dir.next() {
+		if ent.inode == inode.num {
+			return ent.name, nil
+		}
+	}
+	return "", err
+}
+
+// Watcher returns a Watcher sending events to the events channel, which is
+// closed when the watcher is closed.  The watcher is a SinkWatcher and
+// events may be nil when they only go to sinks
 func (fs *memfs) Watcher(events chan<- Event) (Watcher, error) {
 	mw := &memWatcher{
-		fs:     fs,
-		events: events,
-		paths:  make(map[string]struct{}),
+		eventSender: newEventSender(events),
+		fs:          fs,
+		paths:       make(map[string]struct{}),
 	}
+	mw.SetOverflowPolicy(fs.overflow)
 	return mw, nil
 }
 
 func (fs *memfs) removeWatch(watcher *memWatcher, path string) error {
 	inode, err := fs.find(path)
 	if err == nil {
-		fs.Lock()
+		fs.watchMu.Lock()
 		if watchers, found := fs.watchers[inode.num]; found {
+			if watchers[watcher].recursive {
+				fs.recursiveWatches--
+			}
 			delete(watchers, watcher)
 		}
-		fs.Unlock()
+		fs.watchMu.Unlock()
 	}
 	return err
 }
 
-func (fs *memfs) watch(watcher *memWatcher, path string) error {
+// watch registers the watcher for events in path, or in the whole subtree
+// beneath path when recursive is set.  Since events are matched to
+// watches as they happen there is no window in which a new subdirectory
+// is not yet being watched
+func (fs *memfs) watch(watcher *memWatcher, path string, recursive bool) error {
 	inode, err := fs.find(path)
 	if err == nil {
-		fs.Lock()
+		fs.watchMu.Lock()
 		if _, found := fs.watchers[inode.num]; !found {
-			fs.watchers[inode.num] = make(map[*memWatcher]string)
+			fs.watchers[inode.num] = make(map[*memWatcher]memWatch)
 		}
-		fs.watchers[inode.num][watcher] = path
-		fs.Unlock()
+
+		if fs.watchers[inode.num][watcher].recursive {
+			fs.recursiveWatches--
+		}
+
+		if recursive {
+			fs.recursiveWatches++
+		}
+		fs.watchers[inode.num][watcher] = memWatch{path: path, recursive: recursive}
+		fs.watchMu.Unlock()
 	}
 	return err
 }
 
-func (fs *memfs) inode(n memInodeNum) *memInode { return fs.inodes[n] }
+// Usage reports the blocks and inodes in use, the capacity is only known
+// when it was limited with WithMaxBytes or WithMaxInodes
+func (fs *memfs) Usage() (Usage, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.blockMu.RLock()
+	defer fs.blockMu.RUnlock()
+	sys := &MemUsage{
+		BlockSize:  fs.blocksize,
+		Blocks:     int64(len(fs.blocks)),
+		FreeBlocks: int64(len(fs.freeBlocks)),
+		Inodes:     int64(len(fs.inodes)),
+		FreeInodes: int64(len(fs.freeInodes)),
+	}
+
+	for _, block := range fs.blocks {
+		if block != nil {
+			sys.HeldBytes += fs.blocksize
+		}
+	}
+
+	if fs.spill != nil {
+		sys.SpilledBytes = int64(len(fs.spill.slots)) * fs.blocksize
+	}
 
-func (fs *memfs) block(n int64) []byte { fs.Lock(); defer fs.Unlock(); return fs.blocks[n] }
+	usage := Usage{
+		UsedBytes:  (sys.Blocks - sys.FreeBlocks) * sys.BlockSize,
+		UsedInodes: sys.Inodes - sys.FreeInodes,
+		Sys:        sys,
+	}
 
-func (fs *memfs) free(blocks ...int64) {
+	if fs.maxBytes > 0 {
+		usage.TotalBytes = fs.maxBytes
+		usage.FreeBytes = fs.maxBytes - usage.UsedBytes
+	}
+
+	if fs.maxInodes > 0 {
+		usage.TotalInodes = int64(fs.maxInodes)
+		usage.FreeInodes = usage.TotalInodes - usage.UsedInodes
+	}
+	return usage, nil
+}
+
+func (fs *memfs) inode(n memInodeNum) *memInode {
 	fs.Lock()
+	defer fs.Unlock()
+	return fs.inodes[n]
+}
+
+func (fs *memfs) blockSize() int64 { return fs.blocksize }
+
+// Umask returns the mask applied to the permissions of new files and
+// directories
+func (fs *memfs) Umask() os.FileMode {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.umask
+}
+
+// SetUmask sets the mask applied to the permissions of new files and
+// directories and returns the previous mask
+func (fs *memfs) SetUmask(mask os.FileMode) os.FileMode {
+	fs.Lock()
+	defer fs.Unlock()
+	previous := fs.umask
+	fs.umask = mask & os.ModePerm
+	return previous
+}
+
+// permission bits checked when permissions are enforced
+const (
+	permRead  = os.FileMode(0400)
+	permWrite = os.FileMode(0200)
+	permExec  = os.FileMode(0100)
+)
+
+// access checks that the owner permission bits of inode include perm when
+// permissions are enforced
+func (fs *memfs) access(inode *memInode, perm os.FileMode) error {
+	if fs.permissions && inode.Mode().Perm()&perm != perm {
+		return ErrPermission
+	}
+	return nil
+}
+
+// openAccess returns the permission bits required to open a file with flag
+func openAccess(flag OpenFlag) (perm os.FileMode) {
+	if flag.accessMode() != WrOnlyFlag {
+		perm |= permRead
+	}
+
+	if flag.accessMode() != RdOnlyFlag || flag.has(TruncFlag) {
+		perm |= permWrite
+	}
+	return perm
+}
+
+// readAt copies block n from off into p.  Data is only copied while the
+// block table is locked so that a block can be evicted by WithSpill as soon
+// as nobody is copying it
+func (fs *memfs) readAt(n int64, p []byte, off int64) (int, error) {
+	fs.blockMu.RLock()
+	if block := fs.blocks[n]; block != nil {
+		defer fs.blockMu.RUnlock()
+		fs.spill.reference(n)
+		return copy(p, block[off:]), nil
+	}
+	fs.blockMu.RUnlock()
+
+	fs.blockMu.Lock()
+	defer fs.blockMu.Unlock()
+	block, err := fs.fault(n)
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, block[off:]), nil
+}
+
+// writeAt copies p into block n at off, copying the block first if it is
+// shared
+func (fs *memfs) writeAt(n int64, p []byte, off int64) (int, error) {
+	if fs.readOnly.Load() {
+		// files opened for writing before the memfs was frozen
+		return 0, ErrReadOnly
+	}
+
+	fs.blockMu.RLock()
+	if block := fs.blocks[n]; block != nil && !fs.shared[n] {
+		// the inode lock keeps other writers of the block out
+		defer fs.blockMu.RUnlock()
+		fs.spill.reference(n)
+		return copy(block[off:], p), nil
+	}
+	fs.blockMu.RUnlock()
+
+	fs.blockMu.Lock()
+	defer fs.blockMu.Unlock()
+	block, err := fs.fault(n)
+	if err != nil {
+		return 0, err
+	}
+
+	if fs.shared[n] {
+		block = fs.newBlock()
+		copy(block, fs.blocks[n])
+		fs.blocks[n] = block
+		delete(fs.shared, n)
+	}
+	return copy(block[off:], p), nil
+}
+
+func (fs *memfs) free(blocks ...int64) {
+	fs.blockMu.Lock()
 	for _, block := range blocks {
 		fs.freeBlocks = append(fs.freeBlocks, block)
+		if fs.blocks[block] != nil {
+			fs.freeHeld++
+		} else {
+			fs.spill.discard(block)
+		}
 	}
-	fs.Unlock()
+	fs.trim()
+	fs.blockMu.Unlock()
 }
 
-func (fs *memfs) freeInode(inode memInodeNum) {
-	fs.Lock()
-	for _, block := range fs.inodes[inode].blocks {
-		fs.freeBlocks = append(fs.freeBlocks, block)
+// autoCompactBlocks is the number of free blocks holding storage above
+// which freeing blocks compacts the filesystem, once they are also more than
+// half of all blocks
+const autoCompactBlocks = 256
+
+// trim compacts the filesystem when the free blocks hold a lot of storage.
+// The block table must be locked
+func (fs *memfs) trim() {
+	if fs.freeHeld > autoCompactBlocks && 2*fs.freeHeld > len(fs.blocks) {
+		fs.compact()
 	}
+}
 
-	fs.inodes[inode].parent = 0
-	fs.inodes[inode].size = 0
-	fs.inodes[inode].mode = 0
-	fs.inodes[inode].modTime = time.Time{}
-	fs.inodes[inode].link = ""
-	fs.inodes[inode].blocks = nil
+// compact releases the storage of the free blocks and shrinks the block
+// table by dropping the free blocks at its end.  Block numbers that are in
+// use never change, so inodes are not touched.  The remaining free blocks
+// are reused lowest first, which lets later compactions drop more of the
+// table.  compact returns the number of bytes released and the block table
+// must be locked
+func (fs *memfs) compact() (released int64) {
+	free := make(map[int64]bool, len(fs.freeBlocks))
+	for _, block := range fs.freeBlocks {
+		free[block] = true
+		if fs.blocks[block] != nil {
+			if !fs.shared[block] {
+				fs.releaseBlock(fs.blocks[block])
+			}
+			fs.blocks[block] = nil
+			delete(fs.shared, block)
+			fs.spill.drop()
+			released += fs.blocksize
+		}
+	}
 
-	fs.freeInodes = append(fs.freeInodes, inode)
-	fs.Unlock()
+	n := int64(len(fs.blocks))
+	for n > 0 && free[n-1] {
+		n--
+	}
+	fs.blocks = append([][]byte(nil), fs.blocks[:n]...)
+	fs.spill.shrink(n)
+
+	fs.freeBlocks = fs.freeBlocks[:0]
+	for block := range free {
+		if block < n {
+			fs.freeBlocks = append(fs.freeBlocks, block)
+		}
+	}
+	sort.Slice(fs.freeBlocks, func(i, j int) bool { return fs.freeBlocks[i] < fs.freeBlocks[j] })
+	fs.freeBlocks = append([]int64(nil), fs.freeBlocks...)
+	fs.freeHeld = 0
+	return released
+}
+
+// GC compacts the filesystem, releasing the storage of every free block.
+// The storage is reported as a single item, MinAge and TargetBytes do not
+// apply
+func (fs *memfs) GC(ctx context.Context, policy GCPolicy) (report GCReport, err error) {
+	if err = ctx.Err(); err != nil {
+		return report, err
+	}
+
+	fs.blockMu.Lock()
+	defer fs.blockMu.Unlock()
+	report.DryRun = policy.DryRun
+	if policy.DryRun {
+		for _, block := range fs.freeBlocks {
+			if fs.blocks[block] != nil {
+				report.Bytes += fs.blocksize
+			}
+		}
+	} else {
+		report.Bytes = fs.compact()
+	}
+
+	if report.Bytes > 0 {
+		report.Items = []GCItem{{Layer: "memfs", Path: PathSeparator, Bytes: report.Bytes}}
+	}
+	return report, nil
 }
 
-func (fs *memfs) alloc() (block int64) {
+func (fs *memfs) freeInode(num memInodeNum) {
+	fs.reclaim(fs.inode(num))
+}
+
+// open counts a handle opened on inode and returns the function releasing it
+func (fs *memfs) open(inode *memInode) func() {
+	inode.Lock()
+	inode.opens++
+	inode.Unlock()
+
+	return func() {
+		inode.Lock()
+		inode.opens--
+		unlinked := inode.unlinked && inode.opens == 0
+		inode.Unlock()
+
+		fs.Lock()
+		closed := fs.inodes == nil
+		fs.Unlock()
+		if unlinked && !closed {
+			fs.reclaim(inode)
+		}
+	}
+}
+
+// reclaim frees inode, or marks it unlinked when it is still open so that
+// its handles keep reading and writing it until they are closed
+func (fs *memfs) reclaim(inode *memInode) {
+	inode.Lock()
+	if inode.opens > 0 {
+		inode.unlinked = true
+		inode.Unlock()
+		return
+	}
+	inode.unlinked = false
+	blocks := inode.blocks
+	inode.parent = 0
+	inode.size = 0
+	inode.mode = 0
+	inode.modTime = time.Time{}
+	inode.link = ""
+	inode.blocks = nil
+	inode.fifo = nil
+	inode.Unlock()
+
 	fs.Lock()
+	fs.freeInodes = append(fs.freeInodes, inode.num)
+	fs.Unlock()
+	fs.free(blocks...)
+}
+
+// alloc returns a free block, ErrNoSpace is returned when the blocks in use
+// already fill the capacity set by WithMaxBytes and ErrReadOnly once the
+// memfs is frozen
+func (fs *memfs) alloc() (block int64, err error) {
+	if fs.readOnly.Load() {
+		return 0, ErrReadOnly
+	}
+
+	fs.blockMu.Lock()
+	defer fs.blockMu.Unlock()
+	used := int64(len(fs.blocks) - len(fs.freeBlocks))
+	if fs.maxBytes > 0 && (used+1)*fs.blocksize > fs.maxBytes {
+		return 0, ErrNoSpace
+	}
+
+	if err = fs.makeRoom(); err != nil {
+		return 0, err
+	}
+
 	if len(fs.freeBlocks) > 0 {
 		block = fs.freeBlocks[0]
 		fs.freeBlocks = fs.freeBlocks[1:]
+		if fs.blocks[block] != nil {
+			fs.freeHeld--
+		} else {
+			fs.spill.hold(block)
+		}
+
+		if fs.shared[block] || fs.blocks[block] == nil {
+			// the storage is shared with a clone or was released
+			fs.blocks[block] = fs.newBlock()
+			delete(fs.shared, block)
+		} else {
+			clearBlock(fs.blocks[block])
+		}
 	} else {
-		fs.blocks = append(fs.blocks, make([]byte, blocksize))
+		fs.blocks = append(fs.blocks, fs.newBlock())
 		block = int64(len(fs.blocks) - 1)
+		fs.spill.hold(block)
 	}
-	fs.Unlock()
-	return
+	return block, nil
 }
 
-func (fs *memfs) find(filename string) (inode *memInode, err error) {
-	if strings.HasPrefix(filename, PathSeparator) {
-		filename = strings.TrimPrefix(filename, PathSeparator)
+// blockPools holds a *sync.Pool of released block storage for each block
+// size so that filesystems created and dropped by a test suite reuse each
+// other's blocks rather than allocating new ones
+var blockPools sync.Map
+
+func blockPool(size int64) *sync.Pool {
+	if pool, found := blockPools.Load(size); found {
+		return pool.(*sync.Pool)
 	}
 
-	if strings.HasSuffix(filename, PathSeparator) {
-		filename = strings.TrimSuffix(filename, PathSeparator)
+	pool, _ := blockPools.LoadOrStore(size, &sync.Pool{
+		New: func() interface{} {
+			block := make([]byte, size)
+			return &block
+		},
+	})
+	return pool.(*sync.Pool)
+}
+
+// newBlock returns cleared storage for a block, from the arena when the
+// filesystem has one and from the pool otherwise
+func (fs *memfs) newBlock() []byte {
+	if fs.arena != nil {
+		return fs.arena.get()
 	}
 
-	// inode[0] is always root directory
-	n := memInodeNum(0)
-	if len(filename) == 0 {
-		inode = fs.inodes[n]
+	block := *blockPool(fs.blocksize).Get().(*[]byte)
+	clearBlock(block)
+	return block
+}
+
+// releaseBlock returns the storage of a block that is no longer referenced
+// to where it came from
+func (fs *memfs) releaseBlock(block []byte) {
+	if fs.arena != nil {
+		fs.arena.put(block)
 	} else {
-		// TODO: change this to use path.Split or something safer than
-		// strings.Split
-		names := strings.Split(filename, string(PathSeparator))
-		inode = fs.inodes[n]
-		for i, name := range names {
-			if inode.Mode().IsDir() {
-				dir := &memDir{fs: fs, file: &memFile{notifier: fs, inode: inode}}
-				n, err = dir.find(name)
-				if err != nil {
-					break
-				}
-				inode = fs.inodes[n]
-			} else if i <= len(names)-1 {
-				err = ErrNotDir
-			}
+		blockPool(int64(len(block))).Put(&block)
+	}
+}
+
+// find looks up filename without following a symbolic link in the final
+// component
+func (fs *memfs) find(filename string) (*memInode, error) {
+	return fs.lookup(filename, false)
+}
+
+// resolve looks up filename following symbolic links all the way through
+func (fs *memfs) resolve(filename string) (*memInode, error) {
+	return fs.lookup(filename, true)
+}
+
+// lookup finds the inode for filename following symbolic links in every
+// directory component and, when follow is set, in the final component.
+// Relative link targets are resolved from the directory holding the link
+func (fs *memfs) lookup(filename string, follow bool) (*memInode, error) {
+	// inode[0] is always root directory
+	current, inode := PathSeparator, fs.inode(0)
+	remaining := splitPath(filename)
+	for links := 0; len(remaining) > 0; {
+		name := remaining[0]
+		remaining = remaining[1:]
+		if !inode.IsDir() {
+			return nil, ErrNotDir
+		} else if err := fs.access(inode, permExec); err != nil {
+			return nil, err
 		}
 
+		n, err := fs.dir(inode).find(name)
 		if err == io.EOF {
-			err = ErrNotExist
+			return nil, ErrNotExist
+		} else if err != nil {
+			return nil, err
+		}
+
+		next := fs.inode(fs.mounted(n))
+		if next.Mode()&os.ModeSymlink != 0 && (len(remaining) > 0 || follow) {
+			if links++; links > maxLinks {
+				return nil, ErrLoop
+			}
+
+			target := next.Link()
+			if !path.IsAbs(target) {
+				target = path.Join(current, target)
+			}
+			remaining = append(splitPath(target), remaining...)
+			current, inode = PathSeparator, fs.inode(0)
+			continue
 		}
+		current, inode = path.Join(current, name), next
 	}
-	return inode, err
+	return inode, nil
 }
 
-// Chmod changes the mode of the named file to mode.
+// splitPath cleans filename and splits it into its components.  The root
+// directory has no components
+func splitPath(filename string) []string {
+	filename = strings.TrimPrefix(Clean(filename), PathSeparator)
+	if filename == "" {
+		return nil
+	}
+	return strings.Split(filename, PathSeparator)
+}
+
+// Chmod changes the mode of the named file to mode.  The type bits of mode
+// are ignored, a file cannot be turned into a directory or the other way
+// around
 func (fs *memfs) Chmod(filename string, mode os.FileMode) error {
-	inode, err := fs.find(filename)
-	if err == nil {
-		inode.setMode(mode)
+	if fs.readOnly.Load() {
+		return &PathError{Op: "chmod", Path: filename, Cause: ErrReadOnly}
 	}
-	return err
+
+	inode, err := fs.resolve(filename)
+	if err != nil {
+		return &PathError{Op: "chmod", Path: filename, Cause: err}
+	}
+
+	inode.setMode(inode.Mode()&os.ModeType | mode&^os.ModeType)
+	return nil
+}
+
+// Chtimes changes the modification time of the named file.  memfs does not
+// keep access times so atime is ignored
+func (fs *memfs) Chtimes(filename string, atime, mtime time.Time) error {
+	if fs.readOnly.Load() {
+		return &PathError{Op: "chtimes", Path: filename, Cause: ErrReadOnly}
+	}
+
+	inode, err := fs.resolve(filename)
+	if err != nil {
+		return &PathError{Op: "chtimes", Path: filename, Cause: err}
+	}
+
+	inode.Lock()
+	inode.modTime = mtime
+	inode.Unlock()
+	return nil
 }
 
-func (fs *memfs) create(name string, parent *memInode, perm os.FileMode) (inode *memInode, file *memFile) {
-	dir := &memDir{fs: fs, file: &memFile{notifier: fs, inode: parent}}
+// create adds a new inode to parent.  ErrNoSpace is returned when the
+// inode limit set by WithMaxInodes has been reached or the directory entry
+// does not fit
+func (fs *memfs) create(name string, parent *memInode, perm os.FileMode) (inode *memInode, file *memFile, err error) {
+	dir := fs.dir(parent)
 	// create a new inode
 	fs.Lock()
-	if len(fs.freeInodes) > 0 {
+	if perm&os.ModeSymlink == 0 {
+		perm, _ = fs.perms.apply(perm)
+		perm &^= fs.umask
+	}
+
+	if len(fs.freeInodes) == 0 && fs.maxInodes > 0 && len(fs.inodes) >= fs.maxInodes {
+		fs.Unlock()
+		return nil, nil, ErrNoSpace
+	} else if len(fs.freeInodes) > 0 {
 		inodeNum := fs.freeInodes[0]
 		inode = fs.inodes[inodeNum]
 		fs.freeInodes = fs.freeInodes[1:]
@@ -603,10 +1634,35 @@ func (fs *memfs) create(name string, parent *memInode, perm os.FileMode) (inode
 	}
 	fs.Unlock()
 	inode.parent = parent.num
-	dir.append(inode.num, name)
+	if err = dir.append(inode.num, name); err != nil {
+		fs.freeInode(inode.num)
+		return nil, nil, err
+	}
 	inode.touch()
 	file = &memFile{notifier: fs, inode: inode}
-	return inode, file
+	return inode, file, nil
+}
+
+// danglingTarget returns the name that creating filename, which does not
+// resolve, would create: filename itself or the target the symbolic links
+// at filename lead to.  Exclusive creation fails on any symbolic link
+func (fs *memfs) danglingTarget(filename string, excl bool) (string, error) {
+	for links := 0; ; links++ {
+		inode, err := fs.find(filename)
+		if err != nil || inode.Mode()&os.ModeSymlink == 0 {
+			return filename, nil
+		} else if excl {
+			return "", ErrExist
+		} else if links >= maxLinks {
+			return "", ErrLoop
+		}
+
+		target := inode.Link()
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(filename), target)
+		}
+		filename = target
+	}
 }
 
 // Create creates the named file with mode 0666 (before umask), truncating it if it already exists.  If
@@ -633,25 +1689,40 @@ func (fs *memfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (Fil
 	var file *memFile
 	var inode *memInode
 	err := flag.check()
+	if err == nil && fs.readOnly.Load() && (flag.accessMode() != RdOnlyFlag || flag.has(CreateFlag) || flag.has(TruncFlag)) {
+		err = ErrReadOnly
+	}
+
 	if err == nil {
-		inode, err = fs.find(filename)
+		inode, err = fs.resolve(filename)
 		if err == nil {
-			file = &memFile{notifier: fs, inode: inode}
-			file.flags(flag)
 			if flag.has(CreateFlag) && flag.has(ExclFlag) {
-				file = nil
 				err = ErrExist
+			} else if err = fs.access(inode, openAccess(flag)); err == nil {
+				file = &memFile{notifier: fs, inode: inode}
+				err = file.flags(flag)
 			}
-		} else {
+		} else if err == ErrNotExist {
+			// like os, creating through a dangling symbolic link creates
+			// its target
+			target := filename
+			if flag.has(CreateFlag) {
+				target, err = fs.danglingTarget(filename, flag.has(ExclFlag))
+			}
+
 			var parent *memInode
-			parent, err = fs.find(path.Dir(filename))
+			if err == nil {
+				parent, err = fs.resolve(path.Dir(target))
+			}
+
 			if err == nil {
 				if parent.Mode().IsDir() {
-					if flag.has(CreateFlag) && (flag.has(RdWrFlag) || flag.has(WrOnlyFlag)) {
-						inode, file = fs.create(path.Base(filename), parent, perm)
-						file.flags(flag)
-					} else {
+					if !flag.has(CreateFlag) {
 						err = ErrNotExist
+					} else if err = fs.access(parent, permWrite|permExec); err == nil {
+						if inode, file, err = fs.create(path.Base(target), parent, perm); err == nil {
+							err = file.flags(flag)
+						}
 					}
 				} else {
 					err = ErrNotDir
@@ -662,70 +1733,202 @@ func (fs *memfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (Fil
 
 	if err == nil {
 		file.name = filename
-		if inode.IsDir() {
+		file.release = fs.open(inode)
+		if inode.IsDir() && fs.sorted {
+			return &sortedDir{File: &memDir{fs: fs, file: file}}, nil
+		} else if inode.IsDir() {
 			return &memDir{fs: fs, file: file}, nil
+		} else if inode.Mode()&os.ModeNamedPipe != 0 {
+			return openFifo(file, flag), nil
 		}
+		file.maxSize = fs.maxFileSize
 		return file, nil
 	}
 	return nil, err
 }
 
+// Remove removes the named file or empty directory.  Like an operating
+// system, a file that is still open is only freed once its last handle is
+// closed
 func (fs *memfs) Remove(name string) error {
-	dirname, filename := path.Split(name)
-	parentInode, err := fs.find(dirname)
+	if fs.readOnly.Load() {
+		return &PathError{Op: "remove", Path: name, Cause: ErrReadOnly}
+	}
+
+	dirname, filename := Split(name)
+	parentInode, err := fs.resolve(dirname)
 	if err == nil {
-		var ent *dirent
-		parent := &memDir{fs: fs, file: &memFile{notifier: fs, inode: parentInode}}
-		ent, err = parent.remove(filename)
-		fs.freeInode(ent.inode)
+		err = fs.access(parentInode, permWrite|permExec)
 	}
-	return err
-}
 
-func (fs *memfs) Rename(oldpath, newpath string) error {
-	olddir, oldfile := path.Split(oldpath)
-	newdir, newfile := path.Split(newpath)
-	inode, err := fs.find(olddir)
 	if err == nil {
-		oldParent := &memDir{fs: fs, file: &memFile{notifier: fs, inode: inode}}
-		if olddir == newdir {
-			oldParent.rename(oldfile, newfile)
-		} else {
-			inode, err = fs.find(newdir)
-			if err == nil {
-				newParent := &memDir{fs: fs, file: &memFile{notifier: fs, inode: inode}}
-				var ent *dirent
-				ent, err = oldParent.remove(oldfile)
-				if err == nil {
-					newParent.append(ent.inode, newfile)
-				}
-			} else {
-				err = &PathError{Op: "rename", Path: newdir, Cause: err}
+		var num memInodeNum
+		if num, err = fs.dir(parentInode).find(filename); err != nil {
+			err = ErrNotExist
+		} else if fs.isMountPoint(num) || fs.isBound(num) {
+			err = ErrBusy
+		} else if inode := fs.inode(num); inode.IsDir() && inode.Size() > 0 {
+			err = ErrNotEmpty
+		}
+
+		if err == nil {
+			var ent *dirent
+			if ent, err = fs.dir(parentInode).remove(filename); err == nil {
+				fs.freeInode(ent.inode)
 			}
 		}
-	} else {
-		err = &PathError{Op: "rename", Path: olddir, Cause: err}
+	}
+
+	if err != nil {
+		return &PathError{Op: "remove", Path: name, Cause: err}
+	}
+	return nil
+}
+
+// isAncestor reports whether the directory dir is num or holds it anywhere
+// beneath it
+func (fs *memfs) isAncestor(dir, num memInodeNum) bool {
+	for ; num != dir; num = fs.inode(num).Parent() {
+		if num == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Rename renames (moves) oldpath to newpath.  An existing newpath is
+// replaced in a single step, so that newpath never stops existing, as long
+// as it is not a directory that still has entries.  The displaced file is
+// freed.  A directory cannot be moved into its own subtree
+func (fs *memfs) Rename(oldpath, newpath string) error {
+	if fs.readOnly.Load() {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrReadOnly}
+	}
+
+	olddir, oldfile := Split(oldpath)
+	newdir, newfile := Split(newpath)
+	if len(newfile) > maxNameLen {
+		// checked before the entry is taken out of its old directory
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrNameTooLong}
+	}
+
+	oldParent, err := fs.renameDir(olddir)
+	if err != nil {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: err}
+	}
+
+	newParent := oldParent
+	if olddir != newdir {
+		if newParent, err = fs.renameDir(newdir); err != nil {
+			return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: err}
+		}
+	}
+
+	num, err := fs.dir(oldParent).find(oldfile)
+	if err != nil {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrNotExist}
+	}
+
+	if fs.inode(num).IsDir() && fs.isAncestor(num, newParent.num) {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrInvalid}
+	}
+
+	displaced, err := fs.dir(newParent).find(newfile)
+	if fs.isMountPoint(num) || (err == nil && displaced != num && (fs.isMountPoint(displaced) || fs.isBound(displaced))) {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrBusy}
+	}
+
+	// with case-insensitive names newfile may be oldfile in a different
+	// case, which is a plain rename
+	if err == nil && (displaced != num || oldfile == newfile) {
+		return fs.replace(oldParent, newParent, oldpath, newpath, num, displaced)
+	}
+
+	if olddir == newdir {
+		return fs.dir(oldParent).rename(oldfile, newfile)
+	}
+
+	ent, err := fs.dir(oldParent).remove(oldfile)
+	if err == nil {
+		err = fs.dir(newParent).append(ent.inode, newfile)
+	}
+
+	if err == nil {
+		fs.inode(ent.inode).setParent(newParent.num)
 	}
 	return err
 }
 
+// dir returns a handle for reading and writing the entries of a directory
+func (fs *memfs) dir(inode *memInode) *memDir {
+	return &memDir{fs: fs, file: &memFile{notifier: fs, inode: inode}, fold: fs.caseInsensitive}
+}
+
+// renameDir looks up a directory that an entry is being renamed from or to
+func (fs *memfs) renameDir(dirname string) (*memInode, error) {
+	inode, err := fs.resolve(dirname)
+	if err == nil {
+		err = fs.access(inode, permWrite|permExec)
+	}
+	return inode, err
+}
+
+// replace renames an entry over an existing entry by pointing the existing
+// entry at the renamed inode
+func (fs *memfs) replace(oldParent, newParent *memInode, oldpath, newpath string, num, displaced memInodeNum) error {
+	if num == displaced {
+		return nil
+	}
+
+	src, dst := fs.inode(num), fs.inode(displaced)
+	switch {
+	case dst.IsDir() && !src.IsDir():
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrIsDir}
+	case !dst.IsDir() && src.IsDir():
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrNotDir}
+	case dst.IsDir() && dst.Size() > 0:
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrNotEmpty}
+	}
+
+	oldfile, newfile := path.Base(oldpath), path.Base(newpath)
+	if err := fs.dir(newParent).replace(newfile, num); err != nil {
+		return err
+	}
+
+	if _, err := fs.dir(oldParent).unlink(oldfile); err != nil {
+		return err
+	}
+
+	src.setParent(newParent.num)
+	fs.notify(RenameEvent, oldParent.num, oldfile)
+	fs.notify(CreateEvent, newParent.num, newfile)
+	fs.freeInode(displaced)
+	return nil
+}
+
 func (fs *memfs) Mkdir(name string, perm os.FileMode) error {
 	if !strings.HasPrefix(name, "/") {
 		name = fmt.Sprintf("/%s", name)
 	}
 
+	if fs.readOnly.Load() {
+		return &PathError{"mkdir", name, ErrReadOnly}
+	}
+
 	// check for existing file
 	_, err := fs.find(name)
 	if err == nil {
 		return &PathError{"mkdir", name, ErrExist}
 	}
 
-	inode, err := fs.find(path.Dir(name))
+	inode, err := fs.resolve(path.Dir(name))
 	if err == nil {
-		if inode.Mode().IsDir() {
-			fs.create(path.Base(name), inode, os.ModeDir|perm)
-		} else {
+		if !inode.Mode().IsDir() {
 			err = &PathError{"mkdir", name, ErrNotDir}
+		} else if err = fs.access(inode, permWrite|permExec); err != nil {
+			err = &PathError{"mkdir", name, err}
+		} else if _, _, err = fs.create(path.Base(name), inode, os.ModeDir|perm); err != nil {
+			err = &PathError{"mkdir", name, err}
 		}
 	} else {
 		err = &PathError{"mkdir", name, err}
@@ -746,10 +1949,8 @@ func (fs *memfs) Lstat(filename string) (fi os.FileInfo, err error) {
 
 // Stat returns the FileInfo structure describing file.
 func (fs *memfs) Stat(filename string) (fi os.FileInfo, err error) {
-	inode, err := fs.find(filename)
-	if err == nil && inode.Mode()&os.ModeSymlink == os.ModeSymlink {
-		fi, err = fs.Stat(inode.link)
-	} else if err == nil {
+	inode, err := fs.resolve(filename)
+	if err == nil {
 		fi = &memFileInfo{
 			memInode: inode,
 			name:     path.Base(filename),
@@ -759,11 +1960,73 @@ func (fs *memfs) Stat(filename string) (fi os.FileInfo, err error) {
 	return fi, err
 }
 
+// Symlink creates newname as a symbolic link to oldname.  The FileSystem
+// returned by NewMemFs can be asserted to
+// interface{ Symlink(string, string) error } to reach it
+func (fs *memfs) Symlink(oldname, newname string) error {
+	newname = Clean(newname)
+	if fs.readOnly.Load() {
+		return &LinkError{"symlink", oldname, newname, ErrReadOnly}
+	}
+
+	if _, err := fs.find(newname); err == nil {
+		return &LinkError{"symlink", oldname, newname, ErrExist}
+	}
+
+	parent, err := fs.resolve(path.Dir(newname))
+	if err != nil {
+		return &LinkError{"symlink", oldname, newname, err}
+	} else if !parent.IsDir() {
+		return &LinkError{"symlink", oldname, newname, ErrNotDir}
+	} else if err = fs.access(parent, permWrite|permExec); err != nil {
+		return &LinkError{"symlink", oldname, newname, err}
+	}
+
+	inode, _, err := fs.create(path.Base(newname), parent, os.ModeSymlink|0777)
+	if err != nil {
+		return &LinkError{"symlink", oldname, newname, err}
+	}
+
+	inode.Lock()
+	inode.link = oldname
+	inode.Unlock()
+	return nil
+}
+
+// Readlink returns the target of the named symbolic link
+func (fs *memfs) Readlink(name string) (string, error) {
+	inode, err := fs.find(name)
+	if err != nil {
+		return "", &PathError{"readlink", name, err}
+	} else if inode.Mode()&os.ModeSymlink == 0 {
+		return "", &PathError{"readlink", name, ErrNotExist}
+	}
+	return inode.Link(), nil
+}
+
 func (fs *memfs) Close() error {
 	fs.Lock()
 	defer fs.Unlock()
+	fs.blockMu.Lock()
+	defer fs.blockMu.Unlock()
+	for n, block := range fs.blocks {
+		if block != nil && !fs.shared[int64(n)] {
+			fs.releaseBlock(block)
+		}
+	}
+
+	err := fs.spill.close()
+	if fs.arena != nil {
+		if err1 := fs.arena.release(); err == nil {
+			err = err1
+		}
+		fs.arena = nil
+	}
+
 	fs.inodes = nil
 	fs.freeBlocks = nil
+	fs.freeHeld = 0
 	fs.blocks = nil
-	return nil
+	fs.shared = nil
+	return err
 }
@@ -1,11 +1,20 @@
 package vfs
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 	"os"
 	"path"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type testBlockManager struct {
@@ -14,17 +23,26 @@ type testBlockManager struct {
 	allocBlock    int64
 }
 
+func (tbm *testBlockManager) blockSize() int64 {
+	return blocksize
+}
+
 func (tbm *testBlockManager) free(free ...int64) {
 	tbm.freeBlocks = free
 }
 
-func (tbm *testBlockManager) block(block int64) []byte {
+func (tbm *testBlockManager) readAt(block int64, p []byte, off int64) (int, error) {
 	tbm.retrieveBlock = block
-	return make([]byte, blocksize)
+	return copy(p, make([]byte, blocksize)[off:]), nil
 }
 
-func (tbm *testBlockManager) alloc() int64 {
-	return tbm.allocBlock
+func (tbm *testBlockManager) writeAt(block int64, p []byte, off int64) (int, error) {
+	tbm.retrieveBlock = block
+	return copy(make([]byte, blocksize)[off:], p), nil
+}
+
+func (tbm *testBlockManager) alloc() (int64, error) {
+	return tbm.allocBlock, nil
 }
 
 func TestMemInodeTrunc(t *testing.T) {
@@ -71,6 +89,116 @@ func TestMemFileReaddirnames(t *testing.T) {
 	}
 }
 
+func TestMemDirReaddir(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		n       []int
+		want    []int
+		wantErr error
+	}{
+		{"batches", 5, []int{2, 2, 2}, []int{2, 2, 1}, nil},
+		{"end of directory", 2, []int{2, 2}, []int{2, 0}, io.EOF},
+		{"larger than directory", 3, []int{10, 10}, []int{3, 0}, io.EOF},
+		{"remaining entries", 5, []int{2, -1, -1}, []int{2, 3, 0}, nil},
+		{"empty directory", 0, []int{0}, []int{0}, nil},
+		{"empty directory in batches", 0, []int{1}, []int{0}, io.EOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs()
+			fs.Mkdir("/dir", 0755)
+			for i := 0; i < test.entries; i++ {
+				WriteFile(fs, fmt.Sprintf("/dir/%d", i), nil, 0644)
+			}
+
+			f, _ := fs.Open("/dir")
+			defer closeFile(f)
+			var err error
+			for i, n := range test.n {
+				var infos []os.FileInfo
+				infos, err = f.Readdir(n)
+				if len(infos) != test.want[i] {
+					t.Errorf("Wanted %d entries from call %d got %d", test.want[i], i, len(infos))
+				}
+			}
+
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMemDirReaddirRemove(t *testing.T) {
+	// the last name looks like an entry with a huge name length to a
+	// handle left in the middle of it
+	crafted := "x" + "AAAAAAAA" + "\x7f\xff\xff\xff\xff\xff\xff\xff" + "zz"
+	tests := []struct {
+		name    string
+		entries []string
+		remove  []string
+		want    []string
+	}{
+		{"plain names", []string{"a", "b", "c", "d"}, []string{"/d/a", "/d/b"}, []string{"c", "d"}},
+		{"crafted name", []string{"a", "b", crafted}, []string{"/d/b"}, []string{crafted}},
+		{"removed ahead", []string{"a", "b", "c", "d"}, []string{"/d/d"}, []string{"c", "d"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs()
+			fs.Mkdir("/d", 0755)
+			for _, name := range test.entries {
+				WriteFile(fs, "/d/"+name, nil, 0644)
+			}
+
+			f, _ := fs.Open("/d")
+			defer closeFile(f)
+			if _, err := f.Readdir(2); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, name := range test.remove {
+				if err := fs.Remove(name); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			got, err := f.Readdirnames(10)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMemDirentNameLength(t *testing.T) {
+	fs := NewMemFs()
+	long := "/" + strings.Repeat("x", maxNameLen+1)
+	if err := WriteFile(fs, long, nil, 0644); !IsError(ErrNameTooLong, err) {
+		t.Errorf("Wanted %v got %v", ErrNameTooLong, err)
+	}
+
+	WriteFile(fs, "/file", nil, 0644)
+	if err := fs.Rename("/file", long); !IsError(ErrNameTooLong, err) {
+		t.Errorf("Wanted %v got %v", ErrNameTooLong, err)
+	} else if exists, _ := Exists(fs, "/file"); !exists {
+		t.Errorf("Wanted the file to stay in place")
+	}
+
+	// a length past the limit is rejected before anything is allocated
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int64(1))
+	binary.Write(&buf, binary.BigEndian, int64(math.MaxInt64))
+	if err := (&dirent{}).read(&buf); err != ErrNameTooLong {
+		t.Errorf("Wanted %v got %v", ErrNameTooLong, err)
+	}
+}
+
 func TestMemFileReadWriteSeekerSeek(t *testing.T) {
 	tests := []struct {
 		size    int64
@@ -121,7 +249,7 @@ func TestMemStat(t *testing.T) {
 	}
 
 	// create a symlink
-	linkInode, file := fs.create(linkname, fs.inodes[0], 0777|os.ModeSymlink)
+	linkInode, file, _ := fs.create(linkname, fs.inodes[0], 0777|os.ModeSymlink)
 	linkInode.link = filename
 	root := &memDir{fs: fs, file: &memFile{inode: fs.inodes[0], notifier: fs}}
 	root.append(linkInode.num, linkname)
@@ -201,12 +329,11 @@ func TestMemRename(t *testing.T) {
 		newName      string
 		createNewDir bool
 		wantErr      error
-		wantErrPath  string
 	}{
-		{"rename same dir", "/old.txt", false, "/new.txt", false, nil, ""},
-		{"rename different dir", "/old.txt", false, "/foo/new.txt", true, nil, ""},
-		{"rename nonexistant dir", "/old.txt", false, "/foo/bar/new.txt", false, ErrNotExist, "/foo/bar/"},
-		{"rename nonexistant source", "/great/googly/moogly/old.txt", false, "/new.txt", false, ErrNotExist, "/great/googly/moogly/"},
+		{"rename same dir", "/old.txt", false, "/new.txt", false, nil},
+		{"rename different dir", "/old.txt", false, "/foo/new.txt", true, nil},
+		{"rename nonexistant dir", "/old.txt", false, "/foo/bar/new.txt", false, ErrNotExist},
+		{"rename nonexistant source", "/great/googly/moogly/old.txt", false, "/new.txt", false, ErrNotExist},
 	}
 
 	for _, test := range tests {
@@ -241,12 +368,12 @@ func TestMemRename(t *testing.T) {
 						t.Errorf("Old file shouldn't exist, got %v", err)
 					}
 				} else {
-					if pe, ok := err.(*PathError); ok {
-						if pe.Path != test.wantErrPath {
-							t.Errorf("Wanted error path %q got %q", test.wantErrPath, pe.Path)
+					if le, ok := err.(*LinkError); ok {
+						if le.Old != test.oldName || le.New != test.newName {
+							t.Errorf("Wanted error paths %q %q got %q %q", test.oldName, test.newName, le.Old, le.New)
 						}
 					} else {
-						t.Errorf("Expected any error returned from Mkdir to be a *PathError, got %T", err)
+						t.Errorf("Expected any error returned from Rename to be a *LinkError, got %T", err)
 					}
 				}
 			} else {
@@ -269,6 +396,8 @@ func TestMemRemove(t *testing.T) {
 	}
 	wantInode := file.inode.num
 
+	// an open file is only freed once it is closed
+	file.Close()
 	err := fs.Remove("/foo.txt")
 	if err == nil {
 		// make sure it's gone
@@ -451,3 +580,1069 @@ func TestMemErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestMemFileStat(t *testing.T) {
+	fs := NewMemFs()
+	f, _ := fs.Create("/foo.txt")
+	f.Write([]byte{1, 2, 3, 4, 5})
+
+	// the handle should still describe the file after a rename
+	fs.Rename("/foo.txt", "/bar.txt")
+	fi, err := f.Stat()
+	if err == nil {
+		if fi.Name() != "foo.txt" {
+			t.Errorf("Wanted name %q got %q", "foo.txt", fi.Name())
+		}
+
+		if fi.Size() != 5 {
+			t.Errorf("Wanted size %d got %d", 5, fi.Size())
+		}
+	} else {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	fs.Mkdir("/dir", 0755)
+	d, _ := fs.Open("/dir")
+	fi, err = d.Stat()
+	if err == nil {
+		if !fi.IsDir() {
+			t.Errorf("Expected directory handle to report IsDir")
+		}
+	} else {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestMemFileRemovedOpen(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/a", []byte("removed"), 0644)
+	f, _ := fs.Open("/a")
+	fs.Remove("/a")
+
+	// the inode is kept for the handle rather than reused by the next file
+	WriteFile(fs, "/b", []byte("new"), 0644)
+	if got, _ := io.ReadAll(f); string(got) != "removed" {
+		t.Errorf("Wanted %q got %q", "removed", got)
+	}
+
+	if fi, err := f.Stat(); err != nil || fi.Size() != 7 {
+		t.Errorf("Wanted size %d got %v (%v)", 7, fi, err)
+	}
+
+	if usage, _ := StatFS(fs); usage.Sys.(*MemUsage).FreeInodes != 0 {
+		t.Errorf("Wanted no free inode got %+v", usage.Sys)
+	}
+
+	// the snapshot does not keep it
+	snapshot := fs.(interface{ Snapshot() FileSystem }).Snapshot()
+	if usage, _ := StatFS(snapshot); usage.Sys.(*MemUsage).FreeInodes != 1 {
+		t.Errorf("Wanted 1 free inode got %+v", usage.Sys)
+	}
+
+	f.(io.Closer).Close()
+	if usage, _ := StatFS(fs); usage.Sys.(*MemUsage).FreeInodes != 1 {
+		t.Errorf("Wanted 1 free inode got %+v", usage.Sys)
+	}
+
+	if got, _ := ReadFile(fs, "/b"); string(got) != "new" {
+		t.Errorf("Wanted %q got %q", "new", got)
+	}
+}
+
+func TestMemWatcherStats(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		buffer      int
+		events      int
+		wantDropped uint64
+	}{
+		{"no queue", nil, 1, 3, 2},
+		{"queue", []Option{WithWatcherQueue(1)}, 0, 5, 3},
+		{"queue large enough", []Option{WithWatcherQueue(10)}, 0, 5, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs(test.opts...)
+			events := make(chan Event, test.buffer)
+			watcher, _ := fs.Watcher(events)
+			watcher.Watch("/")
+			for i := 0; i < test.events; i++ {
+				fs.Mkdir(fmt.Sprintf("/dir%d", i), 0755)
+			}
+
+			received := make(chan uint64)
+			go func() {
+				n := uint64(0)
+				for range events {
+					n++
+				}
+				received <- n
+			}()
+			watcher.Close()
+			got := <-received
+
+			stats := watcher.(StatWatcher).Stats()
+			if got != stats.Delivered {
+				t.Errorf("Received %d events but stats report %d delivered", got, stats.Delivered)
+			}
+
+			if stats.Delivered+stats.Dropped != uint64(test.events) {
+				t.Errorf("Wanted %d events accounted for got %d", test.events, stats.Delivered+stats.Dropped)
+			}
+
+			if stats.Dropped < test.wantDropped {
+				t.Errorf("Wanted at least %d dropped got %d", test.wantDropped, stats.Dropped)
+			}
+		})
+	}
+}
+
+func TestMemWatcherOverflow(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       OverflowPolicy
+		consume      bool
+		wantReceived int
+		wantOverflow bool
+	}{
+		{"drop", OverflowPolicy{Mode: OverflowDrop}, false, 1, false},
+		{"block timeout", OverflowPolicy{Mode: OverflowBlock, Timeout: time.Millisecond}, false, 1, false},
+		{"block", OverflowPolicy{Mode: OverflowBlock}, true, 5, false},
+		{"queue", OverflowPolicy{Mode: OverflowQueue, Limit: 10}, false, 5, false},
+		{"notify", OverflowPolicy{Mode: OverflowNotify, Limit: 1}, false, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs()
+			events := make(chan Event, 1)
+			watcher, _ := fs.Watcher(events)
+			watcher.(OverflowWatcher).SetOverflowPolicy(test.policy)
+			watcher.Watch("/")
+
+			received := make(chan Event, 10)
+			start := make(chan struct{})
+			go func() {
+				if !test.consume {
+					<-start
+				}
+
+				for event := range events {
+					received <- event
+				}
+				close(received)
+			}()
+
+			for i := 0; i < 5; i++ {
+				fs.Mkdir(fmt.Sprintf("/dir%d", i), 0755)
+			}
+			close(start)
+
+			// the events are received before the watcher is closed since
+			// closing it drops the events that have not been delivered
+			var got []Event
+			for len(got) < test.wantReceived || (test.wantOverflow && (len(got) == 0 || got[len(got)-1].Type != OverflowEvent)) {
+				select {
+				case event := <-received:
+					got = append(got, event)
+				case <-time.After(time.Second):
+					t.Fatalf("Wanted %d events got %v", test.wantReceived, got)
+				}
+			}
+
+			watcher.Close()
+			for event := range received {
+				got = append(got, event)
+			}
+
+			if test.wantOverflow {
+				if len(got) < 2 || got[len(got)-1].Type != OverflowEvent {
+					t.Errorf("Wanted events ending in an overflow got %v", got)
+				}
+
+				for _, event := range got[:len(got)-1] {
+					if event.Type == OverflowEvent {
+						t.Errorf("Wanted a single overflow event got %v", got)
+					}
+				}
+			} else if len(got) != test.wantReceived {
+				t.Errorf("Wanted %d events got %v", test.wantReceived, got)
+			}
+		})
+	}
+}
+
+func TestMemWatcherCloseUndrained(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		policy *OverflowPolicy
+	}{
+		{"drop", nil, nil},
+		{"queue", []Option{WithWatcherQueue(100)}, nil},
+		{"notify", nil, &OverflowPolicy{Mode: OverflowNotify, Limit: 2}},
+		{"block", nil, &OverflowPolicy{Mode: OverflowBlock}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs(test.opts...)
+			events := make(chan Event)
+			watcher, _ := fs.Watcher(events)
+			if test.policy != nil {
+				watcher.(OverflowWatcher).SetOverflowPolicy(*test.policy)
+			}
+			watcher.Watch("/")
+
+			// nothing ever reads the events, so the blocking policy holds
+			// up the first mkdir until the watcher is closed
+			made := make(chan struct{})
+			go func() {
+				for i := 0; i < 5; i++ {
+					fs.Mkdir(fmt.Sprintf("/dir%d", i), 0755)
+				}
+				close(made)
+			}()
+
+			block := test.policy != nil && test.policy.Mode == OverflowBlock
+			if !block {
+				<-made
+			} else {
+				for _, err := fs.Stat("/dir0"); err != nil; _, err = fs.Stat("/dir0") {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			closed := make(chan struct{})
+			go func() {
+				watcher.Close()
+				close(closed)
+			}()
+
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Fatalf("Wanted Close to return without the events being read")
+			}
+			<-made
+
+			if _, ok := <-events; ok {
+				t.Errorf("Wanted the events channel to be closed")
+			}
+
+			// the mkdirs that follow the blocked one may find the watcher
+			// already gone
+			stats := watcher.(StatWatcher).Stats()
+			if stats.Delivered != 0 || (!block && stats.Dropped != 5) || (block && stats.Dropped == 0) {
+				t.Errorf("Wanted the events dropped got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestMemWatcherPolicyUndrained(t *testing.T) {
+	tests := []struct {
+		name string
+		mode OverflowMode
+	}{
+		{"drop", OverflowDrop},
+		{"queue", OverflowQueue},
+		{"notify", OverflowNotify},
+		{"block", OverflowBlock},
+	}
+
+	for _, test := range tests {
+		mode := test.mode
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs(WithWatcherQueue(10))
+			events := make(chan Event)
+			watcher, _ := fs.Watcher(events)
+			watcher.Watch("/")
+			fs.Mkdir("/dir0", 0755)
+			fs.Mkdir("/dir1", 0755)
+
+			// the queued events are handed to the new policy, which only
+			// waits for the consumer when it blocks
+			set := make(chan struct{})
+			go func() {
+				watcher.(OverflowWatcher).SetOverflowPolicy(OverflowPolicy{Mode: mode, Limit: 10})
+				close(set)
+			}()
+
+			if mode != OverflowBlock {
+				select {
+				case <-set:
+				case <-time.After(time.Second):
+					t.Fatalf("Wanted SetOverflowPolicy to return without the events being read")
+				}
+			}
+
+			closed := make(chan struct{})
+			go func() {
+				watcher.Close()
+				close(closed)
+			}()
+
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Fatalf("Wanted Close to return without the events being read")
+			}
+			<-set
+
+			if stats := watcher.(StatWatcher).Stats(); stats.Delivered != 0 || stats.Dropped != 2 {
+				t.Errorf("Wanted 2 events dropped got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestMemWatcherPolicyHandoff(t *testing.T) {
+	fs := NewMemFs(WithWatcherQueue(10))
+	events := make(chan Event)
+	watcher, _ := fs.Watcher(events)
+	defer watcher.Close()
+	watcher.Watch("/")
+	fs.Mkdir("/dir0", 0755)
+	fs.Mkdir("/dir1", 0755)
+	watcher.(OverflowWatcher).SetOverflowPolicy(OverflowPolicy{Mode: OverflowQueue, Limit: 10})
+	fs.Mkdir("/dir2", 0755)
+
+	for _, want := range []string{"/dir0", "/dir1", "/dir2"} {
+		select {
+		case event := <-events:
+			if event.Path != want {
+				t.Errorf("Wanted %v got %v", want, event.Path)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Wanted event for %v", want)
+		}
+	}
+}
+
+func TestMemFileWriteAt(t *testing.T) {
+	fs := NewMemFs()
+	f, _ := fs.Create("/foo.txt")
+	f.Write([]byte("hello world"))
+
+	n, err := f.WriteAt([]byte("HELLO"), 0)
+	if n != 5 || err != nil {
+		t.Fatalf("Wanted 5 bytes written got %d (err %v)", n, err)
+	}
+
+	got := make([]byte, 5)
+	n, err = f.ReadAt(got, 0)
+	if n != 5 || err != nil {
+		t.Errorf("Wanted 5 bytes read got %d (err %v)", n, err)
+	} else if string(got) != "HELLO" {
+		t.Errorf("Wanted %q got %q", "HELLO", string(got))
+	}
+
+	if offset, _ := f.Seek(0, io.SeekCurrent); offset != 11 {
+		t.Errorf("Wanted offset 11 got %d", offset)
+	}
+
+	if _, err = f.ReadAt(got, -1); err != ErrInvalidSeek {
+		t.Errorf("Wanted error %v got %v", ErrInvalidSeek, err)
+	}
+}
+
+func TestMemSymlink(t *testing.T) {
+	fs := NewMemFs()
+	linker := fs.(interface{ Symlink(string, string) error })
+	MkdirAll(fs, "/real/dir", 0755)
+	WriteFile(fs, "/real/dir/file.txt", []byte("content"), 0644)
+	linker.Symlink("/real/dir", "/absolute")
+	linker.Symlink("real/dir", "/relative")
+	linker.Symlink("..", "/real/dir/up")
+	linker.Symlink("/absolute/file.txt", "/file-link")
+	linker.Symlink("/loop-b", "/loop-a")
+	linker.Symlink("/loop-a", "/loop-b")
+	linker.Symlink("self", "/self")
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+		wantErr  error
+	}{
+		{"absolute link to dir", "/absolute/file.txt", "content", nil},
+		{"relative link to dir", "/relative/file.txt", "content", nil},
+		{"link back up", "/relative/up/dir/file.txt", "content", nil},
+		{"link to file", "/file-link", "content", nil},
+		{"loop", "/loop-a/file.txt", "", ErrLoop},
+		{"link to itself", "/self", "", ErrLoop},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadFile(fs, test.filename)
+			if !IsError(test.wantErr, err) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if string(got) != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+
+	if err := WriteFile(fs, "/absolute/new.txt", []byte("new"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(fs, "/real/dir/new.txt"); string(got) != "new" {
+		t.Errorf("Wanted a file created through a link got %q", got)
+	}
+
+	if info, err := fs.Lstat("/absolute"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Wanted Lstat to describe the link got %v (%v)", info, err)
+	} else if info, err = fs.Stat("/absolute"); err != nil || !info.IsDir() {
+		t.Errorf("Wanted Stat to describe the directory got %v (%v)", info, err)
+	}
+
+	if target, err := fs.(linkReader).Readlink("/relative"); err != nil || target != "real/dir" {
+		t.Errorf("Wanted %q got %q (%v)", "real/dir", target, err)
+	}
+
+	if err := linker.Symlink("/real", "/absolute"); !IsError(ErrExist, err) {
+		t.Errorf("Wanted %v got %v", ErrExist, err)
+	}
+}
+
+func TestMemSymlinkDangling(t *testing.T) {
+	fs := NewMemFs()
+	linker := fs.(interface{ Symlink(string, string) error })
+	fs.Mkdir("/dir", 0755)
+	linker.Symlink("dir/target", "/link")
+	linker.Symlink("/link", "/chain")
+
+	if _, err := fs.OpenFile("/link", WrOnlyFlag|CreateFlag|ExclFlag, 0644); !IsError(ErrExist, err) {
+		t.Errorf("Wanted %v got %v", ErrExist, err)
+	}
+
+	// like os, the target of the dangling link is created
+	if err := WriteFile(fs, "/chain", []byte("content"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(fs, "/dir/target"); string(got) != "content" {
+		t.Errorf("Wanted %q got %q", "content", got)
+	}
+
+	f, _ := fs.Open("/")
+	names, _ := f.Readdirnames(-1)
+	sort.Strings(names)
+	if want := []string{"chain", "dir", "link"}; !reflect.DeepEqual(want, names) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+
+	if info, err := fs.Lstat("/link"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Wanted the link to be kept got %v (%v)", info, err)
+	}
+}
+
+func TestMemPermissions(t *testing.T) {
+	fs := NewMemFs(WithPermissions())
+	fs.Mkdir("/dir", 0755)
+	fs.Mkdir("/locked", 0755)
+	WriteFile(fs, "/dir/none", nil, 0000)
+	WriteFile(fs, "/dir/readonly", nil, 0444)
+	WriteFile(fs, "/dir/writeonly", nil, 0200)
+	WriteFile(fs, "/locked/file", nil, 0644)
+	fs.Chmod("/locked", os.ModeDir|0600)
+	fs.Mkdir("/unwritable", 0555)
+
+	tests := []struct {
+		name     string
+		filename string
+		flag     OpenFlag
+		want     error
+	}{
+		{"no permissions", "/dir/none", RdOnlyFlag, ErrPermission},
+		{"read readonly", "/dir/readonly", RdOnlyFlag, nil},
+		{"write readonly", "/dir/readonly", WrOnlyFlag, ErrPermission},
+		{"truncate readonly", "/dir/readonly", RdOnlyFlag | TruncFlag, ErrPermission},
+		{"write writeonly", "/dir/writeonly", WrOnlyFlag, nil},
+		{"read writeonly", "/dir/writeonly", RdWrFlag, ErrPermission},
+		{"search without execute", "/locked/file", RdOnlyFlag, ErrPermission},
+		{"create in unwritable", "/unwritable/new", WrOnlyFlag | CreateFlag, ErrPermission},
+		{"create in writable", "/dir/new", WrOnlyFlag | CreateFlag, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := fs.OpenFile(test.filename, test.flag, 0644)
+			if !IsError(test.want, err) {
+				t.Errorf("Wanted %v got %v", test.want, err)
+			}
+		})
+	}
+
+	if err := fs.Mkdir("/unwritable/dir", 0755); !IsPermission(err) {
+		t.Errorf("Wanted %v got %v", ErrPermission, err)
+	} else if err = fs.Remove("/dir/readonly"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := NewMemFs().Chmod("/", os.ModeDir); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestMemChmod(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/dir", 0755)
+	WriteFile(fs, "/file", nil, 0644)
+
+	tests := []struct {
+		name string
+		path string
+		mode os.FileMode
+		want os.FileMode
+	}{
+		{"dir", "/dir", 0700, os.ModeDir | 0700},
+		{"file", "/file", 0600, 0600},
+		{"type bits ignored", "/file", os.ModeDir | 0400, 0400},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := fs.Chmod(test.path, test.mode); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if info, _ := fs.Stat(test.path); info.Mode() != test.want {
+				t.Errorf("Wanted %v got %v", test.want, info.Mode())
+			}
+		})
+	}
+}
+
+func TestMemModTime(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/file", nil, 0644)
+	info, _ := fs.Stat("/file")
+	before := info.ModTime()
+
+	time.Sleep(time.Millisecond)
+	WriteFile(fs, "/file", []byte("data"), 0644)
+	if after, _ := fs.Stat("/file"); !after.ModTime().After(before) {
+		t.Errorf("Wanted modification time after %v got %v", before, after.ModTime())
+	}
+}
+
+func TestMemCapacity(t *testing.T) {
+	t.Run("bytes", func(t *testing.T) {
+		fs := NewMemFs(WithMaxBytes(4 * blocksize))
+		f, _ := fs.Create("/file")
+		// the root directory entry uses the first block
+		n, err := f.Write(make([]byte, 4*blocksize))
+		if !IsError(ErrNoSpace, err) {
+			t.Errorf("Wanted %v got %v", ErrNoSpace, err)
+		} else if n != int(3*blocksize) {
+			t.Errorf("Wanted %d bytes written got %d", 3*blocksize, n)
+		}
+
+		f, _ = fs.Create("/file")
+		if _, err = f.Write(make([]byte, 2*blocksize)); err != nil {
+			t.Errorf("Wanted truncating to release space got %v", err)
+		}
+	})
+
+	t.Run("inodes", func(t *testing.T) {
+		fs := NewMemFs(WithMaxInodes(3))
+		fs.Mkdir("/dir", 0755)
+		WriteFile(fs, "/file", nil, 0644)
+		if err := WriteFile(fs, "/full", nil, 0644); !IsError(ErrNoSpace, err) {
+			t.Errorf("Wanted %v got %v", ErrNoSpace, err)
+		} else if err = fs.Mkdir("/full", 0755); !IsError(ErrNoSpace, err) {
+			t.Errorf("Wanted %v got %v", ErrNoSpace, err)
+		}
+
+		fs.Remove("/file")
+		if err := WriteFile(fs, "/file", nil, 0644); err != nil {
+			t.Errorf("Wanted removing to release an inode got %v", err)
+		}
+	})
+
+	t.Run("file size", func(t *testing.T) {
+		fs := NewMemFs(WithMaxFileSize(10))
+		f, _ := fs.Create("/file")
+		if n, err := f.Write([]byte("0123456")); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if n, err = f.Write([]byte("789abc")); !IsError(ErrFileTooLarge, err) {
+			t.Errorf("Wanted %v got %v", ErrFileTooLarge, err)
+		} else if n != 3 {
+			t.Errorf("Wanted %d bytes written got %d", 3, n)
+		}
+
+		if _, err := f.WriteAt([]byte("x"), 10); !IsError(ErrFileTooLarge, err) {
+			t.Errorf("Wanted %v got %v", ErrFileTooLarge, err)
+		} else if _, err = f.WriteAt([]byte("x"), 9); err != nil {
+			t.Errorf("Wanted rewriting within the limit to succeed got %v", err)
+		}
+
+		// directories grow regardless
+		for i := 0; i < 16; i++ {
+			if err := WriteFile(fs, fmt.Sprintf("/file%d", i), nil, 0644); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	})
+}
+
+func TestMemBlockSize(t *testing.T) {
+	for _, size := range []int64{16, 1024, 64 * 1024} {
+		t.Run(fmt.Sprintf("%d", size), func(t *testing.T) {
+			fs := NewMemFs(WithBlockSize(size))
+			want := make([]byte, 3*size+7)
+			for i := range want {
+				want[i] = byte(i)
+			}
+
+			if err := WriteFile(fs, "/file", want, 0644); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got, err := ReadFile(fs, "/file")
+			if err != nil || !reflect.DeepEqual(want, got) {
+				t.Errorf("Wanted %d bytes got %d (%v)", len(want), len(got), err)
+			} else if blocks := len(fs.(*memfs).inodes[1].blocks); blocks != 4 {
+				t.Errorf("Wanted 4 blocks got %d", blocks)
+			}
+		})
+	}
+}
+
+func TestMemAppend(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/log", nil, 0644)
+
+	const writers, lines = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		f, err := fs.OpenFile("/log", WrOnlyFlag|AppendFlag, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		wg.Add(1)
+		go func(f File, i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				f.Write([]byte(fmt.Sprintf("writer %d line %02d\n", i, j)))
+			}
+		}(f, i)
+	}
+	wg.Wait()
+
+	got, _ := ReadFile(fs, "/log")
+	if want := writers * lines * len("writer 0 line 00\n"); len(got) != want {
+		t.Errorf("Wanted %d bytes got %d", want, len(got))
+	}
+
+	f, _ := fs.OpenFile("/log", RdWrFlag|AppendFlag, 0)
+	f.Seek(0, io.SeekStart)
+	f.Write([]byte("end\n"))
+	if got, _ := ReadFile(fs, "/log"); !strings.HasSuffix(string(got), "line 49\nend\n") {
+		t.Errorf("Wanted the write to land at the end of the file")
+	}
+}
+
+func TestMemOverwrite(t *testing.T) {
+	fs := NewMemFs(WithBlockSize(8))
+	f, _ := fs.Create("/records")
+	f.Write([]byte("aaaaaaaabbbbbbbbcccc"))
+
+	tests := []struct {
+		name  string
+		write string
+		off   int64
+		want  string
+	}{
+		{"within a block", "XY", 2, "aaXYaaaabbbbbbbbcccc"},
+		{"across blocks", "1234", 6, "aaXYaa1234bbbbbbcccc"},
+		{"past the end", "end", 18, "aaXYaa1234bbbbbbccend"},
+		{"sparse", "!", 24, "aaXYaa1234bbbbbbccend\x00\x00\x00!"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := f.WriteAt([]byte(test.write), test.off); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got, _ := ReadFile(fs, "/records")
+			if string(got) != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			} else if info, _ := f.Stat(); info.Size() != int64(len(test.want)) {
+				t.Errorf("Wanted size %d got %d", len(test.want), info.Size())
+			}
+		})
+	}
+
+	// stale data beyond a truncation must not reappear
+	f.(*memFile).trunc(3)
+	f.WriteAt([]byte("z"), 12)
+	if got, _ := ReadFile(fs, "/records"); string(got) != "aaX\x00\x00\x00\x00\x00\x00\x00\x00\x00z" {
+		t.Errorf("Wanted the gap to read as zeros got %q", got)
+	}
+}
+
+func TestMemRenameSubtree(t *testing.T) {
+	tests := []struct {
+		name    string
+		newpath string
+		wantErr error
+	}{
+		{"into grandchild", "/a/b/c", ErrInvalid},
+		{"into itself", "/a/c", ErrInvalid},
+		{"onto itself", "/a", nil},
+		{"beside", "/c", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs()
+			MkdirAll(fs, "/a/b", 0755)
+			if err := fs.Rename("/a", test.newpath); !IsError(test.wantErr, err) {
+				t.Errorf("Wanted %v got %v", test.wantErr, err)
+			} else if _, ok := err.(*LinkError); err != nil && !ok {
+				t.Errorf("Wanted *LinkError got %T", err)
+			}
+
+			if _, err := fs.Stat(path.Join(test.newpath, "b")); test.wantErr == nil && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if _, err := fs.Stat("/a/b"); test.wantErr != nil && err != nil {
+				t.Errorf("Wanted the tree to be unchanged got %v", err)
+			}
+		})
+	}
+}
+
+func TestMemRenameReplace(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldpath string
+		newpath string
+		wantErr error
+	}{
+		{"file over file", "/a/file1", "/a/file2", nil},
+		{"file over file in other dir", "/a/file1", "/b/file3", nil},
+		{"file over itself", "/a/file1", "/a/file1", nil},
+		{"dir over empty dir", "/b", "/empty", nil},
+		{"file over dir", "/a/file1", "/empty", ErrIsDir},
+		{"dir over file", "/empty", "/a/file1", ErrNotDir},
+		{"dir over non empty dir", "/empty", "/b", ErrNotEmpty},
+		{"missing source", "/a/missing", "/a/file1", ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs()
+			fs.Mkdir("/a", 0755)
+			fs.Mkdir("/b", 0755)
+			fs.Mkdir("/empty", 0755)
+			WriteFile(fs, "/a/file1", []byte("one"), 0644)
+			WriteFile(fs, "/a/file2", []byte("two"), 0644)
+			WriteFile(fs, "/b/file3", []byte("three"), 0644)
+			before, _ := fs.Stat(test.oldpath)
+
+			err := fs.Rename(test.oldpath, test.newpath)
+			if !IsError(test.wantErr, err) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			} else if err != nil {
+				return
+			}
+
+			after, err := fs.Stat(test.newpath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else if before.(*memFileInfo).memInode != after.(*memFileInfo).memInode {
+				t.Errorf("Wanted %s to refer to the renamed inode", test.newpath)
+			}
+
+			names := readDirNames(t, fs, path.Dir(test.newpath))
+			seen := make(map[string]bool)
+			for _, name := range names {
+				if seen[name] {
+					t.Errorf("Wanted a single entry for %q got %v", name, names)
+				}
+				seen[name] = true
+			}
+
+			if test.oldpath != test.newpath {
+				if _, err = fs.Stat(test.oldpath); !IsNotExist(err) {
+					t.Errorf("Wanted %s to be gone got %v", test.oldpath, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMemCaseInsensitive(t *testing.T) {
+	fs := NewMemFs(WithCaseInsensitive())
+	fs.Mkdir("/Dir", 0755)
+	WriteFile(fs, "/Dir/ReadMe.txt", []byte("original"), 0644)
+
+	if got, err := ReadFile(fs, "/dir/README.TXT"); err != nil || string(got) != "original" {
+		t.Errorf("Wanted %q got %q (%v)", "original", got, err)
+	}
+
+	if err := fs.Mkdir("/DIR", 0755); !IsError(ErrExist, err) {
+		t.Errorf("Wanted %v got %v", ErrExist, err)
+	}
+
+	WriteFile(fs, "/dir/readme.txt", []byte("replaced"), 0644)
+	if names := readDirNames(t, fs, "/dir"); !reflect.DeepEqual([]string{"ReadMe.txt"}, names) {
+		t.Errorf("Wanted the original name to be kept got %v", names)
+	}
+
+	if err := fs.Rename("/Dir/ReadMe.txt", "/Dir/README.txt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if names := readDirNames(t, fs, "/dir"); !reflect.DeepEqual([]string{"README.txt"}, names) {
+		t.Errorf("Wanted the case to change got %v", names)
+	}
+
+	if got, _ := ReadFile(fs, "/DIR/readme.TXT"); string(got) != "replaced" {
+		t.Errorf("Wanted %q got %q", "replaced", got)
+	}
+
+	if _, err := NewMemFs().Stat("/DIR"); !IsNotExist(err) {
+		t.Errorf("Wanted names to be case-sensitive by default got %v", err)
+	}
+}
+
+func TestMemCompact(t *testing.T) {
+	held := func(fs FileSystem) (int64, int64) {
+		usage, _ := StatFS(fs)
+		return usage.UsedBytes, usage.Sys.(*MemUsage).HeldBytes
+	}
+
+	fs := NewMemFs()
+	for i := 0; i < 4; i++ {
+		WriteFile(fs, fmt.Sprintf("/file%d", i), make([]byte, 10*blocksize), 0644)
+	}
+	fs.Remove("/file1")
+	fs.Remove("/file3")
+
+	used, before := held(fs)
+	if before <= used {
+		t.Fatalf("Wanted free blocks to hold storage got %d used and %d held", used, before)
+	}
+
+	report, err := GC(context.Background(), fs, GCPolicy{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if report.Bytes != 20*blocksize {
+		t.Errorf("Wanted %d bytes to be reclaimable got %d", 20*blocksize, report.Bytes)
+	} else if _, got := held(fs); got != before {
+		t.Errorf("Wanted a dry run to keep %d bytes got %d", before, got)
+	}
+
+	if report, err = GC(context.Background(), fs, GCPolicy{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if report.Bytes != 20*blocksize {
+		t.Errorf("Wanted %d bytes reclaimed got %d", 20*blocksize, report.Bytes)
+	}
+
+	if used, got := held(fs); got != used {
+		t.Errorf("Wanted %d bytes held got %d", used, got)
+	}
+
+	// the released blocks are reused and the remaining files are intact
+	WriteFile(fs, "/new", []byte("new data"), 0644)
+	for name, want := range map[string]int64{"/file0": 10 * blocksize, "/file2": 10 * blocksize, "/new": 8} {
+		if data, err := ReadFile(fs, name); err != nil || int64(len(data)) != want {
+			t.Errorf("Wanted %d bytes in %s got %d: %v", want, name, len(data), err)
+		}
+	}
+}
+
+func TestMemAutoCompact(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/small", []byte("small"), 0644)
+	WriteFile(fs, "/big", make([]byte, 2*autoCompactBlocks*blocksize), 0644)
+	fs.Remove("/big")
+
+	usage, _ := StatFS(fs)
+	sys := usage.Sys.(*MemUsage)
+	if sys.HeldBytes != usage.UsedBytes {
+		t.Errorf("Wanted %d bytes held got %d", usage.UsedBytes, sys.HeldBytes)
+	}
+
+	if sys.Blocks > 2 {
+		t.Errorf("Wanted the block table to shrink got %d blocks", sys.Blocks)
+	}
+}
+
+func TestMemBlockPool(t *testing.T) {
+	dirty := make([]byte, 4*blocksize)
+	for i := range dirty {
+		dirty[i] = 'x'
+	}
+
+	// blocks released by one filesystem are reused by the next
+	fs := NewMemFs()
+	WriteFile(fs, "/dirty", dirty, 0644)
+	fs.Close()
+
+	fs = NewMemFs()
+	f, _ := fs.Create("/sparse")
+	if _, err := f.WriteAt([]byte("end"), 3*blocksize); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, _ := ReadFile(fs, "/sparse")
+	for i, b := range data[:3*blocksize] {
+		if b != 0 {
+			t.Fatalf("Wanted zero at offset %d got %q", i, b)
+		}
+	}
+
+	// so are blocks released by compaction
+	WriteFile(fs, "/dirty", dirty, 0644)
+	fs.Remove("/dirty")
+	GC(context.Background(), fs, GCPolicy{})
+	f, _ = fs.Create("/sparse")
+	f.WriteAt([]byte("end"), 3*blocksize)
+	data, _ = ReadFile(fs, "/sparse")
+	if string(data) != string(make([]byte, 3*blocksize))+"end" {
+		t.Errorf("Wanted reused blocks to be cleared")
+	}
+}
+
+func TestMemConcurrency(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/shared", 0755)
+	events := make(chan Event, 1024)
+	watcher, _ := fs.Watcher(events)
+	defer watcher.Close()
+	watcher.Watch("/shared")
+	go func() {
+		for range events {
+		}
+	}()
+
+	const workers, rounds = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("/shared/file%d", i)
+			want := []byte(strings.Repeat(fmt.Sprintf("%d", i), 3*int(blocksize)))
+			for round := 0; round < rounds; round++ {
+				if err := WriteFile(fs, name, want, 0644); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+
+				if got, err := ReadFile(fs, name); err != nil || string(got) != string(want) {
+					t.Errorf("Wanted %d bytes of %d in %s got %d: %v", len(want), i, name, len(got), err)
+					return
+				}
+
+				if round%10 == 0 {
+					fs.Remove(name)
+					fs.Stat("/shared")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMemSys(t *testing.T) {
+	fs := NewMemFs(WithBlockSize(1024))
+	WriteFile(fs, "/file", make([]byte, 1500), 0644)
+	WriteFile(fs, "/empty", nil, 0644)
+	fs.Mkdir("/dir", 0755)
+
+	tests := []struct {
+		name   string
+		nlink  uint64
+		size   int64
+		blocks int64
+	}{
+		{"/file", 1, 1500, 4},
+		{"/empty", 1, 0, 0},
+		{"/dir", 2, 0, 0},
+	}
+
+	inodes := make(map[uint64]string)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := fs.Stat(test.name)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			stat, ok := info.Sys().(*MemStat)
+			if !ok {
+				t.Fatalf("Wanted a *MemStat got %T", info.Sys())
+			}
+
+			want := MemStat{Ino: stat.Ino, Nlink: test.nlink, Uid: owner(os.Getuid()), Gid: owner(os.Getgid()), Size: test.size, Blksize: 1024, Blocks: test.blocks}
+			if *stat != want {
+				t.Errorf("Wanted %+v got %+v", want, *stat)
+			}
+
+			if other, found := inodes[stat.Ino]; found {
+				t.Errorf("Wanted a unique inode number got %d for %s and %s", stat.Ino, other, test.name)
+			}
+			inodes[stat.Ino] = test.name
+		})
+	}
+}
+
+func TestMemTrailingSlash(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/dir/sub", 0755)
+	fs.Mkdir("/empty", 0755)
+
+	if err := fs.Rename("/dir/", "/renamed/"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if _, err = fs.Stat("/renamed/sub"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := fs.Remove("/empty/"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if _, err = fs.Stat("/empty"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
+
+func TestMemDirConcurrency(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/dir", 0755)
+
+	// entries span block boundaries, so unserialized changes would tear them
+	const workers, rounds = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				name := fmt.Sprintf("/dir/%d-%d", i, round)
+				if err := WriteFile(fs, name, []byte(name), 0644); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+
+				if got, err := ReadFile(fs, name); err != nil || string(got) != name {
+					t.Errorf("Wanted %q got %q: %v", name, got, err)
+					return
+				}
+
+				if round%2 == 0 {
+					fs.Remove(name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if names := readDirNames(t, fs, "/dir"); len(names) != workers*rounds/2 {
+		t.Errorf("Wanted %d entries got %d", workers*rounds/2, len(names))
+	}
+}
@@ -0,0 +1,149 @@
+package vfs
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricsCollector receives the measurements taken by a FileSystem returned
+// from Instrument.  Operations are identified by the lower case name of the
+// method, such as "open", "stat" or "read", so each method maps directly onto
+// a Prometheus vector labelled by operation.  Collectors are called from
+// every goroutine using the FileSystem and must be safe for concurrent use
+type MetricsCollector interface {
+	// ObserveOp records an operation that completed after duration with
+	// the given error, which is nil on success.  Reads and writes that
+	// reach the end of a file report io.EOF
+	ObserveOp(op string, duration time.Duration, err error)
+
+	// AddBytes records n bytes transferred by a read or write operation
+	AddBytes(op string, n int)
+}
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram kept
+// by Metrics when no buckets are given
+var DefaultLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// OpMetrics are the measurements Metrics keeps for a single operation
+type OpMetrics struct {
+	// Count is the number of times the operation was performed
+	Count int64
+
+	// Errors is the number of times the operation failed.  io.EOF is not
+	// counted as a failure
+	Errors int64
+
+	// Bytes is the number of bytes read or written
+	Bytes int64
+
+	// Latency counts the operations by duration.  Latency[i] is the number
+	// of operations that took at most Buckets[i] and the final element
+	// counts those slower than every bucket
+	Latency []int64
+
+	// Total is the sum of the durations of every operation
+	Total time.Duration
+}
+
+// Metrics is a MetricsCollector that keeps counts and latency histograms in
+// memory, for services that expose them some other way or for tests
+type Metrics struct {
+	buckets []time.Duration
+
+	mu  sync.Mutex
+	ops map[string]*OpMetrics
+}
+
+// NewMetrics returns an empty Metrics with the given latency buckets, which
+// default to DefaultLatencyBuckets
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return &Metrics{buckets: buckets, ops: make(map[string]*OpMetrics)}
+}
+
+// Buckets returns the upper bounds of the latency histogram
+func (m *Metrics) Buckets() []time.Duration {
+	return append([]time.Duration(nil), m.buckets...)
+}
+
+func (m *Metrics) op(name string) *OpMetrics {
+	op, found := m.ops[name]
+	if !found {
+		op = &OpMetrics{Latency: make([]int64, len(m.buckets)+1)}
+		m.ops[name] = op
+	}
+	return op
+}
+
+// ObserveOp counts the operation and adds its duration to the histogram
+func (m *Metrics) ObserveOp(name string, duration time.Duration, err error) {
+	bucket := sort.Search(len(m.buckets), func(i int) bool { return duration <= m.buckets[i] })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op := m.op(name)
+	op.Count++
+	op.Total += duration
+	op.Latency[bucket]++
+	if err != nil && err != io.EOF {
+		op.Errors++
+	}
+}
+
+// AddBytes adds n to the bytes transferred by the operation
+func (m *Metrics) AddBytes(name string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.op(name).Bytes += int64(n)
+}
+
+// Snapshot returns a copy of the measurements of every operation performed
+// so far
+func (m *Metrics) Snapshot() map[string]OpMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]OpMetrics, len(m.ops))
+	for name, op := range m.ops {
+		copied := *op
+		copied.Latency = append([]int64(nil), op.Latency...)
+		snapshot[name] = copied
+	}
+	return snapshot
+}
+
+// metricsObserver reports the operations of an observed FileSystem to a
+// MetricsCollector
+type metricsObserver struct {
+	collector MetricsCollector
+}
+
+// Instrument returns a FileSystem that reports every operation on fs, and on
+// the files it opens, to collector along with how long it took and whether
+// it failed.  Reads and writes also report the number of bytes transferred
+func Instrument(fs FileSystem, collector MetricsCollector) FileSystem {
+	return Observe(fs, metricsObserver{collector})
+}
+
+func (mo metricsObserver) Begin(op Op) func(n int, err error) {
+	start := time.Now()
+	return func(n int, err error) {
+		mo.collector.ObserveOp(op.Name, time.Since(start), err)
+		if n > 0 && (op.Name == "read" || op.Name == "write") {
+			mo.collector.AddBytes(op.Name, n)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package vfs
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInstrument(t *testing.T) {
+	metrics := NewMetrics()
+	fs := Instrument(NewMemFs(), metrics)
+
+	WriteFile(fs, "/file.txt", []byte("hello world"), 0644)
+	ReadFile(fs, "/file.txt")
+	fs.Stat("/file.txt")
+	fs.Stat("/missing")
+	fs.Mkdir("/dir", 0755)
+	fs.Rename("/file.txt", "/dir/file.txt")
+
+	got := metrics.Snapshot()
+	tests := []struct {
+		op     string
+		count  int64
+		errors int64
+		bytes  int64
+	}{
+		{"openfile", 1, 0, 0},
+		{"open", 1, 0, 0},
+		{"write", 1, 0, 11},
+		{"read", 1, 0, 11},
+		{"close", 2, 0, 0},
+		{"stat", 2, 1, 0},
+		{"mkdir", 1, 0, 0},
+		{"rename", 1, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.op, func(t *testing.T) {
+			op, found := got[test.op]
+			if !found {
+				t.Fatalf("Wanted metrics for %s got none", test.op)
+			}
+
+			if op.Count != test.count || op.Errors != test.errors || op.Bytes != test.bytes {
+				t.Errorf("Wanted count %d errors %d bytes %d got %d %d %d", test.count, test.errors, test.bytes, op.Count, op.Errors, op.Bytes)
+			}
+
+			var observed int64
+			for _, n := range op.Latency {
+				observed += n
+			}
+			if observed != op.Count {
+				t.Errorf("Wanted %d latency observations got %d", op.Count, observed)
+			}
+		})
+	}
+
+	if unwrapper, ok := fs.(Unwrapper); !ok || len(unwrapper.Unwrap()) != 1 {
+		t.Errorf("Wanted the instrumented FileSystem to unwrap")
+	}
+}
+
+func TestMetricsBuckets(t *testing.T) {
+	metrics := NewMetrics(time.Second, time.Millisecond)
+	metrics.ObserveOp("op", 500*time.Microsecond, nil)
+	metrics.ObserveOp("op", time.Millisecond, io.EOF)
+	metrics.ObserveOp("op", 10*time.Millisecond, ErrNotExist)
+	metrics.ObserveOp("op", time.Minute, nil)
+
+	want := OpMetrics{
+		Count:   4,
+		Errors:  1,
+		Latency: []int64{2, 1, 1},
+		Total:   time.Minute + 11*time.Millisecond + 500*time.Microsecond,
+	}
+
+	if got := metrics.Snapshot()["op"]; !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %+v got %+v", want, got)
+	}
+
+	if got := metrics.Buckets(); !reflect.DeepEqual([]time.Duration{time.Millisecond, time.Second}, got) {
+		t.Errorf("Wanted sorted buckets got %v", got)
+	}
+}
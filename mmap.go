@@ -0,0 +1,89 @@
+package vfs
+
+import "sync"
+
+// mmapRegionSize is the size of the regions a mmapArena maps at once
+const mmapRegionSize = 1 << 20
+
+// mmapArena hands out block storage carved from anonymous memory mappings,
+// which the Go garbage collector does not scan.  An arena is shared by a
+// memfs and its snapshots and clones, since they share blocks, and its
+// regions are unmapped once the last of them is closed
+type mmapArena struct {
+	mu        sync.Mutex
+	blocksize int64
+	regions   [][]byte
+
+	// next is what is left of the newest region, spare holds released
+	// blocks waiting to be reused
+	next  []byte
+	spare [][]byte
+	refs  int
+}
+
+func newMmapArena(blocksize int64) *mmapArena {
+	return &mmapArena{blocksize: blocksize, refs: 1}
+}
+
+// get returns storage for a block.  Blocks come from the heap if memory
+// cannot be mapped
+func (a *mmapArena) get() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n := len(a.spare); n > 0 {
+		block := a.spare[n-1]
+		a.spare = a.spare[:n-1]
+		clearBlock(block)
+		return block
+	}
+
+	if int64(len(a.next)) < a.blocksize {
+		size := int64(mmapRegionSize)
+		if size < a.blocksize {
+			size = a.blocksize
+		}
+
+		region, err := mmap(int(size - size%a.blocksize))
+		if err != nil {
+			return make([]byte, a.blocksize)
+		}
+		a.regions = append(a.regions, region)
+		a.next = region
+	}
+
+	// mapped memory starts out cleared
+	block := a.next[:a.blocksize:a.blocksize]
+	a.next = a.next[a.blocksize:]
+	return block
+}
+
+// put keeps the storage of a released block for reuse
+func (a *mmapArena) put(block []byte) {
+	a.mu.Lock()
+	a.spare = append(a.spare, block)
+	a.mu.Unlock()
+}
+
+// ref adds a memfs sharing the arena
+func (a *mmapArena) ref() {
+	a.mu.Lock()
+	a.refs++
+	a.mu.Unlock()
+}
+
+// release drops a reference and unmaps the regions when it was the last
+func (a *mmapArena) release() (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.refs--; a.refs > 0 {
+		return nil
+	}
+
+	for _, region := range a.regions {
+		if err1 := munmap(region); err == nil {
+			err = err1
+		}
+	}
+	a.regions, a.next, a.spare = nil, nil, nil
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package vfs
+
+// mmap is not supported on this platform, so WithMmap stores blocks on the
+// heap
+func mmap(size int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+func munmap(region []byte) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestMmap(t *testing.T) {
+	want := bytes.Repeat([]byte("0123456789"), 300*1024)
+	fs := NewMemFs(WithMmap(), WithBlockSize(4096))
+	if fs.(*memfs).arena == nil {
+		t.Fatalf("Wanted the filesystem to have an arena")
+	}
+
+	if err := WriteFile(fs, "/big", want, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the snapshot keeps the mappings alive after the original is closed
+	snapshot := fs.(interface{ Snapshot() FileSystem }).Snapshot()
+	WriteFile(fs, "/big", []byte("changed"), 0644)
+	WriteFile(fs, "/other", want[:5000], 0644)
+	fs.Remove("/other")
+	GC(context.Background(), fs, GCPolicy{})
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, err := ReadFile(snapshot, "/big"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if !bytes.Equal(got, want) {
+		t.Errorf("Wanted %d bytes got %d", len(want), len(got))
+	}
+
+	clone := snapshot.(interface{ Clone() FileSystem }).Clone()
+	if err := snapshot.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// blocks released by the others are reused cleared
+	f, _ := clone.Create("/sparse")
+	f.WriteAt([]byte("end"), 3*4096)
+	if got, _ := ReadFile(clone, "/sparse"); !bytes.Equal(got, append(make([]byte, 3*4096), "end"...)) {
+		t.Errorf("Wanted reused blocks to be cleared")
+	}
+
+	if got, _ := ReadFile(clone, "/big"); !bytes.Equal(got, want) {
+		t.Errorf("Wanted the clone to keep the data")
+	}
+
+	if err := clone.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package vfs
+
+import "syscall"
+
+// mmap maps size bytes of anonymous memory
+func mmap(size int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func munmap(region []byte) error {
+	return syscall.Munmap(region)
+}
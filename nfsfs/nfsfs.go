@@ -0,0 +1,118 @@
+// Package nfsfs serves a vfs.FileSystem over NFSv3 using
+// github.com/willscott/go-nfs.  This allows a memfs, or a filesystem composed
+// of several backends, to be mounted by a real NFS client for integration
+// testing without provisioning any storage.
+package nfsfs
+
+import (
+	"net"
+	"os"
+
+	"github.com/mh-orange/vfs"
+	"github.com/mh-orange/vfs/billyfs"
+	nfs "github.com/willscott/go-nfs"
+	nfshelper "github.com/willscott/go-nfs/helpers"
+)
+
+// DefaultHandleCacheSize is the number of file handles remembered by the
+// handler returned from NewHandler when the cache size is not positive
+const DefaultHandleCacheSize = 1024
+
+// toOsErr converts vfs errors into their os equivalents, go-nfs relies on
+// os.IsNotExist and os.IsExist to choose NFS status codes
+func toOsErr(err error) error {
+	switch e := err.(type) {
+	case *vfs.PathError:
+		return &os.PathError{Op: e.Op, Path: e.Path, Err: toOsErr(e.Cause)}
+	case *vfs.LinkError:
+		return &os.LinkError{Op: e.Op, Old: e.Old, New: e.New, Err: toOsErr(e.Cause)}
+	}
+
+	switch err {
+	case vfs.ErrNotExist:
+		err = os.ErrNotExist
+	case vfs.ErrExist:
+		err = os.ErrExist
+	case vfs.ErrClosed:
+		err = os.ErrClosed
+	case vfs.ErrPermission:
+		err = os.ErrPermission
+	case vfs.ErrReadOnly:
+		err = os.ErrPermission
+	}
+	return err
+}
+
+// osErrFs converts the errors returned by a vfs.FileSystem with toOsErr
+type osErrFs struct {
+	vfs.FileSystem
+}
+
+func (fs osErrFs) Chmod(name string, mode os.FileMode) error {
+	return toOsErr(fs.FileSystem.Chmod(name, mode))
+}
+
+func (fs osErrFs) Create(name string) (vfs.File, error) {
+	f, err := fs.FileSystem.Create(name)
+	return f, toOsErr(err)
+}
+
+func (fs osErrFs) Open(name string) (vfs.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	return f, toOsErr(err)
+}
+
+func (fs osErrFs) OpenFile(name string, flag vfs.OpenFlag, perm os.FileMode) (vfs.File, error) {
+	f, err := fs.FileSystem.OpenFile(name, flag, perm)
+	return f, toOsErr(err)
+}
+
+func (fs osErrFs) Mkdir(name string, perm os.FileMode) error {
+	return toOsErr(fs.FileSystem.Mkdir(name, perm))
+}
+
+func (fs osErrFs) Remove(name string) error {
+	return toOsErr(fs.FileSystem.Remove(name))
+}
+
+func (fs osErrFs) Rename(oldpath, newpath string) error {
+	return toOsErr(fs.FileSystem.Rename(oldpath, newpath))
+}
+
+func (fs osErrFs) Lstat(name string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Lstat(name)
+	return info, toOsErr(err)
+}
+
+func (fs osErrFs) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Stat(name)
+	return info, toOsErr(err)
+}
+
+// NewHandler returns a go-nfs handler exporting fs at "/" to any client
+// without authentication.  File handles are cached for the most recently used
+// cacheSize files, or DefaultHandleCacheSize when cacheSize is not positive
+func NewHandler(fs vfs.FileSystem, cacheSize int) nfs.Handler {
+	if cacheSize <= 0 {
+		cacheSize = DefaultHandleCacheSize
+	}
+	handler := nfshelper.NewNullAuthHandler(billyfs.New(osErrFs{fs}))
+	return nfshelper.NewCachingHandler(handler, cacheSize)
+}
+
+// Serve accepts NFS connections on l and serves fs to them.  It blocks until
+// l is closed
+func Serve(l net.Listener, fs vfs.FileSystem) error {
+	return nfs.Serve(l, NewHandler(fs, DefaultHandleCacheSize))
+}
+
+// ListenAndServe listens on the TCP network address addr and serves fs to
+// incoming NFS connections
+func ListenAndServe(addr string, fs vfs.FileSystem) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return Serve(l, fs)
+}
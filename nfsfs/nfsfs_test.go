@@ -0,0 +1,89 @@
+package nfsfs
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+	nfsc "github.com/willscott/go-nfs-client/nfs"
+	"github.com/willscott/go-nfs-client/nfs/rpc"
+)
+
+func TestToOsErr(t *testing.T) {
+	tests := []struct {
+		name  string
+		input error
+		check func(error) bool
+	}{
+		{"not exist", &vfs.PathError{Op: "open", Path: "/foo", Cause: vfs.ErrNotExist}, os.IsNotExist},
+		{"exist", &vfs.PathError{Op: "mkdir", Path: "/foo", Cause: vfs.ErrExist}, os.IsExist},
+		{"read only", &vfs.PathError{Op: "write", Path: "/foo", Cause: vfs.ErrReadOnly}, os.IsPermission},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := toOsErr(test.input); !test.check(got) {
+				t.Errorf("Unexpected error %v", got)
+			}
+		})
+	}
+
+	if err := toOsErr(nil); err != nil {
+		t.Errorf("Wanted nil got %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	fs := vfs.NewMemFs()
+	vfs.WriteFile(fs, "/hello.txt", []byte("hello"), 0644)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+	go Serve(listener, fs)
+
+	c, err := rpc.DialTCP(listener.Addr().Network(), listener.Addr().String(), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	mounter := nfsc.Mount{Client: c}
+	target, err := mounter.Mount("/", rpc.AuthNull)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer mounter.Unmount()
+
+	entries, err := target.ReadDirPlus("/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := false
+	for _, entry := range entries {
+		found = found || entry.Name() == "hello.txt"
+	}
+
+	if !found {
+		t.Errorf("Wanted hello.txt in the directory listing")
+	}
+
+	f, err := target.Open("/hello.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	if content, err := io.ReadAll(f); err != nil || string(content) != "hello" {
+		t.Errorf("Wanted %q got %q (%v)", "hello", content, err)
+	}
+
+	if _, err = target.Open("/missing.txt"); err == nil {
+		t.Errorf("Wanted an error opening a missing file")
+	}
+}
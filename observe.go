@@ -0,0 +1,209 @@
+package vfs
+
+import (
+	"io"
+	"os"
+)
+
+// Op describes an operation performed through a FileSystem returned by
+// Observe or WithHooks or on one of the files it opened
+type Op struct {
+	// Name is the lower case name of the method, such as "open" or
+	// "rename".  ReadAt and WriteAt are reported as "read" and "write" and
+	// Readdirnames as "readdir"
+	Name string
+
+	// Path is the name of the file operated on
+	Path string
+
+	// NewPath is the destination of a rename
+	NewPath string
+
+	// Flag is the flag given to OpenFile
+	Flag OpenFlag
+
+	// Mode is the mode given to OpenFile, Mkdir and Chmod
+	Mode os.FileMode
+}
+
+// Observer is told about every operation performed through a FileSystem
+// returned by Observe.  Observers are called from every goroutine using the
+// FileSystem and must be safe for concurrent use
+type Observer interface {
+	// Begin is called as an operation starts and returns the function
+	// that is called with its result.  n is the number of bytes read or
+	// written or the number of directory entries read
+	Begin(op Op) func(n int, err error)
+}
+
+// observedfs wraps a FileSystem, and the files it opens, so that an
+// Observer sees every operation
+type observedfs struct {
+	FileSystem
+	observer Observer
+}
+
+// Observe returns a FileSystem that tells observer about every operation on
+// fs and on the files it opens.  It is the basis of Instrument and NewLogFs
+// and of wrappers in other packages that report on operations, such as
+// tracing
+func Observe(fs FileSystem, observer Observer) FileSystem {
+	return &observedfs{FileSystem: fs, observer: observer}
+}
+
+// file wraps a file opened by the underlying FileSystem
+func (ofs *observedfs) file(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &observedFile{File: f, observer: ofs.observer}, nil
+}
+
+func (ofs *observedfs) Chmod(filename string, mode os.FileMode) error {
+	end := ofs.observer.Begin(Op{Name: "chmod", Path: filename, Mode: mode})
+	err := ofs.FileSystem.Chmod(filename, mode)
+	end(0, err)
+	return err
+}
+
+func (ofs *observedfs) Create(filename string) (File, error) {
+	end := ofs.observer.Begin(Op{Name: "create", Path: filename})
+	f, err := ofs.FileSystem.Create(filename)
+	end(0, err)
+	return ofs.file(f, err)
+}
+
+func (ofs *observedfs) Open(filename string) (File, error) {
+	end := ofs.observer.Begin(Op{Name: "open", Path: filename})
+	f, err := ofs.FileSystem.Open(filename)
+	end(0, err)
+	return ofs.file(f, err)
+}
+
+func (ofs *observedfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	end := ofs.observer.Begin(Op{Name: "openfile", Path: filename, Flag: flag, Mode: perm})
+	f, err := ofs.FileSystem.OpenFile(filename, flag, perm)
+	end(0, err)
+	return ofs.file(f, err)
+}
+
+func (ofs *observedfs) Mkdir(name string, perm os.FileMode) error {
+	end := ofs.observer.Begin(Op{Name: "mkdir", Path: name, Mode: perm})
+	err := ofs.FileSystem.Mkdir(name, perm)
+	end(0, err)
+	return err
+}
+
+func (ofs *observedfs) Remove(name string) error {
+	end := ofs.observer.Begin(Op{Name: "remove", Path: name})
+	err := ofs.FileSystem.Remove(name)
+	end(0, err)
+	return err
+}
+
+func (ofs *observedfs) Rename(oldpath, newpath string) error {
+	end := ofs.observer.Begin(Op{Name: "rename", Path: oldpath, NewPath: newpath})
+	err := ofs.FileSystem.Rename(oldpath, newpath)
+	end(0, err)
+	return err
+}
+
+func (ofs *observedfs) Lstat(filename string) (os.FileInfo, error) {
+	end := ofs.observer.Begin(Op{Name: "lstat", Path: filename})
+	fi, err := ofs.FileSystem.Lstat(filename)
+	end(0, err)
+	return fi, err
+}
+
+func (ofs *observedfs) Stat(filename string) (os.FileInfo, error) {
+	end := ofs.observer.Begin(Op{Name: "stat", Path: filename})
+	fi, err := ofs.FileSystem.Stat(filename)
+	end(0, err)
+	return fi, err
+}
+
+// Unwrap returns the observed FileSystem
+func (ofs *observedfs) Unwrap() []FileSystem {
+	return []FileSystem{ofs.FileSystem}
+}
+
+// observedFile reports the operations on a file opened by an observedfs
+type observedFile struct {
+	File
+	observer Observer
+}
+
+func (f *observedFile) begin(op string) func(n int, err error) {
+	return f.observer.Begin(Op{Name: op, Path: f.Name()})
+}
+
+func (f *observedFile) Read(p []byte) (int, error) {
+	end := f.begin("read")
+	n, err := f.File.Read(p)
+	end(n, err)
+	return n, err
+}
+
+func (f *observedFile) ReadAt(p []byte, off int64) (int, error) {
+	end := f.begin("read")
+	n, err := f.File.ReadAt(p, off)
+	end(n, err)
+	return n, err
+}
+
+func (f *observedFile) Write(p []byte) (int, error) {
+	end := f.begin("write")
+	n, err := f.File.Write(p)
+	end(n, err)
+	return n, err
+}
+
+func (f *observedFile) WriteAt(p []byte, off int64) (int, error) {
+	end := f.begin("write")
+	n, err := f.File.WriteAt(p, off)
+	end(n, err)
+	return n, err
+}
+
+func (f *observedFile) Seek(offset int64, whence int) (int64, error) {
+	end := f.begin("seek")
+	n, err := f.File.Seek(offset, whence)
+	end(0, err)
+	return n, err
+}
+
+func (f *observedFile) Readdir(n int) ([]os.FileInfo, error) {
+	end := f.begin("readdir")
+	infos, err := f.File.Readdir(n)
+	end(len(infos), err)
+	return infos, err
+}
+
+func (f *observedFile) Readdirnames(n int) ([]string, error) {
+	end := f.begin("readdir")
+	names, err := f.File.Readdirnames(n)
+	end(len(names), err)
+	return names, err
+}
+
+// Truncate changes the size of the file if the underlying file supports it
+func (f *observedFile) Truncate(size int64) error {
+	end := f.begin("truncate")
+	err := error(&PathError{Op: "truncate", Path: f.Name(), Cause: ErrNotSupported})
+	if truncater, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		err = truncater.Truncate(size)
+	}
+	end(0, err)
+	return err
+}
+
+// Close closes the underlying file if it can be closed
+func (f *observedFile) Close() error {
+	end := f.begin("close")
+	var err error
+	if closer, ok := f.File.(io.Closer); ok {
+		err = closer.Close()
+	}
+	end(0, err)
+	return err
+}
@@ -0,0 +1,327 @@
+package vfs
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// Option configures a FileSystem when passed to one of the constructors
+// such as NewMemFs.  Options that do not apply to the FileSystem being
+// constructed are ignored
+type Option func(FileSystem)
+
+// WithWatcherQueue configures the memfs and osfs watchers to buffer events
+// in an internal queue that grows as needed up to limit events.  Without a
+// queue a memfs watcher drops any event that does not fit in the caller's
+// channel and an osfs watcher waits for it to have room.  With a queue only
+// events arriving while limit events are already pending are dropped.
+// Dropped events are counted and reported by the watcher's Stats
+func WithWatcherQueue(limit int) Option {
+	if limit <= 0 {
+		return func(FileSystem) {}
+	}
+	return WithOverflowPolicy(OverflowPolicy{Mode: OverflowQueue, Limit: limit})
+}
+
+// WithOverflowPolicy sets the policy memfs and osfs watchers start with for
+// events that do not fit in their channel.  The policy of an individual
+// watcher can be changed with its SetOverflowPolicy method
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.overflow = policy
+		} else if ofs, ok := fs.(*osfs); ok {
+			ofs.overflow = policy
+		}
+	}
+}
+
+// WithPermissions configures a memfs to enforce the owner permission bits of
+// its files and directories.  Opening a file for reading or writing requires
+// the read or write bit, listing a directory requires its read bit, looking
+// up names in a directory requires its execute bit and creating, removing or
+// renaming entries requires the write and execute bits of the directory.
+// Operations that are not allowed fail with ErrPermission.
+//
+// An osfs leaves most checks to the operating system but, since those are
+// skipped for root, checks the owner bits of existing files itself before
+// opening them
+func WithPermissions() Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.permissions = true
+		} else if ofs, ok := fs.(*osfs); ok {
+			ofs.permissions = true
+		}
+	}
+}
+
+// WithBlockSize sets the size of the blocks a memfs stores file data in.
+// The default of 1KiB keeps small files small, larger blocks make large files
+// much cheaper to write since fewer blocks need to be allocated
+func WithBlockSize(size int64) Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok && size > 0 {
+			mfs.blocksize = size
+		}
+	}
+}
+
+// WithMmap stores the blocks of a memfs in anonymous memory mappings rather
+// than on the Go heap, which keeps very large filesystems from lengthening
+// garbage collection.  Released blocks are kept for reuse and the mappings
+// are only unmapped once the memfs and all of its snapshots and clones have
+// been closed, so none of them may be used after that.  Where memory cannot
+// be mapped blocks are stored on the heap as usual
+func WithMmap() Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.mmap = true
+		}
+	}
+}
+
+// WithSpill lets a memfs hold more data than fits in memory.  Once the block
+// storage in memory reaches maxResident bytes the least recently used blocks
+// are written to a file on backing, such as an osfs rooted in a scratch
+// directory, and read back in transparently when they are next used.  The
+// spill file is removed when the memfs and its snapshots and clones are
+// closed.  backing must not be the memfs itself
+func WithSpill(backing FileSystem, maxResident int64) Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok && backing != nil {
+			mfs.spill = newMemSpill(backing, maxResident)
+		}
+	}
+}
+
+// WithMaxBytes limits the space a memfs may allocate for file data and
+// directory entries to max bytes.  Space is allocated in whole blocks, so
+// the limit is effectively rounded down to a multiple of the block size.
+// Writes that need more space fail with ErrNoSpace
+func WithMaxBytes(max int64) Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.maxBytes = max
+		}
+	}
+}
+
+// WithMaxInodes limits the number of files, directories and symbolic links,
+// including the root directory, a memfs may hold.  Creating more fails with
+// ErrNoSpace
+func WithMaxInodes(max int) Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.maxInodes = max
+		}
+	}
+}
+
+// WithMaxFileSize limits the size of each regular file in a memfs to max
+// bytes.  Writes that would grow a file past it write as much as fits and
+// fail with ErrFileTooLarge.  Other FileSystems can be limited with the
+// MaxFileSize of a Quota
+func WithMaxFileSize(max int64) Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.maxFileSize = max
+		}
+	}
+}
+
+// WithCaseInsensitive makes a memfs look names up without regard to case,
+// the way macOS and Windows filesystems do by default.  Names keep the case
+// they were created with, so listings show the original names, and creating
+// a name that differs from an existing one only in case opens the existing
+// file
+func WithCaseInsensitive() Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.caseInsensitive = true
+		}
+	}
+}
+
+// WithSortedReaddir makes a memfs or osfs list directories sorted by name.
+// memfs otherwise lists entries in the order they were created and osfs in
+// whatever order the operating system keeps them.  Other FileSystems can be
+// wrapped in a SortedFs
+func WithSortedReaddir() Option {
+	return func(fs FileSystem) {
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.sorted = true
+		} else if ofs, ok := fs.(*osfs); ok {
+			ofs.sorted = true
+		}
+	}
+}
+
+// WithDefaultPerms makes a memfs or osfs create files with the permissions
+// file and directories with dir, whatever the caller asked for, which keeps
+// the permissions of everything written through a shared FileSystem within a
+// policy.  The umask is still cleared from them and a zero mode leaves the
+// permissions of that kind of entry to the caller
+func WithDefaultPerms(file, dir os.FileMode) Option {
+	return func(fs FileSystem) {
+		perms := defaultPerms{file: file & os.ModePerm, dir: dir & os.ModePerm}
+		if mfs, ok := fs.(*memfs); ok {
+			mfs.perms = perms
+		} else if ofs, ok := fs.(*osfs); ok {
+			ofs.perms = perms
+		}
+	}
+}
+
+// WithUmask sets the mask that a memfs or osfs clears from the permissions
+// of new files and directories.  An osfs given a umask sets the permissions
+// of what it creates explicitly, so the process umask no longer applies
+func WithUmask(mask os.FileMode) Option {
+	return func(fs FileSystem) {
+		if umasker, ok := fs.(Umasker); ok {
+			umasker.SetUmask(mask)
+		}
+	}
+}
+
+// WithSyncOnClose configures an osfs to fsync files that were opened for
+// writing when they are closed.  Close does not return until the data has
+// been committed to stable storage
+func WithSyncOnClose() Option {
+	return func(fs FileSystem) {
+		if ofs, ok := fs.(*osfs); ok {
+			ofs.syncOnClose = true
+		}
+	}
+}
+
+// WithDirSync configures an osfs to fsync the parent directory after a
+// file or directory is created, removed or renamed so that the directory
+// entry itself is durable
+func WithDirSync() Option {
+	return func(fs FileSystem) {
+		if ofs, ok := fs.(*osfs); ok {
+			ofs.dirSync = true
+		}
+	}
+}
+
+// WithIdleTimeout configures a FileSystem created by NewConnFs to close its
+// connection once it has not been used for timeout
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(fs FileSystem) {
+		if c, ok := fs.(*connfs); ok {
+			c.idleTimeout = timeout
+		}
+	}
+}
+
+// WithKeepalive configures a FileSystem created by NewConnFs to check its
+// connection every interval so that lost connections are detected early
+func WithKeepalive(interval time.Duration) Option {
+	return func(fs FileSystem) {
+		if c, ok := fs.(*connfs); ok {
+			c.keepalive = interval
+		}
+	}
+}
+
+// WithReconnect sets the backoff used by a FileSystem created by NewConnFs
+// when re-establishing a lost connection
+func WithReconnect(backoff Backoff) Option {
+	return func(fs FileSystem) {
+		if c, ok := fs.(*connfs); ok {
+			c.backoff = backoff
+		}
+	}
+}
+
+// WithHTTPClient sets the client used by a FileSystem created by NewHttpFs
+func WithHTTPClient(client *http.Client) Option {
+	return func(fs FileSystem) {
+		if hfs, ok := fs.(*httpfs); ok {
+			hfs.client = client
+		}
+	}
+}
+
+// WithIndexManifest configures a FileSystem created by NewHttpFs to read its
+// directory structure from the Manifest at name, relative to the base URL
+func WithIndexManifest(name string) Option {
+	return func(fs FileSystem) {
+		if hfs, ok := fs.(*httpfs); ok {
+			hfs.index = name
+		}
+	}
+}
+
+// WithClock sets the Clock used by FileSystems that track time, such as
+// the last use of files held by a CacheFs, the flush timer of a
+// WriteBackFs or the age of the files in a TTLFs
+func WithClock(clock Clock) Option {
+	return func(fs FileSystem) {
+		switch fs := fs.(type) {
+		case *CacheFs:
+			fs.clock = clock
+		case *WriteBackFs:
+			fs.clock = clock
+		case *TTLFs:
+			fs.clock = clock
+		}
+	}
+}
+
+// WithFlushInterval configures a WriteBackFs to flush closed files every
+// interval rather than as soon as they are closed
+func WithFlushInterval(interval time.Duration) Option {
+	return func(fs FileSystem) {
+		if wfs, ok := fs.(*WriteBackFs); ok {
+			wfs.interval = interval
+		}
+	}
+}
+
+// WithMaxVersions limits the number of versions a VersionFs keeps of each
+// file, the oldest are removed once there are more
+func WithMaxVersions(max int) Option {
+	return func(fs FileSystem) {
+		if verfs, ok := fs.(*VersionFs); ok {
+			verfs.maxVersions = max
+		}
+	}
+}
+
+// WithSweepInterval configures how often a TTLFs sweeps the whole
+// FileSystem for expired files.  Zero or less disables the sweeps, leaving
+// files to expire when they are next accessed
+func WithSweepInterval(interval time.Duration) Option {
+	return func(fs FileSystem) {
+		if tfs, ok := fs.(*TTLFs); ok {
+			tfs.interval = interval
+		}
+	}
+}
+
+// WithFlushErrorHandler sets a function that a WriteBackFs calls whenever a
+// file cannot be flushed to the backing FileSystem.  This is the only way to
+// learn of failures of flushes made by the interval timer
+func WithFlushErrorHandler(handler func(name string, err error)) Option {
+	return func(fs FileSystem) {
+		if wfs, ok := fs.(*WriteBackFs); ok {
+			wfs.onError = handler
+		}
+	}
+}
+
+// WithEncryptedNames configures a FileSystem created by NewCryptFs to encrypt
+// file and directory names as well as file contents.  Encrypted names are
+// longer than the originals, which matters for backing FileSystems that
+// limit name length
+func WithEncryptedNames() Option {
+	return func(fs FileSystem) {
+		if cfs, ok := fs.(*cryptfs); ok {
+			cfs.names = true
+		}
+	}
+}
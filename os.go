@@ -15,8 +15,10 @@
 package vfs
 
 import (
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -24,39 +26,260 @@ import (
 // osfs is a VFS backed by the operating system filesystem
 type osfs struct {
 	root string
+
+	// syncOnClose causes writable files to be fsynced when closed
+	syncOnClose bool
+
+	// dirSync causes parent directories to be fsynced after their
+	// entries change
+	dirSync bool
+
+	// permissions checks the owner permission bits of existing files
+	// before opening them, which the operating system skips for root
+	permissions bool
+
+	// overflow is the policy watchers start with, OverflowBlock unless
+	// WithOverflowPolicy or WithWatcherQueue say otherwise
+	overflow OverflowPolicy
+
+	// umask is applied to the permissions of new files and directories in
+	// place of the process umask once umaskSet is set
+	mu       sync.Mutex
+	umask    os.FileMode
+	umaskSet bool
+
+	// perms replace the permissions of new files and directories
+	perms defaultPerms
+
+	// sorted makes directory listings sorted by name
+	sorted bool
 }
 
 // NewOsFs will return a new FileSystem that is backed by the operating
 // system functions in the 'os' package.  The osfs filesystem will be
 // rooted in the given path
-func NewOsFs(root string) FileSystem {
+func NewOsFs(root string, opts ...Option) FileSystem {
 	root, _ = filepath.Abs(root)
-	return &osfs{filepath.Clean(root)}
+	fs := &osfs{root: filepath.Clean(root), overflow: OverflowPolicy{Mode: OverflowBlock}}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
+}
+
+// syncDir fsyncs the directory containing filename when
+// the dirSync option is set
+func (ofs *osfs) syncDir(filename string) error {
+	if !ofs.dirSync {
+		return nil
+	}
+
+	dir, err := os.Open(filepath.Dir(ofs.path(filename)))
+	if err == nil {
+		err = dir.Sync()
+		if err1 := dir.Close(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// Umask returns the mask applied to the permissions of new files and
+// directories.  Until a mask has been set with WithUmask or SetUmask the
+// process umask applies and Umask returns zero
+func (ofs *osfs) Umask() os.FileMode {
+	mask, _ := ofs.mask()
+	return mask
+}
+
+// SetUmask sets the mask applied to the permissions of new files and
+// directories, replacing the process umask for this filesystem, and returns
+// the previous mask
+func (ofs *osfs) SetUmask(mask os.FileMode) os.FileMode {
+	ofs.mu.Lock()
+	defer ofs.mu.Unlock()
+	previous := ofs.umask
+	ofs.umask, ofs.umaskSet = mask&os.ModePerm, true
+	return previous
+}
+
+func (ofs *osfs) mask() (os.FileMode, bool) {
+	ofs.mu.Lock()
+	defer ofs.mu.Unlock()
+	return ofs.umask, ofs.umaskSet
 }
 
 // Chmod changes the mode of the named file to mode.
 func (ofs *osfs) Chmod(filename string, mode os.FileMode) error {
-	return os.Chmod(ofs.path(filename), mode)
+	return fixErr(os.Chmod(ofs.path(filename), mode))
+}
+
+// osFile wraps an *os.File so that Name reports the name as it was
+// given to the FileSystem rather than the underlying operating system path.
+// Like memfs files, every operation other than Name fails with ErrClosed
+// once the file has been closed
+type osFile struct {
+	*os.File
+	name string
+	sync bool
+}
+
+// Name returns the name of the file as presented to Open
+func (f *osFile) Name() string { return f.name }
+
+func (f *osFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	return n, fixErr(err)
+}
+
+func (f *osFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	return n, fixErr(err)
+}
+
+func (f *osFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	return n, fixErr(err)
+}
+
+func (f *osFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	return n, fixErr(err)
+}
+
+func (f *osFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.File.Seek(offset, whence)
+	return n, fixErr(err)
+}
+
+func (f *osFile) Truncate(size int64) error {
+	return fixErr(f.File.Truncate(size))
+}
+
+func (f *osFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	return wrapInfo(info), fixErr(err)
+}
+
+func (f *osFile) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(n)
+	for i, info := range infos {
+		infos[i] = wrapInfo(info)
+	}
+	return infos, f.readdirErr(err)
+}
+
+func (f *osFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.File.Readdirnames(n)
+	return names, f.readdirErr(err)
+}
+
+// readdirErr fixes an error from reading the directory.  The os package
+// reports reading a closed directory as a use of a closed file rather than
+// with os.ErrClosed, so a closed descriptor is checked for explicitly
+func (f *osFile) readdirErr(err error) error {
+	if err != nil && f.File.Fd() == ^uintptr(0) {
+		return &PathError{Op: "readdirent", Path: f.File.Name(), Cause: ErrClosed}
+	}
+	return fixErr(err)
+}
+
+// Close closes the file.  If the filesystem was created with WithSyncOnClose
+// and the file was opened for writing, the file is fsynced before it is closed
+func (f *osFile) Close() error {
+	var err error
+	if f.sync {
+		err = f.File.Sync()
+	}
+
+	if err1 := f.File.Close(); err == nil {
+		err = err1
+	}
+	return fixErr(err)
 }
 
 // Create creates the named file with mode 0666 (before umask), truncating it if it already exists.  If
 // successful, an io.ReadWriteSeeker is returned
 func (ofs *osfs) Create(filename string) (File, error) {
-	return os.Create(ofs.path(filename))
+	return ofs.OpenFile(filename, RdWrFlag|CreateFlag|TruncFlag, 0666)
 }
 
 // Open opens the named file for reading.  If successful, an io.ReadSeeker is returned
 func (ofs *osfs) Open(filename string) (File, error) {
-	return os.Open(ofs.path(filename))
+	return ofs.OpenFile(filename, RdOnlyFlag, 0)
 }
 
 // OpenFile is the generalized open call; most users will use Open or Create instead.
 // It opens the named file with specified flag (O_RDONLY etc.) and perm (before umask),
 // if applicable. If successful, an io.ReadWriteSeeker is returned.  If the OpenFlag was
 // set to O_RDONLY then the io.ReadWriteSeeker itself may not be writable.  This is
-// dependent on the implementation
+// dependent on the implementation.  AppendFlag is passed to the operating
+// system, which positions every Write at the end of the file.  Unlike memfs,
+// the os package refuses WriteAt on files opened with AppendFlag
 func (ofs *osfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
-	return os.OpenFile(ofs.path(filename), int(flag), perm)
+	var f *os.File
+	err := ofs.access(filename, flag)
+	perm, forced := ofs.perms.apply(perm &^ os.ModeType)
+	if mask, masked := ofs.mask(); err == nil && (masked || forced) && flag.has(CreateFlag) {
+		f, err = ofs.create(filename, flag, perm)
+		if err == nil && f != nil {
+			if err = f.Chmod(perm &^ mask); err != nil {
+				f.Close()
+			}
+		}
+	}
+
+	if f == nil && err == nil {
+		f, err = os.OpenFile(ofs.path(filename), int(flag), perm)
+	}
+
+	if err == nil && flag.has(CreateFlag) {
+		err = ofs.syncDir(filename)
+		if err != nil {
+			f.Close()
+		}
+	}
+
+	if err == nil {
+		file := &osFile{File: f, name: filename, sync: ofs.syncOnClose && flag.accessMode() != RdOnlyFlag}
+		if ofs.sorted {
+			if info, err := f.Stat(); err == nil && info.IsDir() {
+				return &sortedDir{File: file}, nil
+			}
+		}
+		return file, nil
+	}
+	return nil, fixErr(err)
+}
+
+// access checks that the owner permission bits of an existing file allow it
+// to be opened with flag when permissions are enforced
+func (ofs *osfs) access(filename string, flag OpenFlag) error {
+	if !ofs.permissions || (flag.has(CreateFlag) && flag.has(ExclFlag)) {
+		return nil
+	}
+
+	info, err := os.Stat(ofs.path(filename))
+	if err != nil || info.IsDir() {
+		// leave missing files and directories to os.OpenFile
+		return nil
+	}
+
+	if perm := openAccess(flag); info.Mode().Perm()&perm != perm {
+		return &os.PathError{Op: "open", Path: ofs.path(filename), Err: os.ErrPermission}
+	}
+	return nil
+}
+
+// create creates filename exclusively so that the caller knows its
+// permissions must be set.  A nil file and error are returned when the file
+// already exists and ExclFlag was not given
+func (ofs *osfs) create(filename string, flag OpenFlag, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(ofs.path(filename), int(flag|ExclFlag), perm)
+	if os.IsExist(err) && !flag.has(ExclFlag) {
+		return nil, nil
+	}
+	return f, err
 }
 
 func (ofs *osfs) path(filename string) string {
@@ -73,13 +296,27 @@ func (ofs *osfs) path(filename string) string {
 // Mkdir creates a new directory with the specified name and permission bits
 // (before umask). If there is an error, it will be of type *PathError.
 func (ofs *osfs) Mkdir(name string, perm os.FileMode) error {
-	return os.Mkdir(ofs.path(name), perm)
+	mode, forced := ofs.perms.apply(os.ModeDir | perm)
+	perm = mode &^ os.ModeDir
+	err := os.Mkdir(ofs.path(name), perm)
+	if mask, masked := ofs.mask(); err == nil && (masked || forced) {
+		err = os.Chmod(ofs.path(name), perm&^mask)
+	}
+
+	if err == nil {
+		err = ofs.syncDir(name)
+	}
+	return fixErr(err)
 }
 
 // Remove removes the named file or (empty) directory. If there is an error,
 // it will be of type *PathError.
 func (ofs *osfs) Remove(name string) error {
-	return os.Remove(ofs.path(name))
+	err := os.Remove(ofs.path(name))
+	if err == nil {
+		err = ofs.syncDir(name)
+	}
+	return fixErr(err)
 }
 
 // Rename renames (moves) oldpath to newpath.
@@ -87,7 +324,14 @@ func (ofs *osfs) Remove(name string) error {
 // OS-specific restrictions may apply when oldpath and newpath are in different directories.
 // If there is an error, it will be of type *LinkError.
 func (ofs *osfs) Rename(oldpath, newpath string) error {
-	return os.Rename(ofs.path(oldpath), ofs.path(newpath))
+	err := os.Rename(ofs.path(oldpath), ofs.path(newpath))
+	if err == nil {
+		err = ofs.syncDir(newpath)
+		if err == nil && filepath.Dir(ofs.path(oldpath)) != filepath.Dir(ofs.path(newpath)) {
+			err = ofs.syncDir(oldpath)
+		}
+	}
+	return fixErr(err)
 }
 
 // Lstat returns a FileInfo describing the named file. If the file is a
@@ -95,25 +339,88 @@ func (ofs *osfs) Rename(oldpath, newpath string) error {
 // Lstat makes no attempt to follow the link. If there is an error, it
 // will be of type *PathError.
 func (ofs *osfs) Lstat(filename string) (os.FileInfo, error) {
-	return os.Lstat(ofs.path(filename))
+	info, err := os.Lstat(ofs.path(filename))
+	return wrapInfo(info), fixErr(err)
 }
 
 // Stat returns the FileInfo structure describing file.
 func (ofs *osfs) Stat(filename string) (os.FileInfo, error) {
-	return os.Stat(ofs.path(filename))
+	info, err := os.Stat(ofs.path(filename))
+	return wrapInfo(info), fixErr(err)
+}
+
+// CloneFile copies the regular file src to dst, replacing dst if it exists.
+// Where the operating system supports reflinks, as btrfs and xfs do on
+// Linux, the copy shares the data of src.  Otherwise the os package copies
+// the file, using copy_file_range(2) on Linux
+func (ofs *osfs) CloneFile(src, dst string) error {
+	in, err := os.Open(ofs.path(src))
+	if err != nil {
+		return fixErr(err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err == nil && info.IsDir() {
+		err = ErrIsDir
+	} else if dstInfo, _ := os.Stat(ofs.path(dst)); err == nil && dstInfo != nil && os.SameFile(info, dstInfo) {
+		return nil
+	}
+
+	var f File
+	if err == nil {
+		f, err = ofs.OpenFile(dst, WrOnlyFlag|CreateFlag|TruncFlag, info.Mode().Perm())
+	}
+
+	if err != nil {
+		return &LinkError{Op: "clone", Old: src, New: dst, Cause: unwrapCause(err)}
+	}
+
+	out := f.(*osFile)
+	if err = reflink(out.File, in); err != nil {
+		_, err = io.Copy(out.File, in)
+	}
+
+	if err1 := out.Close(); err == nil {
+		err = err1
+	}
+
+	if err != nil {
+		return &LinkError{Op: "clone", Old: src, New: dst, Cause: fixCause(err)}
+	}
+	return nil
 }
 
 func (ofs *osfs) Close() error { return nil }
 
+// osFileInfo adds the FileInfoEx methods to the FileInfos of the os package
+type osFileInfo struct {
+	os.FileInfo
+}
+
+// wrapInfo wraps a FileInfo returned by the os package, leaving nil alone
+func wrapInfo(info os.FileInfo) os.FileInfo {
+	if info == nil {
+		return nil
+	}
+	return &osFileInfo{info}
+}
+
 func (ofs *osfs) Watcher(events chan<- Event) (Watcher, error) {
 	fswatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
 	watcher := &osWatcher{
-		fs:      ofs,
-		watcher: fswatcher,
-		events:  events,
-		closer:  make(chan bool, 2),
+		eventSender: newEventSender(events),
+		fs:          ofs,
+		watcher:     fswatcher,
+		closer:      make(chan bool, 2),
+		recursive:   make(map[string]bool),
 	}
+	watcher.SetOverflowPolicy(ofs.overflow)
 	go watcher.eventLoop()
 	go watcher.errorLoop()
-	return watcher, err
+	return watcher, nil
 }
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package vfs
+
+import "os"
+
+// reflink is not supported on this platform, so CloneFile copies the data
+func reflink(dst, src *os.File) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+
+package vfs
+
+import "syscall"
+
+// Ino returns the inode number from stat(2)
+func (fi *osFileInfo) Ino() uint64 {
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
+
+// Nlink returns the number of hard links from stat(2)
+func (fi *osFileInfo) Nlink() uint64 {
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink)
+	}
+	return 1
+}
+
+// Blocks returns the number of 512 byte units allocated from stat(2)
+func (fi *osFileInfo) Blocks() int64 {
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int64(stat.Blocks)
+	}
+	return (fi.Size() + 511) / 512
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+
+package vfs
+
+// Ino returns zero since the inode number is not part of the FileInfo on
+// this platform
+func (fi *osFileInfo) Ino() uint64 { return 0 }
+
+// Nlink returns 1 since the number of links is not part of the FileInfo on
+// this platform
+func (fi *osFileInfo) Nlink() uint64 { return 1 }
+
+// Blocks estimates the number of 512 byte units allocated from the size
+func (fi *osFileInfo) Blocks() int64 { return (fi.Size() + 511) / 512 }
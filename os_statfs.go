@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd
+
+package vfs
+
+import "syscall"
+
+// Usage reports the usage of the filesystem holding the root directory as
+// returned by statfs(2).  Free space is the space available to unprivileged
+// users
+func (ofs *osfs) Usage() (Usage, error) {
+	stat := &syscall.Statfs_t{}
+	if err := syscall.Statfs(ofs.root, stat); err != nil {
+		return Usage{}, &PathError{Op: "statfs", Path: PathSeparator, Cause: fixCause(err)}
+	}
+
+	bsize := int64(stat.Bsize)
+	return Usage{
+		TotalBytes:  int64(stat.Blocks) * bsize,
+		UsedBytes:   (int64(stat.Blocks) - int64(stat.Bfree)) * bsize,
+		FreeBytes:   int64(stat.Bavail) * bsize,
+		TotalInodes: int64(stat.Files),
+		UsedInodes:  int64(stat.Files) - int64(stat.Ffree),
+		FreeInodes:  int64(stat.Ffree),
+		Sys:         stat,
+	}, nil
+}
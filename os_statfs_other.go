@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package vfs
+
+// Usage is not supported on this platform
+func (ofs *osfs) Usage() (Usage, error) {
+	return Usage{}, ErrNotSupported
+}
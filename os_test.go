@@ -1,6 +1,8 @@
 package vfs
 
 import (
+	"fmt"
+	"io"
 	"testing"
 )
 
@@ -16,7 +18,7 @@ func TestOsPath(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.input, func(t *testing.T) {
-			fs := &osfs{test.root}
+			fs := &osfs{root: test.root}
 			got := fs.path(test.input)
 			if test.want != got {
 				t.Errorf("Wanted %q got %q", test.want, got)
@@ -37,3 +39,215 @@ func TestOsWatcher(t *testing.T) {
 		t.Errorf("Unexpected error: %v", err)
 	}
 }
+
+func TestOsSyncOptions(t *testing.T) {
+	tfs := NewTempFs().(*tempfs)
+	defer tfs.Close()
+
+	fs := NewOsFs(tfs.tempdir, WithSyncOnClose(), WithDirSync()).(*osfs)
+	if !fs.syncOnClose || !fs.dirSync {
+		t.Fatalf("Expected options to be applied")
+	}
+
+	f, err := fs.Create("/foo.txt")
+	if err == nil {
+		if !f.(*osFile).sync {
+			t.Errorf("Expected writable file to sync on close")
+		}
+		f.Write([]byte("hello world"))
+		err = f.(io.Closer).Close()
+	}
+
+	if err == nil {
+		err = fs.Mkdir("/dir", 0755)
+	}
+
+	if err == nil {
+		err = fs.Rename("/foo.txt", "/dir/foo.txt")
+	}
+
+	if err == nil {
+		var f File
+		f, err = fs.Open("/dir/foo.txt")
+		if err == nil {
+			if f.(*osFile).sync {
+				t.Errorf("Expected read only file to not sync on close")
+			}
+			err = f.(io.Closer).Close()
+		}
+	}
+
+	if err == nil {
+		err = fs.Remove("/dir/foo.txt")
+	}
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestOsErrors(t *testing.T) {
+	tfs := NewTempFs()
+	defer tfs.Close()
+
+	for _, fs := range []FileSystem{tfs, NewMemFs()} {
+		WriteFile(fs, "/file", []byte("data"), 0644)
+		MkdirAll(fs, "/dir/sub", 0755)
+		MkdirAll(fs, "/full", 0755)
+		WriteFile(fs, "/full/file", []byte("data"), 0644)
+
+		tests := []struct {
+			name string
+			op   func() error
+			want error
+		}{
+			{"not exist", func() error { _, err := fs.Stat("/missing"); return err }, ErrNotExist},
+			{"exist", func() error { return fs.Mkdir("/dir", 0755) }, ErrExist},
+			{"not dir", func() error { _, err := fs.Stat("/file/child"); return err }, ErrNotDir},
+			{"is dir", func() error { _, err := fs.OpenFile("/dir", WrOnlyFlag, 0); return err }, ErrIsDir},
+			{"not empty", func() error { return fs.Remove("/full") }, ErrNotEmpty},
+			{"remove missing", func() error { return fs.Remove("/missing") }, ErrNotExist},
+		}
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%T %s", fs, test.name), func(t *testing.T) {
+				if err := test.op(); !IsError(test.want, err) {
+					t.Errorf("Wanted %v got %v", test.want, err)
+				}
+			})
+		}
+	}
+}
+
+func TestOsPermissions(t *testing.T) {
+	tfs := NewTempFs().(*tempfs)
+	defer tfs.Close()
+
+	for _, fs := range []FileSystem{NewOsFs(tfs.tempdir, WithPermissions()), NewMemFs(WithPermissions())} {
+		WriteFile(fs, "/readonly", []byte("data"), 0444)
+		WriteFile(fs, "/writeonly", []byte("data"), 0200)
+
+		tests := []struct {
+			name     string
+			filename string
+			flag     OpenFlag
+			want     error
+		}{
+			{"read readonly", "/readonly", RdOnlyFlag, nil},
+			{"write readonly", "/readonly", WrOnlyFlag, ErrPermission},
+			{"read write readonly", "/readonly", RdWrFlag, ErrPermission},
+			{"truncate readonly", "/readonly", RdOnlyFlag | TruncFlag, ErrPermission},
+			{"create readonly", "/readonly", WrOnlyFlag | CreateFlag, ErrPermission},
+			{"exclusive readonly", "/readonly", WrOnlyFlag | CreateFlag | ExclFlag, ErrExist},
+			{"write writeonly", "/writeonly", WrOnlyFlag, nil},
+			{"read writeonly", "/writeonly", RdOnlyFlag, ErrPermission},
+		}
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%T %s", fs, test.name), func(t *testing.T) {
+				f, err := fs.OpenFile(test.filename, test.flag, 0644)
+				if !IsError(test.want, err) {
+					t.Errorf("Wanted %v got %v", test.want, err)
+				} else if err == nil {
+					closeFile(f)
+				}
+			})
+		}
+	}
+}
+
+func TestFileInfoEx(t *testing.T) {
+	tfs := NewTempFs()
+	defer tfs.Close()
+
+	for _, fs := range []FileSystem{tfs, NewMemFs()} {
+		t.Run(fmt.Sprintf("%T", fs), func(t *testing.T) {
+			WriteFile(fs, "/file", make([]byte, 1500), 0644)
+			WriteFile(fs, "/other", nil, 0644)
+
+			infos := make(map[string]FileInfoEx)
+			for _, name := range []string{"/file", "/other"} {
+				info, err := fs.Stat(name)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				ex, ok := info.(FileInfoEx)
+				if !ok {
+					t.Fatalf("Wanted a FileInfoEx got %T", info)
+				}
+				infos[name] = ex
+			}
+
+			if infos["/file"].Ino() == infos["/other"].Ino() {
+				t.Errorf("Wanted different inode numbers got %d", infos["/file"].Ino())
+			}
+
+			if got := infos["/file"].Nlink(); got != 1 {
+				t.Errorf("Wanted 1 got %d", got)
+			}
+
+			if got := infos["/file"].Blocks(); got < 3 {
+				t.Errorf("Wanted at least 3 blocks got %d", got)
+			}
+
+			f, err := fs.Open("/file")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer closeFile(f)
+
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else if ex, ok := info.(FileInfoEx); !ok || ex.Ino() != infos["/file"].Ino() {
+				t.Errorf("Wanted the inode of /file got %v", info)
+			}
+
+			if !SameFile(info, infos["/file"]) || SameFile(info, infos["/other"]) {
+				t.Errorf("Wanted SameFile to compare the files")
+			}
+		})
+	}
+}
+
+func TestClosedFile(t *testing.T) {
+	tfs := NewTempFs()
+	defer tfs.Close()
+
+	for _, fs := range []FileSystem{tfs, NewMemFs()} {
+		WriteFile(fs, "/file", []byte("data"), 0644)
+		fs.Mkdir("/dir", 0755)
+
+		f, _ := fs.OpenFile("/file", RdWrFlag, 0)
+		dir, _ := fs.Open("/dir")
+		for _, file := range []File{f, dir} {
+			if err := file.(io.Closer).Close(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		tests := []struct {
+			name string
+			op   func() error
+		}{
+			{"read", func() error { _, err := f.Read(make([]byte, 1)); return err }},
+			{"read at", func() error { _, err := f.ReadAt(make([]byte, 1), 0); return err }},
+			{"write", func() error { _, err := f.Write([]byte("x")); return err }},
+			{"write at", func() error { _, err := f.WriteAt([]byte("x"), 0); return err }},
+			{"seek", func() error { _, err := f.Seek(0, io.SeekStart); return err }},
+			{"close", func() error { return f.(io.Closer).Close() }},
+			{"readdir", func() error { _, err := dir.Readdir(-1); return err }},
+			{"readdirnames", func() error { _, err := dir.Readdirnames(-1); return err }},
+			{"close dir", func() error { return dir.(io.Closer).Close() }},
+		}
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%T %s", fs, test.name), func(t *testing.T) {
+				if err := test.op(); !IsError(ErrClosed, err) {
+					t.Errorf("Wanted %v got %v", ErrClosed, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package otelfs traces the operations of a vfs.FileSystem with
+// OpenTelemetry so that filesystem latency shows up in the distributed
+// traces of services using remote or caching backends.
+package otelfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mh-orange/vfs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by this package
+const instrumentationName = "github.com/mh-orange/vfs/otelfs"
+
+// Option configures a FileSystem returned by New
+type Option func(*FileSystem)
+
+// WithTracerProvider sets the provider of the tracer used to create spans,
+// it defaults to the global provider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(fs *FileSystem) {
+		fs.tracer = provider.Tracer(instrumentationName)
+	}
+}
+
+// WithBackend sets the vfs.backend attribute of every span, which defaults
+// to the type of the traced FileSystem
+func WithBackend(name string) Option {
+	return func(fs *FileSystem) {
+		fs.backend = attribute.String("vfs.backend", name)
+	}
+}
+
+// FileSystem is a vfs.FileSystem that starts a span for every operation on
+// the traced FileSystem and on the files it opens.  Spans are named after
+// the operation, such as "vfs.open", and carry the vfs.path, vfs.new_path,
+// vfs.backend and vfs.bytes attributes where they apply.  Failed operations
+// record their error, reaching the end of a file is not a failure.
+//
+// vfs.FileSystem methods take no context so the spans of FileSystem itself
+// are roots.  WithContext returns a view whose spans, and those of the files
+// it opens, are children of the span in a context
+type FileSystem struct {
+	vfs.FileSystem
+	traced  vfs.FileSystem
+	tracer  trace.Tracer
+	backend attribute.KeyValue
+}
+
+// New returns a FileSystem tracing the operations on fs
+func New(fs vfs.FileSystem, opts ...Option) *FileSystem {
+	tfs := &FileSystem{
+		traced:  fs,
+		tracer:  otel.GetTracerProvider().Tracer(instrumentationName),
+		backend: attribute.String("vfs.backend", fmt.Sprintf("%T", fs)),
+	}
+
+	for _, opt := range opts {
+		opt(tfs)
+	}
+	tfs.FileSystem = tfs.WithContext(context.Background())
+	return tfs
+}
+
+// WithContext returns a FileSystem whose operations are traced as children
+// of the span in ctx
+func (tfs *FileSystem) WithContext(ctx context.Context) vfs.FileSystem {
+	return vfs.Observe(tfs.traced, &tracer{ctx: ctx, fs: tfs})
+}
+
+// Unwrap returns the traced FileSystem
+func (tfs *FileSystem) Unwrap() []vfs.FileSystem {
+	return []vfs.FileSystem{tfs.traced}
+}
+
+// tracer starts the spans of a FileSystem view
+type tracer struct {
+	ctx context.Context
+	fs  *FileSystem
+}
+
+func (t *tracer) Begin(op vfs.Op) func(n int, err error) {
+	attrs := []attribute.KeyValue{t.fs.backend, attribute.String("vfs.path", op.Path)}
+	if op.NewPath != "" {
+		attrs = append(attrs, attribute.String("vfs.new_path", op.NewPath))
+	}
+
+	_, span := t.fs.tracer.Start(t.ctx, "vfs."+op.Name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return func(n int, err error) {
+		if n > 0 && (op.Name == "read" || op.Name == "write") {
+			span.SetAttributes(attribute.Int("vfs.bytes", n))
+		}
+
+		if err != nil && err != io.EOF {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,67 @@
+package otelfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFileSystem(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	fs := New(vfs.NewMemFs(), WithTracerProvider(provider), WithBackend("memfs"))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	vfs.WriteFile(fs.WithContext(ctx), "/file.txt", []byte("hello"), 0644)
+	parent.End()
+	fs.Stat("/missing")
+
+	spans := recorder.Ended()
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+
+	want := []string{"vfs.openfile", "vfs.write", "vfs.close", "request", "vfs.stat"}
+	if !reflect.DeepEqual(want, names) {
+		t.Fatalf("Wanted spans %v got %v", want, names)
+	}
+
+	for _, span := range spans[:3] {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s: wanted parent %v got %v", span.Name(), parent.SpanContext().SpanID(), span.Parent().SpanID())
+		}
+
+		attrs := attribute.NewSet(span.Attributes()...)
+		if v, _ := attrs.Value("vfs.path"); v.AsString() != "/file.txt" {
+			t.Errorf("%s: wanted path /file.txt got %q", span.Name(), v.AsString())
+		}
+
+		if v, _ := attrs.Value("vfs.backend"); v.AsString() != "memfs" {
+			t.Errorf("%s: wanted backend memfs got %q", span.Name(), v.AsString())
+		}
+	}
+
+	if attrs := attribute.NewSet(spans[1].Attributes()...); attrs.HasValue("vfs.bytes") {
+		if v, _ := attrs.Value("vfs.bytes"); v.AsInt64() != 5 {
+			t.Errorf("Wanted 5 bytes written got %d", v.AsInt64())
+		}
+	} else {
+		t.Errorf("Wanted write to report vfs.bytes")
+	}
+
+	stat := spans[4]
+	if stat.Parent().IsValid() {
+		t.Errorf("Wanted stat without context to be a root span")
+	}
+
+	if stat.Status().Code != codes.Error || len(stat.Events()) != 1 {
+		t.Errorf("Wanted stat error to be recorded got %v %v", stat.Status(), stat.Events())
+	}
+}
@@ -0,0 +1,65 @@
+package vfs
+
+import (
+	"path"
+	"strings"
+)
+
+// Clean returns the shortest absolute path naming the same file as name, the
+// form every FileSystem in this package works with.  Relative names are
+// taken from the root
+func Clean(name string) string {
+	return path.Clean(PathSeparator + name)
+}
+
+// Split splits name into its parent directory and base name after cleaning
+// it.  Unlike path.Split a trailing separator does not leave the base name
+// empty, so "/dir/" splits into "/" and "dir".  The root splits into "/" and
+// an empty name
+func Split(name string) (dir, file string) {
+	name = Clean(name)
+	if name == PathSeparator {
+		return PathSeparator, ""
+	}
+	return path.Dir(name), path.Base(name)
+}
+
+// Rel returns the path of target relative to base, both being cleaned
+// first.  Targets outside of base are reached with ".." elements and "." is
+// returned when both name the same directory
+func Rel(base, target string) string {
+	baseParts, targetParts := splitPath(base), splitPath(target)
+	common := 0
+	for common < len(baseParts) && common < len(targetParts) && baseParts[common] == targetParts[common] {
+		common++
+	}
+
+	parts := make([]string, 0, len(baseParts)+len(targetParts)-2*common)
+	for range baseParts[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, targetParts[common:]...)
+
+	if len(parts) == 0 {
+		return "."
+	}
+	return strings.Join(parts, PathSeparator)
+}
+
+// Abs returns the cleaned absolute form of name.  Relative names are taken
+// from the working directory of FileSystems that implement Chdirer and from
+// the root otherwise
+func Abs(fs FileSystem, name string) (string, error) {
+	if path.IsAbs(name) {
+		return Clean(name), nil
+	}
+
+	if wd, ok := fs.(Chdirer); ok {
+		dir, err := wd.Getwd()
+		if err != nil {
+			return "", err
+		}
+		return Clean(path.Join(dir, name)), nil
+	}
+	return Clean(name), nil
+}
@@ -0,0 +1,98 @@
+package vfs
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"file", "/file"},
+		{"/dir/", "/dir"},
+		{"//dir/./sub/../file", "/dir/file"},
+		{"../../file", "/file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Clean(test.name); got != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantDir  string
+		wantFile string
+	}{
+		{"/", "/", ""},
+		{"", "/", ""},
+		{"/file", "/", "file"},
+		{"file", "/", "file"},
+		{"/dir/", "/", "dir"},
+		{"/dir/sub/file", "/dir/sub", "file"},
+		{"/dir//sub/", "/dir", "sub"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, file := Split(test.name)
+			if dir != test.wantDir || file != test.wantFile {
+				t.Errorf("Wanted %q %q got %q %q", test.wantDir, test.wantFile, dir, file)
+			}
+		})
+	}
+}
+
+func TestRel(t *testing.T) {
+	tests := []struct {
+		base   string
+		target string
+		want   string
+	}{
+		{"/", "/", "."},
+		{"/dir", "/dir/", "."},
+		{"/", "/dir/file", "dir/file"},
+		{"/dir", "/dir/sub/file", "sub/file"},
+		{"dir", "dir/file", "file"},
+		{"/dir/sub", "/dir/other", "../other"},
+		{"/dir/sub", "/", "../.."},
+		{"/a", "/ab", "../ab"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.base+" "+test.target, func(t *testing.T) {
+			if got := Rel(test.base, test.target); got != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestAbs(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"/dir/file", "/dir/file"},
+		{"file", "/file"},
+		{"dir/../file/", "/file"},
+	}
+
+	fs := NewMemFs()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Abs(fs, test.name)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if got != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the interval a PollingWatcher uses when none is
+// configured
+const DefaultPollInterval = time.Second
+
+// PollConfig configures a PollingWatcher
+type PollConfig struct {
+	// Interval is the time between scans of the watched paths, it
+	// defaults to DefaultPollInterval
+	Interval time.Duration
+
+	// Hash compares the contents of regular files as well as their
+	// modification time and size.  This catches changes that keep both
+	// the same, at the cost of reading every watched file on every scan
+	Hash bool
+
+	// Clock schedules the scans, it defaults to SystemClock
+	Clock Clock
+}
+
+// pollState is what a PollingWatcher remembers about a path between scans
+type pollState struct {
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+	sum     []byte
+}
+
+// PollingWatcher is a Watcher for FileSystems that cannot report changes
+// themselves.  It periodically scans the watched paths and compares what it
+// finds to the previous scan.  Like the memfs watcher, watching a directory
+// reports changes to the directory and its immediate children.  Changes that
+// are undone between two scans go unnoticed and renames are reported as a
+// remove and a create
+type PollingWatcher struct {
+	fs     FileSystem
+	config PollConfig
+	events chan<- Event
+	done   chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	timer  Timer
+	paths  map[string]map[string]pollState
+	closed bool
+}
+
+// NewPollingWatcher returns a PollingWatcher scanning fs and sending events
+// to the events channel, which is closed when the watcher is closed
+func NewPollingWatcher(fs FileSystem, events chan<- Event, config PollConfig) *PollingWatcher {
+	if config.Interval <= 0 {
+		config.Interval = DefaultPollInterval
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	pw := &PollingWatcher{
+		fs:     fs,
+		config: config,
+		events: events,
+		done:   make(chan struct{}),
+		paths:  make(map[string]map[string]pollState),
+	}
+	pw.timer = config.Clock.AfterFunc(config.Interval, pw.tick)
+	return pw
+}
+
+func (pw *PollingWatcher) tick() {
+	pw.Poll()
+	pw.mu.Lock()
+	if !pw.closed {
+		pw.timer.Reset(pw.config.Interval)
+	}
+	pw.mu.Unlock()
+}
+
+// state returns the current state of the named file
+func (pw *PollingWatcher) state(name string, info os.FileInfo) (state pollState, err error) {
+	state = pollState{mode: info.Mode(), size: info.Size(), modTime: info.ModTime()}
+	if pw.config.Hash && info.Mode().IsRegular() {
+		state.sum, err = HashFile(pw.fs, name, nil)
+	}
+	return state, err
+}
+
+// scan returns the state of the named path and, if it is a directory, its
+// children
+func (pw *PollingWatcher) scan(name string) (map[string]pollState, error) {
+	info, err := pw.fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]pollState)
+	if states[name], err = pw.state(name, info); err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		infos, err := readDir(pw.fs, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			child := path.Join(name, info.Name())
+			if states[child], err = pw.state(child, info); IsNotExist(err) {
+				// removed since the directory was read
+				delete(states, child)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return states, nil
+}
+
+// Watch starts watching the named file or directory
+func (pw *PollingWatcher) Watch(name string) error {
+	name = Clean(name)
+	states, err := pw.scan(name)
+	if err != nil {
+		return err
+	}
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if _, found := pw.paths[name]; !found {
+		pw.paths[name] = states
+	}
+	return nil
+}
+
+// Remove stops watching the named path
+func (pw *PollingWatcher) Remove(name string) error {
+	name = Clean(name)
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if _, found := pw.paths[name]; !found {
+		return &PathError{Op: "remove", Path: name, Cause: ErrNotExist}
+	}
+	delete(pw.paths, name)
+	return nil
+}
+
+// Poll scans the watched paths immediately and sends events for any changes
+// found since the previous scan.  Poll blocks until every event has been
+// delivered or the watcher is closed
+func (pw *PollingWatcher) Poll() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	for name, previous := range pw.paths {
+		current, err := pw.scan(name)
+		if err != nil && !IsNotExist(err) {
+			pw.send(Event{Type: ErrorEvent, Path: name, Error: err})
+			continue
+		}
+
+		for child, prev := range previous {
+			cur, found := current[child]
+			if !found {
+				pw.send(Event{Type: RemoveEvent, Path: child})
+			} else if cur.modTime != prev.modTime || cur.size != prev.size || !bytes.Equal(cur.sum, prev.sum) {
+				pw.send(Event{Type: ModifyEvent, Path: child})
+			} else if cur.mode != prev.mode {
+				pw.send(Event{Type: AttributeEvent, Path: child})
+			}
+		}
+
+		for child := range current {
+			if _, found := previous[child]; !found {
+				pw.send(Event{Type: CreateEvent, Path: child})
+			}
+		}
+
+		if current == nil {
+			// keep watching in case the path is recreated
+			current = make(map[string]pollState)
+		}
+		pw.paths[name] = current
+	}
+}
+
+// send delivers the event unless the watcher is closed first
+func (pw *PollingWatcher) send(event Event) {
+	select {
+	case pw.events <- event:
+	case <-pw.done:
+	}
+}
+
+// Close stops the scans and closes the events channel
+func (pw *PollingWatcher) Close() error {
+	pw.once.Do(func() {
+		close(pw.done)
+		pw.mu.Lock()
+		pw.closed = true
+		pw.timer.Stop()
+		pw.paths = nil
+		close(pw.events)
+		pw.mu.Unlock()
+	})
+	return nil
+}
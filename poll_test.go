@@ -0,0 +1,70 @@
+package vfs
+
+import (
+	"testing"
+)
+
+func TestPollingWatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(fs FileSystem) error
+		want   Event
+	}{
+		{"create", func(fs FileSystem) error { return WriteFile(fs, "/dir/new", nil, 0644) }, Event{Type: CreateEvent, Path: "/dir/new"}},
+		{"modify", func(fs FileSystem) error { return WriteFile(fs, "/dir/file", []byte("longer"), 0644) }, Event{Type: ModifyEvent, Path: "/dir/file"}},
+		{"chmod", func(fs FileSystem) error { return fs.Chmod("/dir/file", 0600) }, Event{Type: AttributeEvent, Path: "/dir/file"}},
+		{"remove", func(fs FileSystem) error { return fs.Remove("/dir/file") }, Event{Type: RemoveEvent, Path: "/dir/file"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFs()
+			fs.Mkdir("/dir", 0755)
+			WriteFile(fs, "/dir/file", []byte("file"), 0644)
+
+			clock := &testClock{}
+			events := make(chan Event, 10)
+			watcher := NewPollingWatcher(fs, events, PollConfig{Clock: clock, Hash: true})
+			if err := watcher.Watch("/dir"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			clock.fire()
+			if len(events) != 0 {
+				t.Fatalf("Wanted no events got %v", <-events)
+			}
+
+			if err := test.change(fs); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			clock.fire()
+			watcher.Close()
+
+			var got []Event
+			for event := range events {
+				if event.Path != "/dir" {
+					got = append(got, event)
+				}
+			}
+
+			if len(got) != 1 || got[0] != test.want {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPollingWatcherErrors(t *testing.T) {
+	fs := NewMemFs()
+	events := make(chan Event)
+	watcher := NewPollingWatcher(fs, events, PollConfig{Clock: &testClock{}})
+	defer watcher.Close()
+
+	if err := watcher.Watch("/missing"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+
+	if err := watcher.Remove("/missing"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
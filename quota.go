@@ -0,0 +1,301 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// Quota limits what may be stored in a FileSystem returned by NewQuotaFs.
+// Zero means no limit
+type Quota struct {
+	// MaxBytes limits the total size of the regular files
+	MaxBytes int64
+
+	// MaxFiles limits the number of files, directories and symbolic links,
+	// not counting the root directory
+	MaxFiles int64
+
+	// MaxFileSize limits the size of each regular file
+	MaxFileSize int64
+}
+
+// quotafs enforces a Quota over the FileSystem it wraps
+type quotafs struct {
+	FileSystem
+	quota Quota
+
+	// mu serializes the operations that change usage so that checking
+	// the quota and using the space happen together
+	mu    sync.Mutex
+	bytes int64
+	files int64
+}
+
+// NewQuotaFs returns a FileSystem that stores at most quota in fs.  The
+// space already used is found by walking fs when NewQuotaFs is called and
+// from then on creates, removes, renames, truncates and writes through the
+// returned FileSystem are tracked.  Creating more entries than allowed fails
+// with ErrNoSpace, as do writes that would grow files beyond the limit, in
+// which case as much as fits is written.  Writes and truncates that would
+// make a file larger than MaxFileSize fail with ErrFileTooLarge in the same
+// way.  Changes made to fs other than through the returned FileSystem are
+// not noticed
+func NewQuotaFs(fs FileSystem, quota Quota) (FileSystem, error) {
+	qfs := &quotafs{FileSystem: fs, quota: quota}
+	err := Walk(fs, PathSeparator, func(name string, info os.FileInfo, err error) error {
+		if err != nil || name == PathSeparator {
+			return err
+		}
+
+		qfs.files++
+		if info.Mode().IsRegular() {
+			qfs.bytes += info.Size()
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return qfs, nil
+}
+
+// Usage reports the space and entries used against the quota
+func (qfs *quotafs) Usage() (Usage, error) {
+	qfs.mu.Lock()
+	defer qfs.mu.Unlock()
+	usage := Usage{UsedBytes: qfs.bytes, UsedInodes: qfs.files}
+	if qfs.quota.MaxBytes > 0 {
+		usage.TotalBytes, usage.FreeBytes = qfs.quota.MaxBytes, qfs.quota.MaxBytes-qfs.bytes
+	}
+
+	if qfs.quota.MaxFiles > 0 {
+		usage.TotalInodes, usage.FreeInodes = qfs.quota.MaxFiles, qfs.quota.MaxFiles-qfs.files
+	}
+	return usage, nil
+}
+
+// reserveFile checks that one more entry may be created
+func (qfs *quotafs) reserveFile(op, name string) error {
+	if qfs.quota.MaxFiles > 0 && qfs.files >= qfs.quota.MaxFiles {
+		return &PathError{Op: op, Path: name, Cause: ErrNoSpace}
+	}
+	return nil
+}
+
+// entryBytes returns the bytes counted for an entry.  It is taken before the
+// entry changes since some FileSystems return a live view of the file
+func entryBytes(info os.FileInfo) int64 {
+	if info.Mode().IsRegular() {
+		return info.Size()
+	}
+	return 0
+}
+
+// fit shortens p so that writing it at off in a file of the given size stays
+// within the quota and returns why it had to be shortened, if it was
+func (qfs *quotafs) fit(p []byte, off, size int64) ([]byte, error) {
+	var cause error
+	if max := qfs.quota.MaxFileSize; max > 0 && off+int64(len(p)) > max {
+		keep := max - off
+		if keep < 0 {
+			keep = 0
+		}
+		p, cause = p[:keep], ErrFileTooLarge
+	}
+
+	growth := off + int64(len(p)) - size
+	if qfs.quota.MaxBytes > 0 && growth > qfs.quota.MaxBytes-qfs.bytes {
+		keep := int64(len(p)) - (growth - (qfs.quota.MaxBytes - qfs.bytes))
+		if keep < 0 {
+			keep = 0
+		}
+		p, cause = p[:keep], ErrNoSpace
+	}
+	return p, cause
+}
+
+func (qfs *quotafs) Create(filename string) (File, error) {
+	return qfs.OpenFile(filename, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (qfs *quotafs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if !flag.has(CreateFlag) && !flag.has(TruncFlag) && flag.accessMode() == RdOnlyFlag {
+		return qfs.FileSystem.OpenFile(filename, flag, perm)
+	}
+
+	qfs.mu.Lock()
+	defer qfs.mu.Unlock()
+	info, err := qfs.FileSystem.Stat(filename)
+	exists, size := err == nil, int64(0)
+	if exists {
+		size = entryBytes(info)
+	} else if flag.has(CreateFlag) {
+		if err = qfs.reserveFile("open", filename); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := qfs.FileSystem.OpenFile(filename, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		qfs.files++
+	} else if flag.has(TruncFlag) && flag.accessMode() != RdOnlyFlag {
+		qfs.bytes -= size
+	}
+	return &quotaFile{File: f, fs: qfs, append: flag.has(AppendFlag)}, nil
+}
+
+func (qfs *quotafs) Mkdir(name string, perm os.FileMode) error {
+	qfs.mu.Lock()
+	defer qfs.mu.Unlock()
+	if err := qfs.reserveFile("mkdir", name); err != nil {
+		return err
+	}
+
+	err := qfs.FileSystem.Mkdir(name, perm)
+	if err == nil {
+		qfs.files++
+	}
+	return err
+}
+
+func (qfs *quotafs) Remove(name string) error {
+	qfs.mu.Lock()
+	defer qfs.mu.Unlock()
+	info, err := qfs.FileSystem.Lstat(name)
+	if err == nil {
+		size := entryBytes(info)
+		if err = qfs.FileSystem.Remove(name); err == nil {
+			qfs.files--
+			qfs.bytes -= size
+		}
+	}
+	return err
+}
+
+func (qfs *quotafs) Rename(oldpath, newpath string) error {
+	qfs.mu.Lock()
+	defer qfs.mu.Unlock()
+	src, err := qfs.FileSystem.Lstat(oldpath)
+	if err != nil {
+		return err
+	}
+
+	displaced, err := qfs.FileSystem.Lstat(newpath)
+	replaced := err == nil && Clean(oldpath) != Clean(newpath) && !SameFile(src, displaced)
+	size := int64(0)
+	if replaced {
+		size = entryBytes(displaced)
+	}
+
+	if err = qfs.FileSystem.Rename(oldpath, newpath); err == nil && replaced {
+		qfs.files--
+		qfs.bytes -= size
+	}
+	return err
+}
+
+// Unwrap returns the FileSystem the quota is enforced on
+func (qfs *quotafs) Unwrap() []FileSystem {
+	return []FileSystem{qfs.FileSystem}
+}
+
+// quotaFile counts the data written to a file opened through a quotafs
+type quotaFile struct {
+	File
+	fs     *quotafs
+	append bool
+}
+
+// size returns the current size of the file without moving its offset
+func (f *quotaFile) size() (offset, size int64, err error) {
+	if offset, err = f.File.Seek(0, io.SeekCurrent); err == nil {
+		if size, err = f.File.Seek(0, io.SeekEnd); err == nil {
+			_, err = f.File.Seek(offset, io.SeekStart)
+		}
+	}
+	return offset, size, err
+}
+
+// write writes p at off, or at the offset of the file unless at is set, as
+// far as the quota allows
+func (f *quotaFile) write(p []byte, off int64, at bool) (n int, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	offset, size, err := f.size()
+	if err != nil {
+		return 0, err
+	}
+
+	if !at {
+		off = offset
+		if f.append {
+			off = size
+		}
+	}
+
+	p, cause := f.fs.fit(p, off, size)
+	if len(p) > 0 || cause == nil {
+		if at {
+			n, err = f.File.WriteAt(p, off)
+		} else {
+			n, err = f.File.Write(p)
+		}
+	}
+
+	if end := off + int64(n); end > size {
+		f.fs.bytes += end - size
+	}
+
+	if err == nil && cause != nil {
+		err = &PathError{Op: "write", Path: f.Name(), Cause: cause}
+	}
+	return n, err
+}
+
+func (f *quotaFile) Write(p []byte) (int, error) {
+	return f.write(p, 0, false)
+}
+
+func (f *quotaFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.write(p, off, true)
+}
+
+// Truncate changes the size of the file if the underlying file supports it
+// and the quota allows it to grow
+func (f *quotaFile) Truncate(size int64) error {
+	truncater, ok := f.File.(interface{ Truncate(int64) error })
+	if !ok {
+		return &PathError{Op: "truncate", Path: f.Name(), Cause: ErrNotSupported}
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	_, current, err := f.size()
+	if err != nil {
+		return err
+	}
+
+	if _, cause := f.fs.fit(nil, size, current); cause != nil {
+		return &PathError{Op: "truncate", Path: f.Name(), Cause: cause}
+	}
+
+	err = truncater.Truncate(size)
+	if err == nil {
+		f.fs.bytes += size - current
+	}
+	return err
+}
+
+// Close closes the underlying file if it can be closed
+func (f *quotaFile) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package vfs
+
+import (
+	"io"
+	"testing"
+)
+
+func TestQuotaFs(t *testing.T) {
+	base := NewMemFs()
+	WriteFile(base, "/existing.txt", []byte("0123456789"), 0644)
+
+	fs, err := NewQuotaFs(base, Quota{MaxBytes: 20, MaxFiles: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	usage := func() (int64, int64) {
+		u, _ := StatFS(fs)
+		return u.UsedBytes, u.UsedInodes
+	}
+
+	tests := []struct {
+		name      string
+		op        func() error
+		wantErr   error
+		wantBytes int64
+		wantFiles int64
+	}{
+		{"initial", func() error { return nil }, nil, 10, 1},
+		{"write", func() error { return WriteFile(fs, "/new.txt", []byte("01234"), 0644) }, nil, 15, 2},
+		{"overwrite", func() error { return WriteFile(fs, "/new.txt", []byte("0123456789"), 0644) }, nil, 20, 2},
+		{"full", func() error {
+			f, err := fs.OpenFile("/new.txt", WrOnlyFlag|AppendFlag, 0)
+			if err == nil {
+				var n int
+				n, err = f.Write([]byte("x"))
+				if n != 0 {
+					t.Errorf("Wanted nothing written got %d bytes", n)
+				}
+				f.(io.Closer).Close()
+			}
+			return err
+		}, ErrNoSpace, 20, 2},
+		{"rewrite in place", func() error {
+			f, err := fs.OpenFile("/new.txt", WrOnlyFlag, 0)
+			if err == nil {
+				_, err = f.WriteAt([]byte("abc"), 2)
+				f.(io.Closer).Close()
+			}
+			return err
+		}, nil, 20, 2},
+		{"remove", func() error { return fs.Remove("/existing.txt") }, nil, 10, 1},
+		{"partial", func() error { return WriteFile(fs, "/big.txt", make([]byte, 15), 0644) }, ErrNoSpace, 20, 2},
+		{"mkdir", func() error { return fs.Mkdir("/dir", 0755) }, nil, 20, 3},
+		{"too many files", func() error { return fs.Mkdir("/dir2", 0755) }, ErrNoSpace, 20, 3},
+		{"too many creates", func() error { _, err := fs.Create("/dir/file"); return err }, ErrNoSpace, 20, 3},
+		{"rename over", func() error { return fs.Rename("/big.txt", "/new.txt") }, nil, 10, 2},
+		{"truncate", func() error { _, err := fs.Create("/new.txt"); return err }, nil, 0, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.op(); !IsError(test.wantErr, err) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if bytes, files := usage(); bytes != test.wantBytes || files != test.wantFiles {
+				t.Errorf("Wanted %d bytes and %d files got %d and %d", test.wantBytes, test.wantFiles, bytes, files)
+			}
+		})
+	}
+
+	if data, _ := ReadFile(base, "/new.txt"); len(data) != 0 {
+		t.Errorf("Wanted the truncated file to be empty got %q", data)
+	}
+}
+
+func TestQuotaFsMaxFileSize(t *testing.T) {
+	fs, _ := NewQuotaFs(NewOsFs(t.TempDir()), Quota{MaxFileSize: 10})
+
+	tests := []struct {
+		name     string
+		op       func(f File) (int, error)
+		wantN    int
+		wantErr  error
+		wantSize int64
+	}{
+		{"write", func(f File) (int, error) { return f.Write([]byte("0123456")) }, 7, nil, 7},
+		{"partial", func(f File) (int, error) { return f.Write([]byte("789abc")) }, 3, ErrFileTooLarge, 10},
+		{"past the end", func(f File) (int, error) { return f.WriteAt([]byte("x"), 10) }, 0, ErrFileTooLarge, 10},
+		{"in place", func(f File) (int, error) { return f.WriteAt([]byte("x"), 9) }, 1, nil, 10},
+		{"truncate", func(f File) (int, error) { return 0, f.(interface{ Truncate(int64) error }).Truncate(11) }, 0, ErrFileTooLarge, 10},
+	}
+
+	f, err := fs.Create("/file")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(f)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := test.op(f)
+			if !IsError(test.wantErr, err) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if n != test.wantN {
+				t.Errorf("Wanted %d bytes written got %d", test.wantN, n)
+			}
+
+			if info, _ := fs.Stat("/file"); info.Size() != test.wantSize {
+				t.Errorf("Wanted size %d got %d", test.wantSize, info.Size())
+			}
+		})
+	}
+}
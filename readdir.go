@@ -0,0 +1,117 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+)
+
+// ReadDirFileSystem is a FileSystem that can list a directory without
+// describing every entry in full
+type ReadDirFileSystem interface {
+	FileSystem
+
+	// ReadDir reads the named directory and returns its entries sorted by
+	// name
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// ReadDirFile is a File that can list the entries of a directory without
+// describing every entry in full.  ReadDir behaves like Readdir, returning
+// at most n entries from successive calls when n > 0 and every remaining
+// entry otherwise
+type ReadDirFile interface {
+	File
+	ReadDir(n int) ([]fs.DirEntry, error)
+}
+
+// ReadDir reads the named directory and returns its entries sorted by
+// name.  FileSystems that implement ReadDirFileSystem list the directory
+// themselves, otherwise the directory is opened and read with ReadDir when
+// the File implements ReadDirFile, as memfs and osfs directories do, or with
+// Readdir when it does not.  Only the Readdir fallback describes every entry
+// in full up front
+func ReadDir(fsys FileSystem, name string) (entries []fs.DirEntry, err error) {
+	if rfs, ok := fsys.(ReadDirFileSystem); ok {
+		return rfs.ReadDir(name)
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir, ok := f.(ReadDirFile); ok {
+		entries, err = dir.ReadDir(-1)
+	} else {
+		var infos []os.FileInfo
+		infos, err = f.Readdir(-1)
+		for _, info := range infos {
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+
+	if closer, ok := f.(io.Closer); ok {
+		closer.Close()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, err
+}
+
+// WalkDirFunc is the type of the function called for each file or directory
+// visited by WalkDir.  It is called the same way as a WalkFunc, except that
+// it is given a DirEntry rather than a FileInfo.  When a directory cannot be
+// read the function is called a second time for that directory with the
+// error, as filepath.WalkDir does
+type WalkDirFunc func(path string, d fs.DirEntry, err error) error
+
+// WalkDir walks the file tree rooted at root like Walk, calling walkFn for
+// each file or directory in the tree, including root.  Directories are
+// listed with ReadDir, so unlike Walk the entries are not described in full
+// unless walkFn asks for their Info.  WalkDir does not follow symbolic links
+func WalkDir(fsys FileSystem, root string, walkFn WalkDirFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = walkFn(root, nil, fixErr(err))
+	} else {
+		err = walkDir(fsys, root, fs.FileInfoToDirEntry(info), walkFn)
+	}
+
+	if err == ErrSkipDir {
+		return nil
+	}
+	return fixErr(err)
+}
+
+// walkDir recursively descends name, calling walkFn
+func walkDir(fsys FileSystem, name string, d fs.DirEntry, walkFn WalkDirFunc) error {
+	if err := walkFn(name, d, nil); err != nil || !d.IsDir() {
+		if err == ErrSkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := ReadDir(fsys, name)
+	if err != nil {
+		// report the error and let walkFn decide whether to go on
+		if err = walkFn(name, d, fixErr(err)); err != nil {
+			if err == ErrSkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if err := walkDir(fsys, path.Join(name, entry.Name()), entry, walkFn); err != nil {
+			if err == ErrSkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestReadDir(t *testing.T) {
+	tempfs := NewTempFs()
+	defer tempfs.Close()
+
+	sub, _ := Sub(NewMemFs(), "/")
+	tests := []struct {
+		name string
+		fs   FileSystem
+	}{
+		{"memfs", NewMemFs()},
+		{"osfs", tempfs},
+		{"readdir fallback", sub},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fs.Mkdir("/dir", 0755)
+			WriteFile(test.fs, "/b.txt", []byte("b"), 0644)
+			WriteFile(test.fs, "/a.txt", []byte("aa"), 0644)
+
+			entries, err := ReadDir(test.fs, "/")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+
+			if want := []string{"a.txt", "b.txt", "dir"}; !reflect.DeepEqual(want, names) {
+				t.Fatalf("Wanted %v got %v", want, names)
+			}
+
+			if !entries[2].IsDir() || entries[2].Type() != fs.ModeDir || entries[0].IsDir() {
+				t.Errorf("Wanted only dir to be a directory")
+			}
+
+			if info, err := entries[0].Info(); err != nil || info.Size() != 2 {
+				t.Errorf("Wanted a.txt to have 2 bytes got %v (%v)", info, err)
+			}
+
+			if _, err = ReadDir(test.fs, "/missing"); !IsNotExist(err) {
+				t.Errorf("Wanted not exist got %v", err)
+			}
+		})
+	}
+}
+
+func TestMemDirReadDir(t *testing.T) {
+	fs := NewMemFs()
+	for _, name := range []string{"/one", "/two", "/three"} {
+		WriteFile(fs, name, nil, 0644)
+	}
+
+	f, _ := fs.Open("/")
+	dir := f.(ReadDirFile)
+	var names []string
+	for {
+		entries, err := dir.ReadDir(2)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(entries) > 2 {
+			t.Fatalf("Wanted at most 2 entries got %d", len(entries))
+		}
+
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+	}
+
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(want, names) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	memfs := NewMemFs()
+	MkdirAll(memfs, "/a/b", 0755)
+	MkdirAll(memfs, "/skip/me", 0755)
+	WriteFile(memfs, "/a/b/file", nil, 0644)
+	WriteFile(memfs, "/a/file", nil, 0644)
+	WriteFile(memfs, "/skip/file", nil, 0644)
+	WriteFile(memfs, "/z", nil, 0644)
+
+	var got []string
+	err := WalkDir(memfs, "/", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		got = append(got, path)
+		if d.IsDir() && d.Name() == "skip" {
+			return ErrSkipDir
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"/", "/a", "/a/b", "/a/b/file", "/a/file", "/skip", "/z"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	err = WalkDir(memfs, "/missing", func(path string, d fs.DirEntry, err error) error {
+		if d != nil {
+			t.Errorf("Wanted no entry for %s", path)
+		}
+		return err
+	})
+
+	if !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
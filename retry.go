@@ -0,0 +1,129 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// IsTransient returns a boolean indicating whether the error is likely to
+// go away if the operation is retried, such as timeouts and lost connections
+func IsTransient(err error) bool {
+	err = errorCause(err)
+	return isDisconnect(err) || errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// RetryPolicy determines which operations NewRetryFs retries and how long
+// it waits between attempts
+type RetryPolicy struct {
+	Backoff
+
+	// Retryable reports whether a failed operation should be retried.
+	// When nil IsTransient is used
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy retries transient errors using DefaultBackoff
+var DefaultRetryPolicy = RetryPolicy{Backoff: DefaultBackoff}
+
+type retryfs struct {
+	FileSystem
+	policy RetryPolicy
+}
+
+// NewRetryFs returns a FileSystem that retries operations on base that fail
+// with a retryable error.  Only idempotent operations are retried, exclusive
+// creates and renames are attempted once since a failed response does not
+// mean the operation did not take effect.  Mkdir and Remove are retried, a
+// retry finding that the directory already exists, or that the file is
+// already gone, is taken to mean the failed attempt succeeded.  Once the
+// retries are exhausted the last error is returned.  Files returned by the
+// FileSystem are those of base, their operations are not retried
+func NewRetryFs(base FileSystem, policy RetryPolicy) FileSystem {
+	if policy.Retryable == nil {
+		policy.Retryable = IsTransient
+	}
+	return &retryfs{FileSystem: base, policy: policy}
+}
+
+func (rfs *retryfs) retry(fn func() error) (err error) {
+	for retry := 0; ; retry++ {
+		err = fn()
+		if err == nil || retry >= rfs.policy.Retries || !rfs.policy.Retryable(err) {
+			return err
+		}
+		time.Sleep(rfs.policy.Delay(retry))
+	}
+}
+
+func (rfs *retryfs) Chmod(filename string, mode os.FileMode) error {
+	return rfs.retry(func() error { return rfs.FileSystem.Chmod(filename, mode) })
+}
+
+func (rfs *retryfs) Create(filename string) (file File, err error) {
+	err = rfs.retry(func() (err error) { file, err = rfs.FileSystem.Create(filename); return err })
+	return file, err
+}
+
+func (rfs *retryfs) Open(filename string) (file File, err error) {
+	err = rfs.retry(func() (err error) { file, err = rfs.FileSystem.Open(filename); return err })
+	return file, err
+}
+
+func (rfs *retryfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (file File, err error) {
+	if flag.has(CreateFlag) && flag.has(ExclFlag) {
+		return rfs.FileSystem.OpenFile(filename, flag, perm)
+	}
+	err = rfs.retry(func() (err error) { file, err = rfs.FileSystem.OpenFile(filename, flag, perm); return err })
+	return file, err
+}
+
+// Mkdir creates the directory, a retry finding it already exists succeeds
+// since the attempt that failed may have created it
+func (rfs *retryfs) Mkdir(name string, perm os.FileMode) error {
+	retry := false
+	return rfs.retry(func() error {
+		err := rfs.FileSystem.Mkdir(name, perm)
+		if retry && IsExist(err) {
+			return nil
+		}
+		retry = true
+		return err
+	})
+}
+
+// Remove removes the file, a retry finding it is already gone succeeds since
+// the attempt that failed may have removed it
+func (rfs *retryfs) Remove(name string) error {
+	retry := false
+	return rfs.retry(func() error {
+		err := rfs.FileSystem.Remove(name)
+		if retry && IsNotExist(err) {
+			return nil
+		}
+		retry = true
+		return err
+	})
+}
+
+func (rfs *retryfs) Lstat(filename string) (fi os.FileInfo, err error) {
+	err = rfs.retry(func() (err error) { fi, err = rfs.FileSystem.Lstat(filename); return err })
+	return fi, err
+}
+
+func (rfs *retryfs) Stat(filename string) (fi os.FileInfo, err error) {
+	err = rfs.retry(func() (err error) { fi, err = rfs.FileSystem.Stat(filename); return err })
+	return fi, err
+}
+
+func (rfs *retryfs) Watcher(events chan<- Event) (watcher Watcher, err error) {
+	err = rfs.retry(func() (err error) { watcher, err = rfs.FileSystem.Watcher(events); return err })
+	return watcher, err
+}
+
+// Unwrap returns the wrapped FileSystem
+func (rfs *retryfs) Unwrap() []FileSystem {
+	return []FileSystem{rfs.FileSystem}
+}
@@ -0,0 +1,144 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// failFs fails every operation with err until fail reaches zero.  With
+// applied set, Mkdir and Remove take effect before failing
+type failFs struct {
+	FileSystem
+	err     error
+	fail    int
+	calls   int
+	applied bool
+}
+
+func (ff *failFs) failing() error {
+	ff.calls++
+	if ff.fail > 0 {
+		ff.fail--
+		return ff.err
+	}
+	return nil
+}
+
+func (ff *failFs) Stat(filename string) (os.FileInfo, error) {
+	if err := ff.failing(); err != nil {
+		return nil, err
+	}
+	return ff.FileSystem.Stat(filename)
+}
+
+func (ff *failFs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if err := ff.failing(); err != nil {
+		return nil, &PathError{Op: "open", Path: filename, Cause: err}
+	}
+	return ff.FileSystem.OpenFile(filename, flag, perm)
+}
+
+// run runs op before or after failing depending on applied
+func (ff *failFs) run(op func() error) error {
+	if !ff.applied {
+		if err := ff.failing(); err != nil {
+			return err
+		}
+		return op()
+	}
+
+	err := op()
+	if failed := ff.failing(); failed != nil {
+		return failed
+	}
+	return err
+}
+
+func (ff *failFs) Mkdir(name string, perm os.FileMode) error {
+	return ff.run(func() error { return ff.FileSystem.Mkdir(name, perm) })
+}
+
+func (ff *failFs) Remove(name string) error {
+	return ff.run(func() error { return ff.FileSystem.Remove(name) })
+}
+
+func TestRetryFs(t *testing.T) {
+	policy := RetryPolicy{Backoff: Backoff{Retries: 2}}
+	tests := []struct {
+		name      string
+		err       error
+		fail      int
+		op        func(FileSystem) error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", io.ErrUnexpectedEOF, 0, statRoot, 1, false},
+		{"transient", io.ErrUnexpectedEOF, 2, statRoot, 3, false},
+		{"exhausted", syscall.ECONNRESET, 3, statRoot, 3, true},
+		{"permanent", ErrNotExist, 1, statRoot, 1, true},
+		{"open retried", syscall.ETIMEDOUT, 1, openFile(CreateFlag | WrOnlyFlag), 2, false},
+		{"exclusive create", syscall.ETIMEDOUT, 1, openFile(CreateFlag | ExclFlag | WrOnlyFlag), 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ff := &failFs{FileSystem: NewMemFs(), err: test.err, fail: test.fail}
+			fs := NewRetryFs(ff, policy)
+			defer fs.Close()
+
+			err := test.op(fs)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if ff.calls != test.wantCalls {
+				t.Errorf("Wanted %d calls got %d", test.wantCalls, ff.calls)
+			}
+		})
+	}
+}
+
+func statRoot(fs FileSystem) error {
+	_, err := fs.Stat("/")
+	return err
+}
+
+func openFile(flag OpenFlag) func(FileSystem) error {
+	return func(fs FileSystem) error {
+		f, err := fs.OpenFile("/file", flag, 0644)
+		if err == nil {
+			f.(io.Closer).Close()
+		}
+		return err
+	}
+}
+
+func TestRetryFsApplied(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(FileSystem) error
+	}{
+		{"mkdir", func(fs FileSystem) error { return fs.Mkdir("/dir", 0755) }},
+		{"remove", func(fs FileSystem) error { return fs.Remove("/file") }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mem := NewMemFs()
+			WriteFile(mem, "/file", nil, 0644)
+
+			// the first attempt takes effect but reports a lost connection
+			ff := &failFs{FileSystem: mem, err: syscall.ECONNRESET, fail: 1, applied: true}
+			fs := NewRetryFs(ff, RetryPolicy{Backoff: Backoff{Retries: 2}})
+			if err := test.op(fs); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if ff.calls != 2 {
+				t.Errorf("Wanted %d calls got %d", 2, ff.calls)
+			}
+		})
+	}
+}
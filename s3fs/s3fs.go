@@ -0,0 +1,617 @@
+// Package s3fs provides a vfs.FileSystem backed by an Amazon S3 bucket.
+// Directories are emulated with key prefixes so code written against memfs
+// or osfs can be run against S3 unchanged.
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/mh-orange/vfs"
+)
+
+// Client is the subset of *s3.Client used by the FileSystem
+type Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// s3fs is a vfs.FileSystem storing files as objects beneath prefix in bucket
+type s3fs struct {
+	client Client
+	bucket string
+	prefix string
+}
+
+// New returns a FileSystem rooted at prefix in bucket.  Files are objects
+// keyed by their path below prefix and directories are key prefixes, with
+// Mkdir storing an empty "dir/" marker object so that empty directories
+// exist.  File contents are read with ranged requests while files opened for
+// writing are buffered in memory and uploaded when they are closed.  S3 has no
+// permissions or change notifications so Chmod and Watcher return
+// vfs.ErrNotSupported
+func New(client Client, bucket, prefix string) vfs.FileSystem {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3fs{client: client, bucket: bucket, prefix: prefix}
+}
+
+// key returns the object key for a vfs path, the root is the empty key
+func (fs *s3fs) key(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return strings.TrimSuffix(fs.prefix, "/")
+	}
+	return fs.prefix + name
+}
+
+// dirKey returns the key prefix shared by every object in a directory
+func (fs *s3fs) dirKey(name string) string {
+	if key := fs.key(name); key != "" {
+		return key + "/"
+	}
+	return ""
+}
+
+// isNotFound reports whether err is S3's way of saying an object does
+// not exist
+func isNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	var apiErr smithy.APIError
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return true
+	}
+	return errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchKey")
+}
+
+// isPreconditionFailed reports whether a conditional request was rejected
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed"
+}
+
+func pathError(op, name string, err error) error {
+	if isNotFound(err) {
+		err = vfs.ErrNotExist
+	} else if isPreconditionFailed(err) {
+		err = vfs.ErrExist
+	}
+	return &vfs.PathError{Op: op, Path: name, Cause: err}
+}
+
+// linkError is pathError for operations involving two paths
+func linkError(op, oldname, newname string, err error) error {
+	pe := pathError(op, oldname, err).(*vfs.PathError)
+	return &vfs.LinkError{Op: op, Old: oldname, New: newname, Cause: pe.Cause}
+}
+
+func (fs *s3fs) Chmod(filename string, mode os.FileMode) error {
+	return &vfs.PathError{Op: "chmod", Path: filename, Cause: vfs.ErrNotSupported}
+}
+
+func (fs *s3fs) Create(filename string) (vfs.File, error) {
+	return fs.OpenFile(filename, vfs.RdWrFlag|vfs.CreateFlag|vfs.TruncFlag, 0666)
+}
+
+func (fs *s3fs) Open(filename string) (vfs.File, error) {
+	return fs.OpenFile(filename, vfs.RdOnlyFlag, 0)
+}
+
+// OpenFile opens the named file.  Files opened for writing are read into
+// memory (unless truncated) and uploaded on Close if they were changed.  New
+// files are created empty when opened, exclusive creates use a conditional
+// upload so that a racing writer is detected
+func (fs *s3fs) OpenFile(filename string, flag vfs.OpenFlag, perm os.FileMode) (vfs.File, error) {
+	info, err := fs.Stat(filename)
+	if err == nil && info.IsDir() {
+		if flag&(vfs.WrOnlyFlag|vfs.RdWrFlag) != 0 {
+			return nil, &vfs.PathError{Op: "open", Path: filename, Cause: vfs.ErrIsDir}
+		}
+		return &s3File{fs: fs, name: filename, info: info, flag: flag}, nil
+	} else if err == nil && flag&vfs.CreateFlag != 0 && flag&vfs.ExclFlag != 0 {
+		return nil, &vfs.PathError{Op: "open", Path: filename, Cause: vfs.ErrExist}
+	} else if vfs.IsNotExist(err) && flag&vfs.CreateFlag != 0 {
+		if dir, err := fs.Stat(path.Dir(path.Clean("/" + filename))); err != nil {
+			return nil, err
+		} else if !dir.IsDir() {
+			return nil, &vfs.PathError{Op: "open", Path: filename, Cause: vfs.ErrNotDir}
+		}
+
+		// create the object now so that it is visible before Close
+		if err := fs.upload(filename, nil, flag&vfs.ExclFlag != 0); err != nil {
+			return nil, err
+		}
+		info = &fileInfo{name: path.Base(filename), mode: 0644, modTime: time.Now()}
+	} else if err != nil {
+		return nil, err
+	}
+
+	f := &s3File{fs: fs, name: filename, info: info, flag: flag}
+	if flag&(vfs.WrOnlyFlag|vfs.RdWrFlag) == 0 {
+		return f, nil
+	}
+
+	f.buf = &bytes.Buffer{}
+	if flag&vfs.TruncFlag != 0 {
+		f.dirty = info.Size() > 0
+	} else if info.Size() > 0 {
+		if err = f.download(); err != nil {
+			return nil, err
+		}
+	}
+
+	if flag&vfs.AppendFlag != 0 {
+		f.offset = int64(f.buf.Len())
+	}
+	return f, nil
+}
+
+// upload stores data at the key for filename.  When exclusive is set the
+// upload fails if the object was created by someone else in the meantime
+func (fs *s3fs) upload(filename string, data []byte, exclusive bool) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(fs.bucket),
+		Key:    aws.String(fs.key(filename)),
+		Body:   bytes.NewReader(data),
+	}
+
+	if exclusive {
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	if _, err := fs.client.PutObject(context.Background(), input); err != nil {
+		return pathError("write", filename, err)
+	}
+	return nil
+}
+
+// Mkdir creates a directory marker object
+func (fs *s3fs) Mkdir(name string, perm os.FileMode) error {
+	if _, err := fs.Stat(name); err == nil {
+		return &vfs.PathError{Op: "mkdir", Path: name, Cause: vfs.ErrExist}
+	}
+
+	if dir, err := fs.Stat(path.Dir(path.Clean("/" + name))); err != nil {
+		return &vfs.PathError{Op: "mkdir", Path: name, Cause: vfs.ErrNotExist}
+	} else if !dir.IsDir() {
+		return &vfs.PathError{Op: "mkdir", Path: name, Cause: vfs.ErrNotDir}
+	}
+
+	_, err := fs.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(fs.bucket),
+		Key:    aws.String(fs.dirKey(name)),
+		Body:   bytes.NewReader(nil),
+	})
+
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// Remove deletes a file or an empty directory
+func (fs *s3fs) Remove(name string) error {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	key := fs.key(name)
+	if info.IsDir() {
+		infos, err := fs.list(name, 1)
+		if err != nil {
+			return err
+		} else if len(infos) > 0 {
+			return &vfs.PathError{Op: "remove", Path: name, Cause: errors.New("directory not empty")}
+		}
+		key = fs.dirKey(name)
+	}
+
+	_, err = fs.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: aws.String(fs.bucket), Key: aws.String(key)})
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+// Rename copies every object for oldpath to newpath and then deletes the
+// originals.  S3 has no rename so this is neither atomic nor cheap for
+// large directories
+func (fs *s3fs) Rename(oldpath, newpath string) error {
+	info, err := fs.Stat(oldpath)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{fs.key(oldpath)}
+	if info.IsDir() {
+		if keys, err = fs.keys(fs.dirKey(oldpath)); err != nil {
+			return err
+		}
+	}
+
+	oldKey, newKey := fs.key(oldpath), fs.key(newpath)
+	for _, key := range keys {
+		_, err = fs.client.CopyObject(context.Background(), &s3.CopyObjectInput{
+			Bucket:     aws.String(fs.bucket),
+			Key:        aws.String(newKey + strings.TrimPrefix(key, oldKey)),
+			CopySource: aws.String(url.PathEscape(fs.bucket + "/" + key)),
+		})
+
+		if err != nil {
+			return linkError("rename", oldpath, newpath, err)
+		}
+	}
+
+	for _, key := range keys {
+		_, err = fs.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: aws.String(fs.bucket), Key: aws.String(key)})
+		if err != nil {
+			return linkError("rename", oldpath, newpath, err)
+		}
+	}
+	return nil
+}
+
+// keys returns every object key beginning with prefix
+func (fs *s3fs) keys(prefix string) (keys []string, err error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(fs.bucket), Prefix: aws.String(prefix)}
+	for {
+		output, err := fs.client.ListObjectsV2(context.Background(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range output.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+
+		if !aws.ToBool(output.IsTruncated) {
+			return keys, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// Lstat is the same as Stat since S3 has no symbolic links
+func (fs *s3fs) Lstat(filename string) (os.FileInfo, error) {
+	return fs.Stat(filename)
+}
+
+// Stat returns the FileInfo for an object, or for a directory when any
+// object exists beneath the path
+func (fs *s3fs) Stat(filename string) (os.FileInfo, error) {
+	name := path.Base(path.Clean("/" + filename))
+	key := fs.key(filename)
+	if key == strings.TrimSuffix(fs.prefix, "/") {
+		return &fileInfo{name: name, mode: os.ModeDir | 0755}, nil
+	}
+
+	output, err := fs.client.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: aws.String(fs.bucket), Key: aws.String(key)})
+	if err == nil {
+		return &fileInfo{name: name, size: aws.ToInt64(output.ContentLength), mode: 0644, modTime: aws.ToTime(output.LastModified)}, nil
+	} else if !isNotFound(err) {
+		return nil, pathError("stat", filename, err)
+	}
+
+	list, err := fs.client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket:  aws.String(fs.bucket),
+		Prefix:  aws.String(key + "/"),
+		MaxKeys: aws.Int32(1),
+	})
+
+	if err != nil {
+		return nil, pathError("stat", filename, err)
+	} else if len(list.Contents) == 0 && len(list.CommonPrefixes) == 0 {
+		return nil, &vfs.PathError{Op: "stat", Path: filename, Cause: vfs.ErrNotExist}
+	}
+	return &fileInfo{name: name, mode: os.ModeDir | 0755}, nil
+}
+
+// list returns up to n (all if n <= 0) entries of a directory sorted by name
+func (fs *s3fs) list(dirname string, n int) (infos []os.FileInfo, err error) {
+	prefix := fs.dirKey(dirname)
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(fs.bucket), Prefix: aws.String(prefix), Delimiter: aws.String("/")}
+	for {
+		output, err := fs.client.ListObjectsV2(context.Background(), input)
+		if err != nil {
+			return nil, pathError("readdir", dirname, err)
+		}
+
+		for _, common := range output.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(common.Prefix), prefix), "/")
+			infos = append(infos, &fileInfo{name: name, mode: os.ModeDir | 0755})
+		}
+
+		for _, object := range output.Contents {
+			if key := aws.ToString(object.Key); key != prefix {
+				infos = append(infos, &fileInfo{
+					name:    strings.TrimPrefix(key, prefix),
+					size:    aws.ToInt64(object.Size),
+					mode:    0644,
+					modTime: aws.ToTime(object.LastModified),
+				})
+			}
+		}
+
+		if !aws.ToBool(output.IsTruncated) || (n > 0 && len(infos) >= n) {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	if n > 0 && len(infos) > n {
+		infos = infos[:n]
+	}
+	return infos, nil
+}
+
+func (fs *s3fs) Close() error { return nil }
+
+func (fs *s3fs) Watcher(chan<- vfs.Event) (vfs.Watcher, error) {
+	return nil, vfs.ErrNotSupported
+}
+
+// fileInfo describes an object or emulated directory
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// s3File is an open object or directory.  Read-only files read directly
+// from S3 with ranged requests, writable files are buffered in buf
+type s3File struct {
+	fs     *s3fs
+	name   string
+	info   os.FileInfo
+	flag   vfs.OpenFlag
+	offset int64
+	body   io.ReadCloser
+	buf    *bytes.Buffer
+	dirty  bool
+	dir    []os.FileInfo
+	closed bool
+}
+
+// download reads the existing object into the write buffer
+func (f *s3File) download() error {
+	output, err := f.fs.client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String(f.fs.bucket), Key: aws.String(f.fs.key(f.name))})
+	if err != nil {
+		return pathError("open", f.name, err)
+	}
+	defer output.Body.Close()
+
+	_, err = f.buf.ReadFrom(output.Body)
+	return err
+}
+
+func (f *s3File) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return &vfs.PathError{Op: op, Path: f.name, Cause: vfs.ErrClosed}
+	case f.info.IsDir():
+		return &vfs.PathError{Op: op, Path: f.name, Cause: vfs.ErrIsDir}
+	case write && f.buf == nil:
+		return &vfs.PathError{Op: op, Path: f.name, Cause: vfs.ErrReadOnly}
+	case !write && f.flag&vfs.WrOnlyFlag != 0:
+		return &vfs.PathError{Op: op, Path: f.name, Cause: vfs.ErrWriteOnly}
+	}
+	return nil
+}
+
+func (f *s3File) Name() string { return f.name }
+
+func (f *s3File) Read(p []byte) (n int, err error) {
+	if err = f.check("read", false); err != nil {
+		return 0, err
+	}
+
+	if f.buf != nil {
+		n, err = f.ReadAt(p, f.offset)
+		f.offset += int64(n)
+		return n, err
+	}
+
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		output, err := f.fs.client.GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String(f.fs.bucket),
+			Key:    aws.String(f.fs.key(f.name)),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-", f.offset)),
+		})
+
+		if err != nil {
+			return 0, pathError("read", f.name, err)
+		}
+		f.body = output.Body
+	}
+
+	n, err = f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (n int, err error) {
+	if err = f.check("read", false); err != nil {
+		return 0, err
+	} else if off < 0 {
+		return 0, &vfs.PathError{Op: "read", Path: f.name, Cause: vfs.ErrInvalidSeek}
+	}
+
+	if f.buf != nil {
+		if off >= int64(f.buf.Len()) {
+			return 0, io.EOF
+		}
+
+		n = copy(p, f.buf.Bytes()[off:])
+		if n < len(p) {
+			err = io.EOF
+		}
+		return n, err
+	}
+
+	if off >= f.info.Size() || len(p) == 0 {
+		return 0, io.EOF
+	}
+
+	output, err := f.fs.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(f.fs.bucket),
+		Key:    aws.String(f.fs.key(f.name)),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)),
+	})
+
+	if err != nil {
+		return 0, pathError("read", f.name, err)
+	}
+	defer output.Body.Close()
+
+	n, err = io.ReadFull(output.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *s3File) Write(p []byte) (n int, err error) {
+	if f.flag&vfs.AppendFlag != 0 && f.buf != nil {
+		f.offset = int64(f.buf.Len())
+	}
+
+	n, err = f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *s3File) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	} else if off < 0 {
+		return 0, &vfs.PathError{Op: "write", Path: f.name, Cause: vfs.ErrInvalidSeek}
+	}
+
+	if end := off + int64(len(p)); end > int64(f.buf.Len()) {
+		f.buf.Write(make([]byte, end-int64(f.buf.Len())))
+	}
+	copy(f.buf.Bytes()[off:], p)
+	f.dirty = true
+	return len(p), nil
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek", false); err != nil && !vfs.IsError(vfs.ErrWriteOnly, err) {
+		return 0, err
+	}
+
+	size := f.info.Size()
+	if f.buf != nil {
+		size = int64(f.buf.Len())
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, &vfs.PathError{Op: "seek", Path: f.name, Cause: vfs.ErrWhence}
+	}
+
+	if offset < 0 {
+		return 0, &vfs.PathError{Op: "seek", Path: f.name, Cause: vfs.ErrInvalidSeek}
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *s3File) Readdir(n int) (infos []os.FileInfo, err error) {
+	if !f.info.IsDir() {
+		return nil, &vfs.PathError{Op: "readdir", Path: f.name, Cause: vfs.ErrNotDir}
+	}
+
+	if f.dir == nil {
+		if f.dir, err = f.fs.list(f.name, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	infos = f.dir[f.offset:]
+	if n > 0 && len(infos) > n {
+		infos = infos[:n]
+	}
+	f.offset += int64(len(infos))
+
+	if n > 0 && len(infos) == 0 {
+		err = io.EOF
+	}
+	return infos, err
+}
+
+func (f *s3File) Readdirnames(n int) (names []string, err error) {
+	infos, err := f.Readdir(n)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, err
+}
+
+func (f *s3File) Stat() (os.FileInfo, error) {
+	if f.buf != nil {
+		return &fileInfo{name: f.info.Name(), size: int64(f.buf.Len()), mode: f.info.Mode(), modTime: f.info.ModTime()}, nil
+	}
+	return f.info, nil
+}
+
+// Close uploads the contents of a file opened for writing if it changed
+func (f *s3File) Close() (err error) {
+	if f.closed {
+		return &vfs.PathError{Op: "close", Path: f.name, Cause: vfs.ErrClosed}
+	}
+	f.closed = true
+
+	if f.body != nil {
+		f.body.Close()
+	}
+
+	if f.dirty {
+		err = f.fs.upload(f.name, f.buf.Bytes(), false)
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/mh-orange/vfs"
+)
+
+// testClient is an in-memory S3 bucket that lists two keys per page
+type testClient struct {
+	objects map[string][]byte
+}
+
+func newTestClient() *testClient {
+	return &testClient{objects: make(map[string][]byte)}
+}
+
+func (tc *testClient) GetObject(ctx context.Context, in *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, found := tc.objects[aws.ToString(in.Key)]
+	if !found {
+		return nil, &types.NoSuchKey{}
+	}
+
+	if r := aws.ToString(in.Range); r != "" {
+		start, end, _ := strings.Cut(strings.TrimPrefix(r, "bytes="), "-")
+		from, _ := strconv.Atoi(start)
+		to := len(data) - 1
+		if end != "" {
+			to, _ = strconv.Atoi(end)
+		}
+
+		if to >= len(data) {
+			to = len(data) - 1
+		}
+		data = data[from : to+1]
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data)), ContentLength: aws.Int64(int64(len(data)))}, nil
+}
+
+func (tc *testClient) HeadObject(ctx context.Context, in *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	data, found := tc.objects[aws.ToString(in.Key)]
+	if !found {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data))), LastModified: aws.Time(time.Now())}, nil
+}
+
+func (tc *testClient) PutObject(ctx context.Context, in *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	key := aws.ToString(in.Key)
+	if _, found := tc.objects[key]; found && aws.ToString(in.IfNoneMatch) == "*" {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+	}
+
+	data, err := io.ReadAll(in.Body)
+	tc.objects[key] = data
+	return &s3.PutObjectOutput{}, err
+}
+
+func (tc *testClient) CopyObject(ctx context.Context, in *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	source, _ := url.PathUnescape(aws.ToString(in.CopySource))
+	_, key, _ := strings.Cut(source, "/")
+	data, found := tc.objects[key]
+	if !found {
+		return nil, &types.NoSuchKey{}
+	}
+	tc.objects[aws.ToString(in.Key)] = data
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (tc *testClient) DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(tc.objects, aws.ToString(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (tc *testClient) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	prefix, delimiter := aws.ToString(in.Prefix), aws.ToString(in.Delimiter)
+	var entries []string
+	seen := make(map[string]bool)
+	for key := range tc.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			key = key[:len(prefix)+i+1]
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			entries = append(entries, key)
+		}
+	}
+	sort.Strings(entries)
+
+	start, _ := strconv.Atoi(aws.ToString(in.ContinuationToken))
+	end := start + 2
+	if max := int(aws.ToInt32(in.MaxKeys)); max > 0 && start+max < end {
+		end = start + max
+	}
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(entries))}
+	if end < len(entries) {
+		output.NextContinuationToken = aws.String(strconv.Itoa(end))
+	} else {
+		end = len(entries)
+	}
+
+	for _, entry := range entries[start:end] {
+		if delimiter != "" && strings.HasSuffix(entry, delimiter) && entry != prefix {
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(entry)})
+		} else {
+			output.Contents = append(output.Contents, types.Object{Key: aws.String(entry), Size: aws.Int64(int64(len(tc.objects[entry])))})
+		}
+	}
+	return output, nil
+}
+
+func TestS3Fs(t *testing.T) {
+	client := newTestClient()
+	fs := New(client, "bucket", "/root/")
+
+	if err := vfs.MkdirAll(fs, "/one/two", 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"/a.txt", "/b.txt", "/c.txt", "/one/1.txt"} {
+		if err := vfs.WriteFile(fs, name, []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if _, found := client.objects["root/one/1.txt"]; !found {
+		t.Errorf("Expected object root/one/1.txt got %v", client.objects)
+	}
+
+	if data, err := vfs.ReadFile(fs, "/one/1.txt"); err != nil || string(data) != "content of /one/1.txt" {
+		t.Errorf("Unexpected read %q %v", data, err)
+	}
+
+	d, _ := fs.Open("/")
+	names, _ := d.Readdirnames(-1)
+	if want := []string{"a.txt", "b.txt", "c.txt", "one"}; !reflect.DeepEqual(want, names) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+
+	if fi, err := fs.Stat("/one/two"); err != nil || !fi.IsDir() {
+		t.Errorf("Wanted directory got %v %v", fi, err)
+	}
+
+	if _, err := fs.Stat("/missing"); !vfs.IsNotExist(err) {
+		t.Errorf("Wanted ErrNotExist got %v", err)
+	}
+
+	if err := fs.Remove("/one"); err == nil {
+		t.Errorf("Expected error removing non-empty directory")
+	}
+
+	if err := fs.Rename("/one", "/uno"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if data, err := vfs.ReadFile(fs, "/uno/1.txt"); err != nil || string(data) != "content of /one/1.txt" {
+		t.Errorf("Unexpected read %q %v", data, err)
+	}
+
+	if _, err := fs.OpenFile("/a.txt", vfs.CreateFlag|vfs.ExclFlag|vfs.WrOnlyFlag, 0644); !vfs.IsExist(err) {
+		t.Errorf("Wanted ErrExist got %v", err)
+	}
+
+	if err := fs.Remove("/uno/two"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestS3File(t *testing.T) {
+	fs := New(newTestClient(), "bucket", "")
+	vfs.WriteFile(fs, "/file", []byte("0123456789"), 0644)
+
+	f, _ := fs.Open("/file")
+	buf := make([]byte, 4)
+	if n, err := f.ReadAt(buf, 3); n != 4 || err != nil || string(buf) != "3456" {
+		t.Errorf("Unexpected ReadAt %d %q %v", n, buf, err)
+	}
+
+	f.Seek(8, io.SeekStart)
+	if data, _ := io.ReadAll(f); string(data) != "89" {
+		t.Errorf("Wanted 89 got %q", data)
+	}
+
+	if _, err := f.Write([]byte("x")); !vfs.IsError(vfs.ErrReadOnly, err) {
+		t.Errorf("Wanted ErrReadOnly got %v", err)
+	}
+
+	f, _ = fs.OpenFile("/file", vfs.RdWrFlag, 0)
+	f.WriteAt([]byte("abc"), 2)
+	f.(io.Closer).Close()
+	if data, _ := vfs.ReadFile(fs, "/file"); string(data) != "01abc56789" {
+		t.Errorf("Wanted 01abc56789 got %q", data)
+	}
+
+	f, _ = fs.OpenFile("/file", vfs.WrOnlyFlag|vfs.AppendFlag, 0)
+	f.Write([]byte("!"))
+	f.(io.Closer).Close()
+	if fi, _ := fs.Stat("/file"); fi.Size() != 11 || fi.Mode() != 0644 {
+		t.Errorf("Wanted size 11 mode %v got %d %v", os.FileMode(0644), fi.Size(), fi.Mode())
+	}
+}
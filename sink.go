@@ -0,0 +1,82 @@
+package vfs
+
+import (
+	"sync/atomic"
+)
+
+// EventSink receives the events of the Watchers it is attached to, next to
+// their channels.  Sinks are called as the events happen and hold up the
+// FileSystem while they run, so they should return quickly and must not
+// modify the FileSystem being watched.  Sinks that take longer, such as
+// bridges to other systems, can be wrapped in a QueueSink
+type EventSink interface {
+	Send(event Event)
+}
+
+// EventSinkFunc is an EventSink calling the function for each event
+type EventSinkFunc func(event Event)
+
+func (f EventSinkFunc) Send(event Event) { f(event) }
+
+// SinkWatcher is implemented by Watchers that send their events to sinks.
+// The Watcher returned by a memfs is one, and can be created with a nil
+// channel when the events only go to sinks
+type SinkWatcher interface {
+	Watcher
+
+	// AddSink attaches sink to the watcher, it receives every event from
+	// then on until remove is called or the watcher is closed
+	AddSink(sink EventSink) (remove func())
+}
+
+// QueueSink holds events for another EventSink and sends them from a
+// goroutine of its own, so that a slow sink does not hold up the
+// FileSystem.  Events that do not fit in the queue are dropped
+type QueueSink struct {
+	queue  *eventQueue
+	events chan Event
+	done   chan struct{}
+	stats  WatcherStats
+}
+
+// NewQueueSink returns a QueueSink holding up to limit events for sink.  The
+// QueueSink must be closed once it is no longer attached to a watcher
+func NewQueueSink(sink EventSink, limit int) *QueueSink {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	qs := &QueueSink{events: make(chan Event), done: make(chan struct{})}
+	qs.queue = newEventQueue(qs.events, limit, &qs.stats)
+	go qs.queue.run()
+	go func() {
+		defer close(qs.done)
+		for event := range qs.events {
+			sink.Send(event)
+		}
+	}()
+	return qs
+}
+
+// Send queues the event, dropping it when the queue is full
+func (qs *QueueSink) Send(event Event) {
+	qs.queue.push(event)
+}
+
+// Stats returns the number of events sent on and dropped by the QueueSink
+func (qs *QueueSink) Stats() WatcherStats {
+	return WatcherStats{
+		Delivered: atomic.LoadUint64(&qs.stats.Delivered),
+		Dropped:   atomic.LoadUint64(&qs.stats.Dropped),
+	}
+}
+
+// Close stops the QueueSink.  It waits for the event being sent on, if any,
+// but not for the rest of the queue, the events still queued and those sent
+// afterwards are dropped
+func (qs *QueueSink) Close() error {
+	qs.queue.shutdown()
+	close(qs.events)
+	<-qs.done
+	return nil
+}
@@ -0,0 +1,120 @@
+package vfs
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemWatcherSinks(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/dir", 0755)
+
+	events := make(chan Event, 10)
+	watcher, _ := fs.Watcher(events)
+	sinkOnly, _ := fs.Watcher(nil)
+	for _, w := range []Watcher{watcher, sinkOnly} {
+		if err := w.Watch("/dir"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	var first, second []string
+	record := func(got *[]string) EventSink {
+		return EventSinkFunc(func(event Event) {
+			if event.Type == CreateEvent {
+				mu.Lock()
+				*got = append(*got, event.Path)
+				mu.Unlock()
+			}
+		})
+	}
+
+	remove := watcher.(SinkWatcher).AddSink(record(&first))
+	sinkOnly.(SinkWatcher).AddSink(record(&second))
+	WriteFile(fs, "/dir/a", nil, 0644)
+	remove()
+	WriteFile(fs, "/dir/b", nil, 0644)
+	watcher.Close()
+	sinkOnly.Close()
+
+	if want := []string{"/dir/a"}; !reflect.DeepEqual(want, first) {
+		t.Errorf("Wanted %v got %v", want, first)
+	}
+
+	if want := []string{"/dir/a", "/dir/b"}; !reflect.DeepEqual(want, second) {
+		t.Errorf("Wanted %v got %v", want, second)
+	}
+
+	var paths []string
+	for event := range events {
+		if event.Type == CreateEvent {
+			paths = append(paths, event.Path)
+		}
+	}
+
+	if want := []string{"/dir/a", "/dir/b"}; !reflect.DeepEqual(want, paths) {
+		t.Errorf("Wanted the channel to get every event got %v", paths)
+	}
+}
+
+func TestQueueSink(t *testing.T) {
+	release := make(chan struct{})
+	var got []string
+	qs := NewQueueSink(EventSinkFunc(func(event Event) {
+		<-release
+		got = append(got, event.Path)
+	}), 2)
+
+	// the first event is being sent on, the next two are queued and the
+	// last one does not fit
+	for _, name := range []string{"/a", "/b", "/c", "/d"} {
+		qs.Send(Event{Type: CreateEvent, Path: name})
+	}
+	close(release)
+
+	// Close drops whatever is still queued, so the queue is given the time
+	// to empty first
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if stats := qs.Stats(); stats.Delivered+stats.Dropped == 4 {
+			break
+		}
+	}
+	qs.Close()
+
+	if stats := qs.Stats(); stats.Delivered+stats.Dropped != 4 || stats.Dropped == 0 {
+		t.Errorf("Wanted some of 4 events dropped got %+v", stats)
+	}
+
+	if len(got) != int(qs.Stats().Delivered) || got[0] != "/a" {
+		t.Errorf("Wanted the delivered events in order got %v", got)
+	}
+}
+
+func TestQueueSinkCloseBlocked(t *testing.T) {
+	release := make(chan struct{})
+	qs := NewQueueSink(EventSinkFunc(func(event Event) { <-release }), 10)
+	for _, name := range []string{"/a", "/b", "/c"} {
+		qs.Send(Event{Type: CreateEvent, Path: name})
+	}
+
+	// only the event being sent on is waited for
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	closed := make(chan struct{})
+	go func() {
+		qs.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("Wanted Close to return once the event being sent on was")
+	}
+
+	if stats := qs.Stats(); stats.Delivered+stats.Dropped != 3 || stats.Dropped == 0 {
+		t.Errorf("Wanted the queued events dropped got %+v", stats)
+	}
+}
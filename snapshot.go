@@ -0,0 +1,229 @@
+package vfs
+
+import (
+	"path"
+	"time"
+)
+
+// Clone returns a writable copy of the memfs.  The copy starts out sharing
+// every block of file data with the original and a block is only copied
+// once either side writes to it, so cloning is cheap no matter how much data
+// the memfs holds.  Watchers are not carried over.  The FileSystem returned
+// by NewMemFs can be asserted to interface{ Clone() FileSystem } to reach it
+func (fs *memfs) Clone() FileSystem {
+	return fs.clone(false)
+}
+
+// Snapshot returns a read-only copy of the memfs that shares block storage
+// in the same way as Clone.  Every modification of the snapshot fails with
+// ErrReadOnly.  Rolling back to a snapshot is a matter of cloning it:
+//
+//	snapshot := fs.(interface{ Snapshot() FileSystem }).Snapshot()
+//	// ... modify fs ...
+//	fs = snapshot.(interface{ Clone() FileSystem }).Clone()
+//
+// A snapshot taken while files are being written may capture part of a write
+func (fs *memfs) Snapshot() FileSystem {
+	return fs.clone(true)
+}
+
+func (fs *memfs) clone(readOnly bool) *memfs {
+	clone := &memfs{
+		watchers:        make(map[memInodeNum]map[*memWatcher]memWatch),
+		overflow:        fs.overflow,
+		permissions:     fs.permissions,
+		blocksize:       fs.blocksize,
+		arena:           fs.arena,
+		caseInsensitive: fs.caseInsensitive,
+		sorted:          fs.sorted,
+		umask:           fs.umask,
+		perms:           fs.perms,
+		maxBytes:        fs.maxBytes,
+		maxInodes:       fs.maxInodes,
+		maxFileSize:     fs.maxFileSize,
+	}
+	clone.readOnly.Store(readOnly)
+
+	// inodes lock the filesystem while holding their own lock, so they are
+	// copied before the filesystem is locked
+	fs.Lock()
+	inodes := append([]*memInode(nil), fs.inodes...)
+	for point, source := range fs.mounts {
+		if clone.mounts == nil {
+			clone.mounts = make(map[memInodeNum]memInodeNum)
+		}
+		clone.mounts[point] = source
+	}
+	fs.Unlock()
+
+	// inodes removed while open are only kept for their handles, which the
+	// clone does not have
+	var unlinked []memInodeNum
+	clone.inodes = make([]*memInode, len(inodes))
+	for i, inode := range inodes {
+		inode.Lock()
+		if inode.unlinked {
+			unlinked = append(unlinked, inode.num)
+		}
+		clone.inodes[i] = &memInode{
+			fs:      clone,
+			num:     inode.num,
+			parent:  inode.parent,
+			size:    inode.size,
+			mode:    inode.mode,
+			modTime: inode.modTime,
+			link:    inode.link,
+			blocks:  append([]int64(nil), inode.blocks...),
+		}
+		inode.Unlock()
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+	fs.blockMu.Lock()
+	defer fs.blockMu.Unlock()
+	clone.freeInodes = append([]memInodeNum(nil), fs.freeInodes...)
+	clone.freeBlocks = append([]int64(nil), fs.freeBlocks...)
+	clone.freeHeld = fs.freeHeld
+	if fs.arena != nil {
+		fs.arena.ref()
+	}
+	clone.blocks = append([][]byte(nil), fs.blocks...)
+	clone.spill = fs.spill.clone()
+	clone.shared = make(map[int64]bool, len(fs.blocks))
+	if fs.shared == nil {
+		fs.shared = make(map[int64]bool, len(fs.blocks))
+	}
+
+	for n := range fs.blocks {
+		fs.shared[int64(n)] = true
+		clone.shared[int64(n)] = true
+	}
+
+	for _, num := range unlinked {
+		clone.freeInode(num)
+	}
+	return clone
+}
+
+// Freeze makes the memfs immutable, so that a fixture can be shared by
+// tests running in parallel.  Every modification fails with ErrReadOnly
+// afterwards, including writes to files that were open for writing, and
+// reads no longer take the lock of each file.  A Clone of a frozen memfs can
+// be modified as usual.  The FileSystem returned by NewMemFs can be asserted
+// to interface{ Freeze() } to reach it
+func (fs *memfs) Freeze() {
+	fs.readOnly.Store(true)
+	fs.Lock()
+	inodes := append([]*memInode(nil), fs.inodes...)
+	fs.Unlock()
+
+	for _, inode := range inodes {
+		// writes in progress finish before the inode is frozen
+		inode.Lock()
+		inode.frozen.Store(true)
+		inode.Unlock()
+	}
+}
+
+// CloneFile copies the regular file src to dst, replacing dst if it exists.
+// The copy shares the blocks of src, including those spilled by WithSpill,
+// and a block is only copied once either file writes to it.  The blocks of
+// the copy count towards the capacity set by WithMaxBytes all the same
+func (fs *memfs) CloneFile(src, dst string) error {
+	err := fs.cloneFile(src, dst)
+	if err != nil {
+		return &LinkError{Op: "clone", Old: src, New: dst, Cause: err}
+	}
+	return nil
+}
+
+func (fs *memfs) cloneFile(src, dst string) error {
+	if fs.readOnly.Load() {
+		return ErrReadOnly
+	}
+
+	inode, err := fs.resolve(src)
+	if err == nil {
+		err = fs.access(inode, permRead)
+	}
+
+	if err != nil {
+		return err
+	} else if inode.IsDir() {
+		return ErrIsDir
+	} else if target, err := fs.resolve(dst); err == nil && target == inode {
+		return nil
+	}
+
+	f, err := fs.OpenFile(dst, WrOnlyFlag|CreateFlag|TruncFlag, inode.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	file := f.(*memFile)
+	defer file.Close()
+
+	inode.Lock()
+	size := inode.size
+	blocks, err := fs.share(inode.blocks)
+	inode.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// anything written to dst since it was truncated is replaced
+	file.inode.Lock()
+	replaced := file.inode.blocks
+	file.inode.blocks, file.inode.size, file.inode.modTime = blocks, size, time.Now()
+	file.inode.Unlock()
+	fs.free(replaced...)
+	fs.notify(ModifyEvent, file.inode.Parent(), path.Base(file.name))
+	return nil
+}
+
+// share returns new blocks that share the storage of blocks until they are
+// written.  ErrNoSpace is returned when the new blocks would not fit within
+// the capacity set by WithMaxBytes
+func (fs *memfs) share(blocks []int64) ([]int64, error) {
+	fs.blockMu.Lock()
+	defer fs.blockMu.Unlock()
+	used := int64(len(fs.blocks) - len(fs.freeBlocks))
+	if fs.maxBytes > 0 && (used+int64(len(blocks)))*fs.blocksize > fs.maxBytes {
+		return nil, ErrNoSpace
+	}
+
+	if fs.shared == nil {
+		fs.shared = make(map[int64]bool)
+	}
+
+	clones := make([]int64, len(blocks))
+	for i, n := range blocks {
+		clone := int64(len(fs.blocks))
+		if len(fs.freeBlocks) > 0 {
+			clone = fs.freeBlocks[0]
+			fs.freeBlocks = fs.freeBlocks[1:]
+			if fs.blocks[clone] != nil {
+				if !fs.shared[clone] {
+					fs.releaseBlock(fs.blocks[clone])
+				}
+				fs.blocks[clone] = nil
+				delete(fs.shared, clone)
+				fs.freeHeld--
+				fs.spill.drop()
+			}
+		} else {
+			fs.blocks = append(fs.blocks, nil)
+		}
+
+		if fs.blocks[n] == nil {
+			// the block was evicted, the copy shares its spilled copy
+			fs.spill.share(n, clone)
+		} else {
+			fs.blocks[clone] = fs.blocks[n]
+			fs.shared[n], fs.shared[clone] = true, true
+			fs.spill.hold(clone)
+		}
+		clones[i] = clone
+	}
+	return clones, nil
+}
@@ -0,0 +1,193 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestMemFsClone(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/dir", 0755)
+	WriteFile(fs, "/dir/file", []byte("original"), 0644)
+
+	clone := fs.(interface{ Clone() FileSystem }).Clone()
+	WriteFile(clone, "/dir/file", []byte("changed"), 0644)
+	WriteFile(clone, "/dir/new", []byte("new"), 0644)
+	WriteFile(fs, "/other", []byte("other"), 0644)
+
+	tests := []struct {
+		name     string
+		fs       FileSystem
+		filename string
+		want     string
+		wantErr  error
+	}{
+		{"original unchanged", fs, "/dir/file", "original", nil},
+		{"clone changed", clone, "/dir/file", "changed", nil},
+		{"new file in clone", clone, "/dir/new", "new", nil},
+		{"new file not in original", fs, "/dir/new", "", ErrNotExist},
+		{"new file in original", fs, "/other", "other", nil},
+		{"new file not in clone", clone, "/other", "", ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadFile(test.fs, test.filename)
+			if !IsError(test.wantErr, err) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if string(got) != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMemFsSnapshot(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/file", []byte("before"), 0644)
+
+	snapshot := fs.(interface{ Snapshot() FileSystem }).Snapshot()
+	WriteFile(fs, "/file", []byte("after"), 0644)
+
+	if got, _ := ReadFile(snapshot, "/file"); string(got) != "before" {
+		t.Errorf("Wanted %q got %q", "before", got)
+	}
+
+	if err := WriteFile(snapshot, "/file", nil, 0644); !IsError(ErrReadOnly, err) {
+		t.Errorf("Wanted %v got %v", ErrReadOnly, err)
+	} else if err = snapshot.Mkdir("/dir", 0755); !IsError(ErrReadOnly, err) {
+		t.Errorf("Wanted %v got %v", ErrReadOnly, err)
+	} else if err = snapshot.Remove("/file"); !IsError(ErrReadOnly, err) {
+		t.Errorf("Wanted %v got %v", ErrReadOnly, err)
+	}
+
+	restored := snapshot.(interface{ Clone() FileSystem }).Clone()
+	if err := WriteFile(restored, "/file", []byte("restored"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(snapshot, "/file"); string(got) != "before" {
+		t.Errorf("Wanted the snapshot to be unchanged got %q", got)
+	}
+}
+
+func TestMemFsCloneFile(t *testing.T) {
+	backing := NewMemFs()
+	tests := []struct {
+		name    string
+		fs      FileSystem
+		size    int64
+		wantErr error
+	}{
+		{"shared", NewMemFs(), 8 * blocksize, nil},
+		{"spilled", NewMemFs(WithSpill(backing, 4*blocksize)), 8 * blocksize, nil},
+		{"no space", NewMemFs(WithMaxBytes(12 * blocksize)), 8 * blocksize, ErrNoSpace},
+		{"read only", NewMemFs().(interface{ Snapshot() FileSystem }).Snapshot(), 0, ErrReadOnly},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contents := bytes.Repeat([]byte("abcdefgh"), int(test.size/8))
+			WriteFile(test.fs, "/file", contents, 0644)
+			err := CloneFile(test.fs, "/file", "/clone")
+			if !IsError(test.wantErr, err) {
+				t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+			} else if err != nil {
+				return
+			}
+
+			f, _ := test.fs.OpenFile("/clone", WrOnlyFlag, 0)
+			f.WriteAt([]byte("changed"), 2*blocksize)
+			closeFile(f)
+
+			want := append([]byte(nil), contents...)
+			copy(want[2*blocksize:], "changed")
+			if got, _ := ReadFile(test.fs, "/clone"); !bytes.Equal(want, got) {
+				t.Errorf("Wanted the clone to be changed")
+			}
+
+			if got, _ := ReadFile(test.fs, "/file"); !bytes.Equal(contents, got) {
+				t.Errorf("Wanted the source to be unchanged")
+			}
+
+			// only the written block was copied
+			memfs := test.fs.(*memfs)
+			src, _ := memfs.resolve("/file")
+			clone, _ := memfs.resolve("/clone")
+			memfs.blockMu.Lock()
+			defer memfs.blockMu.Unlock()
+			shared := 0
+			for i := range src.blocks {
+				if a, b := memfs.blocks[src.blocks[i]], memfs.blocks[clone.blocks[i]]; a != nil && b != nil && &a[0] == &b[0] {
+					shared++
+				}
+			}
+
+			if test.name == "shared" && shared != len(src.blocks)-1 {
+				t.Errorf("Wanted %d shared blocks got %d", len(src.blocks)-1, shared)
+			}
+		})
+	}
+}
+
+func TestMemFsFreeze(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/dir", 0755)
+	WriteFile(fs, "/dir/file", []byte("fixture"), 0644)
+	open, _ := fs.OpenFile("/dir/file", WrOnlyFlag, 0)
+	defer closeFile(open)
+	fs.(interface{ Freeze() }).Freeze()
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"create", func() error { return WriteFile(fs, "/new", nil, 0644) }},
+		{"overwrite", func() error { return WriteFile(fs, "/dir/file", nil, 0644) }},
+		{"mkdir", func() error { return fs.Mkdir("/other", 0755) }},
+		{"remove", func() error { return fs.Remove("/dir/file") }},
+		{"rename", func() error { return fs.Rename("/dir/file", "/moved") }},
+		{"chmod", func() error { return fs.Chmod("/dir/file", 0600) }},
+		{"open handle", func() error { _, err := open.Write([]byte("changed")); return err }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.op(); !IsError(ErrReadOnly, err) {
+				t.Errorf("Wanted %v got %v", ErrReadOnly, err)
+			}
+		})
+	}
+
+	// the errors name the paths involved
+	var pathErr *PathError
+	var linkErr *LinkError
+	if err := fs.Remove("/dir/file"); !errors.As(err, &pathErr) || pathErr.Path != "/dir/file" {
+		t.Errorf("Wanted *PathError for %v got %v", "/dir/file", err)
+	} else if err = fs.Chmod("/dir", 0700); !errors.As(err, &pathErr) || pathErr.Path != "/dir" {
+		t.Errorf("Wanted *PathError for %v got %v", "/dir", err)
+	} else if err = fs.Rename("/dir/file", "/moved"); !errors.As(err, &linkErr) || linkErr.New != "/moved" {
+		t.Errorf("Wanted *LinkError for %v got %v", "/moved", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := ReadFile(fs, "/dir/file"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if string(got) != "fixture" {
+				t.Errorf("Wanted %q got %q", "fixture", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	clone := fs.(interface{ Clone() FileSystem }).Clone()
+	if err := WriteFile(clone, "/dir/file", []byte("changed"), 0644); err != nil {
+		t.Errorf("Wanted the clone to be writable got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+// SortedFs lists directories in lexicographical order, whatever order the
+// underlying FileSystem keeps them in, so that listings are the same across
+// backends.  memfs and osfs do the same themselves when constructed with
+// WithSortedReaddir
+type SortedFs struct {
+	FileSystem
+}
+
+// NewSortedFs returns a SortedFs listing the directories of fs in order
+func NewSortedFs(fs FileSystem) *SortedFs {
+	return &SortedFs{FileSystem: fs}
+}
+
+func (sfs *SortedFs) Create(name string) (File, error) {
+	return sfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (sfs *SortedFs) Open(name string) (File, error) {
+	return sfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+func (sfs *SortedFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	f, err := sfs.FileSystem.OpenFile(name, flag, perm)
+	if err == nil {
+		if info, err := f.Stat(); err == nil && info.IsDir() {
+			f = &sortedDir{File: f}
+		}
+	}
+	return f, err
+}
+
+// Unwrap returns the underlying FileSystem
+func (sfs *SortedFs) Unwrap() []FileSystem { return []FileSystem{sfs.FileSystem} }
+
+// sortedDir reads a whole directory the first time it is listed and hands
+// out the entries sorted by name
+type sortedDir struct {
+	File
+	infos []os.FileInfo
+	read  bool
+}
+
+func (d *sortedDir) Readdir(n int) ([]os.FileInfo, error) {
+	if !d.read {
+		infos, err := d.File.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		d.infos, d.read = infos, true
+	}
+
+	if n <= 0 || n > len(d.infos) {
+		if n > 0 && len(d.infos) == 0 {
+			return nil, io.EOF
+		}
+		n = len(d.infos)
+	}
+
+	infos := d.infos[:n:n]
+	d.infos = d.infos[n:]
+	return infos, nil
+}
+
+// Seek rewinds the underlying directory, which is read again the next time
+// it is listed
+func (d *sortedDir) Seek(offset int64, whence int) (int64, error) {
+	pos, err := d.File.Seek(offset, whence)
+	if err == nil && pos == 0 {
+		d.infos, d.read = nil, false
+	}
+	return pos, err
+}
+
+func (d *sortedDir) Readdirnames(n int) (names []string, err error) {
+	infos, err := d.Readdir(n)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, err
+}
+
+// Close closes the underlying directory if it can be closed
+func (d *sortedDir) Close() error {
+	if closer, ok := d.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
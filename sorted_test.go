@@ -0,0 +1,58 @@
+package vfs
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSortedReaddir(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   FileSystem
+	}{
+		{"memfs", NewMemFs(WithSortedReaddir())},
+		{"osfs", NewOsFs(t.TempDir(), WithSortedReaddir())},
+		{"SortedFs", NewSortedFs(NewMemFs())},
+		{"clone", NewMemFs(WithSortedReaddir()).(interface{ Clone() FileSystem }).Clone()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"/c", "/a", "/e", "/b", "/d"} {
+				WriteFile(test.fs, name, nil, 0644)
+			}
+
+			f, err := test.fs.Open("/")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer closeFile(f)
+
+			var got [][]string
+			for {
+				names, err := f.Readdirnames(2)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				got = append(got, names)
+			}
+
+			want := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Wanted %v got %v", want, got)
+			}
+
+			// the whole directory at once after rewinding
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if names, _ := f.Readdirnames(-1); !reflect.DeepEqual([]string{"a", "b", "c", "d", "e"}, names) {
+				t.Errorf("Wanted sorted names got %v", names)
+			}
+		})
+	}
+}
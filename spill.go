@@ -0,0 +1,306 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// spillFiles numbers the spill files so that filesystems spilling to the
+// same backing FileSystem do not overwrite each other
+var spillFiles int64
+
+// spillStore keeps blocks evicted from memory in a single file on a backing
+// FileSystem.  Like block storage it is shared by a memfs and its snapshots
+// and clones, so the slots of the file are reference counted and only reused
+// once no filesystem refers to them
+type spillStore struct {
+	mu      sync.Mutex
+	backing FileSystem
+	name    string
+	file    File
+
+	refs  map[int64]int
+	free  []int64
+	next  int64
+	users int
+}
+
+func newSpillStore(backing FileSystem) *spillStore {
+	return &spillStore{
+		backing: backing,
+		name:    fmt.Sprintf("/memfs-%d-%d.spill", os.Getpid(), atomic.AddInt64(&spillFiles, 1)),
+		refs:    make(map[int64]int),
+		users:   1,
+	}
+}
+
+// put writes block to an unused slot of the spill file, which is created
+// the first time, and returns the slot
+func (s *spillStore) put(block []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		file, err := s.backing.OpenFile(s.name, RdWrFlag|CreateFlag|TruncFlag, 0600)
+		if err != nil {
+			return 0, err
+		}
+		s.file = file
+	}
+
+	slot := s.next
+	if n := len(s.free); n > 0 {
+		slot = s.free[n-1]
+	}
+
+	if _, err := s.file.WriteAt(block, slot*int64(len(block))); err != nil {
+		return 0, err
+	}
+
+	if n := len(s.free); n > 0 {
+		s.free = s.free[:n-1]
+	} else {
+		s.next++
+	}
+	s.refs[slot] = 1
+	return slot, nil
+}
+
+// get reads the block stored in slot
+func (s *spillStore) get(slot int64, block []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.file.ReadAt(block, slot*int64(len(block)))
+	if n == len(block) {
+		err = nil
+	}
+	return err
+}
+
+// release drops a reference to slot, it is reused once the last is gone
+func (s *spillStore) release(slot int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refs[slot]--; s.refs[slot] <= 0 {
+		delete(s.refs, slot)
+		s.free = append(s.free, slot)
+	}
+}
+
+// close drops a filesystem using the store and removes the spill file once
+// the last one is closed
+func (s *spillStore) close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users--; s.users > 0 || s.file == nil {
+		return nil
+	}
+
+	if closer, ok := s.file.(io.Closer); ok {
+		err = closer.Close()
+	}
+
+	if err1 := s.backing.Remove(s.name); err == nil {
+		err = err1
+	}
+	s.file = nil
+	return err
+}
+
+// memSpill is what a memfs spilling blocks with WithSpill knows about them.
+// It is guarded by the block lock, except that referenced is also set by
+// readers and writers holding only the read lock
+type memSpill struct {
+	store *spillStore
+
+	// limit is the block storage in bytes kept in memory
+	limit int64
+
+	// slots maps the evicted blocks to where they are in the spill file
+	slots map[int64]int64
+
+	// resident counts the blocks holding storage
+	resident int
+
+	// referenced marks the blocks used since the eviction sweep last passed
+	// them and hand is where the sweep continues
+	referenced []uint32
+	hand       int
+}
+
+func newMemSpill(backing FileSystem, limit int64) *memSpill {
+	return &memSpill{store: newSpillStore(backing), limit: limit, slots: make(map[int64]int64)}
+}
+
+// reference marks block n as recently used
+func (s *memSpill) reference(n int64) {
+	if s != nil && n < int64(len(s.referenced)) {
+		atomic.StoreUint32(&s.referenced[n], 1)
+	}
+}
+
+// hold records that block n was given storage
+func (s *memSpill) hold(n int64) {
+	if s == nil {
+		return
+	}
+
+	for int64(len(s.referenced)) <= n {
+		s.referenced = append(s.referenced, 0)
+	}
+	s.referenced[n] = 1
+	s.resident++
+}
+
+// drop records that the storage of a block was released
+func (s *memSpill) drop() {
+	if s != nil {
+		s.resident--
+	}
+}
+
+// discard forgets the spilled copy of block n once it is freed
+func (s *memSpill) discard(n int64) {
+	if s == nil {
+		return
+	}
+
+	if slot, found := s.slots[n]; found {
+		s.store.release(slot)
+		delete(s.slots, n)
+	}
+}
+
+// shrink follows the block table when compaction shortens it to n blocks
+func (s *memSpill) shrink(n int64) {
+	if s != nil && n < int64(len(s.referenced)) {
+		s.referenced = append([]uint32(nil), s.referenced[:n]...)
+		if int64(s.hand) > n {
+			s.hand = 0
+		}
+	}
+}
+
+// share makes block clone refer to the spilled copy of block n
+func (s *memSpill) share(n, clone int64) {
+	slot := s.slots[n]
+	s.store.mu.Lock()
+	s.store.refs[slot]++
+	s.store.mu.Unlock()
+	s.slots[clone] = slot
+}
+
+// clone returns the spilling state of a clone, which shares the spilled
+// blocks the same way it shares those in memory
+func (s *memSpill) clone() *memSpill {
+	if s == nil {
+		return nil
+	}
+
+	s.store.mu.Lock()
+	s.store.users++
+	clone := &memSpill{
+		store:      s.store,
+		limit:      s.limit,
+		slots:      make(map[int64]int64, len(s.slots)),
+		resident:   s.resident,
+		referenced: make([]uint32, len(s.referenced)),
+	}
+
+	for n, slot := range s.slots {
+		s.store.refs[slot]++
+		clone.slots[n] = slot
+	}
+	s.store.mu.Unlock()
+	return clone
+}
+
+// close releases the spilled blocks
+func (s *memSpill) close() error {
+	if s == nil {
+		return nil
+	}
+
+	for _, slot := range s.slots {
+		s.store.release(slot)
+	}
+	s.slots = nil
+	s.referenced = nil
+	s.resident = 0
+	return s.store.close()
+}
+
+// full reports whether another block would exceed the limit
+func (s *memSpill) full(blocksize int64) bool {
+	return int64(s.resident+1)*blocksize > s.limit
+}
+
+// makeRoom evicts blocks until one more fits within the limit set by
+// WithSpill.  Blocks are swept in turn and those used since the sweep last
+// passed them get a second chance.  Blocks shared with a clone or snapshot
+// are never evicted since their storage would not be released, so the limit
+// is exceeded when nothing else is left.  The block table must be locked
+func (fs *memfs) makeRoom() error {
+	s := fs.spill
+	if s == nil || !s.full(fs.blocksize) {
+		return nil
+	}
+
+	if fs.freeHeld > 0 {
+		fs.compact()
+	}
+
+	for i := 0; s.full(fs.blocksize) && i < 2*len(fs.blocks); i++ {
+		if s.hand >= len(fs.blocks) {
+			s.hand = 0
+		}
+
+		n := int64(s.hand)
+		s.hand++
+		if fs.blocks[n] == nil || fs.shared[n] {
+			continue
+		} else if s.referenced[n] != 0 {
+			s.referenced[n] = 0
+			continue
+		}
+
+		slot, err := s.store.put(fs.blocks[n])
+		if err != nil {
+			return err
+		}
+
+		fs.releaseBlock(fs.blocks[n])
+		fs.blocks[n] = nil
+		s.slots[n] = slot
+		s.resident--
+	}
+	return nil
+}
+
+// fault returns the storage of block n, reading it back from the spill file
+// when it was evicted.  The block table must be locked
+func (fs *memfs) fault(n int64) ([]byte, error) {
+	if fs.blocks[n] != nil {
+		return fs.blocks[n], nil
+	}
+
+	if err := fs.makeRoom(); err != nil {
+		return nil, err
+	}
+
+	s := fs.spill
+	slot := s.slots[n]
+	block := fs.newBlock()
+	if err := s.store.get(slot, block); err != nil {
+		fs.releaseBlock(block)
+		return nil, err
+	}
+
+	s.store.release(slot)
+	delete(s.slots, n)
+	fs.blocks[n] = block
+	s.hold(n)
+	return block, nil
+}
@@ -0,0 +1,112 @@
+package vfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestMemSpill(t *testing.T) {
+	spilled := func(fs FileSystem) (held, spilled int64) {
+		usage, _ := StatFS(fs)
+		sys := usage.Sys.(*MemUsage)
+		return sys.HeldBytes, sys.SpilledBytes
+	}
+
+	contents := func(i int) []byte {
+		return bytes.Repeat([]byte{byte('a' + i)}, int(8*blocksize)+i)
+	}
+
+	backing := NewMemFs()
+	fs := NewMemFs(WithSpill(backing, 16*blocksize))
+	for i := 0; i < 8; i++ {
+		if err := WriteFile(fs, fmt.Sprintf("/file%d", i), contents(i), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	held, before := spilled(fs)
+	if held > 16*blocksize {
+		t.Errorf("Wanted at most %d bytes held got %d", 16*blocksize, held)
+	} else if before == 0 {
+		t.Errorf("Wanted blocks to be spilled")
+	}
+
+	if names := readDirNames(t, backing, PathSeparator); len(names) != 1 {
+		t.Errorf("Wanted one spill file got %v", names)
+	}
+
+	// spilled blocks are read back in, including while they are written
+	f, _ := fs.OpenFile("/file0", RdWrFlag, 0)
+	f.WriteAt([]byte("changed"), 3*blocksize)
+	closeFile(f)
+	want := contents(0)
+	copy(want[3*blocksize:], "changed")
+	for i := 0; i < 8; i++ {
+		if i > 0 {
+			want = contents(i)
+		}
+
+		if got, err := ReadFile(fs, fmt.Sprintf("/file%d", i)); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("Wanted file%d to be intact", i)
+		}
+	}
+
+	if held, _ := spilled(fs); held > 16*blocksize {
+		t.Errorf("Wanted at most %d bytes held got %d", 16*blocksize, held)
+	}
+
+	// snapshots keep the spilled blocks they refer to
+	snapshot := fs.(interface{ Snapshot() FileSystem }).Snapshot()
+	for i := 0; i < 8; i++ {
+		fs.Remove(fmt.Sprintf("/file%d", i))
+	}
+
+	if _, after := spilled(fs); after != 0 {
+		t.Errorf("Wanted no blocks spilled got %d bytes", after)
+	}
+
+	if got, _ := ReadFile(snapshot, "/file7"); !bytes.Equal(got, contents(7)) {
+		t.Errorf("Wanted the snapshot to be intact")
+	}
+
+	fs.(io.Closer).Close()
+	if names := readDirNames(t, backing, PathSeparator); len(names) != 1 {
+		t.Errorf("Wanted the spill file to be kept for the snapshot got %v", names)
+	}
+
+	snapshot.(io.Closer).Close()
+	if names := readDirNames(t, backing, PathSeparator); len(names) != 0 {
+		t.Errorf("Wanted the spill file to be removed got %v", names)
+	}
+}
+
+func TestMemSpillConcurrent(t *testing.T) {
+	fs := NewMemFs(WithSpill(NewMemFs(), 8*blocksize))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("/file%d", i)
+			want := bytes.Repeat([]byte{byte('a' + i)}, int(10*blocksize))
+			for j := 0; j < 10; j++ {
+				if err := WriteFile(fs, name, want, 0644); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+
+				if got, err := ReadFile(fs, name); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				} else if !bytes.Equal(got, want) {
+					t.Errorf("Wanted %s to be intact", name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
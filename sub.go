@@ -0,0 +1,224 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// subfs is a FileSystem rooted at a directory of another FileSystem
+type subfs struct {
+	FileSystem
+	dir string
+}
+
+// Sub returns a FileSystem rooted at dir within fs.  Every path given to the
+// returned FileSystem is cleaned as if it were absolute before dir is
+// prepended, so ".." elements can never reach above dir.  Symbolic links are
+// resolved by fs and are not confined.  Closing the returned FileSystem does
+// not close fs
+func Sub(fs FileSystem, dir string) (FileSystem, error) {
+	dir = Clean(dir)
+	info, err := fs.Stat(dir)
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, &PathError{Op: "sub", Path: dir, Cause: ErrNotDir}
+	}
+
+	if sfs, ok := fs.(*subfs); ok {
+		return &subfs{FileSystem: sfs.FileSystem, dir: sfs.path(dir)}, nil
+	}
+	return &subfs{FileSystem: fs, dir: dir}, nil
+}
+
+// path converts a path within the sub filesystem into a path of the
+// underlying FileSystem
+func (sfs *subfs) path(name string) string {
+	return path.Join(sfs.dir, Clean(name))
+}
+
+// rel converts a path of the underlying FileSystem into a path within the
+// sub filesystem
+func (sfs *subfs) rel(name string) (string, bool) {
+	if name == sfs.dir {
+		return PathSeparator, true
+	} else if sfs.dir == PathSeparator {
+		return name, true
+	} else if strings.HasPrefix(name, sfs.dir+PathSeparator) {
+		return strings.TrimPrefix(name, sfs.dir), true
+	}
+	return name, false
+}
+
+// fixErr rewrites the paths of a PathError or LinkError so that the
+// underlying directory is not revealed
+func (sfs *subfs) fixErr(err error) error {
+	switch e := fixErr(err).(type) {
+	case *PathError:
+		rel, _ := sfs.rel(Clean(e.Path))
+		return &PathError{Op: e.Op, Path: rel, Cause: e.Cause}
+	case *LinkError:
+		oldRel, _ := sfs.rel(Clean(e.Old))
+		newRel, _ := sfs.rel(Clean(e.New))
+		return &LinkError{Op: e.Op, Old: oldRel, New: newRel, Cause: e.Cause}
+	}
+	return err
+}
+
+func (sfs *subfs) file(name string, f File, err error) (File, error) {
+	if err != nil {
+		return nil, sfs.fixErr(err)
+	}
+	return &subFile{File: f, name: name}, nil
+}
+
+func (sfs *subfs) Chmod(name string, mode os.FileMode) error {
+	return sfs.fixErr(sfs.FileSystem.Chmod(sfs.path(name), mode))
+}
+
+func (sfs *subfs) Create(name string) (File, error) {
+	f, err := sfs.FileSystem.Create(sfs.path(name))
+	return sfs.file(name, f, err)
+}
+
+func (sfs *subfs) Open(name string) (File, error) {
+	f, err := sfs.FileSystem.Open(sfs.path(name))
+	return sfs.file(name, f, err)
+}
+
+func (sfs *subfs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	f, err := sfs.FileSystem.OpenFile(sfs.path(name), flag, perm)
+	return sfs.file(name, f, err)
+}
+
+func (sfs *subfs) Mkdir(name string, perm os.FileMode) error {
+	return sfs.fixErr(sfs.FileSystem.Mkdir(sfs.path(name), perm))
+}
+
+// Remove removes the named file or directory.  The root of the sub
+// filesystem cannot be removed
+func (sfs *subfs) Remove(name string) error {
+	if Clean(name) == PathSeparator {
+		return &PathError{Op: "remove", Path: name, Cause: ErrNotSupported}
+	}
+	return sfs.fixErr(sfs.FileSystem.Remove(sfs.path(name)))
+}
+
+func (sfs *subfs) Rename(oldpath, newpath string) error {
+	return sfs.fixErr(sfs.FileSystem.Rename(sfs.path(oldpath), sfs.path(newpath)))
+}
+
+func (sfs *subfs) Lstat(name string) (os.FileInfo, error) {
+	info, err := sfs.FileSystem.Lstat(sfs.path(name))
+	return info, sfs.fixErr(err)
+}
+
+func (sfs *subfs) Stat(name string) (os.FileInfo, error) {
+	info, err := sfs.FileSystem.Stat(sfs.path(name))
+	return info, sfs.fixErr(err)
+}
+
+// Readlink returns the target of the named symbolic link if the underlying
+// FileSystem supports symbolic links
+func (sfs *subfs) Readlink(name string) (string, error) {
+	reader, ok := sfs.FileSystem.(linkReader)
+	if !ok {
+		return "", &PathError{Op: "readlink", Path: name, Cause: ErrNotSupported}
+	}
+
+	target, err := reader.Readlink(sfs.path(name))
+	return target, sfs.fixErr(err)
+}
+
+// Close does nothing, the underlying FileSystem is left open
+func (sfs *subfs) Close() error { return nil }
+
+// Watcher returns a Watcher reporting event paths relative to the sub
+// filesystem
+func (sfs *subfs) Watcher(events chan<- Event) (Watcher, error) {
+	in := make(chan Event, cap(events))
+	watcher, err := sfs.FileSystem.Watcher(in)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &subWatcher{Watcher: watcher, fs: sfs, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(sw.done)
+		for event := range in {
+			if event.Type != ErrorEvent {
+				var ok bool
+				if event.Path, ok = sfs.rel(event.Path); !ok {
+					continue
+				}
+			}
+
+			// once the watcher is closed the remaining events are
+			// dropped rather than waiting for the consumer
+			select {
+			case events <- event:
+			case <-sw.stop:
+			}
+		}
+		close(events)
+	}()
+	return sw, nil
+}
+
+// Unwrap returns the underlying FileSystem
+func (sfs *subfs) Unwrap() []FileSystem { return []FileSystem{sfs.FileSystem} }
+
+type subWatcher struct {
+	Watcher
+	fs   *subfs
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Close closes the underlying watcher and returns once the events channel
+// has been closed.  Events the consumer has not read are dropped
+func (sw *subWatcher) Close() error {
+	sw.once.Do(func() { close(sw.stop) })
+	err := sw.Watcher.Close()
+	if err == nil {
+		<-sw.done
+	}
+	return err
+}
+
+func (sw *subWatcher) Watch(name string) error {
+	return sw.fs.fixErr(sw.Watcher.Watch(sw.fs.path(name)))
+}
+
+func (sw *subWatcher) Remove(name string) error {
+	return sw.fs.fixErr(sw.Watcher.Remove(sw.fs.path(name)))
+}
+
+// subFile reports its name as it was given to the sub filesystem, or to
+// another wrapper that changes the names passed through it
+type subFile struct {
+	File
+	name string
+}
+
+func (f *subFile) Name() string { return f.name }
+
+// Close closes the underlying file if it can be closed
+func (f *subFile) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Truncate changes the size of the file if the underlying file supports it
+func (f *subFile) Truncate(size int64) error {
+	if truncater, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		return truncater.Truncate(size)
+	}
+	return &PathError{Op: "truncate", Path: f.name, Cause: ErrNotSupported}
+}
@@ -0,0 +1,167 @@
+package vfs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSub(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/a", 0755)
+	fs.Mkdir("/a/b", 0755)
+	WriteFile(fs, "/a/b/file", []byte("inside"), 0644)
+	WriteFile(fs, "/secret", []byte("outside"), 0644)
+
+	sub, err := Sub(fs, "/a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+		wantErr  error
+	}{
+		{"relative", "b/file", "inside", nil},
+		{"absolute", "/b/file", "inside", nil},
+		{"escape", "../../b/file", "inside", nil},
+		{"escape to outside", "../secret", "", ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadFile(sub, test.filename)
+			if !IsError(test.wantErr, err) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if string(got) != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+
+	if err := WriteFile(sub, "/new", []byte("new"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, err := ReadFile(fs, "/a/new"); err != nil || string(got) != "new" {
+		t.Errorf("Wanted %q got %q (%v)", "new", got, err)
+	}
+
+	f, _ := sub.Open("/b/file")
+	if f.Name() != "/b/file" {
+		t.Errorf("Wanted name %q got %q", "/b/file", f.Name())
+	}
+
+	nested, err := Sub(sub, "b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, err := ReadFile(nested, "/file"); err != nil || string(got) != "inside" {
+		t.Errorf("Wanted %q got %q (%v)", "inside", got, err)
+	}
+
+	if err = sub.Remove("/"); !IsError(ErrNotSupported, err) {
+		t.Errorf("Wanted %v got %v", ErrNotSupported, err)
+	}
+}
+
+func TestSubErrors(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/file", nil, 0644)
+
+	tests := []struct {
+		name string
+		dir  string
+		want error
+	}{
+		{"missing", "/missing", ErrNotExist},
+		{"file", "/file", ErrNotDir},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Sub(fs, test.dir); !IsError(test.want, err) {
+				t.Errorf("Wanted %v got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestSubLinkError(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/a", 0755)
+	sub, _ := Sub(fs, "/a")
+
+	err := sub.Rename("/missing", "/new")
+	if le, ok := err.(*LinkError); !ok || le.Old != "/missing" || le.New != "/new" || !IsNotExist(err) {
+		t.Errorf("Wanted the rename error relative to the sub filesystem got %v", err)
+	}
+}
+
+func TestSubWatcher(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/a", 0755)
+	sub, _ := Sub(fs, "/a")
+
+	events := make(chan Event, 1)
+	watcher, err := sub.Watcher(events)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if err = watcher.Watch("/"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	WriteFile(sub, "/file", nil, 0644)
+	select {
+	case event := <-events:
+		if event.Type != CreateEvent || event.Path != "/file" {
+			t.Errorf("Wanted create event for /file got %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Timed out waiting for event")
+	}
+
+	watcher.Close()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Errorf("Wanted events channel to be closed")
+		}
+	default:
+		t.Errorf("Wanted events channel to be closed when Close returns")
+	}
+}
+
+func TestSubWatcherUndrained(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/a", 0755)
+	sub, _ := Sub(fs, "/a")
+
+	// nothing reads the events
+	watcher, _ := sub.Watcher(make(chan Event))
+	watcher.Watch("/")
+
+	// make directories until the forwarding goroutine holds an event it
+	// cannot hand on
+	stats := watcher.(*subWatcher).Watcher.(StatWatcher)
+	for i := 0; stats.Stats().Delivered == 0; i++ {
+		if i == 1000 {
+			t.Fatalf("Wanted an event to be delivered")
+		}
+		sub.Mkdir(fmt.Sprintf("/dir%d", i), 0755)
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		watcher.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("Wanted Close to return without the events being read")
+	}
+}
@@ -0,0 +1,211 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// SyncOptions controls how Sync decides what to copy and delete
+type SyncOptions struct {
+	// Delete removes files and directories from dst that do not exist in
+	// src
+	Delete bool
+
+	// Checksum compares the contents of files that exist on both sides
+	// rather than their size and modification time
+	Checksum bool
+
+	// Delta updates changed files that already exist in dst with
+	// DeltaSync, so that only the ranges that differ are written
+	Delta bool
+}
+
+// symlinker is implemented by FileSystems that can create symbolic links
+type symlinker interface {
+	Symlink(oldname, newname string) error
+}
+
+// Sync makes the tree rooted at root in dst match the one in src.  Files
+// missing from dst are copied, as are files whose size differs or that were
+// modified in src after they were last written to dst.  With opts.Checksum
+// the contents are compared instead.  Directories are created as needed,
+// permissions are copied and so are the modification times of files when
+// dst has a Chtimes method, so that a later Sync finds them unchanged.  Symbolic links are recreated when src can read
+// and dst can create them and skipped otherwise.  Sync stops at the first
+// error, leaving dst partially synchronized
+func Sync(dst, src FileSystem, root string, opts SyncOptions) error {
+	err := Walk(src, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return syncEntry(dst, src, name, info, opts)
+	})
+
+	if err == nil && opts.Delete {
+		err = Walk(dst, root, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if _, err = src.Lstat(name); IsNotExist(err) {
+				if err = RemoveAll(dst, name); err == nil && info.IsDir() {
+					err = ErrSkipDir
+				}
+			}
+			return err
+		})
+	}
+	return fixErr(err)
+}
+
+// syncEntry brings a single file, directory or link in dst up to date
+func syncEntry(dst, src FileSystem, name string, info os.FileInfo, opts SyncOptions) error {
+	current, err := dst.Lstat(name)
+	if err == nil && current.Mode().Type() != info.Mode().Type() {
+		// replace entries that changed type
+		current, err = nil, RemoveAll(dst, name)
+	} else if IsNotExist(err) {
+		current, err = nil, nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		if current == nil {
+			return dst.Mkdir(name, mode.Perm())
+		}
+	case mode&os.ModeSymlink != 0:
+		return syncLink(dst, src, name, current)
+	case mode.IsRegular():
+		changed := current == nil
+		if !changed && opts.Checksum {
+			var equal bool
+			equal, err = equalContents(dst, src, name)
+			changed = !equal
+		} else if !changed {
+			changed = current.Size() != info.Size() || info.ModTime().After(current.ModTime())
+		}
+
+		if err != nil || !changed {
+			break
+		} else if opts.Delta && current != nil {
+			if _, err = DeltaSync(dst, src, name, 0); err == nil {
+				err = dst.Chmod(name, mode.Perm())
+			}
+		} else {
+			err = syncFile(dst, src, name, mode.Perm())
+		}
+
+		if err == nil {
+			err = setModTime(dst, name, info.ModTime())
+		}
+		return err
+	default:
+		// devices, pipes and sockets are not copied
+		return nil
+	}
+
+	if err != nil {
+		return err
+	} else if current.Mode().Perm() != info.Mode().Perm() {
+		return dst.Chmod(name, info.Mode().Perm())
+	}
+	return nil
+}
+
+// syncFile copies the contents of a file from src to dst
+func syncFile(dst, src FileSystem, name string, perm os.FileMode) error {
+	w, err := dst.OpenFile(name, WrOnlyFlag|CreateFlag|TruncFlag, perm)
+	if err != nil {
+		return err
+	}
+
+	err = copyTo(w, src, name)
+	if closer, ok := w.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+
+	if err == nil {
+		// the permissions of a file that already existed are not changed
+		// by OpenFile
+		err = dst.Chmod(name, perm)
+	}
+	return err
+}
+
+// syncLink recreates a symbolic link of src in dst
+func syncLink(dst, src FileSystem, name string, current os.FileInfo) error {
+	reader, ok := src.(linkReader)
+	linker, ok1 := dst.(symlinker)
+	if !ok || !ok1 {
+		return nil
+	}
+
+	target, err := reader.Readlink(name)
+	if err != nil {
+		return err
+	}
+
+	if current != nil {
+		if dstReader, ok := dst.(linkReader); ok {
+			if existing, err := dstReader.Readlink(name); err == nil && existing == target {
+				return nil
+			}
+		}
+
+		if err = dst.Remove(name); err != nil {
+			return err
+		}
+	}
+	return linker.Symlink(target, name)
+}
+
+// equalContents reports whether the named file has the same contents in
+// both FileSystems
+func equalContents(a, b FileSystem, name string) (bool, error) {
+	fa, err := a.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer closeFile(fa)
+
+	fb, err := b.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer closeFile(fb)
+
+	bufa, bufb := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		na, erra := io.ReadFull(fa, bufa)
+		nb, errb := io.ReadFull(fb, bufb)
+		if !bytes.Equal(bufa[:na], bufb[:nb]) {
+			return false, nil
+		}
+
+		enda := erra == io.EOF || erra == io.ErrUnexpectedEOF
+		endb := errb == io.EOF || errb == io.ErrUnexpectedEOF
+		if enda && endb {
+			return true, nil
+		} else if erra != nil && !enda {
+			return false, erra
+		} else if errb != nil && !endb {
+			return false, errb
+		} else if enda != endb {
+			return false, nil
+		}
+	}
+}
+
+// closeFile closes f if it can be closed
+func closeFile(f File) {
+	if closer, ok := f.(io.Closer); ok {
+		closer.Close()
+	}
+}
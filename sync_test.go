@@ -0,0 +1,151 @@
+package vfs
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// syncTree returns the paths beneath root with their contents, or the
+// link target for symbolic links
+func syncTree(t *testing.T, fs FileSystem, root string) map[string]string {
+	tree := make(map[string]string)
+	Walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			tree[name], _ = fs.(linkReader).Readlink(name)
+		case info.Mode().IsRegular():
+			data, _ := ReadFile(fs, name)
+			tree[name] = string(data)
+		default:
+			tree[name] = info.Mode().String()
+		}
+		return nil
+	})
+	return tree
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SyncOptions
+	}{
+		{"size and time", SyncOptions{Delete: true}},
+		{"checksum", SyncOptions{Delete: true, Checksum: true}},
+		{"delta", SyncOptions{Delete: true, Delta: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src, dst := NewMemFs(), NewMemFs()
+			MkdirAll(src, "/root/dir", 0700)
+			WriteFile(src, "/root/new", []byte("new"), 0600)
+			WriteFile(src, "/root/changed", []byte("same size"), 0644)
+			WriteFile(src, "/root/dir/file", []byte("file"), 0644)
+			WriteFile(src, "/root/was dir", []byte("now a file"), 0644)
+			src.(symlinker).Symlink("dir/file", "/root/link")
+
+			MkdirAll(dst, "/root/extra/sub", 0755)
+			MkdirAll(dst, "/root/was dir", 0755)
+			WriteFile(dst, "/root/changed", []byte("SAME SIZE"), 0644)
+			WriteFile(dst, "/outside", nil, 0644)
+			if !test.opts.Checksum {
+				// make the source newer than the copy
+				WriteFile(src, "/root/changed", []byte("same size"), 0644)
+			}
+
+			if err := Sync(dst, src, "/root", test.opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			want, got := syncTree(t, src, "/root"), syncTree(t, dst, "/root")
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Wanted %v got %v", want, got)
+			}
+
+			if exists, _ := Exists(dst, "/outside"); !exists {
+				t.Errorf("Wanted files outside of root to be kept")
+			}
+		})
+	}
+}
+
+func TestSyncUnchanged(t *testing.T) {
+	src, dst := NewMemFs(), NewMemFs()
+	WriteFile(src, "/file", []byte("source"), 0644)
+	WriteFile(dst, "/file", []byte("target"), 0644)
+	WriteFile(dst, "/extra", nil, 0644)
+
+	// the target is newer and the same size so it is left alone
+	if err := Sync(dst, src, "/", SyncOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(dst, "/file"); string(got) != "target" {
+		t.Errorf("Wanted %q got %q", "target", got)
+	}
+
+	if exists, _ := Exists(dst, "/extra"); !exists {
+		t.Errorf("Wanted extra file to be kept without Delete")
+	}
+}
+
+func TestSyncDelta(t *testing.T) {
+	data := make([]byte, 4*DefaultBlockSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	src, mem := NewMemFs(), NewMemFs()
+	WriteFile(mem, "/file", data, 0644)
+	data[len(data)-1]++
+	WriteFile(src, "/file", data, 0644)
+
+	written := 0
+	dst := WithHooks(mem, Hooks{AfterWrite: func(op Op, p []byte, n int, err error) { written += n }})
+	if err := Sync(dst, src, "/", SyncOptions{Delta: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(mem, "/file"); !bytes.Equal(data, got) {
+		t.Errorf("Wanted the file to be synchronized")
+	}
+
+	if written == 0 || written >= len(data) {
+		t.Errorf("Wanted only the changed block written got %d bytes", written)
+	}
+}
+
+func TestSyncModTime(t *testing.T) {
+	src, dst := NewMemFs(), NewMemFs()
+	WriteFile(src, "/file", []byte("content"), 0644)
+	old := time.Now().Add(-time.Hour)
+	src.(chtimer).Chtimes("/file", old, old)
+
+	if err := Sync(dst, src, "/", SyncOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if info, _ := dst.Stat("/file"); !info.ModTime().Equal(old) {
+		t.Errorf("Wanted %v got %v", old, info.ModTime())
+	}
+
+	// nothing is copied again
+	opens := 0
+	hooked := WithHooks(src, Hooks{BeforeOpen: func(op Op) error {
+		if op.Path == "/file" {
+			opens++
+		}
+		return nil
+	}})
+	if err := Sync(dst, hooked, "/", SyncOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if opens != 0 {
+		t.Errorf("Wanted no files opened got %d", opens)
+	}
+}
@@ -0,0 +1,150 @@
+package vfs
+
+import (
+	"io"
+	"path"
+	"sync"
+	"time"
+)
+
+// tailPollInterval is how often a TailReader checks for new data when no
+// event has woken it, either because the FileSystem cannot watch or
+// because an event was dropped
+const tailPollInterval = time.Second
+
+// TailReader reads data as it is appended to a file, like tail -f.  Read
+// blocks until new data has been written or the reader is closed
+type TailReader struct {
+	file    File
+	name    string
+	watcher Watcher
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Tail opens the named file for following.  Reading starts at the current
+// end of the file, Seek back to read what was written earlier.  The
+// FileSystem's Watcher is used to wake up readers as soon as data is written
+// and FileSystems that cannot watch are polled.  A file that is truncated
+// while being followed is read again from the start.  Files that are
+// replaced, for instance by log rotation, are not followed to the new file
+func Tail(fs FileSystem, name string) (*TailReader, error) {
+	name = Clean(name)
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, fixErr(err)
+	}
+
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		closeFile(f)
+		return nil, fixErr(err)
+	}
+
+	tr := &TailReader{
+		file: f,
+		name: name,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	events := make(chan Event, 16)
+	if watcher, err := fs.Watcher(events); err == nil {
+		if err = watcher.Watch(path.Dir(name)); err == nil {
+			tr.watcher = watcher
+			go tr.listen(events)
+		} else {
+			watcher.Close()
+		}
+	}
+	return tr, nil
+}
+
+// listen wakes up the reader whenever the file changes
+func (tr *TailReader) listen(events <-chan Event) {
+	for event := range events {
+		if event.Path == tr.name || event.Type == ErrorEvent || event.Type == OverflowEvent {
+			select {
+			case tr.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Read reads the next data appended to the file, waiting for it to be
+// written if necessary.  Once the reader is closed Read returns io.EOF.
+// Read must not be called from more than one goroutine at a time
+func (tr *TailReader) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-tr.done:
+			return 0, io.EOF
+		default:
+		}
+
+		n, err := tr.file.Read(p)
+		if n == 0 && (err == nil || err == io.EOF) {
+			err = tr.rewind()
+		}
+
+		if n > 0 {
+			return n, nil
+		} else if err != nil {
+			select {
+			case <-tr.done:
+				// the file was closed while reading
+				return 0, io.EOF
+			default:
+				return 0, fixErr(err)
+			}
+		}
+
+		timer := time.NewTimer(tailPollInterval)
+		select {
+		case <-tr.wake:
+		case <-timer.C:
+		case <-tr.done:
+		}
+		timer.Stop()
+	}
+}
+
+// rewind starts reading from the beginning again if the file has been
+// truncated below the read offset
+func (tr *TailReader) rewind() error {
+	offset, err := tr.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	info, err := tr.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() < offset {
+		_, err = tr.file.Seek(0, io.SeekStart)
+	}
+	return err
+}
+
+// Seek sets the offset of the next Read
+func (tr *TailReader) Seek(offset int64, whence int) (int64, error) {
+	return tr.file.Seek(offset, whence)
+}
+
+// Close stops following the file, any blocked Read returns io.EOF
+func (tr *TailReader) Close() (err error) {
+	tr.once.Do(func() {
+		close(tr.done)
+		if tr.watcher != nil {
+			tr.watcher.Close()
+		}
+
+		if closer, ok := tr.file.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,91 @@
+package vfs
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// readTail reads from the TailReader until want bytes have arrived
+func readTail(t *testing.T, tr *TailReader, want string) {
+	t.Helper()
+	got := make([]byte, len(want))
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(tr, got)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if string(got) != want {
+			t.Errorf("Wanted %q got %q", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %q", want)
+	}
+}
+
+func TestTail(t *testing.T) {
+	tempfs := NewTempFs()
+	defer tempfs.Close()
+
+	tests := []struct {
+		name string
+		fs   FileSystem
+	}{
+		{"memfs", NewMemFs()},
+		{"osfs", tempfs},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			WriteFile(test.fs, "/log", []byte("old\n"), 0644)
+			tr, err := Tail(test.fs, "/log")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer tr.Close()
+
+			f, _ := test.fs.OpenFile("/log", WrOnlyFlag|AppendFlag, 0)
+			f.Write([]byte("first\n"))
+			readTail(t, tr, "first\n")
+
+			f.Write([]byte("second\n"))
+			readTail(t, tr, "second\n")
+			closeFile(f)
+
+			// truncated files are read from the start
+			WriteFile(test.fs, "/log", []byte("new\n"), 0644)
+			readTail(t, tr, "new\n")
+		})
+	}
+}
+
+func TestTailClose(t *testing.T) {
+	fs := NewMemFs()
+	WriteFile(fs, "/log", []byte("old"), 0644)
+	tr, _ := Tail(fs, "/log")
+
+	done := make(chan error)
+	go func() {
+		_, err := tr.Read(make([]byte, 1))
+		done <- err
+	}()
+
+	tr.Close()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Wanted %v got %v", io.EOF, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for Read to return")
+	}
+
+	if _, err := Tail(fs, "/missing"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
@@ -0,0 +1,295 @@
+package vfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxLinks is the number of symbolic links followed while resolving a
+// path before giving up
+const maxLinks = 40
+
+// tarEntry is a single indexed member of a tarball.  Regular file contents
+// are read directly from the tarball at offset unless the member is stored
+// sparse, in which case data holds the expanded contents
+type tarEntry struct {
+	hdr      *tar.Header
+	offset   int64
+	data     []byte
+	children []string
+}
+
+// tarIndex is an io/fs.FS over an indexed tarball
+type tarIndex struct {
+	r       io.ReaderAt
+	entries map[string]*tarEntry
+}
+
+// tarfs is a read-only FileSystem backed by a tarball
+type tarfs struct {
+	FileSystem
+	index *tarIndex
+}
+
+// NewTarFs indexes the uncompressed tarball in r, of the given size, and
+// returns a read-only FileSystem serving its contents.  File data is read
+// from r on demand so r must remain usable for the life of the FileSystem.
+// Directories missing from the tarball are implied by the paths of their
+// children.  Any operation that would modify the filesystem returns
+// ErrReadOnly
+func NewTarFs(r io.ReaderAt, size int64) (FileSystem, error) {
+	index := &tarIndex{r: r, entries: make(map[string]*tarEntry)}
+	index.entries["."] = &tarEntry{hdr: &tar.Header{Name: ".", Typeflag: tar.TypeDir, Mode: 0755}}
+
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := cleanTarName(hdr.Name)
+		if name == "." {
+			continue
+		}
+
+		entry := &tarEntry{hdr: hdr}
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			target, found := index.entries[cleanTarName(hdr.Linkname)]
+			if !found {
+				return nil, &PathError{Op: "link", Path: hdr.Linkname, Cause: ErrNotExist}
+			}
+			linked := *target.hdr
+			entry = &tarEntry{hdr: &linked, offset: target.offset, data: target.data}
+		case tar.TypeReg, tar.TypeGNUSparse:
+			if isSparse(hdr) {
+				if entry.data, err = io.ReadAll(tr); err != nil {
+					return nil, err
+				}
+			} else if entry.offset, err = sr.Seek(0, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		entry.hdr.Name = name
+		index.add(name, entry)
+	}
+
+	for _, entry := range index.entries {
+		sort.Strings(entry.children)
+	}
+	return &tarfs{FileSystem: FromIoFS(index), index: index}, nil
+}
+
+// isSparse reports whether a member's data must be expanded by tar.Reader
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanTarName converts a tar member name into the unrooted form used
+// by io/fs
+func cleanTarName(name string) string {
+	name = strings.TrimPrefix(Clean(name), PathSeparator)
+	if name == "" {
+		name = "."
+	}
+	return name
+}
+
+// add inserts an entry, creating any missing parent directories
+func (index *tarIndex) add(name string, entry *tarEntry) {
+	if existing, found := index.entries[name]; found {
+		// later members replace earlier ones, but directories keep
+		// their children
+		entry.children = existing.children
+	} else {
+		dir := path.Dir(name)
+		parent, found := index.entries[dir]
+		if !found {
+			parent = &tarEntry{hdr: &tar.Header{Name: dir, Typeflag: tar.TypeDir, Mode: 0755}}
+			index.add(dir, parent)
+		}
+		parent.children = append(parent.children, path.Base(name))
+	}
+	index.entries[name] = entry
+}
+
+// resolve finds the entry for name following symbolic links in every
+// component and, when follow is set, in the final component
+func (index *tarIndex) resolve(op, name string, follow bool) (string, *tarEntry, error) {
+	current := "."
+	entry := index.entries[current]
+	remaining := strings.Split(cleanTarName(name), PathSeparator)
+	for links := 0; len(remaining) > 0; {
+		component := remaining[0]
+		remaining = remaining[1:]
+		if component == "." {
+			continue
+		}
+
+		next := path.Join(current, component)
+		found, ok := index.entries[next]
+		if !ok {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+
+		if found.hdr.Typeflag == tar.TypeSymlink && (len(remaining) > 0 || follow) {
+			if links++; links > maxLinks {
+				return "", nil, &fs.PathError{Op: op, Path: name, Err: ErrLoop}
+			}
+
+			target := found.hdr.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(current, target)
+			}
+			remaining = append(strings.Split(cleanTarName(target), PathSeparator), remaining...)
+			current, entry = ".", index.entries["."]
+			continue
+		}
+
+		if len(remaining) > 0 && found.hdr.Typeflag != tar.TypeDir {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: ErrNotDir}
+		}
+		current, entry = next, found
+	}
+	return current, entry, nil
+}
+
+func (index *tarIndex) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	resolved, entry, err := index.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &tarFile{index: index, name: resolved, entry: entry}
+	if entry.data != nil {
+		f.SectionReader = io.NewSectionReader(bytes.NewReader(entry.data), 0, int64(len(entry.data)))
+	} else {
+		f.SectionReader = io.NewSectionReader(index.r, entry.offset, entry.hdr.Size)
+	}
+	return f, nil
+}
+
+// tarFile is an open member of a tarball
+type tarFile struct {
+	*io.SectionReader
+	index *tarIndex
+	name  string
+	entry *tarEntry
+	pos   int
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry.hdr.FileInfo(), nil }
+
+func (f *tarFile) Close() error { return nil }
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if f.entry.hdr.Typeflag == tar.TypeDir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: ErrIsDir}
+	}
+	return f.SectionReader.Read(p)
+}
+
+// ReadDir returns the directory entries in name order
+func (f *tarFile) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	if f.entry.hdr.Typeflag != tar.TypeDir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: ErrNotDir}
+	}
+
+	children := f.entry.children[f.pos:]
+	if n > 0 && len(children) > n {
+		children = children[:n]
+	}
+
+	for _, child := range children {
+		info := f.index.entries[path.Join(f.name, child)].hdr.FileInfo()
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	f.pos += len(children)
+
+	if n > 0 && len(entries) == 0 {
+		err = io.EOF
+	}
+	return entries, err
+}
+
+// Lstat returns a FileInfo describing the named file without following a
+// final symbolic link
+func (tfs *tarfs) Lstat(filename string) (os.FileInfo, error) {
+	_, entry, err := tfs.index.resolve("lstat", filename, false)
+	if err != nil {
+		return nil, fixErr(err)
+	}
+	return entry.hdr.FileInfo(), nil
+}
+
+// Readlink returns the target of the named symbolic link
+func (tfs *tarfs) Readlink(filename string) (string, error) {
+	_, entry, err := tfs.index.resolve("readlink", filename, false)
+	if err != nil {
+		return "", fixErr(err)
+	}
+
+	if entry.hdr.Typeflag != tar.TypeSymlink {
+		return "", &PathError{Op: "readlink", Path: filename, Cause: ErrNotExist}
+	}
+	return entry.hdr.Linkname, nil
+}
+
+// WriteTar streams the tree rooted at root to tw with member names relative
+// to root.  Modes and modification times are preserved and symbolic links
+// are stored as links when the FileSystem can read them.  The tar.Writer is
+// not closed so that more members may be added
+func WriteTar(fs FileSystem, root string, tw *tar.Writer) error {
+	return Walk(fs, root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || filename == root {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if reader, ok := fs.(linkReader); ok {
+				if link, err = reader.Readlink(filename); err != nil {
+					return err
+				}
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = Rel(root, filename)
+		if info.IsDir() {
+			hdr.Name += PathSeparator
+		}
+
+		if err = tw.WriteHeader(hdr); err == nil && info.Mode().IsRegular() {
+			err = copyTo(tw, fs, filename)
+		}
+		return err
+	})
+}
@@ -0,0 +1,131 @@
+package vfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testTarball(t *testing.T) *bytes.Reader {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	members := []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0750}, ""},
+		{tar.Header{Name: "dir/one.txt", Typeflag: tar.TypeReg, Mode: 0640}, "one"},
+		{tar.Header{Name: "implied/two.txt", Typeflag: tar.TypeReg, Mode: 0600}, "two"},
+		{tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/one.txt"}, ""},
+		{tar.Header{Name: "dirlink", Typeflag: tar.TypeSymlink, Linkname: "/implied"}, ""},
+		{tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "implied/two.txt"}, ""},
+	}
+
+	for _, member := range members {
+		member.hdr.Size = int64(len(member.data))
+		if err := tw.WriteHeader(&member.hdr); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		io.WriteString(tw, member.data)
+	}
+	tw.Close()
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestTarFs(t *testing.T) {
+	r := testTarball(t)
+	fs, err := NewTarFs(r, r.Size())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"/dir/one.txt", "one", nil},
+		{"/implied/two.txt", "two", nil},
+		{"/link", "one", nil},
+		{"/dirlink/two.txt", "two", nil},
+		{"/hard", "two", nil},
+		{"/missing", "", ErrNotExist},
+		{"/dir/one.txt/sub", "", ErrNotDir},
+	}
+
+	for _, test := range tests {
+		got, err := ReadFile(fs, test.name)
+		if !IsError(test.wantErr, err) {
+			t.Errorf("%s: wanted error %v got %v", test.name, test.wantErr, err)
+		} else if string(got) != test.want {
+			t.Errorf("%s: wanted %q got %q", test.name, test.want, got)
+		}
+	}
+
+	if fi, err := fs.Lstat("/link"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Wanted symlink got %v %v", fi, err)
+	}
+
+	if fi, err := fs.Stat("/dir"); err != nil || fi.Mode() != os.ModeDir|0750 {
+		t.Errorf("Wanted dir with mode 0750 got %v %v", fi, err)
+	}
+
+	if target, err := fs.(linkReader).Readlink("/link"); err != nil || target != "dir/one.txt" {
+		t.Errorf("Wanted link target dir/one.txt got %q %v", target, err)
+	}
+
+	d, _ := fs.Open("/")
+	names, _ := d.Readdirnames(-1)
+	want := []string{"dir", "dirlink", "hard", "implied", "link"}
+	if !reflect.DeepEqual(want, names) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+
+	if err := fs.Mkdir("/new", 0755); !IsError(ErrReadOnly, err) {
+		t.Errorf("Wanted ErrReadOnly got %v", err)
+	}
+}
+
+func TestWriteTar(t *testing.T) {
+	src := NewTempFs()
+	defer src.Close()
+	MkdirAll(src, "/root/dir", 0750)
+	WriteFile(src, "/root/one.txt", []byte("one"), 0640)
+	WriteFile(src, "/root/dir/two.txt", []byte("two"), 0600)
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := WriteTar(src, "/root", tw); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tw.Close()
+
+	fs, err := NewTarFs(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got []string
+	Walk(fs, "/", func(filename string, info os.FileInfo, err error) error {
+		want, _ := src.Stat("/root" + filename)
+		if filename != "/" && info.Mode() != want.Mode() {
+			t.Errorf("%s: wanted mode %v got %v", filename, want.Mode(), info.Mode())
+		}
+		got = append(got, filename)
+		return err
+	})
+	sort.Strings(got)
+
+	want := []string{"/", "/dir", "/dir/two.txt", "/one.txt"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	if data, _ := ReadFile(fs, "/dir/two.txt"); string(data) != "two" {
+		t.Errorf("Wanted two got %q", data)
+	}
+}
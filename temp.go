@@ -28,3 +28,7 @@ func (tfs *tempfs) Close() error {
 	}
 	return err
 }
+
+func (tfs *tempfs) CloneFile(src, dst string) error {
+	return CloneFile(tfs.FileSystem, src, dst)
+}
@@ -0,0 +1,84 @@
+package vfs
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"text/template"
+)
+
+// parseTemplateFiles globs each pattern and calls parse with the base name
+// and contents of every matching file, in the same way template.ParseFS does
+func parseTemplateFiles(fs FileSystem, patterns []string, parse func(name, text string) error) error {
+	var filenames []string
+	for _, pattern := range patterns {
+		matches, err := Glob(fs, pattern)
+		if err != nil {
+			return err
+		}
+
+		if len(matches) == 0 {
+			return fmt.Errorf("template: pattern matches no files: %#q", pattern)
+		}
+		filenames = append(filenames, matches...)
+	}
+
+	for _, filename := range filenames {
+		data, err := ReadFile(fs, filename)
+		if err == nil {
+			err = parse(path.Base(filename), string(data))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseTemplates creates a new text/template and parses the template
+// definitions from the files in fs matching patterns.  The returned
+// template's name will have the base name and parsed contents of the first
+// file.  There must be at least one matching file
+func ParseTemplates(fs FileSystem, patterns ...string) (*template.Template, error) {
+	var t *template.Template
+	err := parseTemplateFiles(fs, patterns, func(name, text string) (err error) {
+		if t == nil {
+			t = template.New(name)
+		}
+
+		tmpl := t
+		if name != t.Name() {
+			tmpl = t.New(name)
+		}
+		_, err = tmpl.Parse(text)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParseHTMLTemplates is the html/template equivalent of ParseTemplates
+func ParseHTMLTemplates(fs FileSystem, patterns ...string) (*htmltemplate.Template, error) {
+	var t *htmltemplate.Template
+	err := parseTemplateFiles(fs, patterns, func(name, text string) (err error) {
+		if t == nil {
+			t = htmltemplate.New(name)
+		}
+
+		tmpl := t
+		if name != t.Name() {
+			tmpl = t.New(name)
+		}
+		_, err = tmpl.Parse(text)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,39 @@
+package vfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseTemplates(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/templates/partials", 0755)
+	WriteFile(fs, "/templates/page.tmpl", []byte(`<p>{{template "greeting.tmpl" .}}</p>`), 0644)
+	WriteFile(fs, "/templates/partials/greeting.tmpl", []byte(`hello {{.}}`), 0644)
+
+	text, err := ParseTemplates(fs, "/templates/*.tmpl", "/templates/partials/*.tmpl")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	text.Execute(buf, "<world>")
+	if want := "<p>hello <world></p>"; buf.String() != want {
+		t.Errorf("Wanted %q got %q", want, buf.String())
+	}
+
+	html, err := ParseHTMLTemplates(fs, "/templates/*.tmpl", "/templates/partials/*.tmpl")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf.Reset()
+	html.Execute(buf, "<world>")
+	if want := "<p>hello &lt;world&gt;</p>"; buf.String() != want {
+		t.Errorf("Wanted %q got %q", want, buf.String())
+	}
+
+	if _, err := ParseTemplates(fs, "/missing/*.tmpl"); err == nil {
+		t.Errorf("Expected an error for a pattern with no matches")
+	}
+}
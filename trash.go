@@ -0,0 +1,333 @@
+package vfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrashDir is the directory a TrashFs keeps removed entries in
+const TrashDir = "/.trash"
+
+// TrashEntry describes an entry that was moved to the trash
+type TrashEntry struct {
+	// Path is where the entry was before it was removed
+	Path string
+
+	// Removed is when the entry was moved to the trash
+	Removed time.Time
+
+	id int
+}
+
+// TrashFs moves what is removed to a trash directory on the same
+// FileSystem rather than deleting it, so that it can be restored until the
+// trash is emptied or GC deletes it.  The trash directory is hidden from listings of the
+// root directory and cannot be reached through the TrashFs, operations on
+// it fail with ErrPermission
+type TrashFs struct {
+	FileSystem
+
+	// mu serializes moving entries in and out of the trash, next is the
+	// number given to the next entry and zero until the trash is read
+	mu   sync.Mutex
+	next int
+}
+
+// NewTrashFs returns a TrashFs keeping removed entries of fs in TrashDir
+func NewTrashFs(fs FileSystem) *TrashFs {
+	return &TrashFs{FileSystem: fs}
+}
+
+// trashed reports whether name is the trash directory or inside it
+func trashed(name string) bool {
+	name = Clean(name)
+	return name == TrashDir || strings.HasPrefix(name, TrashDir+PathSeparator)
+}
+
+// trashFile and trashInfo return where the entry with the given id and the
+// path it was removed from are kept
+func trashFile(id int) string { return path.Join(TrashDir, "files", strconv.Itoa(id)) }
+func trashInfo(id int) string { return path.Join(TrashDir, "info", strconv.Itoa(id)) }
+
+// Trash returns the entries in the trash, most recently removed first
+func (tfs *TrashFs) Trash() ([]TrashEntry, error) {
+	tfs.mu.Lock()
+	defer tfs.mu.Unlock()
+	return tfs.entries()
+}
+
+// entries reads the trash, the trash must be locked
+func (tfs *TrashFs) entries() ([]TrashEntry, error) {
+	infos, err := readDir(tfs.FileSystem, path.Join(TrashDir, "info"))
+	if IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []TrashEntry
+	for _, info := range infos {
+		id, err := strconv.Atoi(info.Name())
+		if err != nil {
+			continue
+		}
+
+		data, err := ReadFile(tfs.FileSystem, trashInfo(id))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, TrashEntry{Path: strings.TrimSpace(string(data)), Removed: info.ModTime(), id: id})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id > entries[j].id })
+	return entries, nil
+}
+
+// Remove moves the named file or empty directory to the trash
+func (tfs *TrashFs) Remove(name string) error {
+	if trashed(name) || Clean(name) == PathSeparator {
+		return &PathError{Op: "remove", Path: name, Cause: ErrPermission}
+	}
+
+	tfs.mu.Lock()
+	defer tfs.mu.Unlock()
+	info, err := tfs.FileSystem.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if infos, err := readDir(tfs.FileSystem, name); err != nil {
+			return err
+		} else if len(infos) > 0 {
+			return &PathError{Op: "remove", Path: name, Cause: ErrNotEmpty}
+		}
+	}
+
+	if tfs.next == 0 {
+		entries, err := tfs.entries()
+		if err != nil {
+			return err
+		}
+
+		tfs.next = 1
+		if len(entries) > 0 {
+			tfs.next = entries[0].id + 1
+		}
+	}
+
+	id := tfs.next
+	for _, dir := range []string{path.Dir(trashFile(id)), path.Dir(trashInfo(id))} {
+		if err = MkdirAll(tfs.FileSystem, dir, 0700); err != nil {
+			return err
+		}
+	}
+
+	if err = WriteFile(tfs.FileSystem, trashInfo(id), []byte(Clean(name)+"\n"), 0600); err != nil {
+		return err
+	}
+
+	if err = tfs.FileSystem.Rename(name, trashFile(id)); err != nil {
+		tfs.FileSystem.Remove(trashInfo(id))
+		return err
+	}
+	tfs.next++
+	return nil
+}
+
+// Restore moves the entry most recently removed from the named path out of
+// the trash and back to where it was, creating any missing parent
+// directories.  Restoring fails with ErrExist if the path has been reused
+func (tfs *TrashFs) Restore(name string) error {
+	tfs.mu.Lock()
+	defer tfs.mu.Unlock()
+	entries, err := tfs.entries()
+	if err != nil {
+		return err
+	}
+
+	name = Clean(name)
+	for _, entry := range entries {
+		if entry.Path != name {
+			continue
+		}
+
+		if _, err = tfs.FileSystem.Lstat(name); err == nil {
+			return &PathError{Op: "restore", Path: name, Cause: ErrExist}
+		} else if !IsNotExist(err) {
+			return err
+		}
+
+		if err = MkdirAll(tfs.FileSystem, path.Dir(name), 0755); err != nil {
+			return err
+		}
+
+		if err = tfs.FileSystem.Rename(trashFile(entry.id), name); err != nil {
+			return err
+		}
+		return tfs.FileSystem.Remove(trashInfo(entry.id))
+	}
+	return &PathError{Op: "restore", Path: name, Cause: ErrNotExist}
+}
+
+// EmptyTrash deletes everything in the trash for good
+func (tfs *TrashFs) EmptyTrash() error {
+	tfs.mu.Lock()
+	defer tfs.mu.Unlock()
+	err := RemoveAll(tfs.FileSystem, TrashDir)
+	if err == nil {
+		tfs.next = 0
+	}
+	return err
+}
+
+// GC deletes the entries that have been in the trash for at least
+// policy.MinAge for good, the oldest first, until what is left in the trash
+// takes up no more than policy.TargetBytes
+func (tfs *TrashFs) GC(ctx context.Context, policy GCPolicy) (report GCReport, err error) {
+	tfs.mu.Lock()
+	defer tfs.mu.Unlock()
+	entries, err := tfs.entries()
+	if err != nil {
+		return report, err
+	}
+
+	sizes := make([]int64, len(entries))
+	total := int64(0)
+	for i, entry := range entries {
+		if info, err := tfs.FileSystem.Lstat(trashFile(entry.id)); err == nil && info.Mode().IsRegular() {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+
+	now := time.Now()
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if policy.TargetBytes > 0 && total <= policy.TargetBytes {
+			break
+		} else if policy.MinAge > 0 && now.Sub(entry.Removed) < policy.MinAge {
+			// the rest of the entries were removed more recently
+			break
+		} else if err = ctx.Err(); err != nil {
+			break
+		}
+
+		if !policy.DryRun {
+			if err = RemoveAll(tfs.FileSystem, trashFile(entry.id)); err == nil {
+				err = tfs.FileSystem.Remove(trashInfo(entry.id))
+			}
+
+			if err != nil {
+				break
+			}
+		}
+		total -= sizes[i]
+		report.Items = append(report.Items, GCItem{Layer: "trash", Path: entry.Path, Bytes: sizes[i]})
+		report.Bytes += sizes[i]
+	}
+	return report, err
+}
+
+func (tfs *TrashFs) Create(name string) (File, error) {
+	return tfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (tfs *TrashFs) Open(name string) (File, error) {
+	return tfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+func (tfs *TrashFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if trashed(name) {
+		return nil, &PathError{Op: "open", Path: name, Cause: ErrPermission}
+	}
+
+	f, err := tfs.FileSystem.OpenFile(name, flag, perm)
+	if err == nil && Clean(name) == PathSeparator {
+		f = &trashRoot{File: f}
+	}
+	return f, err
+}
+
+func (tfs *TrashFs) Mkdir(name string, perm os.FileMode) error {
+	if trashed(name) {
+		return &PathError{Op: "mkdir", Path: name, Cause: ErrPermission}
+	}
+	return tfs.FileSystem.Mkdir(name, perm)
+}
+
+func (tfs *TrashFs) Chmod(name string, mode os.FileMode) error {
+	if trashed(name) {
+		return &PathError{Op: "chmod", Path: name, Cause: ErrPermission}
+	}
+	return tfs.FileSystem.Chmod(name, mode)
+}
+
+func (tfs *TrashFs) Rename(oldpath, newpath string) error {
+	if trashed(oldpath) || trashed(newpath) {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: ErrPermission}
+	}
+	return tfs.FileSystem.Rename(oldpath, newpath)
+}
+
+func (tfs *TrashFs) Lstat(name string) (os.FileInfo, error) {
+	if trashed(name) {
+		return nil, &PathError{Op: "lstat", Path: name, Cause: ErrPermission}
+	}
+	return tfs.FileSystem.Lstat(name)
+}
+
+func (tfs *TrashFs) Stat(name string) (os.FileInfo, error) {
+	if trashed(name) {
+		return nil, &PathError{Op: "stat", Path: name, Cause: ErrPermission}
+	}
+	return tfs.FileSystem.Stat(name)
+}
+
+// Unwrap returns the underlying FileSystem
+func (tfs *TrashFs) Unwrap() []FileSystem { return []FileSystem{tfs.FileSystem} }
+
+// trashRoot leaves the trash directory out of listings of the root
+type trashRoot struct {
+	File
+}
+
+func (f *trashRoot) Readdir(n int) ([]os.FileInfo, error) {
+	for {
+		infos, err := f.File.Readdir(n)
+		kept := infos[:0]
+		for _, info := range infos {
+			if info.Name() != path.Base(TrashDir) {
+				kept = append(kept, info)
+			}
+		}
+
+		// a batch holding only the trash is skipped rather than returned
+		// empty, which would look like the end of the directory
+		if len(kept) > 0 || err != nil || n <= 0 {
+			return kept, err
+		}
+	}
+}
+
+func (f *trashRoot) Readdirnames(n int) (names []string, err error) {
+	infos, err := f.Readdir(n)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, err
+}
+
+// Close closes the underlying directory if it can be closed
+func (f *trashRoot) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrashFs(t *testing.T) {
+	base := NewMemFs()
+	fs := NewTrashFs(base)
+	fs.Mkdir("/dir", 0755)
+	WriteFile(fs, "/dir/file", []byte("first"), 0644)
+	WriteFile(fs, "/keep", nil, 0644)
+
+	if err := fs.Remove("/dir"); !IsError(ErrNotEmpty, err) {
+		t.Errorf("Wanted %v got %v", ErrNotEmpty, err)
+	}
+
+	fs.Remove("/dir/file")
+	WriteFile(fs, "/dir/file", []byte("second"), 0644)
+	fs.Remove("/dir/file")
+	fs.Remove("/dir")
+
+	want := []string{"keep"}
+	if got := readDirNames(t, fs, "/"); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	entries, err := fs.Trash()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+
+	if want := []string{"/dir", "/dir/file", "/dir/file"}; !reflect.DeepEqual(want, paths) {
+		t.Errorf("Wanted %v got %v", want, paths)
+	}
+
+	// the most recent removal is restored first and parents are recreated
+	if err = fs.Restore("/dir/file"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(fs, "/dir/file"); string(got) != "second" {
+		t.Errorf("Wanted %q got %q", "second", got)
+	}
+
+	if err = fs.Restore("/dir/file"); !IsError(ErrExist, err) {
+		t.Errorf("Wanted %v got %v", ErrExist, err)
+	}
+
+	fs.Rename("/dir/file", "/dir/renamed")
+	if err = fs.Restore("/dir/file"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(fs, "/dir/file"); string(got) != "first" {
+		t.Errorf("Wanted %q got %q", "first", got)
+	}
+
+	// a new TrashFs continues with the trash left behind
+	fs = NewTrashFs(base)
+	WriteFile(fs, "/keep", []byte("changed"), 0644)
+	fs.Remove("/keep")
+	if entries, _ = fs.Trash(); len(entries) != 2 || entries[0].Path != "/keep" {
+		t.Errorf("Wanted /keep and /dir in the trash got %v", entries)
+	}
+
+	if err = fs.EmptyTrash(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if entries, _ = fs.Trash(); len(entries) != 0 {
+		t.Errorf("Wanted an empty trash got %v", entries)
+	}
+
+	if err = fs.Restore("/keep"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
+
+func TestTrashFsHidden(t *testing.T) {
+	fs := NewTrashFs(NewMemFs())
+	WriteFile(fs, "/file", nil, 0644)
+	fs.Remove("/file")
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"open", func() error { _, err := fs.Open(TrashDir); return err }},
+		{"create", func() error { _, err := fs.Create(TrashDir + "/file"); return err }},
+		{"stat", func() error { _, err := fs.Stat(TrashDir + "/files/1"); return err }},
+		{"lstat", func() error { _, err := fs.Lstat(TrashDir); return err }},
+		{"mkdir", func() error { return fs.Mkdir(TrashDir+"/dir", 0755) }},
+		{"chmod", func() error { return fs.Chmod(TrashDir, 0777) }},
+		{"remove", func() error { return fs.Remove(TrashDir + "/files/1") }},
+		{"rename in", func() error { return fs.Rename("/file", TrashDir+"/file") }},
+		{"rename out", func() error { return fs.Rename(TrashDir+"/files/1", "/file") }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.op(); !IsError(ErrPermission, err) {
+				t.Errorf("Wanted %v got %v", ErrPermission, err)
+			}
+		})
+	}
+}
+
+func TestTrashFsGC(t *testing.T) {
+	base := NewMemFs()
+	fs := NewTrashFs(base)
+	for _, name := range []string{"/a", "/b", "/c"} {
+		WriteFile(fs, name, bytes.Repeat([]byte{'x'}, 10), 0644)
+		fs.Remove(name)
+	}
+
+	// /a and /b were removed two hours ago
+	old := time.Now().Add(-2 * time.Hour)
+	chtimes := base.(interface {
+		Chtimes(string, time.Time, time.Time) error
+	}).Chtimes
+	chtimes(trashInfo(1), old, old)
+	chtimes(trashInfo(2), old.Add(time.Minute), old.Add(time.Minute))
+
+	trashPaths := func() (paths []string) {
+		entries, _ := fs.Trash()
+		for _, entry := range entries {
+			paths = append(paths, entry.Path)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name      string
+		policy    GCPolicy
+		wantItems []string
+		wantTrash []string
+	}{
+		{"dry run", GCPolicy{DryRun: true, MinAge: time.Hour}, []string{"/a", "/b"}, []string{"/c", "/b", "/a"}},
+		{"target bytes", GCPolicy{MinAge: time.Hour, TargetBytes: 20}, []string{"/a"}, []string{"/c", "/b"}},
+		{"min age", GCPolicy{MinAge: time.Hour}, []string{"/b"}, []string{"/c"}},
+	}
+
+	for _, test := range tests {
+		report, err := GC(context.Background(), fs, test.policy)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var items []string
+		for _, item := range report.Items {
+			if item.Layer == "trash" {
+				items = append(items, item.Path)
+			}
+		}
+
+		if !reflect.DeepEqual(test.wantItems, items) {
+			t.Errorf("%s: Wanted %v got %v", test.name, test.wantItems, items)
+		}
+
+		if got := trashPaths(); !reflect.DeepEqual(test.wantTrash, got) {
+			t.Errorf("%s: Wanted %v in the trash got %v", test.name, test.wantTrash, got)
+		}
+	}
+}
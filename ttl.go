@@ -0,0 +1,206 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// TTLFs is a scratch space whose files expire once they have not been
+// modified for the maximum age.  Expired files are removed when they are
+// next opened, stated or listed and by a sweep of the whole FileSystem that
+// runs on an interval, WithSweepInterval, which defaults to the maximum age.
+// Files are removed through the wrapped FileSystem so its watchers report a
+// RemoveEvent for each.  Directories never expire, although the files in
+// them do
+type TTLFs struct {
+	FileSystem
+	maxAge   time.Duration
+	clock    Clock
+	interval time.Duration
+
+	mu     sync.Mutex
+	timer  Timer
+	closed bool
+}
+
+// NewTTLFs returns a TTLFs expiring the files of fs after maxAge.
+// WithSweepInterval and WithClock configure when the sweeps run and how the
+// age of a file is measured
+func NewTTLFs(fs FileSystem, maxAge time.Duration, opts ...Option) *TTLFs {
+	tfs := &TTLFs{FileSystem: fs, maxAge: maxAge, clock: SystemClock, interval: maxAge}
+	for _, opt := range opts {
+		opt(tfs)
+	}
+
+	if tfs.interval > 0 {
+		tfs.timer = tfs.clock.AfterFunc(tfs.interval, tfs.tick)
+	}
+	return tfs
+}
+
+// tick sweeps the FileSystem and schedules the next sweep
+func (tfs *TTLFs) tick() {
+	tfs.Sweep()
+	tfs.mu.Lock()
+	defer tfs.mu.Unlock()
+	if !tfs.closed {
+		tfs.timer.Reset(tfs.interval)
+	}
+}
+
+// expired reports whether info describes a file older than the maximum age
+func (tfs *TTLFs) expired(info os.FileInfo) bool {
+	return !info.IsDir() && tfs.clock.Now().Sub(info.ModTime()) >= tfs.maxAge
+}
+
+// expire removes the named file if it has expired
+func (tfs *TTLFs) expire(name string) {
+	if info, err := tfs.FileSystem.Lstat(name); err == nil && tfs.expired(info) {
+		tfs.FileSystem.Remove(name)
+	}
+}
+
+// Sweep removes every expired file and returns the first error that
+// prevented one from being removed
+func (tfs *TTLFs) Sweep() error {
+	var expired []string
+	err := Walk(tfs.FileSystem, PathSeparator, func(name string, info os.FileInfo, err error) error {
+		if err == nil && tfs.expired(info) {
+			expired = append(expired, name)
+		}
+		return err
+	})
+
+	for _, name := range expired {
+		if err1 := tfs.FileSystem.Remove(name); err == nil && !IsNotExist(err1) {
+			err = err1
+		}
+	}
+	return err
+}
+
+func (tfs *TTLFs) Chmod(name string, mode os.FileMode) error {
+	tfs.expire(name)
+	return tfs.FileSystem.Chmod(name, mode)
+}
+
+func (tfs *TTLFs) Create(name string) (File, error) {
+	return tfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (tfs *TTLFs) Open(name string) (File, error) {
+	return tfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+// OpenFile opens the named file, which no longer exists once it has expired
+func (tfs *TTLFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	tfs.expire(name)
+	f, err := tfs.FileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &ttlFile{File: f, fs: tfs}, nil
+}
+
+func (tfs *TTLFs) Rename(oldpath, newpath string) error {
+	tfs.expire(oldpath)
+	return tfs.FileSystem.Rename(oldpath, newpath)
+}
+
+func (tfs *TTLFs) Lstat(name string) (os.FileInfo, error) {
+	tfs.expire(name)
+	return tfs.FileSystem.Lstat(name)
+}
+
+func (tfs *TTLFs) Stat(name string) (os.FileInfo, error) {
+	tfs.expire(name)
+	return tfs.FileSystem.Stat(name)
+}
+
+// Close stops the sweeps and closes the underlying FileSystem
+func (tfs *TTLFs) Close() error {
+	tfs.mu.Lock()
+	tfs.closed = true
+	if tfs.timer != nil {
+		tfs.timer.Stop()
+	}
+	tfs.mu.Unlock()
+	return tfs.FileSystem.Close()
+}
+
+// Unwrap returns the underlying FileSystem
+func (tfs *TTLFs) Unwrap() []FileSystem { return []FileSystem{tfs.FileSystem} }
+
+// ttlFile leaves expired files out of directory listings
+type ttlFile struct {
+	File
+	fs *TTLFs
+
+	// expired holds the expired files found by Readdir.  They are removed
+	// once the listing is done, since removing entries from a directory
+	// while paging through it may disturb the listing
+	expired []string
+}
+
+// Readdir reads the directory, removing the expired files it finds rather
+// than returning them
+func (f *ttlFile) Readdir(n int) ([]os.FileInfo, error) {
+	for {
+		infos, err := f.File.Readdir(n)
+		kept := infos[:0]
+		for _, info := range infos {
+			if f.fs.expired(info) {
+				f.expired = append(f.expired, path.Join(f.Name(), info.Name()))
+			} else {
+				kept = append(kept, info)
+			}
+		}
+
+		if err != nil || n <= 0 {
+			f.removeExpired()
+		}
+
+		// a batch that has only expired files is skipped rather than
+		// returned empty, which would look like the end of the directory
+		if len(kept) > 0 || err != nil || n <= 0 {
+			return kept, err
+		}
+	}
+}
+
+// removeExpired removes the expired files found so far
+func (f *ttlFile) removeExpired() {
+	for _, name := range f.expired {
+		f.fs.FileSystem.Remove(name)
+	}
+	f.expired = nil
+}
+
+func (f *ttlFile) Readdirnames(n int) (names []string, err error) {
+	infos, err := f.Readdir(n)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, err
+}
+
+// Truncate changes the size of the file if the underlying file supports it
+func (f *ttlFile) Truncate(size int64) error {
+	if truncater, ok := f.File.(interface{ Truncate(int64) error }); ok {
+		return truncater.Truncate(size)
+	}
+	return &PathError{Op: "truncate", Path: f.Name(), Cause: ErrNotSupported}
+}
+
+// Close removes the expired files found by a listing that was not read to
+// the end and closes the underlying file if it can be closed
+func (f *ttlFile) Close() error {
+	f.removeExpired()
+	if closer, ok := f.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package vfs
+
+import (
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTTLFs(t *testing.T) {
+	base := NewMemFs()
+	clock := &testClock{now: time.Now()}
+	fs := NewTTLFs(base, time.Hour, WithClock(clock), WithSweepInterval(0))
+	defer fs.Close()
+
+	chtimes := base.(interface {
+		Chtimes(string, time.Time, time.Time) error
+	}).Chtimes
+	MkdirAll(fs, "/dir", 0755)
+	for _, name := range []string{"/old", "/fresh", "/dir/old", "/dir/fresh", "/dir/stale"} {
+		WriteFile(fs, name, []byte(name), 0644)
+	}
+	old := clock.Now().Add(-2 * time.Hour)
+	chtimes("/old", old, old)
+	chtimes("/dir/old", old, old)
+	chtimes("/dir/stale", old, old)
+	chtimes("/dir", old, old)
+
+	if _, err := fs.Stat("/old"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	} else if _, err = base.Stat("/old"); !IsNotExist(err) {
+		t.Errorf("Wanted the expired file to be removed got %v", err)
+	}
+
+	if got, err := ReadFile(fs, "/fresh"); err != nil || string(got) != "/fresh" {
+		t.Errorf("Wanted /fresh got %q (%v)", got, err)
+	}
+
+	f, _ := fs.Open("/dir")
+	names, err := f.Readdirnames(-1)
+	closeFile(f)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if want := []string{"fresh"}; !reflect.DeepEqual(want, names) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+
+	if _, err = base.Stat("/dir/stale"); !IsNotExist(err) {
+		t.Errorf("Wanted listing to remove expired files got %v", err)
+	}
+
+	// files written again start a new life
+	f, _ = fs.Create("/old")
+	closeFile(f)
+	if _, err = fs.Stat("/old"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestTTLFsReaddirBatches(t *testing.T) {
+	base := NewMemFs()
+	clock := &testClock{now: time.Now()}
+	fs := NewTTLFs(base, time.Hour, WithClock(clock), WithSweepInterval(0))
+	defer fs.Close()
+
+	fs.Mkdir("/dir", 0755)
+	for _, name := range []string{"b", "c", "d", "e"} {
+		WriteFile(fs, "/dir/"+name, nil, 0644)
+	}
+	old := clock.Now().Add(-2 * time.Hour)
+	base.(interface {
+		Chtimes(string, time.Time, time.Time) error
+	}).Chtimes("/dir/c", old, old)
+
+	f, _ := fs.Open("/dir")
+	var names []string
+	for {
+		batch, err := f.Readdirnames(1)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(names) > 10 {
+			t.Fatalf("Wanted the listing to end got %v", names)
+		}
+		names = append(names, batch...)
+	}
+	closeFile(f)
+
+	if want := []string{"b", "d", "e"}; !reflect.DeepEqual(want, names) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+
+	if _, err := base.Stat("/dir/c"); !IsNotExist(err) {
+		t.Errorf("Wanted the expired file to be removed got %v", err)
+	}
+}
+
+func TestTTLFsSweep(t *testing.T) {
+	base := NewMemFs()
+	clock := &testClock{now: time.Now()}
+	fs := NewTTLFs(base, time.Hour, WithClock(clock), WithSweepInterval(time.Minute))
+	defer fs.Close()
+
+	MkdirAll(fs, "/a/b", 0755)
+	for _, name := range []string{"/file", "/a/file", "/a/b/file"} {
+		WriteFile(fs, name, nil, 0644)
+	}
+
+	events := make(chan Event, 10)
+	watcher, _ := fs.Watcher(events)
+	watcher.(RecursiveWatcher).WatchRecursive("/")
+
+	clock.fire()
+	if _, err := base.Stat("/a/b/file"); err != nil {
+		t.Errorf("Wanted fresh files to survive a sweep got %v", err)
+	}
+
+	clock.advance(2 * time.Hour)
+	clock.fire()
+	watcher.Close()
+
+	var got []string
+	for event := range events {
+		if event.Type == RemoveEvent {
+			got = append(got, event.Path)
+		}
+	}
+	sort.Strings(got)
+
+	if want := []string{"/a/b/file", "/a/file", "/file"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted remove events for %v got %v", want, got)
+	}
+
+	if _, err := base.Stat("/a/b"); err != nil {
+		t.Errorf("Wanted directories to remain got %v", err)
+	}
+}
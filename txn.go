@@ -0,0 +1,243 @@
+package vfs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// Txn is a FileSystem view whose changes are staged until they are applied
+// to the underlying FileSystem by Commit or discarded by Rollback.  Either
+// one ends the transaction, the Txn then shows the underlying FileSystem
+// again and may be used for another transaction
+type Txn interface {
+	FileSystem
+	Commit() error
+	Rollback() error
+}
+
+// Transactional is implemented by FileSystems that provide their own
+// transactions
+type Transactional interface {
+	Begin() (Txn, error)
+}
+
+// txnStaged numbers the staging directories of commits so that concurrent
+// commits never stage to the same name
+var txnStaged int64
+
+// Begin starts a transaction on fs.  FileSystems implementing Transactional
+// provide their own, any other gets an overlay that stages changes in memory
+// the way a CowFs does.
+//
+// Committing an overlay first copies every new or changed file into a
+// staging directory, named /.txn-<pid>-<n>, at the root of fs, so a failure
+// while copying, which is where nearly all of the work is, leaves fs
+// untouched.  Only then are the changes applied, entries being removed or
+// replaced by moving them into the staging directory, and a failure while
+// applying them moves everything back.  The staging directory is visible in
+// fs while a commit runs and so are the changes as they are applied, commits
+// are atomic with respect to failures but not to concurrent readers.  If
+// undoing a failed commit fails as well, for instance because fs has become
+// unreachable, fs is left partly changed and the staging directory is kept
+// with the entries that could not be put back.  Changes made to fs during the
+// transaction are overwritten where the transaction changed the same paths
+func Begin(fs FileSystem) (Txn, error) {
+	if transactional, ok := fs.(Transactional); ok {
+		return transactional.Begin()
+	}
+	return &overlayTxn{CowFs: NewCowFs(fs), base: fs}, nil
+}
+
+// overlayTxn stages the changes of a transaction in the top layer of a CowFs
+type overlayTxn struct {
+	*CowFs
+	base FileSystem
+}
+
+// reset starts a new transaction by replacing the top layer, the CowFs must
+// be locked
+func (txn *overlayTxn) reset() error {
+	err := txn.top().fs.Close()
+	txn.layers[0] = newCowLayer()
+	return err
+}
+
+// Rollback discards the changes staged by the transaction
+func (txn *overlayTxn) Rollback() error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	return txn.reset()
+}
+
+// Commit applies the changes staged by the transaction to the underlying
+// FileSystem
+func (txn *overlayTxn) Commit() (err error) {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	top := txn.top()
+	if !top.dirty {
+		return nil
+	}
+
+	type entry struct {
+		name string
+		info os.FileInfo
+		temp string
+	}
+
+	var entries []*entry
+	err = Walk(top.fs, PathSeparator, func(name string, info os.FileInfo, err error) error {
+		if err == nil && name != PathSeparator {
+			entries = append(entries, &entry{name: name, info: info})
+		}
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	commit := &txnCommit{
+		base:    txn.base,
+		staging: fmt.Sprintf("/.txn-%d-%d", os.Getpid(), atomic.AddInt64(&txnStaged, 1)),
+	}
+
+	if err = txn.base.Mkdir(commit.staging, 0700); err != nil {
+		return err
+	}
+
+	// the staging directory goes once the commit is done or undone, it is
+	// only kept when it holds entries that could not be put back
+	defer func() {
+		if err == nil || commit.revert() == nil {
+			RemoveAll(txn.base, commit.staging)
+		}
+	}()
+
+	// copy the files before anything in the base is changed
+	for _, e := range entries {
+		if err != nil {
+			break
+		} else if e.info.Mode().IsRegular() {
+			e.temp = commit.stage("new")
+			err = copyFile(txn.base, e.temp, top.fs, e.name, e.info.Mode().Perm())
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// entries that were removed or replaced as a whole go first, the
+	// sorted order removes directories before anything beneath them
+	var removed []string
+	for name := range top.whiteouts {
+		removed = append(removed, name)
+	}
+
+	for name := range top.opaque {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+
+	for _, name := range removed {
+		if _, err = txn.base.Lstat(name); IsNotExist(err) {
+			err = nil
+		} else if err == nil {
+			err = commit.moveAside(name)
+		}
+
+		if err != nil {
+			return &PathError{Op: "commit", Path: name, Cause: unwrapCause(err)}
+		}
+	}
+
+	for _, e := range entries {
+		if err = commit.apply(e.name, e.info, e.temp); err != nil {
+			return err
+		}
+	}
+	return txn.reset()
+}
+
+// txnCommit applies the top layer of an overlayTxn to the base, logging how
+// to undo every change it makes
+type txnCommit struct {
+	base    FileSystem
+	staging string
+	staged  int
+	undo    []func() error
+}
+
+// stage returns a new name in the staging directory
+func (c *txnCommit) stage(prefix string) string {
+	c.staged++
+	return fmt.Sprintf("%s/%s-%d", c.staging, prefix, c.staged)
+}
+
+// log records how to undo the last change
+func (c *txnCommit) log(undo func() error) {
+	c.undo = append(c.undo, undo)
+}
+
+// moveAside moves name into the staging directory, where it stays until the
+// commit is done or undone
+func (c *txnCommit) moveAside(name string) error {
+	saved := c.stage("old")
+	if err := c.base.Rename(name, saved); err != nil {
+		return err
+	}
+	c.log(func() error { return c.base.Rename(saved, name) })
+	return nil
+}
+
+// revert undoes the logged changes, latest first, and returns the first
+// error met
+func (c *txnCommit) revert() (err error) {
+	for i := len(c.undo) - 1; i >= 0; i-- {
+		if err1 := c.undo[i](); err == nil {
+			err = err1
+		}
+	}
+	c.undo = nil
+	return err
+}
+
+// apply puts a single entry of the top layer in place in the base
+func (c *txnCommit) apply(name string, info os.FileInfo, temp string) error {
+	current, err := c.base.Lstat(name)
+	if IsNotExist(err) {
+		current, err = nil, nil
+	} else if err == nil && (current.IsDir() != info.IsDir() || temp != "") {
+		// replaced entries are kept until the commit is done
+		err = c.moveAside(name)
+		current = nil
+	}
+
+	switch {
+	case err != nil:
+	case info.IsDir() && current == nil:
+		if err = c.base.Mkdir(name, info.Mode().Perm()); err == nil {
+			c.log(func() error { return c.base.Remove(name) })
+			err = c.base.Chmod(name, info.Mode().Perm())
+		}
+	case info.IsDir():
+		if perm := current.Mode().Perm(); perm != info.Mode().Perm() {
+			if err = c.base.Chmod(name, info.Mode().Perm()); err == nil {
+				c.log(func() error { return c.base.Chmod(name, perm) })
+			}
+		}
+	case temp != "":
+		if err = c.base.Rename(temp, name); err == nil {
+			c.log(func() error { return c.base.Remove(name) })
+			err = c.base.Chmod(name, info.Mode().Perm())
+		}
+	}
+
+	if err != nil {
+		return &PathError{Op: "commit", Path: name, Cause: unwrapCause(err)}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package vfs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// txnTree returns the contents of every file in fs keyed by name, with
+// directories as empty strings
+func txnTree(t *testing.T, fs FileSystem) map[string]string {
+	tree := make(map[string]string)
+	err := Walk(fs, "/", func(name string, info os.FileInfo, err error) error {
+		if err != nil || name == "/" {
+			return err
+		} else if info.IsDir() {
+			tree[name] = ""
+		} else {
+			data, err := ReadFile(fs, name)
+			tree[name] = string(data)
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return tree
+}
+
+func TestTxn(t *testing.T) {
+	base := NewMemFs()
+	base.Mkdir("/dir", 0755)
+	WriteFile(base, "/dir/a", []byte("a"), 0644)
+	WriteFile(base, "/dir/b", []byte("b"), 0644)
+	WriteFile(base, "/keep", []byte("keep"), 0644)
+	before := txnTree(t, base)
+
+	txn, err := Begin(base)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	WriteFile(txn, "/dir/a", []byte("changed"), 0644)
+	WriteFile(txn, "/new", []byte("new"), 0644)
+	txn.Remove("/dir/b")
+	txn.Mkdir("/sub", 0700)
+	txn.Rename("/new", "/sub/new")
+
+	if got := txnTree(t, base); !reflect.DeepEqual(before, got) {
+		t.Errorf("Wanted the base to be unchanged before commit got %v", got)
+	}
+
+	want := map[string]string{"/dir": "", "/dir/a": "changed", "/keep": "keep", "/sub": "", "/sub/new": "new"}
+	if got := txnTree(t, txn); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	if err = txn.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := txnTree(t, base); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	if info, _ := base.Stat("/sub"); info.Mode().Perm() != 0700 {
+		t.Errorf("Wanted mode %v got %v", 0700, info.Mode().Perm())
+	}
+
+	// the txn goes on to show the base for the next transaction
+	WriteFile(txn, "/keep", []byte("discarded"), 0644)
+	txn.Remove("/dir/a")
+	if err = txn.Rollback(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, fs := range []FileSystem{base, txn} {
+		if got := txnTree(t, fs); !reflect.DeepEqual(want, got) {
+			t.Errorf("Wanted %v got %v", want, got)
+		}
+	}
+}
+
+func TestTxnFailedCommit(t *testing.T) {
+	base := NewMemFs(WithMaxBytes(8 * blocksize))
+	WriteFile(base, "/small", []byte("small"), 0644)
+	before := txnTree(t, base)
+
+	txn, _ := Begin(base)
+	txn.Remove("/small")
+	WriteFile(txn, "/one", []byte("one"), 0644)
+	WriteFile(txn, "/big", make([]byte, 16*blocksize), 0644)
+	if err := txn.Commit(); !IsError(ErrNoSpace, err) {
+		t.Errorf("Wanted %v got %v", ErrNoSpace, err)
+	}
+
+	if got := txnTree(t, base); !reflect.DeepEqual(before, got) {
+		t.Errorf("Wanted %v got %v", before, got)
+	}
+}
+
+func TestTxnUndoneCommit(t *testing.T) {
+	mem := NewMemFs()
+	mem.Mkdir("/dir", 0755)
+	WriteFile(mem, "/dir/a", []byte("a"), 0644)
+	WriteFile(mem, "/dir/b", []byte("b"), 0644)
+	WriteFile(mem, "/keep", []byte("keep"), 0644)
+	before := txnTree(t, mem)
+
+	// the last entry of the commit cannot be put in place
+	base := WithHooks(mem, Hooks{Before: func(op Op) error {
+		if op.Name == "rename" && op.NewPath == "/z" {
+			return ErrPermission
+		}
+		return nil
+	}})
+
+	txn, _ := Begin(base)
+	WriteFile(txn, "/dir/a", []byte("changed"), 0644)
+	txn.Remove("/dir/b")
+	txn.Chmod("/dir", 0700)
+	txn.Mkdir("/sub", 0700)
+	WriteFile(txn, "/sub/new", []byte("new"), 0644)
+	WriteFile(txn, "/z", []byte("z"), 0644)
+	if err := txn.Commit(); !IsError(ErrPermission, err) {
+		t.Errorf("Wanted %v got %v", ErrPermission, err)
+	}
+
+	if got := txnTree(t, mem); !reflect.DeepEqual(before, got) {
+		t.Errorf("Wanted %v got %v", before, got)
+	}
+
+	if info, _ := mem.Stat("/dir"); info.Mode().Perm() != 0755 {
+		t.Errorf("Wanted mode %v got %v", os.FileMode(0755), info.Mode().Perm())
+	}
+}
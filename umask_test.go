@@ -0,0 +1,70 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+)
+
+func TestUmask(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   FileSystem
+	}{
+		{"memfs", NewMemFs(WithUmask(022))},
+		{"osfs", NewOsFs(t.TempDir(), WithUmask(022))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			umasker := test.fs.(Umasker)
+			if umasker.Umask() != 022 {
+				t.Errorf("Wanted umask 022 got %o", umasker.Umask())
+			}
+
+			WriteFile(test.fs, "/file", nil, 0666)
+			test.fs.Mkdir("/dir", 0777)
+			if previous := umasker.SetUmask(077); previous != 022 {
+				t.Errorf("Wanted previous umask 022 got %o", previous)
+			}
+			WriteFile(test.fs, "/private", nil, 0666)
+			WriteFile(test.fs, "/file", nil, 0666)
+
+			for name, want := range map[string]os.FileMode{"/file": 0644, "/dir": 0755, "/private": 0600} {
+				if info, err := test.fs.Stat(name); err != nil || info.Mode().Perm() != want {
+					t.Errorf("Wanted %s to have mode %v got %v (%v)", name, want, info.Mode().Perm(), err)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultPerms(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   FileSystem
+	}{
+		{"memfs", NewMemFs(WithDefaultPerms(0640, 0750))},
+		{"osfs", NewOsFs(t.TempDir(), WithDefaultPerms(0640, 0750))},
+		{"memfs umask", NewMemFs(WithDefaultPerms(0660, 0770), WithUmask(020))},
+		{"osfs umask", NewOsFs(t.TempDir(), WithDefaultPerms(0660, 0770), WithUmask(020))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			WriteFile(test.fs, "/file", nil, 0666)
+			WriteFile(test.fs, "/private", nil, 0600)
+			test.fs.Mkdir("/dir", 0700)
+			MkdirAll(test.fs, "/a/b", 0777)
+
+			// existing files keep their permissions
+			test.fs.Chmod("/private", 0604)
+			WriteFile(test.fs, "/private", nil, 0600)
+
+			for name, want := range map[string]os.FileMode{"/file": 0640, "/private": 0604, "/dir": 0750, "/a": 0750, "/a/b": 0750} {
+				if info, err := test.fs.Stat(name); err != nil || info.Mode().Perm() != want {
+					t.Errorf("Wanted %s to have mode %v got %v (%v)", name, want, info.Mode().Perm(), err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package vfs
+
+// Usage describes how much of a FileSystem's capacity is in use
+type Usage struct {
+	// TotalBytes and FreeBytes are the capacity of the FileSystem and
+	// how much of it is still available.  Both are zero when the
+	// FileSystem has no limit
+	TotalBytes int64
+	UsedBytes  int64
+	FreeBytes  int64
+
+	// TotalInodes and FreeInodes are zero when the number of files is
+	// not limited
+	TotalInodes int64
+	UsedInodes  int64
+	FreeInodes  int64
+
+	// Sys holds backend specific details, a *MemUsage for memfs and a
+	// *syscall.Statfs_t for osfs
+	Sys interface{}
+}
+
+// MemUsage details the storage of a memfs
+type MemUsage struct {
+	// BlockSize is the size of the blocks file data is stored in
+	BlockSize int64
+
+	// Blocks is the number of blocks allocated, FreeBlocks the number of
+	// those that are on the free list waiting to be reused
+	Blocks     int64
+	FreeBlocks int64
+
+	// HeldBytes is the memory held for block storage, which includes
+	// free blocks until they are released by compaction.  Compare it to
+	// Usage.UsedBytes to see how much a GC pass could release
+	HeldBytes int64
+
+	// SpilledBytes is the block storage moved to the backing FileSystem
+	// given to WithSpill
+	SpilledBytes int64
+
+	// Inodes is the number of inodes allocated, FreeInodes the number of
+	// those that are waiting to be reused
+	Inodes     int64
+	FreeInodes int64
+}
+
+// UsageReporter is implemented by FileSystems that can report their usage
+type UsageReporter interface {
+	Usage() (Usage, error)
+}
+
+// StatFS reports the usage of fs.  FileSystems that do not implement
+// UsageReporter but wrap another FileSystem report the usage of the first
+// FileSystem they unwrap to, which is the one holding the data for wrappers
+// such as Sub and CacheFs.  ErrNotSupported is returned when no layer can
+// report its usage
+func StatFS(fs FileSystem) (Usage, error) {
+	seen := make(map[FileSystem]bool)
+	for !seen[fs] {
+		seen[fs] = true
+		if reporter, ok := fs.(UsageReporter); ok {
+			return reporter.Usage()
+		}
+
+		unwrapper, ok := fs.(Unwrapper)
+		if !ok || len(unwrapper.Unwrap()) == 0 {
+			break
+		}
+		fs = unwrapper.Unwrap()[0]
+	}
+	return Usage{}, ErrNotSupported
+}
@@ -0,0 +1,59 @@
+package vfs
+
+import (
+	"testing"
+)
+
+func TestMemUsage(t *testing.T) {
+	fs := NewMemFs(WithBlockSize(512), WithMaxBytes(4096), WithMaxInodes(10))
+	WriteFile(fs, "/file", make([]byte, 1000), 0644)
+
+	usage, err := StatFS(fs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// two blocks for the file and one for the root directory entry
+	want := Usage{TotalBytes: 4096, UsedBytes: 1536, FreeBytes: 2560, TotalInodes: 10, UsedInodes: 2, FreeInodes: 8}
+	sys, ok := usage.Sys.(*MemUsage)
+	usage.Sys = nil
+	if usage != want {
+		t.Errorf("Wanted %+v got %+v", want, usage)
+	}
+
+	if !ok || sys.BlockSize != 512 || sys.Blocks != 3 || sys.FreeBlocks != 0 {
+		t.Errorf("Wanted 3 blocks of 512 bytes got %+v", sys)
+	}
+
+	fs.Remove("/file")
+	usage, _ = StatFS(fs)
+	if sys := usage.Sys.(*MemUsage); sys.FreeBlocks != 3 || sys.FreeInodes != 1 {
+		t.Errorf("Wanted 3 free blocks and 1 free inode got %+v", sys)
+	}
+}
+
+func TestStatFS(t *testing.T) {
+	osfs := NewOsFs(t.TempDir())
+	sub, _ := Sub(osfs, "/")
+
+	tests := []struct {
+		name    string
+		fs      FileSystem
+		wantErr error
+	}{
+		{"osfs", osfs, nil},
+		{"wrapped", sub, nil},
+		{"unsupported", FromIoFS(nil), ErrNotSupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			usage, err := StatFS(test.fs)
+			if !IsError(test.wantErr, err) {
+				t.Fatalf("Wanted %v got %v", test.wantErr, err)
+			} else if err == nil && (usage.TotalBytes <= 0 || usage.UsedBytes+usage.FreeBytes > usage.TotalBytes) {
+				t.Errorf("Unexpected usage %+v", usage)
+			}
+		})
+	}
+}
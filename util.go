@@ -3,34 +3,66 @@ package vfs
 import (
 	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"sort"
 	"strings"
+	"syscall"
 )
 
-// convert os.PathError to vfs.PathError
+// convert os.PathError and os.LinkError to vfs.PathError and vfs.LinkError
 func fixErr(err error) error {
-	if pe, ok := err.(*os.PathError); ok {
-		cause := pe.Err
-		switch cause {
-		case os.ErrExist:
-			cause = ErrExist
-		case os.ErrNotExist:
-			cause = ErrNotExist
-		case os.ErrClosed:
-			cause = ErrClosed
-		default:
-			if _, ok := cause.(*os.PathError); ok {
-				cause = fixErr(cause)
-			}
-		}
-		err = &PathError{Op: pe.Op, Path: pe.Path, Cause: cause}
+	switch e := err.(type) {
+	case *os.PathError:
+		err = &PathError{Op: e.Op, Path: e.Path, Cause: fixCause(e.Err)}
+	case *os.LinkError:
+		err = &LinkError{Op: e.Op, Old: e.Old, New: e.New, Cause: fixCause(e.Err)}
 	}
 	return err
 }
 
+// fixCause converts the cause of an os.PathError or os.LinkError to the
+// equivalent vfs error
+func fixCause(cause error) error {
+	switch cause.(type) {
+	case *os.PathError, *os.LinkError:
+		return fixErr(cause)
+	}
+
+	// ENOTEMPTY also matches fs.ErrExist so it is checked first
+	switch {
+	case errors.Is(cause, syscall.ENOTEMPTY):
+		cause = ErrNotEmpty
+	case errors.Is(cause, syscall.ENOTDIR):
+		cause = ErrNotDir
+	case errors.Is(cause, syscall.EISDIR):
+		cause = ErrIsDir
+	case errors.Is(cause, syscall.ENOSPC):
+		cause = ErrNoSpace
+	case errors.Is(cause, syscall.EBUSY):
+		cause = ErrBusy
+	case errors.Is(cause, syscall.EPIPE):
+		cause = ErrBrokenPipe
+	case errors.Is(cause, syscall.EFBIG):
+		cause = ErrFileTooLarge
+	case errors.Is(cause, syscall.ELOOP):
+		cause = ErrLoop
+	case errors.Is(cause, syscall.ENAMETOOLONG):
+		cause = ErrNameTooLong
+	case errors.Is(cause, fs.ErrExist):
+		cause = ErrExist
+	case errors.Is(cause, fs.ErrNotExist):
+		cause = ErrNotExist
+	case errors.Is(cause, fs.ErrClosed):
+		cause = ErrClosed
+	case errors.Is(cause, fs.ErrPermission):
+		cause = ErrPermission
+	}
+	return cause
+}
+
 // ErrSkipDir is used as a return value from WalkFuncs to indicate that
 // the directory named in the call is to be skipped. It is not returned
 // as an error by any function.
@@ -74,21 +106,212 @@ func WriteFile(opener Opener, filename string, content []byte, perm os.FileMode)
 	return fixErr(err)
 }
 
-// readDirNames reads the directory named by dirname and returns
-// a sorted list of directory entries.
-func readDirNames(fs FileSystem, dirname string) (names []string, err error) {
+// copyFile copies the contents of the file src in srcFs to dst in dstFs,
+// creating or truncating dst with permissions perm
+func copyFile(dstFs FileSystem, dst string, srcFs FileSystem, src string, perm os.FileMode) error {
+	w, err := dstFs.OpenFile(dst, WrOnlyFlag|CreateFlag|TruncFlag, perm)
+	if err != nil {
+		return err
+	}
+
+	err = copyTo(w, srcFs, src)
+	if closer, ok := w.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// CloneFile copies the regular file src to dst, replacing dst if it exists.
+// FileSystems implementing Cloner make the copy without duplicating the
+// data where they can: memfs shares blocks with src until either file is
+// written and osfs has the operating system reflink or copy the file.  The
+// contents are copied through a buffer on any other FileSystem
+func CloneFile(fs FileSystem, src, dst string) error {
+	if cloner, ok := fs.(Cloner); ok {
+		return cloner.CloneFile(src, dst)
+	}
+
+	info, err := fs.Stat(src)
+	if err == nil && info.IsDir() {
+		err = ErrIsDir
+	}
+
+	if err == nil {
+		if dstInfo, _ := fs.Stat(dst); dstInfo != nil && SameFile(info, dstInfo) {
+			return nil
+		}
+		err = copyFile(fs, dst, fs, src, info.Mode().Perm())
+	}
+
+	if err != nil {
+		return &LinkError{Op: "clone", Old: src, New: dst, Cause: unwrapCause(err)}
+	}
+	return nil
+}
+
+// Copy copies the file or directory tree named src to dst within fs,
+// replacing files that already exist.  Regular files are copied with
+// CloneFile, so copies within a memfs share the blocks of the original
+// rather than duplicating the data.  Directories keep their permissions and
+// symbolic links are recreated when fs supports them and skipped otherwise,
+// as are pipes and devices.  Copy fails with ErrBusy when dst is inside src
+func Copy(fs FileSystem, src, dst string) error {
+	src, dst = Clean(src), Clean(dst)
+	if src == PathSeparator || strings.HasPrefix(dst, src+PathSeparator) {
+		return &LinkError{Op: "copy", Old: src, New: dst, Cause: ErrBusy}
+	}
+
+	return Walk(fs, src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := path.Join(dst, strings.TrimPrefix(name, src))
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err = fs.Mkdir(target, mode.Perm()); IsExist(err) {
+				err = nil
+			}
+
+			if err == nil {
+				err = fs.Chmod(target, mode.Perm())
+			}
+		case mode&os.ModeSymlink != 0:
+			err = copyLink(fs, name, target)
+		case mode.IsRegular():
+			err = CloneFile(fs, name, target)
+		}
+		return err
+	})
+}
+
+// copyLink recreates the symbolic link name at target, replacing whatever
+// target was
+func copyLink(fs FileSystem, name, target string) error {
+	reader, ok := fs.(linkReader)
+	linker, ok1 := fs.(symlinker)
+	if !ok || !ok1 {
+		return nil
+	}
+
+	link, err := reader.Readlink(name)
+	if err == nil {
+		if err = fs.Remove(target); IsNotExist(err) {
+			err = nil
+		}
+	}
+
+	if err == nil {
+		err = linker.Symlink(link, target)
+	}
+	return err
+}
+
+// EvalSymlinks returns name with every symbolic link in it replaced by the
+// path it points to, the way filepath.EvalSymlinks does.  Every component of
+// name must exist and FileSystems without symbolic links return the cleaned
+// name.  Following more than maxLinks links fails with ErrLoop
+func EvalSymlinks(fs FileSystem, name string) (string, error) {
+	reader, ok := fs.(linkReader)
+	current, remaining := PathSeparator, splitPath(name)
+	for links := 0; len(remaining) > 0; {
+		next := path.Join(current, remaining[0])
+		remaining = remaining[1:]
+		info, err := fs.Lstat(next)
+		if err != nil {
+			return "", &PathError{Op: "evalsymlinks", Path: name, Cause: unwrapCause(err)}
+		} else if !ok || info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		if links++; links > maxLinks {
+			return "", &PathError{Op: "evalsymlinks", Path: name, Cause: ErrLoop}
+		}
+
+		target, err := reader.Readlink(next)
+		if err != nil {
+			return "", &PathError{Op: "evalsymlinks", Path: name, Cause: unwrapCause(err)}
+		} else if !path.IsAbs(target) {
+			target = path.Join(current, target)
+		}
+		current, remaining = PathSeparator, append(splitPath(target), remaining...)
+	}
+	return current, nil
+}
+
+// Exists reports whether the named file or directory exists.  An error is
+// only returned when existence could not be determined, for instance
+// because permission was denied
+func Exists(fs FileSystem, name string) (bool, error) {
+	info, err := stat(fs, name)
+	return info != nil, err
+}
+
+// DirExists reports whether the named path exists and is a directory
+func DirExists(fs FileSystem, name string) (bool, error) {
+	info, err := stat(fs, name)
+	return info != nil && info.IsDir(), err
+}
+
+// IsRegular reports whether the named path exists and is a regular file
+func IsRegular(fs FileSystem, name string) (bool, error) {
+	info, err := stat(fs, name)
+	return info != nil && info.Mode().IsRegular(), err
+}
+
+// stat returns the FileInfo of the named path, or nil and no error when the
+// path does not exist
+func stat(fs FileSystem, name string) (os.FileInfo, error) {
+	info, err := fs.Stat(name)
+	if IsNotExist(err) {
+		return nil, nil
+	}
+	return info, fixErr(err)
+}
+
+// SameFile reports whether fi1 and fi2 describe the same file.  FileInfos
+// from a memfs are the same file when they describe the same inode, for
+// other FileSystems, such as osfs, SameFile defers to os.SameFile.  FileInfos
+// returned by different FileSystems never describe the same file, except
+// when the FileSystems share a backing osfs directory
+func SameFile(fi1, fi2 os.FileInfo) bool {
+	fi1, fi2 = baseInfo(fi1), baseInfo(fi2)
+	if m1, ok := fi1.(*memFileInfo); ok {
+		m2, ok := fi2.(*memFileInfo)
+		return ok && m1.memInode == m2.memInode
+	}
+	return os.SameFile(fi1, fi2)
+}
+
+// baseInfo returns the FileInfo of the backing FileSystem that a wrapping
+// FileInfo, such as the cryptfs one, describes
+func baseInfo(fi os.FileInfo) os.FileInfo {
+	if cfi, ok := fi.(*cryptFileInfo); ok {
+		return baseInfo(cfi.FileInfo)
+	} else if ofi, ok := fi.(*osFileInfo); ok {
+		return ofi.FileInfo
+	}
+	return fi
+}
+
+// readDir reads the directory named by dirname and returns
+// a list of directory entries sorted by name.
+func readDir(fs FileSystem, dirname string) (infos []os.FileInfo, err error) {
 	f, err := fs.Open(dirname)
 	if err == nil {
-		names, err = f.Readdirnames(-1)
+		infos, err = f.Readdir(-1)
 		if closer, ok := f.(io.Closer); ok {
 			closer.Close()
 		}
 	}
 
 	if err == nil {
-		sort.Strings(names)
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
 	}
-	return names, fixErr(err)
+	return infos, fixErr(err)
 }
 
 // walk recursively descends path, calling walkFn.
@@ -97,7 +320,7 @@ func walk(fs FileSystem, dir string, info os.FileInfo, walkFn WalkFunc, err erro
 		return walkFn(dir, info, err)
 	}
 
-	names, err := readDirNames(fs, dir)
+	infos, err := readDir(fs, dir)
 	err1 := walkFn(dir, info, err)
 	// If err != nil, walk can't walk into this directory.
 	// err1 != nil means walkFn want walk to skip this directory or stop walking.
@@ -110,10 +333,11 @@ func walk(fs FileSystem, dir string, info os.FileInfo, walkFn WalkFunc, err erro
 		return err1
 	}
 
-	for _, name := range names {
-		filename := path.Join(dir, name)
-		fileInfo, err := fs.Lstat(filename)
-		err = walk(fs, filename, fileInfo, walkFn, err)
+	// Readdir already describes each entry the same way Lstat would
+	// so there is no need to stat each one again
+	for _, fileInfo := range infos {
+		filename := path.Join(dir, fileInfo.Name())
+		err = walk(fs, filename, fileInfo, walkFn, nil)
 		if err != nil {
 			if err != ErrSkipDir {
 				return err
@@ -189,6 +413,44 @@ func MkdirAll(fs FileSystem, dirname string, perm os.FileMode) error {
 	return fixErr(err)
 }
 
+// RemoveAll removes name and everything beneath it, as os.RemoveAll does
+// on the operating system.  It is the counterpart of MkdirAll for any
+// FileSystem, which the afero bridge needs for afero.Fs.RemoveAll and which
+// the wrappers replacing whole trees share.  Symbolic links are removed
+// rather than followed.  RemoveAll removes everything it can and returns the
+// first error it meets, a name that does not exist is not an error
+func RemoveAll(fs FileSystem, name string) error {
+	fi, err := fs.Lstat(name)
+	if err != nil {
+		if IsNotExist(err) {
+			err = nil
+		}
+		return fixErr(err)
+	}
+
+	if fi.IsDir() {
+		var names []string
+		f, err := fs.Open(name)
+		if err == nil {
+			names, err = f.Readdirnames(-1)
+			if closer, ok := f.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+
+		for _, child := range names {
+			if err1 := RemoveAll(fs, path.Join(name, child)); err == nil {
+				err = err1
+			}
+		}
+
+		if err != nil {
+			return fixErr(err)
+		}
+	}
+	return fixErr(fs.Remove(name))
+}
+
 // Glob returns the names of all files matching pattern or nil
 // if there is no matching file.
 // The pattern syntax is:
@@ -255,13 +517,6 @@ func Glob(fs FileSystem, pattern string) (matches []string, err error) {
 // added in lexicographical order.
 func glob(fs FileSystem, dir, pattern string, matches []string) (m []string, e error) {
 	m = matches
-	fi, err := fs.Stat(dir)
-	if err != nil {
-		return
-	}
-	if !fi.IsDir() {
-		return
-	}
 	d, err := fs.Open(dir)
 	if err != nil {
 		return
@@ -270,6 +525,13 @@ func glob(fs FileSystem, dir, pattern string, matches []string) (m []string, e e
 		defer closer.Close()
 	}
 
+	// use the open handle to check for a directory rather than
+	// a separate Stat of the path
+	fi, err := d.Stat()
+	if err != nil || !fi.IsDir() {
+		return
+	}
+
 	names, _ := d.Readdirnames(-1)
 	sort.Strings(names)
 
@@ -285,6 +547,84 @@ func glob(fs FileSystem, dir, pattern string, matches []string) (m []string, e e
 	return
 }
 
+// GlobStar is Glob with support for "**" path elements, which match zero
+// or more directories.  The pattern /assets/**/*.css matches every file
+// ending in .css anywhere beneath /assets, including /assets/site.css, and a
+// trailing "**" matches everything beneath a directory.  Elements other than "**" have the same syntax as in Glob.  Symbolic links
+// to directories are not followed when matching "**".  Matches are returned
+// in lexical order
+func GlobStar(fs FileSystem, pattern string) (matches []string, err error) {
+	if !hasMeta(pattern) {
+		return Glob(fs, pattern)
+	}
+
+	dir := "."
+	if strings.HasPrefix(pattern, PathSeparator) {
+		dir = PathSeparator
+	}
+
+	var elems []string
+	for _, elem := range strings.Split(pattern, PathSeparator) {
+		if elem == "" {
+			continue
+		} else if _, err := path.Match(elem, ""); err != nil {
+			return nil, ErrBadPattern
+		}
+		elems = append(elems, elem)
+	}
+
+	found := make(map[string]bool)
+	globStar(fs, dir, elems, found)
+	for match := range found {
+		matches = append(matches, match)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// globStar adds the paths beneath dir matching the pattern elements to
+// found.  Like glob it ignores directories that cannot be read
+func globStar(fs FileSystem, dir string, elems []string, found map[string]bool) {
+	if len(elems) == 0 {
+		found[dir] = true
+		return
+	}
+
+	elem := elems[0]
+	if !hasMeta(elem) {
+		name := path.Join(dir, elem)
+		if _, err := fs.Lstat(name); err == nil {
+			globStar(fs, name, elems[1:], found)
+		}
+		return
+	}
+
+	infos, err := readDir(fs, dir)
+	if err != nil {
+		return
+	}
+
+	if elem == "**" {
+		// match no directories, then descend keeping the "**".  A
+		// trailing "**" matches files as well
+		globStar(fs, dir, elems[1:], found)
+		for _, info := range infos {
+			if info.IsDir() {
+				globStar(fs, path.Join(dir, info.Name()), elems, found)
+			} else if len(elems) == 1 {
+				found[path.Join(dir, info.Name())] = true
+			}
+		}
+		return
+	}
+
+	for _, info := range infos {
+		if matched, _ := path.Match(elem, info.Name()); matched {
+			globStar(fs, path.Join(dir, info.Name()), elems[1:], found)
+		}
+	}
+}
+
 // cleanGlobPath prepares path for glob matching.
 func cleanGlobPath(path string) string {
 	switch path {
@@ -306,13 +646,17 @@ func hasMeta(path string) bool {
 }
 
 // Watch will setup a Watcher recursively watching the path and
-// sending events down to the events channel.
+// sending events down to the events channel.  Watchers implementing
+// RecursiveWatcher also watch directories created after the call, other
+// Watchers only watch the directories that exist when Watch is called
 func Watch(fs FileSystem, path string, events chan<- Event) (watcher Watcher, err error) {
 	_, err = fs.Stat(path)
 	if err == nil {
 		watcher, err = fs.Watcher(events)
 
-		if err == nil {
+		if rw, ok := watcher.(RecursiveWatcher); ok && err == nil {
+			err = rw.WatchRecursive(path)
+		} else if err == nil {
 			Walk(fs, path, func(path string, info os.FileInfo, err error) error {
 				if err == nil {
 					if info.IsDir() {
@@ -325,3 +669,20 @@ func Watch(fs FileSystem, path string, events chan<- Event) (watcher Watcher, er
 	}
 	return watcher, err
 }
+
+// defaultPerms are the permissions set by WithDefaultPerms
+type defaultPerms struct {
+	file os.FileMode
+	dir  os.FileMode
+}
+
+// apply replaces the permission bits of a new file or directory with the
+// default ones, if any, and reports whether it did
+func (dp defaultPerms) apply(mode os.FileMode) (os.FileMode, bool) {
+	if mode.IsDir() && dp.dir != 0 {
+		return mode&^os.ModePerm | dp.dir, true
+	} else if mode.IsRegular() && dp.file != 0 {
+		return mode&^os.ModePerm | dp.file, true
+	}
+	return mode, false
+}
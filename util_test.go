@@ -2,6 +2,7 @@ package vfs
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -47,9 +48,19 @@ func (tf *testFs) Create(filename string) (File, error) {
 func (tf *testFs) Open(filename string) (File, error) { return tf.OpenFile(filename, 0, 0) }
 
 func (tf *testFs) OpenFile(filename string, flags OpenFlag, perm os.FileMode) (File, error) {
-	return tf, nil
+	return &testFile{tf}, nil
 }
 
+// testFile is the File returned by testFs.  It only exists to give
+// the handle a Stat method distinct from testFs.Stat
+type testFile struct {
+	*testFs
+}
+
+func (tf *testFile) Stat() (os.FileInfo, error)                  { return nil, nil }
+func (tf *testFile) ReadAt(data []byte, off int64) (int, error)  { return tf.Read(data) }
+func (tf *testFile) WriteAt(data []byte, off int64) (int, error) { return tf.Write(data) }
+
 func (tf *testFs) Name() string                               { return "" }
 func (tf *testFs) Readdirnames(n int) ([]string, error)       { return tf.dirnames, nil }
 func (tf *testFs) Readdir(n int) ([]os.FileInfo, error)       { return nil, nil }
@@ -213,6 +224,134 @@ func TestUtilWalk(t *testing.T) {
 	}
 }
 
+func TestUtilExists(t *testing.T) {
+	fs := NewMemFs(WithPermissions())
+	fs.Mkdir("/dir", 0755)
+	fs.Mkdir("/private", 0)
+	WriteFile(fs, "/file", nil, 0644)
+
+	tests := []struct {
+		name        string
+		path        string
+		wantExists  bool
+		wantDir     bool
+		wantRegular bool
+		wantErr     error
+	}{
+		{"file", "/file", true, false, true, nil},
+		{"dir", "/dir", true, true, false, nil},
+		{"missing", "/missing", false, false, false, nil},
+		{"missing parent", "/missing/file", false, false, false, nil},
+		{"permission", "/private/file", false, false, false, ErrPermission},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exists, err := Exists(fs, test.path)
+			if !IsError(test.wantErr, err) || exists != test.wantExists {
+				t.Errorf("Exists wanted %v (%v) got %v (%v)", test.wantExists, test.wantErr, exists, err)
+			}
+
+			isDir, err := DirExists(fs, test.path)
+			if !IsError(test.wantErr, err) || isDir != test.wantDir {
+				t.Errorf("DirExists wanted %v (%v) got %v (%v)", test.wantDir, test.wantErr, isDir, err)
+			}
+
+			regular, err := IsRegular(fs, test.path)
+			if !IsError(test.wantErr, err) || regular != test.wantRegular {
+				t.Errorf("IsRegular wanted %v (%v) got %v (%v)", test.wantRegular, test.wantErr, regular, err)
+			}
+		})
+	}
+}
+
+func TestUtilSameFile(t *testing.T) {
+	memfs := NewMemFs()
+	WriteFile(memfs, "/file", nil, 0644)
+	WriteFile(memfs, "/other", nil, 0644)
+	memfs.(interface{ Symlink(string, string) error }).Symlink("/file", "/link")
+
+	tempfs := NewTempFs()
+	defer tempfs.Close()
+	WriteFile(tempfs, "/file", nil, 0644)
+	WriteFile(tempfs, "/other", nil, 0644)
+
+	cryptfs, _ := NewCryptFs(memfs, make([]byte, 32))
+	WriteFile(cryptfs, "/encrypted", nil, 0644)
+
+	stat := func(fs FileSystem, name string) os.FileInfo {
+		info, err := fs.Stat(name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return info
+	}
+
+	tests := []struct {
+		name string
+		fi1  os.FileInfo
+		fi2  os.FileInfo
+		want bool
+	}{
+		{"memfs same", stat(memfs, "/file"), stat(memfs, "/file"), true},
+		{"memfs link", stat(memfs, "/file"), stat(memfs, "/link"), true},
+		{"memfs different", stat(memfs, "/file"), stat(memfs, "/other"), false},
+		{"osfs same", stat(tempfs, "/file"), stat(tempfs, "/file"), true},
+		{"osfs different", stat(tempfs, "/file"), stat(tempfs, "/other"), false},
+		{"different filesystems", stat(memfs, "/file"), stat(tempfs, "/file"), false},
+		{"wrapped", stat(cryptfs, "/encrypted"), stat(memfs, "/encrypted"), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SameFile(test.fi1, test.fi2); got != test.want {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestUtilEvalSymlinks(t *testing.T) {
+	fs := NewMemFs()
+	linker := fs.(interface{ Symlink(string, string) error })
+	MkdirAll(fs, "/real/dir", 0755)
+	WriteFile(fs, "/real/dir/file", nil, 0644)
+	linker.Symlink("/real", "/absolute")
+	linker.Symlink("dir/file", "/real/relative")
+	linker.Symlink("/b", "/a")
+	linker.Symlink("/a", "/b")
+
+	tempfs := NewTempFs()
+	defer tempfs.Close()
+	WriteFile(tempfs, "/file", nil, 0644)
+
+	tests := []struct {
+		name    string
+		fs      FileSystem
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"no links", fs, "/real/dir/file", "/real/dir/file", nil},
+		{"absolute", fs, "/absolute/dir/file", "/real/dir/file", nil},
+		{"relative", fs, "/absolute/relative", "/real/dir/file", nil},
+		{"missing", fs, "/absolute/missing", "", ErrNotExist},
+		{"loop", fs, "/a/file", "", ErrLoop},
+		{"osfs", tempfs, "/file/", "/file", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := EvalSymlinks(test.fs, test.input)
+			if !IsError(test.wantErr, err) {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if got != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
 func TestUtilMkdirAll(t *testing.T) {
 	fs := NewTempFs()
 	if closer, ok := fs.(io.Closer); ok {
@@ -268,6 +407,55 @@ func TestUtilMkdirAll(t *testing.T) {
 	}
 }
 
+func TestUtilRemoveAll(t *testing.T) {
+	fs := NewTempFs()
+	defer fs.Close()
+
+	MkdirAll(fs, "/one/two/three", 0755)
+	fs.Create("/one/1.txt")
+	fs.Create("/one/two/three/3.txt")
+	fs.Create("/keep.txt")
+
+	if err := RemoveAll(fs, "/one"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if _, err := fs.Stat("/one"); !IsNotExist(err) {
+		t.Errorf("Expected /one to be removed, got %v", err)
+	}
+
+	if _, err := fs.Stat("/keep.txt"); err != nil {
+		t.Errorf("Expected /keep.txt to remain, got %v", err)
+	}
+
+	if err := RemoveAll(fs, "/missing"); err != nil {
+		t.Errorf("Wanted no error for missing path got %v", err)
+	}
+}
+
+func TestUtilRemoveAllLinks(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/target/dir", 0755)
+	WriteFile(fs, "/target/dir/file", nil, 0644)
+	fs.Mkdir("/tree", 0755)
+	fs.(symlinker).Symlink("/target", "/tree/link")
+
+	// the link goes, what it points to stays
+	if err := RemoveAll(fs, "/tree"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if _, err = fs.Lstat("/tree"); !IsNotExist(err) {
+		t.Errorf("Expected /tree to be removed, got %v", err)
+	} else if _, err = fs.Stat("/target/dir/file"); err != nil {
+		t.Errorf("Expected the link target to remain, got %v", err)
+	}
+
+	// the first error is returned
+	snapshot := fs.(interface{ Snapshot() FileSystem }).Snapshot()
+	if err := RemoveAll(snapshot, "/target"); !IsError(ErrReadOnly, err) {
+		t.Errorf("Wanted %v got %v", ErrReadOnly, err)
+	}
+}
+
 func TestGlob(t *testing.T) {
 	fs := NewTempFs()
 	fs.Create("foo.bar")
@@ -309,3 +497,155 @@ func TestGlob(t *testing.T) {
 	}
 	fs.Close()
 }
+
+func TestGlobStar(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/assets/css/vendor", 0755)
+	WriteFile(fs, "/assets/site.css", nil, 0644)
+	WriteFile(fs, "/assets/site.js", nil, 0644)
+	WriteFile(fs, "/assets/css/main.css", nil, 0644)
+	WriteFile(fs, "/assets/css/vendor/lib.css", nil, 0644)
+	WriteFile(fs, "/other.css", nil, 0644)
+
+	tests := []struct {
+		pattern string
+		want    []string
+		wantErr error
+	}{
+		{"/assets/**/*.css", []string{"/assets/css/main.css", "/assets/css/vendor/lib.css", "/assets/site.css"}, nil},
+		{"/**/*.css", []string{"/assets/css/main.css", "/assets/css/vendor/lib.css", "/assets/site.css", "/other.css"}, nil},
+		{"/assets/**", []string{"/assets", "/assets/css", "/assets/css/main.css", "/assets/css/vendor", "/assets/css/vendor/lib.css", "/assets/site.css", "/assets/site.js"}, nil},
+		{"/assets/**/vendor/*", []string{"/assets/css/vendor/lib.css"}, nil},
+		{"/**/**/lib.css", []string{"/assets/css/vendor/lib.css"}, nil},
+		{"/*/site.js", []string{"/assets/site.js"}, nil},
+		{"/assets/site.js", []string{"/assets/site.js"}, nil},
+		{"/missing/**/*.css", nil, nil},
+		{"/**/[", nil, ErrBadPattern},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			got, err := GlobStar(fs, test.pattern)
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			} else if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted %v got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestUtilCloneFile(t *testing.T) {
+	tempfs := NewTempFs()
+	defer tempfs.Close()
+
+	for _, fs := range []FileSystem{NewMemFs(), tempfs, NewTrashFs(NewMemFs())} {
+		contents := bytes.Repeat([]byte("0123456789"), 1000)
+		WriteFile(fs, "/file", contents, 0640)
+		WriteFile(fs, "/existing", []byte("existing"), 0644)
+		fs.Mkdir("/dir", 0755)
+
+		tests := []struct {
+			name    string
+			src     string
+			dst     string
+			wantErr error
+		}{
+			{"new file", "/file", "/clone", nil},
+			{"replace", "/file", "/existing", nil},
+			{"same file", "/file", "/file", nil},
+			{"directory", "/dir", "/clone", ErrIsDir},
+			{"onto directory", "/file", "/dir", ErrIsDir},
+			{"missing", "/missing", "/clone", ErrNotExist},
+		}
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%T %s", fs, test.name), func(t *testing.T) {
+				err := CloneFile(fs, test.src, test.dst)
+				if !IsError(test.wantErr, err) {
+					t.Fatalf("Wanted error %v got %v", test.wantErr, err)
+				} else if err != nil {
+					return
+				}
+
+				if got, _ := ReadFile(fs, test.dst); !bytes.Equal(contents, got) {
+					t.Errorf("Wanted %d bytes of the source got %d bytes", len(contents), len(got))
+				}
+			})
+		}
+
+		// the copy is independent of the source
+		f, _ := fs.OpenFile("/clone", WrOnlyFlag, 0)
+		f.WriteAt([]byte("changed"), 0)
+		closeFile(f)
+		if got, _ := ReadFile(fs, "/file"); !bytes.Equal(contents, got) {
+			t.Errorf("Wanted the source of %T to be unchanged", fs)
+		}
+
+		if info, _ := fs.Stat("/clone"); info.Mode().Perm() != 0640 {
+			t.Errorf("Wanted mode %v got %v", os.FileMode(0640), info.Mode().Perm())
+		}
+	}
+}
+
+func TestUtilCopy(t *testing.T) {
+	tempfs := NewTempFs()
+	defer tempfs.Close()
+
+	for _, fs := range []FileSystem{NewMemFs(), tempfs} {
+		t.Run(fmt.Sprintf("%T", fs), func(t *testing.T) {
+			fs.Mkdir("/dir", 0750)
+			fs.Mkdir("/dir/sub", 0700)
+			WriteFile(fs, "/dir/file", bytes.Repeat([]byte("file"), 1024), 0640)
+			WriteFile(fs, "/dir/sub/file", []byte("sub"), 0600)
+			WriteFile(fs, "/copy/file", []byte("replaced"), 0644)
+			names := []string{"/", "/file", "/sub", "/sub/file"}
+			linker, links := fs.(symlinker)
+			if links {
+				linker.Symlink("sub/file", "/dir/link")
+				names = append(names, "/link")
+			}
+
+			if err := Copy(fs, "/dir", "/copy"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, name := range names {
+				want, _ := fs.Lstat(path.Join("/dir", name))
+				got, err := fs.Lstat(path.Join("/copy", name))
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				} else if want.Mode() != got.Mode() {
+					t.Errorf("Wanted %s to have mode %v got %v", name, want.Mode(), got.Mode())
+				} else if want.Mode().IsRegular() {
+					wantData, _ := ReadFile(fs, path.Join("/dir", name))
+					gotData, _ := ReadFile(fs, path.Join("/copy", name))
+					if !bytes.Equal(wantData, gotData) {
+						t.Errorf("Wanted %q got %q", wantData, gotData)
+					}
+				}
+			}
+
+			if got, _ := ReadFile(fs, "/copy/link"); links && string(got) != "sub" {
+				t.Errorf("Wanted the link to resolve in the copy got %q", got)
+			}
+
+			tests := []struct {
+				name    string
+				src     string
+				dst     string
+				wantErr error
+			}{
+				{"into itself", "/dir", "/dir/sub/copy", ErrBusy},
+				{"root", "/", "/copy", ErrBusy},
+				{"missing", "/missing", "/copy", ErrNotExist},
+			}
+
+			for _, test := range tests {
+				if err := Copy(fs, test.src, test.dst); !IsError(test.wantErr, err) {
+					t.Errorf("%s: wanted %v got %v", test.name, test.wantErr, err)
+				}
+			}
+		})
+	}
+}
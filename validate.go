@@ -0,0 +1,128 @@
+package vfs
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// NameValidator checks the name of an entry about to be created.  name is
+// the last element of the path, a non-nil error rejects it and is reported
+// as the cause of the failed operation
+type NameValidator func(name string) error
+
+// RejectNUL rejects names containing a NUL byte, which most operating
+// systems cannot store
+func RejectNUL(name string) error {
+	if strings.IndexByte(name, 0) >= 0 {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// RejectControlChars rejects names containing ASCII control characters,
+// NUL included
+func RejectControlChars(name string) error {
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] == 0x7f {
+			return ErrInvalidName
+		}
+	}
+	return nil
+}
+
+// windowsReserved holds the device names Windows reserves in every directory
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// RejectWindowsReserved rejects the device names Windows reserves, such as
+// CON or LPT1, in any case and with any extension
+func RejectWindowsReserved(name string) error {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+
+	if windowsReserved[strings.ToUpper(strings.TrimRight(name, " "))] {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// MaxNameLength returns a NameValidator rejecting names longer than max
+// bytes with ErrNameTooLong
+func MaxNameLength(max int) NameValidator {
+	return func(name string) error {
+		if len(name) > max {
+			return ErrNameTooLong
+		}
+		return nil
+	}
+}
+
+// validatingfs consults its validators before creating entries in the
+// FileSystem it wraps
+type validatingfs struct {
+	FileSystem
+	validators []NameValidator
+}
+
+// NewValidatingFs returns a FileSystem that checks the name of every file
+// and directory created through it, by Create, OpenFile with CreateFlag,
+// Mkdir or as the new name of Rename, against each of validators in turn.
+// Names that already exist are not checked, so existing files can still be
+// opened and replaced
+func NewValidatingFs(fs FileSystem, validators ...NameValidator) FileSystem {
+	return &validatingfs{FileSystem: fs, validators: validators}
+}
+
+// validate checks the last element of name unless it already exists
+func (valfs *validatingfs) validate(name string) error {
+	if _, err := valfs.FileSystem.Lstat(name); !IsNotExist(err) {
+		return nil
+	}
+
+	base := path.Base(Clean(name))
+	for _, validator := range valfs.validators {
+		if err := validator(base); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (valfs *validatingfs) Create(filename string) (File, error) {
+	return valfs.OpenFile(filename, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (valfs *validatingfs) OpenFile(filename string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if flag.has(CreateFlag) {
+		if err := valfs.validate(filename); err != nil {
+			return nil, &PathError{Op: "open", Path: filename, Cause: err}
+		}
+	}
+	return valfs.FileSystem.OpenFile(filename, flag, perm)
+}
+
+func (valfs *validatingfs) Mkdir(name string, perm os.FileMode) error {
+	if err := valfs.validate(name); err != nil {
+		return &PathError{Op: "mkdir", Path: name, Cause: err}
+	}
+	return valfs.FileSystem.Mkdir(name, perm)
+}
+
+func (valfs *validatingfs) Rename(oldpath, newpath string) error {
+	if err := valfs.validate(newpath); err != nil {
+		return &LinkError{Op: "rename", Old: oldpath, New: newpath, Cause: err}
+	}
+	return valfs.FileSystem.Rename(oldpath, newpath)
+}
+
+// Unwrap returns the FileSystem the names are checked for
+func (valfs *validatingfs) Unwrap() []FileSystem {
+	return []FileSystem{valfs.FileSystem}
+}
@@ -0,0 +1,68 @@
+package vfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameValidators(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator NameValidator
+		input     string
+		wantErr   error
+	}{
+		{"NUL", RejectNUL, "a\x00b", ErrInvalidName},
+		{"no NUL", RejectNUL, "a\tb", nil},
+		{"control", RejectControlChars, "a\tb", ErrInvalidName},
+		{"delete", RejectControlChars, "a\x7fb", ErrInvalidName},
+		{"printable", RejectControlChars, "héllo wörld", nil},
+		{"reserved", RejectWindowsReserved, "CON", ErrInvalidName},
+		{"reserved lower case", RejectWindowsReserved, "lpt1", ErrInvalidName},
+		{"reserved with extension", RejectWindowsReserved, "nul.txt", ErrInvalidName},
+		{"not reserved", RejectWindowsReserved, "console", nil},
+		{"too long", MaxNameLength(255), strings.Repeat("x", 256), ErrNameTooLong},
+		{"long enough", MaxNameLength(255), strings.Repeat("x", 255), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.validator(test.input); err != test.wantErr {
+				t.Errorf("Wanted %v got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidatingFs(t *testing.T) {
+	base := NewMemFs()
+	WriteFile(base, "/CON", nil, 0644)
+	fs := NewValidatingFs(base, RejectControlChars, RejectWindowsReserved)
+	WriteFile(fs, "/file", nil, 0644)
+
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr error
+	}{
+		{"create", func() error { _, err := fs.Create("/bad\n"); return err }, ErrInvalidName},
+		{"open to create", func() error { _, err := fs.OpenFile("/aux", WrOnlyFlag|CreateFlag, 0644); return err }, ErrInvalidName},
+		{"mkdir", func() error { return fs.Mkdir("/com1", 0755) }, ErrInvalidName},
+		{"rename", func() error { return fs.Rename("/file", "/prn.txt") }, ErrInvalidName},
+		{"valid", func() error { return fs.Mkdir("/dir", 0755) }, nil},
+		{"existing", func() error { _, err := fs.Create("/CON"); return err }, nil},
+		{"open", func() error { _, err := fs.Open("/CON"); return err }, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.op(); !IsError(test.wantErr, err) {
+				t.Errorf("Wanted %v got %v", test.wantErr, err)
+			}
+		})
+	}
+
+	if exists, _ := Exists(base, "/file"); !exists {
+		t.Errorf("Wanted the rejected rename to leave the file in place")
+	}
+}
@@ -0,0 +1,333 @@
+package vfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// versionSuffix is added to the name of a file to find the directory of the
+// history FileSystem holding its versions
+const versionSuffix = ".versions"
+
+// Version describes a previous revision of a file kept by a VersionFs
+type Version struct {
+	// Number identifies the version, versions of a file are numbered from
+	// 1 in the order they were saved
+	Number int
+
+	// Size and ModTime are those of the file when it was saved
+	Size    int64
+	ModTime time.Time
+}
+
+// VersionFs keeps the previous contents of files every time they are
+// changed.  Before a file is first written through a handle, truncated,
+// removed or replaced by Rename its contents are saved as a new version in
+// the history FileSystem.  Versions of a file can be listed, read and
+// restored by name, including after the file was removed.  Renaming a file
+// does not move its versions.  Only regular files are versioned
+type VersionFs struct {
+	FileSystem
+	history     FileSystem
+	maxVersions int
+
+	// mu serializes saving versions so that each gets its own number
+	mu sync.Mutex
+}
+
+// NewVersionFs returns a VersionFs keeping the versions of the files in base
+// in history.  WithMaxVersions limits how many versions of each file are
+// kept
+func NewVersionFs(base, history FileSystem, opts ...Option) *VersionFs {
+	verfs := &VersionFs{FileSystem: base, history: history}
+	for _, opt := range opts {
+		opt(verfs)
+	}
+	return verfs
+}
+
+// versionDir returns the directory of the history holding the versions of
+// the named file
+func versionDir(name string) string {
+	return Clean(name) + versionSuffix
+}
+
+// Versions returns the versions kept of the named file, oldest first
+func (verfs *VersionFs) Versions(name string) ([]Version, error) {
+	infos, err := readDir(verfs.history, versionDir(name))
+	if IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, info := range infos {
+		if n, err := strconv.Atoi(info.Name()); err == nil && n > 0 && info.Mode().IsRegular() {
+			versions = append(versions, Version{Number: n, Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Number < versions[j].Number })
+	return versions, nil
+}
+
+// OpenVersion opens version n of the named file for reading
+func (verfs *VersionFs) OpenVersion(name string, n int) (File, error) {
+	f, err := verfs.history.Open(path.Join(versionDir(name), strconv.Itoa(n)))
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: name, Cause: fixCause(err)}
+	}
+	return &subFile{File: f, name: name}, nil
+}
+
+// Restore replaces the contents of the named file with version n, which is
+// kept.  The contents being replaced are saved as a new version first, so a
+// restore can be undone as well
+func (verfs *VersionFs) Restore(name string, n int) error {
+	version := path.Join(versionDir(name), strconv.Itoa(n))
+	info, err := verfs.history.Stat(version)
+	if err != nil {
+		return &PathError{Op: "restore", Path: name, Cause: fixCause(err)}
+	}
+
+	if err = verfs.save(name); err != nil {
+		return err
+	}
+
+	w, err := verfs.FileSystem.OpenFile(name, WrOnlyFlag|CreateFlag|TruncFlag, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	err = copyTo(w, verfs.history, version)
+	if closer, ok := w.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// save keeps the current contents of the named file as its next version.
+// Nothing is saved for files that do not exist or are not regular files
+func (verfs *VersionFs) save(name string) error {
+	verfs.mu.Lock()
+	defer verfs.mu.Unlock()
+	info, err := verfs.FileSystem.Lstat(name)
+	if IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	versions, err := verfs.Versions(name)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Number + 1
+	}
+
+	dir := versionDir(name)
+	version := path.Join(dir, strconv.Itoa(next))
+	if err = MkdirAll(verfs.history, dir, 0755); err != nil {
+		return err
+	}
+
+	w, err := verfs.history.OpenFile(version, WrOnlyFlag|CreateFlag|ExclFlag, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	err = copyTo(w, verfs.FileSystem, name)
+	if closer, ok := w.(io.Closer); ok {
+		if err1 := closer.Close(); err == nil {
+			err = err1
+		}
+	}
+
+	if err != nil {
+		verfs.history.Remove(version)
+		return err
+	}
+
+	if chtimer, ok := verfs.history.(chtimer); ok {
+		chtimer.Chtimes(version, info.ModTime(), info.ModTime())
+	}
+
+	// drop the oldest versions beyond the limit
+	for i := 0; verfs.maxVersions > 0 && i < len(versions)+1-verfs.maxVersions; i++ {
+		if err = verfs.history.Remove(path.Join(dir, strconv.Itoa(versions[i].Number))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GC deletes the versions whose contents were last modified at least
+// policy.MinAge ago, the oldest first, until the versions that are left
+// take up no more than policy.TargetBytes
+func (verfs *VersionFs) GC(ctx context.Context, policy GCPolicy) (report GCReport, err error) {
+	type candidate struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+
+	verfs.mu.Lock()
+	defer verfs.mu.Unlock()
+	var (
+		candidates []candidate
+		total      int64
+	)
+	now := time.Now()
+	err = Walk(verfs.history, PathSeparator, func(name string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || !strings.HasSuffix(path.Dir(name), versionSuffix) {
+			return err
+		} else if n, err := strconv.Atoi(info.Name()); err != nil || n <= 0 {
+			return nil
+		}
+
+		total += info.Size()
+		if policy.MinAge == 0 || now.Sub(info.ModTime()) >= policy.MinAge {
+			candidates = append(candidates, candidate{name, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return report, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].modTime.Before(candidates[j].modTime)
+	})
+
+	for _, c := range candidates {
+		if policy.TargetBytes > 0 && total <= policy.TargetBytes {
+			break
+		} else if err = ctx.Err(); err != nil {
+			break
+		}
+
+		if !policy.DryRun {
+			if err = verfs.history.Remove(c.name); err != nil {
+				break
+			}
+		}
+		total -= c.size
+		report.Items = append(report.Items, GCItem{Layer: "version", Path: c.name, Bytes: c.size})
+		report.Bytes += c.size
+	}
+	return report, err
+}
+
+func (verfs *VersionFs) Create(name string) (File, error) {
+	return verfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+// OpenFile opens the named file.  Files truncated by opening them are saved
+// first, files opened for writing are saved when they are first changed
+func (verfs *VersionFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	if flag.has(TruncFlag) {
+		if err := verfs.save(name); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := verfs.FileSystem.OpenFile(name, flag, perm)
+	if err != nil || flag.accessMode() == RdOnlyFlag || flag.has(TruncFlag) {
+		return f, err
+	}
+	return &versionFile{File: f, fs: verfs, name: name}, nil
+}
+
+// Remove saves the named file before removing it
+func (verfs *VersionFs) Remove(name string) error {
+	if err := verfs.save(name); err != nil {
+		return err
+	}
+	return verfs.FileSystem.Remove(name)
+}
+
+// Rename saves the file replaced at newpath, if any, before renaming
+func (verfs *VersionFs) Rename(oldpath, newpath string) error {
+	if Clean(oldpath) != Clean(newpath) {
+		if err := verfs.save(newpath); err != nil {
+			return err
+		}
+	}
+	return verfs.FileSystem.Rename(oldpath, newpath)
+}
+
+// Close closes the base and history FileSystems
+func (verfs *VersionFs) Close() error {
+	err := verfs.FileSystem.Close()
+	if err1 := verfs.history.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// Unwrap returns the base and history FileSystems
+func (verfs *VersionFs) Unwrap() []FileSystem {
+	return []FileSystem{verfs.FileSystem, verfs.history}
+}
+
+// versionFile saves the file it was opened on before the first change made
+// through it
+type versionFile struct {
+	File
+	fs    *VersionFs
+	name  string
+	once  sync.Once
+	saved error
+}
+
+// save saves the file once
+func (f *versionFile) save() error {
+	f.once.Do(func() { f.saved = f.fs.save(f.name) })
+	return f.saved
+}
+
+func (f *versionFile) Write(p []byte) (int, error) {
+	if err := f.save(); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *versionFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.save(); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+// Truncate saves the file before changing its size
+func (f *versionFile) Truncate(size int64) error {
+	truncater, ok := f.File.(interface{ Truncate(int64) error })
+	if !ok {
+		return &PathError{Op: "truncate", Path: f.name, Cause: ErrNotSupported}
+	} else if err := f.save(); err != nil {
+		return err
+	}
+	return truncater.Truncate(size)
+}
+
+// Close closes the underlying file if it can be closed
+func (f *versionFile) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
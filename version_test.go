@@ -0,0 +1,175 @@
+package vfs
+
+import (
+	"context"
+	"io"
+	"path"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// versionContents returns the contents of every version of a file
+func versionContents(t *testing.T, fs *VersionFs, name string) (contents []string) {
+	versions, err := fs.Versions(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, version := range versions {
+		f, err := fs.OpenVersion(name, version.Number)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, _ := io.ReadAll(f)
+		closeFile(f)
+		if int64(len(data)) != version.Size {
+			t.Errorf("Wanted version %d to be %d bytes got %d", version.Number, version.Size, len(data))
+		}
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+func TestVersionFs(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(fs *VersionFs) error
+		want   []string
+	}{
+		{"create", func(fs *VersionFs) error { return WriteFile(fs, "/new", []byte("new"), 0644) }, nil},
+		{"write file", func(fs *VersionFs) error { return WriteFile(fs, "/file", []byte("two"), 0644) }, []string{"one"}},
+		{"open without writing", func(fs *VersionFs) error {
+			f, err := fs.OpenFile("/file", RdWrFlag, 0)
+			closeFile(f)
+			return err
+		}, nil},
+		{"write twice through a handle", func(fs *VersionFs) error {
+			f, err := fs.OpenFile("/file", WrOnlyFlag|AppendFlag, 0)
+			if err == nil {
+				f.Write([]byte(" two"))
+				f.Write([]byte(" three"))
+				closeFile(f)
+			}
+			return err
+		}, []string{"one"}},
+		{"remove", func(fs *VersionFs) error { return fs.Remove("/file") }, []string{"one"}},
+		{"rename over", func(fs *VersionFs) error {
+			WriteFile(fs, "/other", []byte("other"), 0644)
+			return fs.Rename("/other", "/file")
+		}, []string{"one"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewVersionFs(NewMemFs(), NewMemFs())
+			WriteFile(fs, "/file", []byte("one"), 0644)
+			if err := test.change(fs); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := versionContents(t, fs, "/file"); !reflect.DeepEqual(test.want, got) {
+				t.Errorf("Wanted versions %q got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestVersionFsRestore(t *testing.T) {
+	fs := NewVersionFs(NewMemFs(), NewMemFs(), WithMaxVersions(3))
+	for _, contents := range []string{"one", "two", "three", "four", "five"} {
+		WriteFile(fs, "/file", []byte(contents), 0644)
+	}
+
+	want := []string{"two", "three", "four"}
+	if got := versionContents(t, fs, "/file"); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted versions %q got %q", want, got)
+	}
+
+	versions, _ := fs.Versions("/file")
+	if versions[0].Number != 2 {
+		t.Errorf("Wanted the oldest version kept to be 2 got %d", versions[0].Number)
+	}
+
+	if err := fs.Restore("/file", 3); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(fs, "/file"); string(got) != "three" {
+		t.Errorf("Wanted %q got %q", "three", got)
+	}
+
+	// the replaced contents are kept so the restore can be undone
+	want = []string{"three", "four", "five"}
+	if got := versionContents(t, fs, "/file"); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted versions %q got %q", want, got)
+	}
+
+	// removed files can be restored
+	fs.Remove("/file")
+	if err := fs.Restore("/file", 6); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(fs, "/file"); string(got) != "three" {
+		t.Errorf("Wanted %q got %q", "three", got)
+	}
+
+	if err := fs.Restore("/file", 1); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+
+	if _, err := fs.OpenVersion("/missing", 1); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+}
+
+func TestVersionFsGC(t *testing.T) {
+	history := NewMemFs()
+	fs := NewVersionFs(NewMemFs(), history)
+	for _, contents := range []string{"1111", "22222", "333333", "current"} {
+		WriteFile(fs, "/file", []byte(contents), 0644)
+	}
+
+	// the first two versions were saved hours ago
+	chtimes := history.(interface {
+		Chtimes(string, time.Time, time.Time) error
+	}).Chtimes
+	for n, age := range map[int]time.Duration{1: 3 * time.Hour, 2: 2 * time.Hour} {
+		old := time.Now().Add(-age)
+		chtimes(path.Join(versionDir("/file"), strconv.Itoa(n)), old, old)
+	}
+
+	tests := []struct {
+		name         string
+		policy       GCPolicy
+		wantItems    []string
+		wantVersions []string
+	}{
+		{"dry run", GCPolicy{DryRun: true, MinAge: time.Hour}, []string{"/file.versions/1", "/file.versions/2"}, []string{"1111", "22222", "333333"}},
+		{"target bytes", GCPolicy{MinAge: time.Hour, TargetBytes: 11}, []string{"/file.versions/1"}, []string{"22222", "333333"}},
+		{"min age", GCPolicy{MinAge: time.Hour}, []string{"/file.versions/2"}, []string{"333333"}},
+	}
+
+	for _, test := range tests {
+		report, err := GC(context.Background(), fs, test.policy)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var items []string
+		for _, item := range report.Items {
+			if item.Layer == "version" {
+				items = append(items, item.Path)
+			}
+		}
+
+		if !reflect.DeepEqual(test.wantItems, items) {
+			t.Errorf("%s: Wanted %v got %v", test.name, test.wantItems, items)
+		}
+
+		if got := versionContents(t, fs, "/file"); !reflect.DeepEqual(test.wantVersions, got) {
+			t.Errorf("%s: Wanted versions %q got %q", test.name, test.wantVersions, got)
+		}
+	}
+}
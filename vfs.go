@@ -15,8 +15,10 @@
 package vfs
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 // OpenFlag is passed to Open functions to indicate any actions taken
@@ -37,7 +39,10 @@ const (
 
 	// The remaining values may be or'ed in to control behavior.
 
-	// AppendFlag will seek the open file to the end
+	// AppendFlag makes every Write land at the end of the file, wherever the
+	// handle's offset was and however many other handles are appending to the
+	// same file.  WriteAt ignores AppendFlag, although osfs refuses WriteAt
+	// on such files altogether
 	AppendFlag OpenFlag = OpenFlag(os.O_APPEND)
 
 	// CreateFlag will create the file if it does not exist
@@ -48,6 +53,17 @@ const (
 
 	// TruncFlag will truncate a file when it is opened for writing
 	TruncFlag = OpenFlag(os.O_TRUNC)
+
+	// SyncFlag makes writes synchronous, returning only once the data and
+	// metadata have reached stable storage.  osfs passes it to the operating
+	// system, memfs has nothing to synchronize and a WriteBackFs flushes the
+	// file to the backing FileSystem after every write
+	SyncFlag = OpenFlag(os.O_SYNC)
+
+	// DsyncFlag is like SyncFlag but only waits for the data and the
+	// metadata needed to read it back.  Platforms without O_DSYNC use
+	// O_SYNC instead
+	DsyncFlag = OpenFlag(dsyncFlag)
 )
 
 const (
@@ -64,21 +80,61 @@ func (of OpenFlag) has(flag OpenFlag) bool {
 	return of&flag == flag
 }
 
-// check determines if the set of flags given are valid.  For instance, if both
-// O_WRONLY and O_RDWR are set that is an invalid state (can't open a file both
-// write only and read/write)
+// accessMode returns only the access mode bits (RdOnlyFlag, WrOnlyFlag or RdWrFlag)
+// of the flag
+func (of OpenFlag) accessMode() OpenFlag {
+	return of & (RdOnlyFlag | WrOnlyFlag | RdWrFlag)
+}
+
+// String returns the flags in the style of the os package constants, such
+// as "O_RDWR|O_CREATE|O_TRUNC"
+func (of OpenFlag) String() string {
+	var names []string
+	switch of.accessMode() {
+	case RdOnlyFlag:
+		names = append(names, "O_RDONLY")
+	case WrOnlyFlag:
+		names = append(names, "O_WRONLY")
+	case RdWrFlag:
+		names = append(names, "O_RDWR")
+	default:
+		names = append(names, "O_WRONLY|O_RDWR")
+	}
+
+	for _, flag := range []struct {
+		flag OpenFlag
+		name string
+	}{{AppendFlag, "O_APPEND"}, {CreateFlag, "O_CREATE"}, {ExclFlag, "O_EXCL"}, {TruncFlag, "O_TRUNC"}} {
+		if of.has(flag.flag) {
+			names = append(names, flag.name)
+		}
+	}
+
+	// O_SYNC includes the O_DSYNC bit on some platforms
+	if of.has(SyncFlag) {
+		names = append(names, "O_SYNC")
+	} else if of.has(DsyncFlag) {
+		names = append(names, "O_DSYNC")
+	}
+
+	if rest := of &^ (RdOnlyFlag | WrOnlyFlag | RdWrFlag | AppendFlag | CreateFlag | ExclFlag | TruncFlag | SyncFlag | DsyncFlag); rest != 0 {
+		names = append(names, fmt.Sprintf("0x%x", int(rest)))
+	}
+	return strings.Join(names, "|")
+}
+
+// check determines if the set of flags given are valid.  The validation follows
+// os.OpenFile as closely as possible: AppendFlag, CreateFlag, ExclFlag, TruncFlag,
+// SyncFlag and DsyncFlag may be combined with any access mode (including RdOnlyFlag)
+// and ExclFlag without CreateFlag is ignored.
+//
+// The one deliberate deviation is that both WrOnlyFlag and RdWrFlag set at the same
+// time is rejected with ErrInvalidFlags.  Some operating systems will open such a
+// file, but the resulting handle can neither be read from nor written to
 func (of OpenFlag) check() (err error) {
 	if of.has(WrOnlyFlag) && of.has(RdWrFlag) {
 		err = ErrInvalidFlags
-	} else if of != 0 {
-		// only write mode can use create, append and truncate
-		if of.has(AppendFlag) || of.has(CreateFlag) || of.has(TruncFlag) || of.has(ExclFlag) {
-			if !of.has(WrOnlyFlag) && !of.has(RdWrFlag) {
-				err = ErrInvalidFlags
-			}
-		}
 	}
-
 	return
 }
 
@@ -86,6 +142,12 @@ func (of OpenFlag) check() (err error) {
 type File interface {
 	io.ReadWriteSeeker
 
+	// ReaderAt and WriterAt provide positional I/O that neither uses nor
+	// changes the offset used by Read, Write and Seek.  This allows
+	// multiple goroutines to read from the same File concurrently
+	io.ReaderAt
+	io.WriterAt
+
 	// Name returns the name of the file as presented to Open.
 	Name() string
 
@@ -119,6 +181,11 @@ type File interface {
 	// directory, Readdir returns the FileInfo read until that point
 	// and a non-nil error.
 	Readdir(n int) ([]os.FileInfo, error)
+
+	// Stat returns the FileInfo structure describing the open file.  Unlike
+	// calling Stat on the FileSystem, this describes the file the handle
+	// refers to even if the path has since been renamed or removed
+	Stat() (os.FileInfo, error)
 }
 
 // Opener is a FileSystem that has the ability to open files
@@ -176,8 +243,64 @@ type FileSystem interface {
 	// Watcher will create a file watcher instance that can be used to watch
 	// for events on paths of the file system.  The provided Event channel
 	// must be initialized by the caller sized appropriately for buffering
-	// events at the rate expected.  If the channel buffer becomes full a
-	// Watcher will drop the event.  The provided channel will be closed by
-	// the watcher instance when the watcher itself is closed
+	// events at the rate expected.  If the channel buffer becomes full the
+	// memfs and osfs Watchers handle the event according to their
+	// OverflowPolicy, set with WithOverflowPolicy or SetOverflowPolicy.
+	// The default differs: a memfs Watcher drops the event, since waiting
+	// would hold up the change being reported, while an osfs Watcher waits
+	// for the channel to have room.  Other Watchers wait for room as well.
+	// Once passed to Watcher the channel belongs to the watcher instance:
+	// only the watcher sends on it and it is closed by the watcher before
+	// the watcher's Close returns.  Close does not wait for the caller to
+	// read the events still pending, they are dropped.  The caller must
+	// never close the channel.
+	// FileSystems that cannot watch return ErrNotSupported and leave the
+	// channel alone
 	Watcher(chan<- Event) (Watcher, error)
 }
+
+// FileInfoEx is implemented by the FileInfos of FileSystems, such as memfs
+// and osfs, that can describe how a file is stored without resorting to a
+// type switch on Sys
+type FileInfoEx interface {
+	os.FileInfo
+
+	// Ino returns the inode number, which identifies the file among those
+	// of the same FileSystem
+	Ino() uint64
+
+	// Nlink returns the number of hard links to the file
+	Nlink() uint64
+
+	// Blocks returns the number of 512 byte units allocated to the file
+	Blocks() int64
+}
+
+// Chdirer is implemented by FileSystems, such as those returned by NewWdFs,
+// that resolve relative paths from a working directory rather than the root
+type Chdirer interface {
+	// Chdir changes the working directory to dir
+	Chdir(dir string) error
+
+	// Getwd returns the absolute path of the working directory
+	Getwd() (string, error)
+}
+
+// Umasker is implemented by FileSystems, such as memfs and osfs, that mask
+// the permissions of the files and directories they create
+type Umasker interface {
+	// Umask returns the permission bits cleared from new files and
+	// directories
+	Umask() os.FileMode
+
+	// SetUmask changes the mask and returns the previous one
+	SetUmask(mask os.FileMode) os.FileMode
+}
+
+// Cloner is implemented by FileSystems, such as memfs and osfs, that can
+// copy a file without duplicating its data
+type Cloner interface {
+	// CloneFile copies the regular file src to dst, replacing dst if it
+	// exists
+	CloneFile(src, dst string) error
+}
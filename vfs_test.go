@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"testing"
@@ -89,6 +90,58 @@ func testAppendFile(fs vfs.FileSystem, filename string, want []byte) func(t *tes
 	}
 }
 
+func testReadAt(fs vfs.FileSystem, filename string, want []byte) func(t *testing.T) {
+	return func(t *testing.T) {
+		f, err := fs.Open(filename)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer f.(io.Closer).Close()
+
+		got := make([]byte, 100)
+		n, err := f.ReadAt(got, 1000)
+		if n != len(got) || err != nil {
+			t.Errorf("Wanted %d bytes got %d (err %v)", len(got), n, err)
+		} else if !bytes.Equal(want[1000:1100], got) {
+			t.Errorf("Didn't read expected data")
+		}
+
+		// reading past the end must report io.EOF
+		n, err = f.ReadAt(got, int64(len(want)-10))
+		if n != 10 || err != io.EOF {
+			t.Errorf("Wanted 10 bytes and io.EOF got %d and %v", n, err)
+		}
+
+		// the handle offset should not have moved
+		if offset, _ := f.Seek(0, io.SeekCurrent); offset != 0 {
+			t.Errorf("Wanted offset 0 got %d", offset)
+		}
+	}
+}
+
+func testOpenName(fs vfs.FileSystem, filename string, isDir bool) func(t *testing.T) {
+	return func(t *testing.T) {
+		f, err := fs.Open(filename)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer f.(io.Closer).Close()
+
+		if f.Name() != filename {
+			t.Errorf("Wanted name %q got %q", filename, f.Name())
+		}
+
+		fi, err := f.Stat()
+		if err == nil {
+			if fi.IsDir() != isDir {
+				t.Errorf("Wanted IsDir %v got %v", isDir, fi.IsDir())
+			}
+		} else {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+}
+
 func testMkdir(fs vfs.FileSystem, dirname string) func(t *testing.T) {
 	return func(t *testing.T) {
 		_, err := fs.Stat(dirname)
@@ -260,6 +313,9 @@ func TestVFS(t *testing.T) {
 			t.Run("remove file", testRemoveFile(fs, removeFile))
 			t.Run("stat file", testStatFile(fs, writeFile, size, startPerm, nil))
 			t.Run("read file", testReadFile(fs, writeFile, want))
+			t.Run("read at", testReadAt(fs, writeFile, want))
+			t.Run("open name", testOpenName(fs, writeFile, false))
+			t.Run("open dir name", testOpenName(fs, path.Dir(writeFile), true))
 			t.Run("append file", testAppendFile(fs, writeFile, want))
 			t.Run("chmod file", testChmodFile(fs, writeFile, endPerm))
 			fs.Close()
@@ -0,0 +1,131 @@
+package vfstest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+// Clock is a vfs.Clock whose time only moves when Advance is called.  Timer
+// functions run synchronously, in deadline order, inside Advance
+type Clock struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	now       time.Time
+	timers    []*timer
+	scheduled int
+}
+
+// NewClock returns a Clock set to start
+func NewClock(start time.Time) *Clock {
+	c := &Clock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current virtual time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules f to be called once the clock has been advanced by d
+func (c *Clock) AfterFunc(d time.Duration, f func()) vfs.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &timer{clock: c, f: f}
+	c.schedule(t, d)
+	return t
+}
+
+// schedule adds a timer, the lock must be held
+func (c *Clock) schedule(t *timer, d time.Duration) {
+	t.deadline = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	c.scheduled++
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].deadline.Before(c.timers[j].deadline) })
+	c.cond.Broadcast()
+}
+
+// unschedule removes a timer and reports whether it was pending, the lock
+// must be held
+func (c *Clock) unschedule(t *timer) bool {
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock forward by d, firing every timer that falls due
+// along the way.  Timers scheduled by the fired functions also fire if they
+// are due before the new time
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for len(c.timers) > 0 && !c.timers[0].deadline.After(end) {
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.deadline
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// Pending returns the number of timers waiting to fire
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil waits until at least n timers are pending.  Use it to make sure
+// code running in another goroutine has scheduled its timers before calling
+// Advance
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// BlockUntilScheduled waits until timers have been scheduled, by AfterFunc or
+// Reset, n times since the Clock was created.  Unlike BlockUntil it also
+// observes a timer being replaced, as when debouncing, which leaves the
+// number of pending timers unchanged
+func (c *Clock) BlockUntilScheduled(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.scheduled < n {
+		c.cond.Wait()
+	}
+}
+
+type timer struct {
+	clock    *Clock
+	deadline time.Time
+	f        func()
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.unschedule(t)
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	pending := t.clock.unschedule(t)
+	t.clock.schedule(t, d)
+	return pending
+}
@@ -0,0 +1,58 @@
+package vfstest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+
+	var fired []string
+	var at []time.Duration
+	record := func(name string) func() {
+		return func() {
+			fired = append(fired, name)
+			at = append(at, clock.Now().Sub(start))
+		}
+	}
+
+	clock.AfterFunc(30*time.Millisecond, record("third"))
+	clock.AfterFunc(10*time.Millisecond, record("first"))
+	stopped := clock.AfterFunc(20*time.Millisecond, record("stopped"))
+	reset := clock.AfterFunc(5*time.Millisecond, record("reset"))
+	clock.AfterFunc(15*time.Millisecond, func() {
+		record("second")()
+		clock.AfterFunc(10*time.Millisecond, record("chained"))
+	})
+
+	if !stopped.Stop() {
+		t.Errorf("Expected pending timer to stop")
+	}
+
+	if !reset.Reset(40 * time.Millisecond) {
+		t.Errorf("Expected pending timer to reset")
+	}
+
+	clock.Advance(30 * time.Millisecond)
+	want := []string{"first", "second", "chained", "third"}
+	if !reflect.DeepEqual(want, fired) {
+		t.Errorf("Wanted %v got %v", want, fired)
+	}
+
+	wantAt := []time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 25 * time.Millisecond, 30 * time.Millisecond}
+	if !reflect.DeepEqual(wantAt, at) {
+		t.Errorf("Wanted %v got %v", wantAt, at)
+	}
+
+	if clock.Pending() != 1 {
+		t.Errorf("Wanted 1 pending timer got %d", clock.Pending())
+	}
+
+	clock.Advance(10 * time.Millisecond)
+	if fired[len(fired)-1] != "reset" || clock.Pending() != 0 {
+		t.Errorf("Expected reset timer to fire got %v", fired)
+	}
+}
@@ -0,0 +1,86 @@
+package vfstest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+// Timeout is how long Recorder.Expect waits for events to arrive
+var Timeout = time.Second
+
+// Recorder collects the events sent on its channel C
+type Recorder struct {
+	C      chan vfs.Event
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []vfs.Event
+}
+
+// NewRecorder returns a Recorder that collects events from C until C is
+// closed
+func NewRecorder() *Recorder {
+	r := &Recorder{C: make(chan vfs.Event)}
+	r.cond = sync.NewCond(&r.mu)
+	go func() {
+		for event := range r.C {
+			r.mu.Lock()
+			r.events = append(r.events, event)
+			r.cond.Broadcast()
+			r.mu.Unlock()
+		}
+	}()
+	return r
+}
+
+// Events returns a copy of the events recorded so far
+func (r *Recorder) Events() []vfs.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]vfs.Event(nil), r.events...)
+}
+
+// Reset discards the recorded events
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.events = nil
+	r.mu.Unlock()
+}
+
+// wait blocks until n events have been recorded or Timeout elapses
+func (r *Recorder) wait(n int) []vfs.Event {
+	timer := time.AfterFunc(Timeout, func() {
+		r.mu.Lock()
+		r.cond.Broadcast()
+		r.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	deadline := time.Now().Add(Timeout)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.events) < n && time.Now().Before(deadline) {
+		r.cond.Wait()
+	}
+	return append([]vfs.Event(nil), r.events...)
+}
+
+// Expect waits for the recorded events to match want, in order, and reports
+// a test error if they do not.  Only the Type, Path and presence of Error
+// are compared.  The recorded events are reset afterwards
+func (r *Recorder) Expect(t testing.TB, want ...vfs.Event) {
+	t.Helper()
+	got := r.wait(len(want))
+	r.Reset()
+
+	match := len(got) == len(want)
+	for i := 0; match && i < len(got); i++ {
+		match = got[i].Type == want[i].Type && got[i].Path == want[i].Path && (got[i].Error == nil) == (want[i].Error == nil)
+	}
+
+	if !match {
+		t.Errorf("Wanted events %v got %v", want, got)
+	}
+}
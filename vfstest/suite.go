@@ -0,0 +1,618 @@
+package vfstest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+// TestFileSystem runs the conformance suite against the FileSystems returned
+// by newFs.  The suite is the reference for the semantics every backend is
+// expected to share: open flags, seeking, renaming and removing, reading
+// directories in batches and rewinding them, the errors returned and how
+// watchers report changes.  Every test calls newFs for an empty FileSystem
+// of its own, which is closed when the test finishes.  Watcher tests are
+// skipped when the FileSystem returns vfs.ErrNotSupported from Watcher
+func TestFileSystem(t *testing.T, newFs func() vfs.FileSystem) {
+	tests := []struct {
+		name string
+		test func(*testing.T, func() vfs.FileSystem)
+	}{
+		{"open flags", testOpenFlags},
+		{"access mode", testAccessMode},
+		{"seek", testSeek},
+		{"read at", testReadAt},
+		{"mkdir", testMkdir},
+		{"stat", testStat},
+		{"rename", testRename},
+		{"remove", testRemove},
+		{"readdir", testReaddir},
+		{"readdir batches", testReaddirBatches},
+		{"readdir rewind", testReaddirRewind},
+		{"closed", testClosed},
+		{"watcher", testWatcher},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) { test.test(t, newFs) })
+	}
+}
+
+// setup creates the named files, or directories for names ending in a
+// slash, each file containing its own name
+func setup(t *testing.T, fs vfs.FileSystem, names ...string) {
+	for _, name := range names {
+		err := vfs.MkdirAll(fs, path.Dir(name), 0755)
+		if err == nil && name[len(name)-1] != '/' {
+			err = vfs.WriteFile(fs, name, []byte(name), 0644)
+		}
+
+		if err != nil {
+			t.Fatalf("Unexpected error setting up %s: %v", name, err)
+		}
+	}
+}
+
+// checkErr reports a test error unless err is want.  Backends may wrap the
+// vfs sentinels, in a *vfs.PathError for instance, so they are compared with
+// vfs.IsError
+func checkErr(t *testing.T, want, err error) {
+	t.Helper()
+	if !vfs.IsError(want, err) {
+		t.Errorf("Wanted error %v got %v", want, err)
+	}
+}
+
+// checkContent reports a test error unless the named file contains want
+func checkContent(t *testing.T, fs vfs.FileSystem, name string, want string) {
+	t.Helper()
+	if got, err := vfs.ReadFile(fs, name); err != nil {
+		t.Errorf("Unexpected error reading %s: %v", name, err)
+	} else if string(got) != want {
+		t.Errorf("Wanted %s to contain %q got %q", name, want, got)
+	}
+}
+
+func closeFile(f vfs.File) {
+	if closer, ok := f.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func testOpenFlags(t *testing.T, newFs func() vfs.FileSystem) {
+	tests := []struct {
+		name     string
+		filename string
+		flag     vfs.OpenFlag
+		wantErr  error
+		write    string
+		want     string
+	}{
+		{"read only", "/file", vfs.RdOnlyFlag, nil, "", "/file"},
+		{"missing", "/missing", vfs.RdOnlyFlag, vfs.ErrNotExist, "", ""},
+		{"missing parent", "/missing/file", vfs.WrOnlyFlag | vfs.CreateFlag, vfs.ErrNotExist, "", ""},
+		{"create", "/new", vfs.WrOnlyFlag | vfs.CreateFlag, nil, "new", "new"},
+		{"create existing", "/file", vfs.WrOnlyFlag | vfs.CreateFlag, nil, "F", "Ffile"},
+		{"exclusive", "/file", vfs.WrOnlyFlag | vfs.CreateFlag | vfs.ExclFlag, vfs.ErrExist, "", ""},
+		{"exclusive new", "/excl", vfs.WrOnlyFlag | vfs.CreateFlag | vfs.ExclFlag, nil, "excl", "excl"},
+		{"truncate", "/file", vfs.WrOnlyFlag | vfs.TruncFlag, nil, "x", "x"},
+		{"append", "/file", vfs.WrOnlyFlag | vfs.AppendFlag, nil, "!", "/file!"},
+		{"read write", "/file", vfs.RdWrFlag, nil, "F", "Ffile"},
+		{"directory", "/dir", vfs.RdOnlyFlag, nil, "", ""},
+		{"directory for writing", "/dir", vfs.WrOnlyFlag, vfs.ErrIsDir, "", ""},
+		{"file as directory", "/file/child", vfs.RdOnlyFlag, vfs.ErrNotDir, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := newFs()
+			defer fs.Close()
+			setup(t, fs, "/file", "/dir/")
+			f, err := fs.OpenFile(test.filename, test.flag, 0644)
+			checkErr(t, test.wantErr, err)
+			if err != nil {
+				return
+			}
+
+			if f.Name() != test.filename {
+				t.Errorf("Wanted name %q got %q", test.filename, f.Name())
+			}
+
+			if test.write != "" {
+				if n, err := f.Write([]byte(test.write)); n != len(test.write) || err != nil {
+					t.Errorf("Wanted %d bytes written got %d: %v", len(test.write), n, err)
+				}
+			}
+			closeFile(f)
+
+			if test.want != "" {
+				checkContent(t, fs, test.filename, test.want)
+			}
+		})
+	}
+}
+
+func testAccessMode(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/file")
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err = f.Write([]byte("x")); err == nil {
+		t.Errorf("Wanted an error writing a file opened read only")
+	}
+	closeFile(f)
+
+	f, err = fs.OpenFile("/file", vfs.WrOnlyFlag, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err = f.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Wanted an error reading a file opened write only")
+	}
+	closeFile(f)
+	checkContent(t, fs, "/file", "/file")
+}
+
+func testSeek(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	vfs.WriteFile(fs, "/file", []byte("0123456789"), 0644)
+	f, err := fs.OpenFile("/file", vfs.RdWrFlag, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(f)
+
+	tests := []struct {
+		name    string
+		offset  int64
+		whence  int
+		want    int64
+		wantErr bool
+	}{
+		{"start", 3, io.SeekStart, 3, false},
+		{"current", 2, io.SeekCurrent, 5, false},
+		{"end", -1, io.SeekEnd, 9, false},
+		{"before start", -20, io.SeekCurrent, 0, true},
+		{"past end", 15, io.SeekStart, 15, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := f.Seek(test.offset, test.whence)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Wanted an error")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if got != test.want {
+				t.Errorf("Wanted offset %d got %d", test.want, got)
+			}
+		})
+	}
+
+	// writing past the end leaves a gap that reads as zeros
+	if _, err = f.Write([]byte("x")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if n, err := f.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Wanted io.EOF at the end of the file got %d bytes and %v", n, err)
+	}
+	checkContent(t, fs, "/file", "0123456789\x00\x00\x00\x00\x00x")
+}
+
+func testReadAt(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	vfs.WriteFile(fs, "/file", []byte("0123456789"), 0644)
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(f)
+
+	tests := []struct {
+		name    string
+		off     int64
+		want    string
+		wantErr error
+	}{
+		{"middle", 2, "23456", nil},
+		{"end", 5, "56789", nil},
+		{"short", 8, "89", io.EOF},
+		{"past end", 20, "", io.EOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := make([]byte, 5)
+			n, err := f.ReadAt(buf, test.off)
+			if err != test.wantErr {
+				t.Errorf("Wanted error %v got %v", test.wantErr, err)
+			}
+
+			if got := string(buf[:n]); got != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+
+	// ReadAt does not move the offset
+	buf := make([]byte, 3)
+	if n, err := f.Read(buf); n != 3 || err != nil || string(buf) != "012" {
+		t.Errorf("Wanted %q got %q: %v", "012", buf[:n], err)
+	}
+}
+
+func testMkdir(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/file", "/dir/")
+	tests := []struct {
+		name    string
+		dirname string
+		wantErr error
+	}{
+		{"new", "/new", nil},
+		{"nested", "/dir/new", nil},
+		{"existing", "/dir", vfs.ErrExist},
+		{"over file", "/file", vfs.ErrExist},
+		{"missing parent", "/missing/new", vfs.ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkErr(t, test.wantErr, fs.Mkdir(test.dirname, 0755))
+			if test.wantErr == nil {
+				if info, err := fs.Stat(test.dirname); err != nil || !info.IsDir() {
+					t.Errorf("Wanted %s to be a directory: %v", test.dirname, err)
+				}
+			}
+		})
+	}
+}
+
+func testStat(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/file", "/dir/")
+	tests := []struct {
+		name     string
+		filename string
+		wantName string
+		wantSize int64
+		wantDir  bool
+		wantErr  error
+	}{
+		{"file", "/file", "file", 5, false, nil},
+		{"directory", "/dir", "dir", 0, true, nil},
+		{"missing", "/missing", "", 0, false, vfs.ErrNotExist},
+		{"file as directory", "/file/child", "", 0, false, vfs.ErrNotDir},
+	}
+
+	for _, test := range tests {
+		for _, stat := range []func(string) (os.FileInfo, error){fs.Stat, fs.Lstat} {
+			t.Run(test.name, func(t *testing.T) {
+				info, err := stat(test.filename)
+				checkErr(t, test.wantErr, err)
+				if err != nil {
+					return
+				}
+
+				if info.Name() != test.wantName {
+					t.Errorf("Wanted name %q got %q", test.wantName, info.Name())
+				}
+
+				if info.IsDir() != test.wantDir {
+					t.Errorf("Wanted IsDir %v got %v", test.wantDir, info.IsDir())
+				} else if !test.wantDir && info.Size() != test.wantSize {
+					t.Errorf("Wanted size %d got %d", test.wantSize, info.Size())
+				}
+			})
+		}
+	}
+}
+
+func testRename(t *testing.T, newFs func() vfs.FileSystem) {
+	tests := []struct {
+		name    string
+		oldpath string
+		newpath string
+		wantErr error
+		check   string
+		want    string
+	}{
+		{"file", "/a", "/c", nil, "/c", "/a"},
+		{"replace", "/a", "/b", nil, "/b", "/a"},
+		{"same name", "/a", "/a", nil, "/a", "/a"},
+		{"into directory", "/a", "/dir/a", nil, "/dir/a", "/a"},
+		{"directory", "/dir", "/moved", nil, "/moved/child", "/dir/child"},
+		{"missing", "/missing", "/c", vfs.ErrNotExist, "", ""},
+		{"missing parent", "/a", "/missing/a", vfs.ErrNotExist, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := newFs()
+			defer fs.Close()
+			setup(t, fs, "/a", "/b", "/dir/child")
+			checkErr(t, test.wantErr, fs.Rename(test.oldpath, test.newpath))
+			if test.check == "" {
+				return
+			}
+
+			checkContent(t, fs, test.check, test.want)
+			if test.oldpath != test.newpath {
+				if _, err := fs.Lstat(test.oldpath); !vfs.IsNotExist(err) {
+					t.Errorf("Wanted %s to be gone got %v", test.oldpath, err)
+				}
+			}
+		})
+	}
+}
+
+func testRemove(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/file", "/empty/", "/full/child")
+	tests := []struct {
+		name     string
+		filename string
+		wantErr  error
+	}{
+		{"file", "/file", nil},
+		{"empty directory", "/empty", nil},
+		{"full directory", "/full", vfs.ErrNotEmpty},
+		{"missing", "/missing", vfs.ErrNotExist},
+		{"missing parent", "/missing/file", vfs.ErrNotExist},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkErr(t, test.wantErr, fs.Remove(test.filename))
+			if _, err := fs.Lstat(test.filename); test.wantErr == nil && !vfs.IsNotExist(err) {
+				t.Errorf("Wanted %s to be gone got %v", test.filename, err)
+			}
+		})
+	}
+}
+
+func testReaddir(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/dir/a", "/dir/b", "/dir/sub/")
+	want := []string{"a", "b", "sub"}
+
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(f)
+
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := make([]string, len(infos))
+	for i, info := range infos {
+		got[i] = info.Name()
+		if info.IsDir() != (info.Name() == "sub") {
+			t.Errorf("Wanted %s IsDir %v got %v", info.Name(), !info.IsDir(), info.IsDir())
+		}
+	}
+
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+
+	// the directory has been read to the end
+	if infos, err = f.Readdir(-1); len(infos) != 0 || err != nil {
+		t.Errorf("Wanted no entries and no error got %d entries and %v", len(infos), err)
+	}
+
+	dir, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(dir)
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sort.Strings(names)
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("Wanted %v got %v", want, names)
+	}
+
+	f, err = fs.Open("/dir/a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(f)
+
+	if _, err = f.Readdir(-1); err == nil {
+		t.Errorf("Wanted an error reading a file as a directory")
+	}
+}
+
+func testReaddirBatches(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/dir/a", "/dir/b", "/dir/c", "/dir/d", "/dir/e")
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(f)
+
+	seen := make(map[string]bool)
+	for _, want := range []int{2, 2, 1} {
+		names, err := f.Readdirnames(2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if len(names) != want {
+			t.Fatalf("Wanted %d names got %v", want, names)
+		}
+
+		for _, name := range names {
+			if seen[name] {
+				t.Errorf("%s returned more than once", name)
+			}
+			seen[name] = true
+		}
+	}
+
+	if names, err := f.Readdirnames(2); len(names) != 0 || err != io.EOF {
+		t.Errorf("Wanted io.EOF got %v and %v", names, err)
+	}
+}
+
+func testReaddirRewind(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/dir/a", "/dir/b", "/dir/c")
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeFile(f)
+
+	f.Readdirnames(2)
+	for i := 0; i < 2; i++ {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		names, err := f.Readdirnames(-1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		sort.Strings(names)
+		if want := []string{"a", "b", "c"}; fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Errorf("Wanted %v after rewinding got %v", want, names)
+		}
+	}
+}
+
+func testClosed(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/file", "/dir/")
+	f, err := fs.OpenFile("/file", vfs.RdWrFlag, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dir, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, file := range []vfs.File{f, dir} {
+		closer, ok := file.(io.Closer)
+		if !ok {
+			t.Skipf("%T cannot be closed", file)
+		} else if err := closer.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"read", func() error { _, err := f.Read(make([]byte, 1)); return err }},
+		{"read at", func() error { _, err := f.ReadAt(make([]byte, 1), 0); return err }},
+		{"write", func() error { _, err := f.Write([]byte("x")); return err }},
+		{"write at", func() error { _, err := f.WriteAt([]byte("x"), 0); return err }},
+		{"seek", func() error { _, err := f.Seek(0, io.SeekStart); return err }},
+		{"close", func() error { return f.(io.Closer).Close() }},
+		{"readdir", func() error { _, err := dir.Readdir(-1); return err }},
+		{"close directory", func() error { return dir.(io.Closer).Close() }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.op(); !vfs.IsError(vfs.ErrClosed, err) {
+				t.Errorf("Wanted %v got %v", vfs.ErrClosed, err)
+			}
+		})
+	}
+}
+
+// waitFor receives events until one of the given type for name arrives and
+// reports a test error if none does within Timeout.  Backends may report
+// other events along the way, such as a modification following a create
+func waitFor(t *testing.T, events <-chan vfs.Event, eventType vfs.EventType, name string) {
+	t.Helper()
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == eventType && event.Path == name {
+				return
+			} else if event.Type == vfs.ErrorEvent {
+				t.Errorf("Unexpected error event: %v", event.Error)
+			}
+		case <-timeout:
+			t.Errorf("Wanted %v event for %s", eventType, name)
+			return
+		}
+	}
+}
+
+func testWatcher(t *testing.T, newFs func() vfs.FileSystem) {
+	fs := newFs()
+	defer fs.Close()
+	setup(t, fs, "/dir/")
+	events := make(chan vfs.Event, 64)
+	watcher, err := fs.Watcher(events)
+	if vfs.IsError(vfs.ErrNotSupported, err) {
+		t.Skipf("%T does not support watchers", fs)
+	} else if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	if err = watcher.Watch("/dir"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	vfs.WriteFile(fs, "/dir/file", []byte("data"), 0644)
+	waitFor(t, events, vfs.CreateEvent, "/dir/file")
+
+	fs.Remove("/dir/file")
+	waitFor(t, events, vfs.RemoveEvent, "/dir/file")
+
+	if err = watcher.Remove("/dir"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// events for paths that are no longer watched are not delivered
+	vfs.WriteFile(fs, "/dir/other", nil, 0644)
+	select {
+	case event := <-events:
+		if event.Path == "/dir/other" {
+			t.Errorf("Unexpected event %v", &event)
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,15 @@
+package vfstest
+
+import (
+	"testing"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestOsFsConformance(t *testing.T) {
+	TestFileSystem(t, vfs.NewTempFs)
+}
+
+func TestMemFsConformance(t *testing.T) {
+	TestFileSystem(t, func() vfs.FileSystem { return vfs.NewMemFs() })
+}
@@ -0,0 +1,148 @@
+// Package vfstest provides helpers for testing code built on the vfs
+// package.  Watcher based code can be driven deterministically by injecting
+// synthetic events with FileSystem.Emit, advancing timers with a virtual
+// Clock and asserting on the delivered events with a Recorder.
+package vfstest
+
+import (
+	"path"
+	"sync"
+
+	"github.com/mh-orange/vfs"
+)
+
+// FileSystem wraps a vfs.FileSystem so that tests can inject events into
+// the Watchers it creates.  Events from the wrapped FileSystem's own
+// watchers, if it has them, are delivered as well
+type FileSystem struct {
+	vfs.FileSystem
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+// New returns a FileSystem wrapping fs
+func New(fs vfs.FileSystem) *FileSystem {
+	return &FileSystem{FileSystem: fs, watchers: make(map[*watcher]struct{})}
+}
+
+// Watcher returns a Watcher delivering both injected events and those of the
+// wrapped FileSystem to events
+func (fs *FileSystem) Watcher(events chan<- vfs.Event) (vfs.Watcher, error) {
+	w := &watcher{fs: fs, events: events, paths: make(map[string]struct{})}
+	in := make(chan vfs.Event, 64)
+	if inner, err := fs.FileSystem.Watcher(in); err == nil {
+		w.inner = inner
+		w.done = make(chan struct{})
+		go w.forward(in)
+	} else if err != vfs.ErrNotSupported {
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	fs.watchers[w] = struct{}{}
+	fs.mu.Unlock()
+	return w, nil
+}
+
+// Emit delivers events, in order, to every open Watcher watching the event
+// path or its parent directory.  Each event is sent on the Watcher's channel
+// before Emit returns, so the channel must be buffered or be read by another
+// goroutine
+func (fs *FileSystem) Emit(events ...vfs.Event) {
+	fs.mu.Lock()
+	watchers := make([]*watcher, 0, len(fs.watchers))
+	for w := range fs.watchers {
+		watchers = append(watchers, w)
+	}
+	fs.mu.Unlock()
+
+	for _, event := range events {
+		for _, w := range watchers {
+			w.emit(event)
+		}
+	}
+}
+
+// watcher is a vfs.Watcher that also accepts injected events
+type watcher struct {
+	fs     *FileSystem
+	mu     sync.Mutex
+	inner  vfs.Watcher
+	events chan<- vfs.Event
+	paths  map[string]struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func (w *watcher) forward(in <-chan vfs.Event) {
+	defer close(w.done)
+	for event := range in {
+		w.mu.Lock()
+		if !w.closed {
+			w.events <- event
+		}
+		w.mu.Unlock()
+	}
+}
+
+// matches reports whether an event path is being watched
+func (w *watcher) matches(name string) bool {
+	_, found := w.paths[name]
+	if !found {
+		_, found = w.paths[path.Dir(name)]
+	}
+	return found
+}
+
+func (w *watcher) emit(event vfs.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed && (event.Type == vfs.ErrorEvent || w.matches(event.Path)) {
+		w.events <- event
+	}
+}
+
+func (w *watcher) Watch(name string) error {
+	if w.inner != nil {
+		if err := w.inner.Watch(name); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	w.paths[path.Clean(name)] = struct{}{}
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *watcher) Remove(name string) (err error) {
+	if w.inner != nil {
+		err = w.inner.Remove(name)
+	}
+
+	w.mu.Lock()
+	delete(w.paths, path.Clean(name))
+	w.mu.Unlock()
+	return err
+}
+
+// Close stops delivery and closes the events channel
+func (w *watcher) Close() (err error) {
+	w.fs.mu.Lock()
+	delete(w.fs.watchers, w)
+	w.fs.mu.Unlock()
+
+	if w.inner != nil {
+		err = w.inner.Close()
+		<-w.done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return vfs.ErrClosed
+	}
+	w.closed = true
+	close(w.events)
+	return err
+}
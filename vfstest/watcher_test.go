@@ -0,0 +1,75 @@
+package vfstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mh-orange/vfs"
+)
+
+// debounce forwards the last event for each path once no events have
+// arrived for that path for delay
+func debounce(clock vfs.Clock, delay time.Duration, in <-chan vfs.Event, out chan<- vfs.Event) {
+	timers := make(map[string]vfs.Timer)
+	for event := range in {
+		event := event
+		if timer, found := timers[event.Path]; found {
+			timer.Stop()
+		}
+		timers[event.Path] = clock.AfterFunc(delay, func() { out <- event })
+	}
+}
+
+func TestFileSystemEmit(t *testing.T) {
+	fs := New(vfs.NewMemFs())
+	fs.Mkdir("/dir", 0755)
+	clock := NewClock(time.Now())
+	events := make(chan vfs.Event)
+	rec := NewRecorder()
+
+	watcher, err := fs.Watcher(events)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Watch("/dir"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	go debounce(clock, 100*time.Millisecond, events, rec.C)
+
+	fs.Emit(
+		vfs.Event{Type: vfs.CreateEvent, Path: "/dir/one"},
+		vfs.Event{Type: vfs.ModifyEvent, Path: "/dir/one"},
+		vfs.Event{Type: vfs.CreateEvent, Path: "/other/ignored"},
+		vfs.Event{Type: vfs.CreateEvent, Path: "/dir/two"},
+	)
+	clock.BlockUntilScheduled(3)
+
+	clock.Advance(50 * time.Millisecond)
+	fs.Emit(vfs.Event{Type: vfs.ModifyEvent, Path: "/dir/two"})
+	clock.BlockUntilScheduled(4)
+
+	clock.Advance(50 * time.Millisecond)
+	rec.Expect(t, vfs.Event{Type: vfs.ModifyEvent, Path: "/dir/one"})
+
+	clock.Advance(100 * time.Millisecond)
+	rec.Expect(t, vfs.Event{Type: vfs.ModifyEvent, Path: "/dir/two"})
+}
+
+func TestFileSystemForward(t *testing.T) {
+	fs := New(vfs.NewMemFs())
+	rec := NewRecorder()
+	watcher, err := fs.Watcher(rec.C)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	watcher.Watch("/")
+	fs.Mkdir("/dir", 0755)
+	rec.Expect(t, vfs.Event{Type: vfs.CreateEvent, Path: "/dir"})
+
+	if err := watcher.Close(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package vfs
+
+import (
+	"os"
+	"path"
+	"sync"
+)
+
+// DefaultWalkWorkers is the number of directories WalkConcurrent reads at
+// once when WalkOptions.Workers is not set
+const DefaultWalkWorkers = 8
+
+// WalkOptions configures WalkConcurrent
+type WalkOptions struct {
+	// Workers is the number of directories read at once
+	Workers int
+
+	// Ordered calls walkFn one path at a time in the order Walk would.
+	// Directories are still read ahead concurrently
+	Ordered bool
+}
+
+// concurrentWalker holds the state shared by the goroutines of a
+// WalkConcurrent call
+type concurrentWalker struct {
+	fs     FileSystem
+	walkFn WalkFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	once sync.Once
+	stop chan struct{}
+	err  error
+}
+
+// WalkConcurrent walks the file tree rooted at root like Walk, reading up to
+// opts.Workers directories at once.  Unless opts.Ordered is set walkFn is
+// called from several goroutines at once and in no particular order, although
+// a directory is always visited before its contents.  Returning ErrSkipDir
+// from walkFn skips the contents of a directory or, for a file, the files of
+// the containing directory that have not been visited yet.  Any other error
+// stops the walk and is returned once the calls in progress have finished
+func WalkConcurrent(fs FileSystem, root string, walkFn WalkFunc, opts WalkOptions) error {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWalkWorkers
+	}
+
+	w := &concurrentWalker{
+		fs:     fs,
+		walkFn: walkFn,
+		sem:    make(chan struct{}, opts.Workers),
+		stop:   make(chan struct{}),
+	}
+
+	info, err := fs.Lstat(root)
+	if err != nil {
+		err = walkFn(root, nil, fixErr(err))
+	} else if !info.IsDir() {
+		err = walkFn(root, info, nil)
+	} else if opts.Ordered {
+		err = w.walkOrdered(root, info, w.prefetch(root))
+		w.fail(nil)
+	} else {
+		w.wg.Add(1)
+		w.visit(root, info)
+		w.wg.Wait()
+		err = w.err
+	}
+
+	if err == ErrSkipDir {
+		return nil
+	}
+	return fixErr(err)
+}
+
+// fail records the first error and stops the walk
+func (w *concurrentWalker) fail(err error) {
+	w.once.Do(func() {
+		w.err = err
+		close(w.stop)
+	})
+}
+
+func (w *concurrentWalker) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire waits for a worker slot and reports false if the walk stopped
+// first
+func (w *concurrentWalker) acquire() bool {
+	select {
+	case w.sem <- struct{}{}:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
+func (w *concurrentWalker) release() { <-w.sem }
+
+// visit reads the directory dir, visits its files and starts a visit for
+// each of its subdirectories
+func (w *concurrentWalker) visit(dir string, info os.FileInfo) {
+	defer w.wg.Done()
+	if !w.acquire() {
+		return
+	}
+	defer w.release()
+
+	infos, err := readDir(w.fs, dir)
+	if err1 := w.walkFn(dir, info, err); err != nil || err1 != nil {
+		if err1 != nil && err1 != ErrSkipDir {
+			w.fail(err1)
+		}
+		return
+	}
+
+	for _, fileInfo := range infos {
+		if w.stopped() {
+			return
+		}
+
+		filename := path.Join(dir, fileInfo.Name())
+		if fileInfo.IsDir() {
+			w.wg.Add(1)
+			go w.visit(filename, fileInfo)
+		} else if err = w.walkFn(filename, fileInfo, nil); err == ErrSkipDir {
+			return
+		} else if err != nil {
+			w.fail(err)
+			return
+		}
+	}
+}
+
+// dirListing is a directory being read ahead of an ordered walk
+type dirListing struct {
+	done  chan struct{}
+	infos []os.FileInfo
+	err   error
+}
+
+// prefetch starts reading the directory dir as soon as a worker is free
+func (w *concurrentWalker) prefetch(dir string) *dirListing {
+	listing := &dirListing{done: make(chan struct{})}
+	go func() {
+		defer close(listing.done)
+		if !w.acquire() {
+			listing.err = ErrSkipDir
+			return
+		}
+		defer w.release()
+		listing.infos, listing.err = readDir(w.fs, dir)
+	}()
+	return listing
+}
+
+// walkOrdered walks dir the way walk does, reading its subdirectories ahead
+// while its entries are being visited
+func (w *concurrentWalker) walkOrdered(dir string, info os.FileInfo, listing *dirListing) error {
+	if !info.IsDir() {
+		return w.walkFn(dir, info, nil)
+	}
+
+	<-listing.done
+	err1 := w.walkFn(dir, info, listing.err)
+	if listing.err != nil || err1 != nil {
+		return err1
+	}
+
+	listings := make([]*dirListing, len(listing.infos))
+	for i, fileInfo := range listing.infos {
+		if fileInfo.IsDir() {
+			listings[i] = w.prefetch(path.Join(dir, fileInfo.Name()))
+		}
+	}
+
+	for i, fileInfo := range listing.infos {
+		err := w.walkOrdered(path.Join(dir, fileInfo.Name()), fileInfo, listings[i])
+		if err == ErrSkipDir {
+			if !fileInfo.IsDir() {
+				break
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkFollow walks the file tree rooted at root like Walk, but follows
+// symbolic links, including root itself.  Each entry is reported under the
+// path it was reached by and described by what the link points to, except
+// for links to missing files which are reported as the link itself.  A link
+// leading back to a directory that is being walked would never end, so
+// walkFn is called for it with an error matching ErrLoop and the directory
+// is not walked again.  Directories reached through several links that do
+// not form a loop are walked once for each
+func WalkFollow(fs FileSystem, root string, walkFn WalkFunc) error {
+	info, err := fs.Stat(root)
+	err = walkFollow(fs, root, info, nil, walkFn, err)
+	if err == ErrSkipDir {
+		return nil
+	}
+	return fixErr(err)
+}
+
+// walkFollow walks dir, following symbolic links, and ancestors are the
+// directories being walked that contain it
+func walkFollow(fs FileSystem, dir string, info os.FileInfo, ancestors []os.FileInfo, walkFn WalkFunc, err error) error {
+	if info == nil || !info.IsDir() {
+		return walkFn(dir, info, err)
+	}
+
+	for _, ancestor := range ancestors {
+		if SameFile(info, ancestor) {
+			return walkFn(dir, nil, &PathError{Op: "walk", Path: dir, Cause: ErrLoop})
+		}
+	}
+	ancestors = append(ancestors[:len(ancestors):len(ancestors)], info)
+
+	infos, err := readDir(fs, dir)
+	err1 := walkFn(dir, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	for _, fileInfo := range infos {
+		filename := path.Join(dir, fileInfo.Name())
+		err = nil
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			if target, err1 := fs.Stat(filename); err1 == nil {
+				fileInfo = target
+			} else if !IsNotExist(err1) {
+				fileInfo, err = nil, err1
+			}
+		}
+
+		err = walkFollow(fs, filename, fileInfo, ancestors, walkFn, err)
+		if err == ErrSkipDir && (fileInfo == nil || !fileInfo.IsDir()) {
+			// skip the rest of the directory
+			break
+		} else if err != nil && err != ErrSkipDir {
+			return err
+		}
+	}
+	return nil
+}
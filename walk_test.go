@@ -0,0 +1,194 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestWalkConcurrent(t *testing.T) {
+	fs := NewMemFs()
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			MkdirAll(fs, fmt.Sprintf("/dir%d/sub%d", i, j), 0755)
+			WriteFile(fs, fmt.Sprintf("/dir%d/sub%d/file", i, j), nil, 0644)
+		}
+		WriteFile(fs, fmt.Sprintf("/dir%d/file", i), nil, 0644)
+	}
+
+	var want []string
+	Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() && path == "/dir1" {
+			return ErrSkipDir
+		}
+		want = append(want, path)
+		return err
+	})
+
+	tests := []struct {
+		name string
+		opts WalkOptions
+	}{
+		{"unordered", WalkOptions{}},
+		{"unordered single worker", WalkOptions{Workers: 1}},
+		{"ordered", WalkOptions{Ordered: true}},
+		{"ordered single worker", WalkOptions{Workers: 1, Ordered: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got []string
+			err := WalkConcurrent(fs, "/", func(path string, info os.FileInfo, err error) error {
+				if info.IsDir() && path == "/dir1" {
+					return ErrSkipDir
+				}
+
+				mu.Lock()
+				got = append(got, path)
+				mu.Unlock()
+				return err
+			}, test.opts)
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !test.opts.Ordered {
+				// Walk visits paths in lexical order
+				sort.Strings(got)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Wanted %v got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestWalkConcurrentErrors(t *testing.T) {
+	fs := NewMemFs()
+	MkdirAll(fs, "/a/b", 0755)
+	WriteFile(fs, "/a/b/file", nil, 0644)
+	WriteFile(fs, "/a/file", nil, 0644)
+	WriteFile(fs, "/a/later", nil, 0644)
+
+	failed := errors.New("failed")
+	tests := []struct {
+		name    string
+		root    string
+		walkFn  WalkFunc
+		wantErr error
+	}{
+		{"missing root", "/missing", func(path string, info os.FileInfo, err error) error { return err }, ErrNotExist},
+		{"error", "/", func(path string, info os.FileInfo, err error) error {
+			if path == "/a/b/file" {
+				return failed
+			}
+			return nil
+		}, failed},
+		{"skip files", "/", func(path string, info os.FileInfo, err error) error {
+			if path == "/a/later" {
+				t.Errorf("Wanted /a/later to be skipped")
+			} else if path == "/a/file" {
+				return ErrSkipDir
+			}
+			return nil
+		}, nil},
+	}
+
+	for _, test := range tests {
+		for _, ordered := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s ordered=%v", test.name, ordered), func(t *testing.T) {
+				err := WalkConcurrent(fs, test.root, test.walkFn, WalkOptions{Ordered: ordered})
+				if !IsError(test.wantErr, err) {
+					t.Errorf("Wanted %v got %v", test.wantErr, err)
+				}
+			})
+		}
+	}
+}
+
+func TestWalkFollow(t *testing.T) {
+	tfs := NewTempFs().(*tempfs)
+	defer tfs.Close()
+	mfs := NewMemFs()
+
+	tests := []struct {
+		fs      FileSystem
+		symlink func(oldname, newname string) error
+	}{
+		{tfs, func(oldname, newname string) error { return os.Symlink(oldname, filepath.Join(tfs.tempdir, newname)) }},
+		{mfs, mfs.(symlinker).Symlink},
+	}
+
+	for _, test := range tests {
+		fs := test.fs
+		t.Run(fmt.Sprintf("%T", fs), func(t *testing.T) {
+			MkdirAll(fs, "/root/dir/sub", 0755)
+			MkdirAll(fs, "/target", 0755)
+			WriteFile(fs, "/root/dir/file", nil, 0644)
+			WriteFile(fs, "/target/file", nil, 0644)
+			test.symlink("../target", "/root/linked")
+			test.symlink("missing", "/root/dangling")
+			test.symlink("../..", "/root/dir/sub/loop")
+			test.symlink("file", "/root/dir/alias")
+
+			var got []string
+			var loops []string
+			err := WalkFollow(fs, "/root", func(path string, info os.FileInfo, err error) error {
+				if IsError(ErrLoop, err) {
+					loops = append(loops, path)
+					return nil
+				} else if err != nil {
+					return err
+				}
+
+				kind := "file"
+				if info.IsDir() {
+					kind = "dir"
+				} else if info.Mode()&os.ModeSymlink != 0 {
+					kind = "link"
+				}
+				got = append(got, path+" "+kind)
+				return nil
+			})
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			want := []string{
+				"/root dir",
+				"/root/dangling link",
+				"/root/dir dir",
+				"/root/dir/alias file",
+				"/root/dir/file file",
+				"/root/dir/sub dir",
+				"/root/linked dir",
+				"/root/linked/file file",
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Wanted %v got %v", want, got)
+			}
+
+			if want := []string{"/root/dir/sub/loop"}; !reflect.DeepEqual(want, loops) {
+				t.Errorf("Wanted loops %v got %v", want, loops)
+			}
+
+			if err = WalkFollow(fs, "/root/dir/sub/loop", func(path string, info os.FileInfo, err error) error {
+				if path == "/root/dir/sub/loop/dir" {
+					return ErrSkipDir
+				}
+				return err
+			}); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
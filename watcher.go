@@ -4,9 +4,13 @@ package vfs
 
 import (
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -24,6 +28,10 @@ const (
 	RenameEvent
 	AttributeEvent
 	ErrorEvent
+
+	// OverflowEvent is sent in place of events a watcher could not
+	// deliver.  Consumers receiving it should rescan the watched paths
+	OverflowEvent
 )
 
 type Event struct {
@@ -42,17 +50,400 @@ type Watcher interface {
 	Close() error
 }
 
+// RecursiveWatcher is implemented by Watchers that can watch a whole
+// directory tree.  Directories created beneath a recursively watched path
+// are watched as soon as they are created, so no events are missed
+type RecursiveWatcher interface {
+	Watcher
+
+	// WatchRecursive starts watching path and every directory beneath it
+	WatchRecursive(path string) error
+}
+
+// WatcherStats reports how many events a Watcher has delivered
+// to its channel and how many it had to drop
+type WatcherStats struct {
+	Delivered uint64
+	Dropped   uint64
+}
+
+// StatWatcher is implemented by Watchers that keep delivery statistics
+type StatWatcher interface {
+	Watcher
+
+	// Stats returns a snapshot of the watcher's delivery counters
+	Stats() WatcherStats
+}
+
+// OverflowMode selects what a watcher does with an event that does not fit
+// in its channel
+type OverflowMode int
+
+const (
+	// OverflowDrop drops the event
+	OverflowDrop OverflowMode = iota
+
+	// OverflowBlock waits up to the policy's Timeout for the channel to
+	// have room before dropping the event, a zero Timeout waits for as
+	// long as it takes.  Modifications of the FileSystem wait with it
+	OverflowBlock
+
+	// OverflowQueue holds up to the policy's Limit events in an internal
+	// queue and drops the events that do not fit
+	OverflowQueue
+
+	// OverflowNotify queues events like OverflowQueue and replaces each
+	// run of events that do not fit with a single OverflowEvent
+	OverflowNotify
+)
+
+// OverflowPolicy configures how a watcher handles a full event channel
+type OverflowPolicy struct {
+	Mode OverflowMode
+
+	// Timeout is how long OverflowBlock waits for room in the channel
+	Timeout time.Duration
+
+	// Limit is the number of events OverflowQueue and OverflowNotify hold
+	// back, it defaults to the capacity of the channel
+	Limit int
+}
+
+// OverflowWatcher is implemented by Watchers whose handling of a full event
+// channel can be changed
+type OverflowWatcher interface {
+	Watcher
+
+	// SetOverflowPolicy changes the policy for the events that follow.
+	// Events already queued are delivered first
+	SetOverflowPolicy(policy OverflowPolicy)
+}
+
+// eventQueue is an elastic buffer sitting in front of a watcher's
+// event channel.  Events are queued without blocking the sender and
+// forwarded to the channel by the run loop.  Once limit events are
+// pending any new events are dropped, or replaced by an OverflowEvent
+// when notify is set
+type eventQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	events  []Event
+	limit   int
+	notify  bool
+	closed  bool
+	stopped bool
+	done    chan struct{}
+	out     chan<- Event
+	stats   *WatcherStats
+
+	// stop is closed by stop so that the run loop gives up on an event
+	// the consumer is not taking
+	stop chan struct{}
+}
+
+func newEventQueue(out chan<- Event, limit int, stats *WatcherStats) *eventQueue {
+	q := &eventQueue{
+		limit: limit,
+		done:  make(chan struct{}),
+		stop:  make(chan struct{}),
+		out:   out,
+		stats: stats,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		atomic.AddUint64(&q.stats.Dropped, 1)
+		return
+	} else if len(q.events) >= q.limit {
+		atomic.AddUint64(&q.stats.Dropped, 1)
+		q.overflow()
+		return
+	}
+	q.events = append(q.events, event)
+	q.cond.Signal()
+}
+
+// overflow queues an overflow event when the queue notifies of them, unless
+// one is already last.  The event goes past the limit so that it is never
+// dropped itself, q.mu must be held
+func (q *eventQueue) overflow() {
+	if q.notify && (len(q.events) == 0 || q.events[len(q.events)-1].Type != OverflowEvent) {
+		q.events = append(q.events, Event{Type: OverflowEvent})
+		q.cond.Signal()
+	}
+}
+
+func (q *eventQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.events) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+
+		if len(q.events) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		event := q.events[0]
+		q.events = q.events[1:]
+		q.mu.Unlock()
+
+		select {
+		case q.out <- event:
+			if event.Type != OverflowEvent {
+				atomic.AddUint64(&q.stats.Delivered, 1)
+			}
+		case <-q.stop:
+			// the event goes back so that it is handed on with the rest
+			q.mu.Lock()
+			q.events = append([]Event{event}, q.events...)
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+// drop counts the events as dropped, overflow events aside
+func (q *eventQueue) drop(events []Event) {
+	for _, event := range events {
+		if event.Type != OverflowEvent {
+			atomic.AddUint64(&q.stats.Dropped, 1)
+		}
+	}
+}
+
+// handoff stops accepting events and returns the pending ones, in order,
+// without waiting for the consumer to take them
+func (q *eventQueue) handoff() []Event {
+	q.mu.Lock()
+	q.closed = true
+	if !q.stopped {
+		q.stopped = true
+		close(q.stop)
+	}
+	q.cond.Signal()
+	q.mu.Unlock()
+	<-q.done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := q.events
+	q.events = nil
+	return events
+}
+
+// shutdown stops accepting events and drops the pending ones, counting
+// them as dropped, rather than waiting for the consumer to take them
+func (q *eventQueue) shutdown() {
+	q.drop(q.handoff())
+}
+
+// eventSender delivers the events of a watcher to its channel according to
+// the watcher's OverflowPolicy.  The policy and queue are guarded by a lock
+// of the watcher
+type eventSender struct {
+	events chan<- Event
+	stats  WatcherStats
+
+	// done is closed when the watcher is closed so that a send blocked by
+	// the OverflowBlock policy gives up
+	done chan struct{}
+
+	policy OverflowPolicy
+	queue  *eventQueue
+}
+
+func newEventSender(events chan<- Event) eventSender {
+	return eventSender{events: events, done: make(chan struct{})}
+}
+
+// send delivers the event either through the queue or directly to the
+// events channel.  Only the OverflowBlock policy blocks
+func (es *eventSender) send(event Event) {
+	if es.events == nil {
+		return
+	} else if es.queue != nil {
+		es.queue.push(event)
+		return
+	}
+
+	var timeout <-chan time.Time
+	if es.policy.Mode != OverflowBlock {
+		select {
+		case es.events <- event:
+			atomic.AddUint64(&es.stats.Delivered, 1)
+		default:
+			atomic.AddUint64(&es.stats.Dropped, 1)
+		}
+		return
+	} else if es.policy.Timeout > 0 {
+		timer := time.NewTimer(es.policy.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case es.events <- event:
+		atomic.AddUint64(&es.stats.Delivered, 1)
+	case <-timeout:
+		atomic.AddUint64(&es.stats.Dropped, 1)
+	case <-es.done:
+		atomic.AddUint64(&es.stats.Dropped, 1)
+	}
+}
+
+// setPolicy changes the policy, lock being the one guarding it.  The events
+// pending in the old queue are handed to the new policy so that they stay
+// in order, nothing waits for the consumer unless the new policy blocks
+func (es *eventSender) setPolicy(policy OverflowPolicy, lock sync.Locker) {
+	var queue *eventQueue
+	if es.events != nil && (policy.Mode == OverflowQueue || policy.Mode == OverflowNotify) {
+		limit := policy.Limit
+		if limit <= 0 {
+			limit = cap(es.events)
+		}
+
+		if limit <= 0 {
+			limit = 1
+		}
+		queue = newEventQueue(es.events, limit, &es.stats)
+		queue.notify = policy.Mode == OverflowNotify
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	select {
+	case <-es.done:
+		return
+	default:
+	}
+
+	old := es.queue
+	es.policy, es.queue = policy, queue
+	if queue != nil {
+		go queue.run()
+	}
+
+	if old != nil {
+		for _, event := range old.handoff() {
+			if event.Type != OverflowEvent {
+				es.send(event)
+			} else if queue != nil {
+				queue.mu.Lock()
+				queue.overflow()
+				queue.mu.Unlock()
+			}
+		}
+	}
+}
+
+// shutdown drops the queued events and closes the events channel once
+// nothing sends on it any more, lock being the one guarding the queue
+func (es *eventSender) shutdown(lock sync.Locker) {
+	lock.Lock()
+	queue := es.queue
+	es.queue = nil
+	lock.Unlock()
+
+	if queue != nil {
+		queue.shutdown()
+	}
+
+	if es.events != nil {
+		close(es.events)
+	}
+}
+
+// Stats returns the number of events delivered and dropped by the watcher
+func (es *eventSender) Stats() WatcherStats {
+	return WatcherStats{
+		Delivered: atomic.LoadUint64(&es.stats.Delivered),
+		Dropped:   atomic.LoadUint64(&es.stats.Dropped),
+	}
+}
+
 type memWatcher struct {
 	sync.Mutex
+	eventSender
 	fs     *memfs
 	paths  map[string]struct{}
-	events chan<- Event
+	closed bool
+
+	// closeDone closes the eventSender's done channel
+	closeDone sync.Once
+
+	// the policy and queue of the eventSender and sinks are guarded by the
+	// filesystem's watch lock
+	sinks []*attachedSink
+}
+
+// attachedSink is a sink attached to a memWatcher, compared by address
+// since sinks themselves need not be comparable
+type attachedSink struct {
+	EventSink
+}
+
+// send hands the event to the sinks and delivers it to the events channel
+func (mw *memWatcher) send(event Event) {
+	for _, sink := range mw.sinks {
+		sink.Send(event)
+	}
+	mw.eventSender.send(event)
+}
+
+// SetOverflowPolicy changes what the watcher does with events that do not
+// fit in its channel
+func (mw *memWatcher) SetOverflowPolicy(policy OverflowPolicy) {
+	mw.Lock()
+	defer mw.Unlock()
+	if !mw.closed {
+		mw.setPolicy(policy, &mw.fs.watchMu)
+	}
+}
+
+// AddSink attaches sink to the watcher until remove is called
+func (mw *memWatcher) AddSink(sink EventSink) (remove func()) {
+	entry := &attachedSink{sink}
+	mw.fs.watchMu.Lock()
+	mw.sinks = append(mw.sinks, entry)
+	mw.fs.watchMu.Unlock()
+
+	return func() {
+		mw.fs.watchMu.Lock()
+		defer mw.fs.watchMu.Unlock()
+		for i, attached := range mw.sinks {
+			if attached == entry {
+				mw.sinks = append(mw.sinks[:i], mw.sinks[i+1:]...)
+				break
+			}
+		}
+	}
 }
 
 func (mw *memWatcher) Watch(path string) error {
+	return mw.watch(path, false)
+}
+
+// WatchRecursive watches path and everything beneath it, including
+// directories created after the call
+func (mw *memWatcher) WatchRecursive(path string) error {
+	return mw.watch(path, true)
+}
+
+func (mw *memWatcher) watch(path string, recursive bool) error {
 	mw.Lock()
 	defer mw.Unlock()
-	err := mw.fs.watch(mw, path)
+	if mw.closed {
+		return &PathError{Op: "watch", Path: path, Cause: ErrClosed}
+	}
+
+	err := mw.fs.watch(mw, path, recursive)
 	if err == nil {
 		mw.paths[path] = struct{}{}
 	}
@@ -66,23 +457,89 @@ func (mw *memWatcher) Remove(path string) error {
 	return mw.fs.removeWatch(mw, path)
 }
 
+// Close stops the watcher and closes its events channel.  Close does not
+// wait for the channel to be drained, events still queued or waiting to be
+// delivered are dropped
 func (mw *memWatcher) Close() error {
+	// done is closed first so that a delivery blocked on the consumer,
+	// which may hold the watcher's locks, gives up
+	mw.closeDone.Do(func() { close(mw.done) })
+
 	mw.Lock()
 	defer mw.Unlock()
-	for path := range mw.paths {
-		// ignore the error because we don't care if a path is
-		// not found
-		mw.fs.removeWatch(mw, path)
+	if mw.closed {
+		return nil
+	}
+	mw.closed = true
+
+	// the watches are removed by watcher rather than by path since the
+	// watched paths may have been removed or renamed
+	mw.fs.watchMu.Lock()
+	for _, watchers := range mw.fs.watchers {
+		if watchers[mw].recursive {
+			mw.fs.recursiveWatches--
+		}
+		delete(watchers, mw)
 	}
-	close(mw.events)
+	mw.paths = nil
+	mw.sinks = nil
+	mw.fs.watchMu.Unlock()
+
+	mw.shutdown(&mw.fs.watchMu)
 	return nil
 }
 
 type osWatcher struct {
+	eventSender
 	fs      *osfs
 	watcher *fsnotify.Watcher
-	events  chan<- Event
 	closer  chan bool
+	once    sync.Once
+	err     error
+
+	// sendMu guards the policy and queue of the eventSender
+	sendMu sync.Mutex
+
+	// recursive holds the paths being watched recursively
+	mu        sync.Mutex
+	recursive map[string]bool
+}
+
+// isRecursive reports whether name is beneath a recursively watched path
+func (osw *osWatcher) isRecursive(name string) bool {
+	osw.mu.Lock()
+	defer osw.mu.Unlock()
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if osw.recursive[dir] {
+			return true
+		} else if dir == PathSeparator || dir == "." {
+			return false
+		}
+	}
+}
+
+// addTree watches the directory name and every directory beneath it.  When
+// report is set a CreateEvent is sent for everything found beneath name,
+// since those entries may have been created before the watch was added
+func (osw *osWatcher) addTree(name string, report bool) error {
+	return Walk(osw.fs, name, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p != name && IsNotExist(err) {
+				// removed while walking
+				return nil
+			}
+			return err
+		}
+
+		if report && p != name {
+			osw.send(Event{Type: CreateEvent, Path: p})
+		}
+
+		if info.IsDir() {
+			return osw.watcher.Add(osw.fs.path(p))
+		}
+		return nil
+	})
 }
 
 func (osw *osWatcher) eventLoop() {
@@ -93,6 +550,18 @@ func (osw *osWatcher) eventLoop() {
 		switch e.Op {
 		case fsnotify.Create:
 			event.Type = CreateEvent
+			if osw.isRecursive(event.Path) {
+				if info, err := osw.fs.Lstat(event.Path); err == nil && info.IsDir() {
+					// the new directory is watched and scanned before any
+					// more events are read so that nothing created in it
+					// is missed
+					osw.send(event)
+					if err = osw.addTree(event.Path, true); err != nil {
+						osw.send(Event{Type: ErrorEvent, Path: event.Path, Error: err})
+					}
+					continue
+				}
+			}
 		case fsnotify.Write:
 			event.Type = ModifyEvent
 		case fsnotify.Remove:
@@ -102,7 +571,7 @@ func (osw *osWatcher) eventLoop() {
 		case fsnotify.Chmod:
 			event.Type = AttributeEvent
 		}
-		osw.events <- event
+		osw.send(event)
 	}
 	osw.closer <- true
 }
@@ -110,26 +579,76 @@ func (osw *osWatcher) eventLoop() {
 func (osw *osWatcher) errorLoop() {
 	for err := range osw.watcher.Errors {
 		if err != nil {
-			osw.events <- Event{Error: err, Type: ErrorEvent}
+			osw.send(Event{Error: err, Type: ErrorEvent})
 		}
 	}
 	osw.closer <- true
 }
 
-func (osw *osWatcher) Remove(path string) error {
-	return osw.watcher.Remove(osw.fs.path(path))
+func (osw *osWatcher) Remove(name string) error {
+	name = Clean(name)
+	osw.mu.Lock()
+	recursive := osw.recursive[name]
+	delete(osw.recursive, name)
+	osw.mu.Unlock()
+
+	if recursive {
+		// the watches beneath name may have already gone with the
+		// directories they watched
+		for _, watched := range osw.watcher.WatchList() {
+			if strings.HasPrefix(watched, osw.fs.path(name)+string(filepath.Separator)) {
+				osw.watcher.Remove(watched)
+			}
+		}
+	}
+	return osw.watcher.Remove(osw.fs.path(name))
+}
+
+// WatchRecursive watches the directory name and every directory beneath
+// it.  New directories are watched and scanned as soon as they are
+// reported, anything found in them is reported with a CreateEvent.  Entries
+// created while a new directory is being scanned may be reported twice
+func (osw *osWatcher) WatchRecursive(name string) error {
+	name = Clean(name)
+	osw.mu.Lock()
+	osw.recursive[name] = true
+	osw.mu.Unlock()
+
+	err := osw.addTree(name, false)
+	if err != nil {
+		osw.Remove(name)
+	}
+	return err
 }
 
 func (osw *osWatcher) Watch(path string) error {
 	return osw.watcher.Add(osw.fs.path(path))
 }
 
+// send delivers the event according to the watcher's OverflowPolicy
+func (osw *osWatcher) send(event Event) {
+	osw.sendMu.Lock()
+	defer osw.sendMu.Unlock()
+	osw.eventSender.send(event)
+}
+
+// SetOverflowPolicy changes what the watcher does with events that do not
+// fit in its channel
+func (osw *osWatcher) SetOverflowPolicy(policy OverflowPolicy) {
+	osw.setPolicy(policy, &osw.sendMu)
+}
+
+// Close stops the watcher and closes its events channel.  Like the memfs
+// watcher it does not wait for the channel to be drained, events still
+// queued or waiting to be delivered are dropped
 func (osw *osWatcher) Close() error {
-	err := osw.watcher.Close()
-	if err == nil {
-		<-osw.closer
-		<-osw.closer
-		close(osw.events)
-	}
-	return err
+	osw.once.Do(func() {
+		close(osw.done)
+		if osw.err = osw.watcher.Close(); osw.err == nil {
+			<-osw.closer
+			<-osw.closer
+			osw.shutdown(&osw.sendMu)
+		}
+	})
+	return osw.err
 }
@@ -2,6 +2,7 @@ package vfs
 
 import (
 	"testing"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -39,6 +40,7 @@ func TestWatcherEventString(t *testing.T) {
 		{"RenameEvent", &Event{RenameEvent, "/dir/file", nil}, "/dir RenameEvent file"},
 		{"AttributeEvent", &Event{AttributeEvent, "/dir/file", nil}, "/dir AttributeEvent file"},
 		{"ErrorEvent", &Event{ErrorEvent, "/dir/file", nil}, "/dir ErrorEvent file"},
+		{"OverflowEvent", &Event{OverflowEvent, "/dir/file", nil}, "/dir OverflowEvent file"},
 		{"UnknownEvent", &Event{EventType(128), "/dir/file", nil}, "/dir EventType(128) file"},
 	}
 
@@ -93,3 +95,124 @@ func TestWatcherOsEventLoop(t *testing.T) {
 		})
 	}
 }
+
+func TestWatcherOsOverflow(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		events int
+	}{
+		{"block", nil, 1},
+		{"drop", []Option{WithOverflowPolicy(OverflowPolicy{Mode: OverflowDrop})}, 3},
+		{"queue", []Option{WithWatcherQueue(10)}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewOsFs(t.TempDir(), test.opts...)
+			defer fs.Close()
+
+			// nothing reads the events
+			w, err := fs.Watcher(make(chan Event))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			watcher := w.(*osWatcher)
+			for i := 0; i < test.events; i++ {
+				watcher.watcher.Events <- fsnotify.Event{Name: "/file", Op: fsnotify.Create}
+			}
+
+			closed := make(chan struct{})
+			go func() {
+				w.Close()
+				close(closed)
+			}()
+
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Fatalf("Wanted Close to return without the events being read")
+			}
+
+			if stats := w.(StatWatcher).Stats(); stats.Delivered != 0 || stats.Dropped != uint64(test.events) {
+				t.Errorf("Wanted %d events dropped got %+v", test.events, stats)
+			}
+		})
+	}
+}
+
+func TestWatchRecursiveMem(t *testing.T) {
+	fs := NewMemFs()
+	fs.Mkdir("/a", 0755)
+	fs.Mkdir("/other", 0755)
+
+	events := make(chan Event, 20)
+	watcher, _ := fs.Watcher(events)
+	if err := watcher.(RecursiveWatcher).WatchRecursive("/a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fs.Mkdir("/a/b", 0755)
+	fs.Mkdir("/a/b/c", 0755)
+	WriteFile(fs, "/a/b/c/file", []byte("data"), 0644)
+	fs.Rename("/a/b", "/a/d")
+	// overlapping watches must not duplicate events
+	watcher.Watch("/a/d/c")
+	WriteFile(fs, "/a/d/c/file", []byte("more data"), 0644)
+	WriteFile(fs, "/other/file", nil, 0644)
+	watcher.Close()
+
+	want := []Event{
+		{CreateEvent, "/a/b", nil},
+		{CreateEvent, "/a/b/c", nil},
+		{CreateEvent, "/a/b/c/file", nil},
+		{ModifyEvent, "/a/b/c/file", nil},
+		{CreateEvent, "/a/d", nil},
+		{RenameEvent, "/a/b", nil},
+		{ModifyEvent, "/a/d/c/file", nil},
+	}
+
+	var got []Event
+	for event := range events {
+		got = append(got, event)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Wanted %v got %v", want, got)
+	}
+
+	for i, event := range got {
+		if event != want[i] {
+			t.Errorf("Wanted %v got %v", want[i], event)
+		}
+	}
+}
+
+func TestWatchRecursiveOs(t *testing.T) {
+	fs := NewOsFs(t.TempDir())
+	fs.Mkdir("/a", 0755)
+
+	events := make(chan Event, 20)
+	watcher, err := Watch(fs, "/", events)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	// the file is created before the watcher can see the new directory
+	fs.Mkdir("/a/b", 0755)
+	WriteFile(fs, "/a/b/file", nil, 0644)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == CreateEvent && event.Path == "/a/b/file" {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for create event for /a/b/file")
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package vfs
+
+import (
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// wdfs resolves relative paths from a working directory
+type wdfs struct {
+	FileSystem
+
+	mu  sync.Mutex
+	dir string
+}
+
+// NewWdFs returns a handle on fs with its own working directory, which starts
+// at the root.  Relative paths given to the handle are resolved from the
+// working directory and absolute ones are used as they are, as with the os
+// package, so code relying on relative paths works unchanged.  The handle
+// implements Chdirer.  Each handle has its own working directory and closing
+// one does not close fs
+func NewWdFs(fs FileSystem) FileSystem {
+	return &wdfs{FileSystem: fs, dir: PathSeparator}
+}
+
+// path returns the absolute path of name
+func (wfs *wdfs) path(name string) string {
+	if path.IsAbs(name) {
+		return Clean(name)
+	}
+
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+	return Clean(path.Join(wfs.dir, name))
+}
+
+// Chdir changes the working directory to dir, which must be a directory.
+// A relative dir is resolved from the current working directory
+func (wfs *wdfs) Chdir(dir string) error {
+	name := wfs.path(dir)
+	info, err := wfs.FileSystem.Stat(name)
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return &PathError{Op: "chdir", Path: dir, Cause: ErrNotDir}
+	}
+
+	wfs.mu.Lock()
+	wfs.dir = name
+	wfs.mu.Unlock()
+	return nil
+}
+
+// Getwd returns the working directory
+func (wfs *wdfs) Getwd() (string, error) {
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+	return wfs.dir, nil
+}
+
+func (wfs *wdfs) file(name string, f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &subFile{File: f, name: name}, nil
+}
+
+func (wfs *wdfs) Chmod(name string, mode os.FileMode) error {
+	return wfs.FileSystem.Chmod(wfs.path(name), mode)
+}
+
+func (wfs *wdfs) Create(name string) (File, error) {
+	f, err := wfs.FileSystem.Create(wfs.path(name))
+	return wfs.file(name, f, err)
+}
+
+func (wfs *wdfs) Open(name string) (File, error) {
+	f, err := wfs.FileSystem.Open(wfs.path(name))
+	return wfs.file(name, f, err)
+}
+
+func (wfs *wdfs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	f, err := wfs.FileSystem.OpenFile(wfs.path(name), flag, perm)
+	return wfs.file(name, f, err)
+}
+
+func (wfs *wdfs) Mkdir(name string, perm os.FileMode) error {
+	return wfs.FileSystem.Mkdir(wfs.path(name), perm)
+}
+
+func (wfs *wdfs) Remove(name string) error {
+	return wfs.FileSystem.Remove(wfs.path(name))
+}
+
+func (wfs *wdfs) Rename(oldpath, newpath string) error {
+	return wfs.FileSystem.Rename(wfs.path(oldpath), wfs.path(newpath))
+}
+
+func (wfs *wdfs) Lstat(name string) (os.FileInfo, error) {
+	return wfs.FileSystem.Lstat(wfs.path(name))
+}
+
+func (wfs *wdfs) Stat(name string) (os.FileInfo, error) {
+	return wfs.FileSystem.Stat(wfs.path(name))
+}
+
+// Symlink creates newname as a symbolic link to oldname if the underlying
+// FileSystem supports symbolic links.  The target is stored as it is given
+// since relative targets are resolved from the directory holding the link
+func (wfs *wdfs) Symlink(oldname, newname string) error {
+	linker, ok := wfs.FileSystem.(symlinker)
+	if !ok {
+		return &LinkError{Op: "symlink", Old: oldname, New: newname, Cause: ErrNotSupported}
+	}
+	return linker.Symlink(oldname, wfs.path(newname))
+}
+
+// Readlink returns the target of the named symbolic link if the underlying
+// FileSystem supports symbolic links
+func (wfs *wdfs) Readlink(name string) (string, error) {
+	reader, ok := wfs.FileSystem.(linkReader)
+	if !ok {
+		return "", &PathError{Op: "readlink", Path: name, Cause: ErrNotSupported}
+	}
+	return reader.Readlink(wfs.path(name))
+}
+
+// Chtimes changes the times of the named file if the underlying FileSystem
+// supports it
+func (wfs *wdfs) Chtimes(name string, atime, mtime time.Time) error {
+	chtimer, ok := wfs.FileSystem.(chtimer)
+	if !ok {
+		return &PathError{Op: "chtimes", Path: name, Cause: ErrNotSupported}
+	}
+	return chtimer.Chtimes(wfs.path(name), atime, mtime)
+}
+
+// Close does nothing, the underlying FileSystem is left open
+func (wfs *wdfs) Close() error { return nil }
+
+// Watcher returns a Watcher that resolves the paths it is given from the
+// working directory.  Events carry absolute paths
+func (wfs *wdfs) Watcher(events chan<- Event) (Watcher, error) {
+	watcher, err := wfs.FileSystem.Watcher(events)
+	if err != nil {
+		return nil, err
+	}
+	return &wdWatcher{Watcher: watcher, fs: wfs}, nil
+}
+
+// Unwrap returns the underlying FileSystem
+func (wfs *wdfs) Unwrap() []FileSystem { return []FileSystem{wfs.FileSystem} }
+
+type wdWatcher struct {
+	Watcher
+	fs *wdfs
+}
+
+func (ww *wdWatcher) Watch(name string) error {
+	return ww.Watcher.Watch(ww.fs.path(name))
+}
+
+func (ww *wdWatcher) Remove(name string) error {
+	return ww.Watcher.Remove(ww.fs.path(name))
+}
@@ -0,0 +1,76 @@
+package vfs
+
+import "testing"
+
+func TestWdFs(t *testing.T) {
+	base := NewMemFs()
+	MkdirAll(base, "/home/user", 0755)
+	WriteFile(base, "/file", []byte("root"), 0644)
+	fs := NewWdFs(base)
+
+	if dir, _ := fs.(Chdirer).Getwd(); dir != "/" {
+		t.Errorf("Wanted / got %q", dir)
+	}
+
+	if err := fs.(Chdirer).Chdir("home"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if err = fs.(Chdirer).Chdir("user"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if dir, _ := fs.(Chdirer).Getwd(); dir != "/home/user" {
+		t.Errorf("Wanted /home/user got %q", dir)
+	}
+
+	if err := WriteFile(fs, "notes", []byte("notes"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"notes", "notes"},
+		{"./notes", "notes"},
+		{"/home/user/notes", "notes"},
+		{"../../file", "root"},
+		{"/file", "root"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadFile(fs, test.name)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if string(got) != test.want {
+				t.Errorf("Wanted %q got %q", test.want, got)
+			}
+		})
+	}
+
+	if got, _ := ReadFile(base, "/home/user/notes"); string(got) != "notes" {
+		t.Errorf("Wanted the file in the working directory got %q", got)
+	}
+
+	f, err := fs.Open("notes")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if f.Name() != "notes" {
+		t.Errorf("Wanted notes got %q", f.Name())
+	}
+	closeFile(f)
+
+	if err = fs.(Chdirer).Chdir("notes"); !IsError(ErrNotDir, err) {
+		t.Errorf("Wanted %v got %v", ErrNotDir, err)
+	} else if err = fs.(Chdirer).Chdir("missing"); !IsNotExist(err) {
+		t.Errorf("Wanted %v got %v", ErrNotExist, err)
+	}
+
+	if got, _ := Abs(fs, "notes"); got != "/home/user/notes" {
+		t.Errorf("Wanted /home/user/notes got %q", got)
+	}
+
+	if dir, _ := NewWdFs(base).(Chdirer).Getwd(); dir != "/" {
+		t.Errorf("Wanted each handle to have its own working directory got %q", dir)
+	}
+}
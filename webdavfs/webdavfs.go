@@ -0,0 +1,115 @@
+// Package webdavfs serves a vfs.FileSystem over WebDAV using
+// golang.org/x/net/webdav.  This allows a memfs, or any other backend, to be
+// mounted by Finder, Explorer or davfs2 for debugging and manual inspection.
+package webdavfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/mh-orange/vfs"
+	"golang.org/x/net/webdav"
+)
+
+// toOsErr converts vfs errors into their os equivalents, the webdav package
+// relies on os.IsNotExist and os.IsExist to choose response codes
+func toOsErr(err error) error {
+	switch e := err.(type) {
+	case *vfs.PathError:
+		return &os.PathError{Op: e.Op, Path: e.Path, Err: toOsErr(e.Cause)}
+	case *vfs.LinkError:
+		return &os.LinkError{Op: e.Op, Old: e.Old, New: e.New, Err: toOsErr(e.Cause)}
+	}
+
+	switch err {
+	case vfs.ErrNotExist:
+		err = os.ErrNotExist
+	case vfs.ErrExist:
+		err = os.ErrExist
+	case vfs.ErrClosed:
+		err = os.ErrClosed
+	case vfs.ErrPermission:
+		err = os.ErrPermission
+	case vfs.ErrReadOnly:
+		err = os.ErrPermission
+	}
+	return err
+}
+
+// NewHandler returns an http.Handler serving fs over WebDAV with an in-memory
+// lock system.  Use New to configure a webdav.Handler directly, for instance
+// to set a Prefix or Logger
+func NewHandler(fs vfs.FileSystem) http.Handler {
+	return &webdav.Handler{
+		FileSystem: New(fs),
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+// davFs is a webdav.FileSystem backed by a vfs.FileSystem
+type davFs struct {
+	fs vfs.FileSystem
+}
+
+// New returns a webdav.FileSystem that performs all operations on fs
+func New(fs vfs.FileSystem) webdav.FileSystem {
+	return &davFs{fs: fs}
+}
+
+func (dfs *davFs) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return toOsErr(dfs.fs.Mkdir(name, perm))
+}
+
+func (dfs *davFs) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := dfs.fs.OpenFile(name, vfs.OpenFlag(flag), perm)
+	if err != nil {
+		return nil, toOsErr(err)
+	}
+	return &davFile{File: f}, nil
+}
+
+func (dfs *davFs) RemoveAll(ctx context.Context, name string) error {
+	return toOsErr(vfs.RemoveAll(dfs.fs, name))
+}
+
+func (dfs *davFs) Rename(ctx context.Context, oldName, newName string) error {
+	return toOsErr(dfs.fs.Rename(oldName, newName))
+}
+
+func (dfs *davFs) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	fi, err := dfs.fs.Stat(name)
+	return fi, toOsErr(err)
+}
+
+// davFile adapts a vfs.File to webdav.File
+type davFile struct {
+	vfs.File
+}
+
+func (f *davFile) Close() error {
+	if closer, ok := f.File.(io.Closer); ok {
+		return toOsErr(closer.Close())
+	}
+	return nil
+}
+
+// Readdir follows the http.File convention where a count of zero or less
+// returns every entry
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		count = -1
+	}
+
+	infos, err := f.File.Readdir(count)
+	if err == io.EOF {
+		return infos, err
+	}
+	return infos, toOsErr(err)
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	return fi, toOsErr(err)
+}
@@ -0,0 +1,61 @@
+package webdavfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mh-orange/vfs"
+)
+
+func TestHandler(t *testing.T) {
+	fs := vfs.NewMemFs()
+	vfs.WriteFile(fs, "/hello.txt", []byte("hello"), 0644)
+	server := httptest.NewServer(NewHandler(fs))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"get", http.MethodGet, "/hello.txt", "", http.StatusOK, "hello"},
+		{"missing", http.MethodGet, "/missing.txt", "", http.StatusNotFound, ""},
+		{"mkcol", "MKCOL", "/dir", "", http.StatusCreated, ""},
+		{"mkcol exists", "MKCOL", "/dir", "", http.StatusMethodNotAllowed, ""},
+		{"put", http.MethodPut, "/dir/new.txt", "new", http.StatusCreated, ""},
+		{"get new", http.MethodGet, "/dir/new.txt", "", http.StatusOK, "new"},
+		{"propfind", "PROPFIND", "/dir", "", http.StatusMultiStatus, "/dir/new.txt"},
+		{"delete", http.MethodDelete, "/dir", "", http.StatusNoContent, ""},
+		{"get deleted", http.MethodGet, "/dir/new.txt", "", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+			if test.method == "PROPFIND" {
+				req.Header.Set("Depth", "1")
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("Wanted status %d got %d", test.wantStatus, resp.StatusCode)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), test.wantBody) {
+				t.Errorf("Wanted body containing %q got %q", test.wantBody, body)
+			}
+		})
+	}
+}
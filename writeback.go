@@ -0,0 +1,476 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writeBackEntry is a file held in the fast FileSystem of a WriteBackFs
+type writeBackEntry struct {
+	name string
+
+	// open is the number of handles open on the fast copy
+	open int
+
+	// modified is set when the fast copy has been written since it was
+	// last flushed
+	modified bool
+}
+
+// WriteBackFs is a write-back cache in front of a slow FileSystem.  Files
+// opened for writing are copied into a fast FileSystem and every read and
+// write of them is served locally until they are flushed to the backing
+// FileSystem.  By default a file is flushed when its last handle is closed,
+// in which case Close reports any error, WithFlushInterval defers flushing
+// closed files to a timer instead.  Sync flushes a single file and Flush flushes every file.
+// New files are created empty in the backing FileSystem straight away so
+// that they appear in directory listings, which are always read from the
+// backing FileSystem
+type WriteBackFs struct {
+	FileSystem
+	fast     FileSystem
+	clock    Clock
+	interval time.Duration
+	onError  func(name string, err error)
+
+	// flushMu serializes flushes so that a file is never written to the
+	// backing FileSystem by two flushes at once
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	entries map[string]*writeBackEntry
+	timer   Timer
+	closed  bool
+}
+
+// NewWriteBackFs returns a WriteBackFs writing to base through fast.  The
+// fast FileSystem should be empty and dedicated to the WriteBackFs since files
+// are removed from it once they have been flushed.  WithFlushInterval,
+// WithFlushErrorHandler and WithClock configure when flushes happen and how
+// failures are reported
+func NewWriteBackFs(base, fast FileSystem, opts ...Option) *WriteBackFs {
+	wfs := &WriteBackFs{FileSystem: base, fast: fast, clock: SystemClock, entries: make(map[string]*writeBackEntry)}
+	for _, opt := range opts {
+		opt(wfs)
+	}
+
+	if wfs.interval > 0 {
+		wfs.timer = wfs.clock.AfterFunc(wfs.interval, wfs.tick)
+	}
+	return wfs
+}
+
+// tick flushes the closed files and schedules the next tick
+func (wfs *WriteBackFs) tick() {
+	wfs.flush(false)
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+	if !wfs.closed {
+		wfs.timer.Reset(wfs.interval)
+	}
+}
+
+// Flush writes every modified file, including those that are still open, to
+// the backing FileSystem.  Files that fail to flush remain modified and are
+// tried again by the next flush.  The first error is returned
+func (wfs *WriteBackFs) Flush() error {
+	return wfs.flush(true)
+}
+
+// Pending returns the names of files that have been modified but not yet
+// flushed
+func (wfs *WriteBackFs) Pending() (names []string) {
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+	for name, entry := range wfs.entries {
+		if entry.modified {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flush writes the modified files, optionally skipping those that are still
+// open, to the backing FileSystem and drops closed files from the fast
+// FileSystem
+func (wfs *WriteBackFs) flush(open bool) (err error) {
+	wfs.flushMu.Lock()
+	defer wfs.flushMu.Unlock()
+
+	wfs.mu.Lock()
+	var entries []*writeBackEntry
+	for _, entry := range wfs.entries {
+		if (entry.modified && open) || entry.open == 0 {
+			entries = append(entries, entry)
+		}
+	}
+	wfs.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	for _, entry := range entries {
+		if err1 := wfs.flushEntry(entry); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// flushFile writes a single file to the backing FileSystem
+func (wfs *WriteBackFs) flushFile(entry *writeBackEntry) error {
+	wfs.flushMu.Lock()
+	defer wfs.flushMu.Unlock()
+	return wfs.flushEntry(entry)
+}
+
+// flushEntry copies a modified file to the backing FileSystem and drops the
+// fast copy once it is closed and unchanged.  The caller must hold flushMu
+func (wfs *WriteBackFs) flushEntry(entry *writeBackEntry) (err error) {
+	wfs.mu.Lock()
+	name := entry.name
+	if wfs.entries[name] != entry {
+		wfs.mu.Unlock()
+		return nil
+	} else if entry.modified {
+		entry.modified = false
+		wfs.mu.Unlock()
+
+		if err = wfs.upload(name); err != nil {
+			err = &PathError{Op: "flush", Path: name, Cause: err}
+		}
+		wfs.mu.Lock()
+	}
+
+	if err != nil {
+		entry.modified = true
+	} else if !entry.modified && entry.open == 0 && wfs.entries[entry.name] == entry {
+		delete(wfs.entries, entry.name)
+		wfs.fast.Remove(entry.name)
+	}
+	wfs.mu.Unlock()
+
+	if err != nil && wfs.onError != nil {
+		wfs.onError(name, err)
+	}
+	return err
+}
+
+// upload copies the fast copy of a file over the backing file
+func (wfs *WriteBackFs) upload(name string) error {
+	info, err := wfs.fast.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	dst, err := wfs.FileSystem.OpenFile(name, WrOnlyFlag|CreateFlag|TruncFlag, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	err = copyTo(dst, wfs.fast, name)
+	if closer, ok := dst.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// copyFrom copies a file from fs into the fast FileSystem
+func (wfs *WriteBackFs) copyFrom(fs FileSystem, name string, perm os.FileMode) error {
+	if err := MkdirAll(wfs.fast, path.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	dst, err := wfs.fast.OpenFile(name, WrOnlyFlag|CreateFlag|TruncFlag, perm)
+	if err != nil {
+		return err
+	}
+
+	if fs != nil {
+		err = copyTo(dst, fs, name)
+	}
+
+	if closer, ok := dst.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// load brings a file into the fast FileSystem so that it can be written,
+// creating it in the backing FileSystem first if necessary.  The caller
+// must hold mu
+func (wfs *WriteBackFs) load(name string, flag OpenFlag, perm os.FileMode) (*writeBackEntry, error) {
+	if entry, found := wfs.entries[name]; found {
+		if flag.has(CreateFlag) && flag.has(ExclFlag) {
+			return nil, &PathError{Op: "open", Path: name, Cause: ErrExist}
+		}
+		return entry, nil
+	}
+
+	info, err := wfs.FileSystem.Stat(name)
+	switch {
+	case err == nil && flag.has(CreateFlag) && flag.has(ExclFlag):
+		return nil, &PathError{Op: "open", Path: name, Cause: ErrExist}
+	case err == nil && info.IsDir():
+		return nil, &PathError{Op: "open", Path: name, Cause: ErrIsDir}
+	case err == nil && flag.has(TruncFlag):
+		err = wfs.copyFrom(nil, name, info.Mode().Perm())
+	case err == nil:
+		err = wfs.copyFrom(wfs.FileSystem, name, info.Mode().Perm())
+	case IsNotExist(err) && flag.has(CreateFlag):
+		var f File
+		if f, err = wfs.FileSystem.OpenFile(name, WrOnlyFlag|CreateFlag|ExclFlag, perm); err == nil {
+			if closer, ok := f.(io.Closer); ok {
+				closer.Close()
+			}
+			err = wfs.copyFrom(nil, name, perm)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &writeBackEntry{name: name}
+	wfs.entries[name] = entry
+	return entry, nil
+}
+
+func (wfs *WriteBackFs) Chmod(name string, mode os.FileMode) error {
+	name = Clean(name)
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+	if _, found := wfs.entries[name]; found {
+		if err := wfs.fast.Chmod(name, mode); err != nil {
+			return err
+		}
+	}
+	return wfs.FileSystem.Chmod(name, mode)
+}
+
+func (wfs *WriteBackFs) Create(name string) (File, error) {
+	return wfs.OpenFile(name, RdWrFlag|CreateFlag|TruncFlag, 0666)
+}
+
+func (wfs *WriteBackFs) Open(name string) (File, error) {
+	return wfs.OpenFile(name, RdOnlyFlag, 0)
+}
+
+// OpenFile opens files that are being written, or are about to be, from
+// the fast FileSystem and every other file from the backing FileSystem
+func (wfs *WriteBackFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	name = Clean(name)
+	if err := flag.check(); err != nil {
+		return nil, &PathError{Op: "open", Path: name, Cause: err}
+	}
+
+	write := flag.accessMode() != RdOnlyFlag || flag.has(CreateFlag) || flag.has(TruncFlag)
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+
+	entry, found := wfs.entries[name]
+	if !write && !found {
+		return wfs.FileSystem.OpenFile(name, flag, perm)
+	} else if write {
+		var err error
+		if entry, err = wfs.load(name, flag, perm); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := wfs.fast.OpenFile(name, flag&^(CreateFlag|ExclFlag), perm)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.open++
+	if flag.has(TruncFlag) {
+		entry.modified = true
+	}
+	return &writeBackFile{File: f, fs: wfs, entry: entry, sync: flag.has(SyncFlag) || flag.has(DsyncFlag)}, nil
+}
+
+func (wfs *WriteBackFs) Remove(name string) error {
+	name = Clean(name)
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+	if _, found := wfs.entries[name]; found {
+		delete(wfs.entries, name)
+		wfs.fast.Remove(name)
+	}
+	return wfs.FileSystem.Remove(name)
+}
+
+// Rename renames the file in the backing FileSystem along with any
+// unflushed copy.  Renaming a directory moves the unflushed copies of the
+// files beneath it as well
+func (wfs *WriteBackFs) Rename(oldpath, newpath string) error {
+	oldpath = Clean(oldpath)
+	newpath = Clean(newpath)
+	wfs.mu.Lock()
+	defer wfs.mu.Unlock()
+
+	if err := wfs.FileSystem.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+
+	for name := range wfs.entries {
+		if name == newpath || strings.HasPrefix(name, newpath+"/") {
+			delete(wfs.entries, name)
+			wfs.fast.Remove(name)
+		}
+	}
+
+	var moved []*writeBackEntry
+	for name, entry := range wfs.entries {
+		if name == oldpath || strings.HasPrefix(name, oldpath+"/") {
+			moved = append(moved, entry)
+		}
+	}
+
+	for _, entry := range moved {
+		name := newpath + strings.TrimPrefix(entry.name, oldpath)
+		err := MkdirAll(wfs.fast, path.Dir(name), 0755)
+		if err == nil {
+			err = wfs.fast.Rename(entry.name, name)
+		}
+
+		if err != nil {
+			return err
+		}
+		delete(wfs.entries, entry.name)
+		entry.name = name
+		wfs.entries[name] = entry
+	}
+	return nil
+}
+
+func (wfs *WriteBackFs) Lstat(name string) (os.FileInfo, error) {
+	return wfs.stat(name, wfs.fast.Lstat, wfs.FileSystem.Lstat)
+}
+
+func (wfs *WriteBackFs) Stat(name string) (os.FileInfo, error) {
+	return wfs.stat(name, wfs.fast.Stat, wfs.FileSystem.Stat)
+}
+
+// stat reports on the fast copy of a file if there is one
+func (wfs *WriteBackFs) stat(name string, fast, base func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+	name = Clean(name)
+	wfs.mu.Lock()
+	_, found := wfs.entries[name]
+	wfs.mu.Unlock()
+	if found {
+		return fast(name)
+	}
+	return base(name)
+}
+
+// Close flushes every modified file and closes both the backing and fast
+// FileSystems
+func (wfs *WriteBackFs) Close() error {
+	wfs.mu.Lock()
+	wfs.closed = true
+	if wfs.timer != nil {
+		wfs.timer.Stop()
+	}
+	wfs.mu.Unlock()
+
+	err := wfs.Flush()
+	if err1 := wfs.FileSystem.Close(); err == nil {
+		err = err1
+	}
+
+	if err1 := wfs.fast.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// Unwrap returns the backing and fast FileSystems
+func (wfs *WriteBackFs) Unwrap() []FileSystem {
+	return []FileSystem{wfs.FileSystem, wfs.fast}
+}
+
+// writeBackFile is a file open on the fast FileSystem
+type writeBackFile struct {
+	File
+	fs     *WriteBackFs
+	entry  *writeBackEntry
+	closed bool
+
+	// sync flushes after every write, the file having been opened with
+	// SyncFlag or DsyncFlag
+	sync bool
+}
+
+func (f *writeBackFile) modified() {
+	f.fs.mu.Lock()
+	f.entry.modified = true
+	f.fs.mu.Unlock()
+}
+
+// synced flushes the file after a successful write when it was opened with
+// SyncFlag or DsyncFlag
+func (f *writeBackFile) synced(n int, err error) (int, error) {
+	if err == nil && f.sync {
+		err = f.fs.flushFile(f.entry)
+	}
+	return n, err
+}
+
+func (f *writeBackFile) Write(p []byte) (int, error) {
+	f.modified()
+	return f.synced(f.File.Write(p))
+}
+
+func (f *writeBackFile) WriteAt(p []byte, off int64) (int, error) {
+	f.modified()
+	return f.synced(f.File.WriteAt(p, off))
+}
+
+// Truncate changes the size of the file if the fast file supports it
+func (f *writeBackFile) Truncate(size int64) error {
+	truncater, ok := f.File.(interface{ Truncate(int64) error })
+	if !ok {
+		return &PathError{Op: "truncate", Path: f.Name(), Cause: ErrNotSupported}
+	}
+	f.modified()
+	return truncater.Truncate(size)
+}
+
+// Sync flushes the file to the backing FileSystem
+func (f *writeBackFile) Sync() error {
+	return f.fs.flushFile(f.entry)
+}
+
+// Close closes the fast file and, when it is the last handle open on the
+// file and the WriteBackFs does not flush on an interval, flushes it to the
+// backing FileSystem
+func (f *writeBackFile) Close() (err error) {
+	if f.closed {
+		return &PathError{Op: "close", Path: f.Name(), Cause: ErrClosed}
+	}
+	f.closed = true
+
+	if closer, ok := f.File.(io.Closer); ok {
+		err = closer.Close()
+	}
+
+	f.fs.mu.Lock()
+	f.entry.open--
+	last := f.entry.open == 0
+	f.fs.mu.Unlock()
+
+	if err == nil && last && f.fs.interval == 0 {
+		err = f.fs.flushFile(f.entry)
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// brokenFs fails every write while broken is set
+type brokenFs struct {
+	FileSystem
+	mu     sync.Mutex
+	broken bool
+}
+
+func (bfs *brokenFs) setBroken(broken bool) {
+	bfs.mu.Lock()
+	bfs.broken = broken
+	bfs.mu.Unlock()
+}
+
+func (bfs *brokenFs) OpenFile(name string, flag OpenFlag, perm os.FileMode) (File, error) {
+	bfs.mu.Lock()
+	defer bfs.mu.Unlock()
+	if bfs.broken && flag.accessMode() != RdOnlyFlag {
+		return nil, &PathError{Op: "open", Path: name, Cause: ErrDisconnected}
+	}
+	return bfs.FileSystem.OpenFile(name, flag, perm)
+}
+
+func TestWriteBackFs(t *testing.T) {
+	base := NewMemFs()
+	WriteFile(base, "/existing", []byte("existing"), 0644)
+	fs := NewWriteBackFs(base, NewTempFs())
+	defer fs.Close()
+
+	f, err := fs.OpenFile("/existing", RdWrFlag, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.Seek(0, io.SeekEnd)
+	f.Write([]byte(" appended"))
+
+	if got, _ := ReadFile(fs, "/existing"); string(got) != "existing appended" {
+		t.Errorf("Wanted reads to see the pending write got %q", got)
+	}
+
+	if got, _ := ReadFile(base, "/existing"); string(got) != "existing" {
+		t.Errorf("Wanted the backing file to be unchanged got %q", got)
+	}
+
+	if got := fs.Pending(); !reflect.DeepEqual([]string{"/existing"}, got) {
+		t.Errorf("Wanted /existing to be pending got %v", got)
+	}
+
+	if err = f.(io.Closer).Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(base, "/existing"); string(got) != "existing appended" {
+		t.Errorf("Wanted close to flush got %q", got)
+	}
+
+	if got := fs.Pending(); len(got) != 0 {
+		t.Errorf("Wanted nothing pending got %v", got)
+	}
+
+	f, _ = fs.Create("/new")
+	if _, err = base.Stat("/new"); err != nil {
+		t.Errorf("Wanted new files to be created in the backing FileSystem got %v", err)
+	}
+
+	f.Write([]byte("new"))
+	if err = f.(interface{ Sync() error }).Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(base, "/new"); string(got) != "new" {
+		t.Errorf("Wanted sync to flush got %q", got)
+	}
+	f.(io.Closer).Close()
+
+	f, err = fs.OpenFile("/synced", WrOnlyFlag|CreateFlag|SyncFlag, 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer f.(io.Closer).Close()
+
+	if _, err = f.Write([]byte("synced")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if got, _ := ReadFile(base, "/synced"); string(got) != "synced" {
+		t.Errorf("Wanted SyncFlag to flush every write got %q", got)
+	}
+}
+
+func TestWriteBackFsRenameDir(t *testing.T) {
+	base := NewMemFs()
+	base.Mkdir("/d", 0755)
+	fs := NewWriteBackFs(base, NewMemFs())
+
+	f, err := fs.Create("/d/f")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.Write([]byte("hello"))
+
+	if err = fs.Rename("/d", "/e"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := fs.Pending(); !reflect.DeepEqual([]string{"/e/f"}, got) {
+		t.Errorf("Wanted %v got %v", []string{"/e/f"}, got)
+	}
+
+	if got, _ := ReadFile(fs, "/e/f"); string(got) != "hello" {
+		t.Errorf("Wanted reads to see the pending write got %q", got)
+	}
+
+	if err = f.(io.Closer).Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(base, "/e/f"); string(got) != "hello" {
+		t.Errorf("Wanted %q got %q", "hello", got)
+	}
+
+	if _, err = base.Stat("/d"); !IsNotExist(err) {
+		t.Errorf("Wanted the old directory to be gone got %v", err)
+	}
+	fs.Close()
+}
+
+func TestWriteBackFsInterval(t *testing.T) {
+	base := &brokenFs{FileSystem: NewMemFs()}
+	clock := &testClock{}
+
+	var failed []string
+	handler := func(name string, err error) { failed = append(failed, name) }
+	fs := NewWriteBackFs(base, NewTempFs(), WithClock(clock), WithFlushInterval(time.Second), WithFlushErrorHandler(handler))
+	defer fs.Close()
+
+	if err := WriteFile(fs, "/file", []byte("content"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got, _ := ReadFile(base, "/file"); len(got) != 0 {
+		t.Errorf("Wanted the flush to wait for the timer got %q", got)
+	}
+
+	base.setBroken(true)
+	clock.fire()
+	if !reflect.DeepEqual([]string{"/file"}, failed) {
+		t.Errorf("Wanted a failed flush of /file got %v", failed)
+	}
+
+	if err := fs.Flush(); !IsError(ErrDisconnected, err) {
+		t.Errorf("Wanted %v got %v", ErrDisconnected, err)
+	}
+
+	base.setBroken(false)
+	clock.fire()
+	if got, _ := ReadFile(base, "/file"); string(got) != "content" {
+		t.Errorf("Wanted the timer to flush got %q", got)
+	}
+
+	if got := fs.Pending(); len(got) != 0 {
+		t.Errorf("Wanted nothing pending got %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package vfs
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+// WriteZip writes the tree rooted at root to w as a zip archive.  Entry names
+// are relative to root and file modes and modification times are preserved.
+// Symbolic links are stored with their target as content when the FileSystem
+// can read them.  The archive can be read back with FromIoFS(zip.NewReader(...))
+func WriteZip(fs FileSystem, root string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := Walk(fs, root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || filename == root {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = Rel(root, filename)
+		if info.IsDir() {
+			header.Name += PathSeparator
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if reader, ok := fs.(linkReader); ok {
+				var target string
+				if target, err = reader.Readlink(filename); err == nil {
+					_, err = io.WriteString(writer, target)
+				}
+			}
+		case info.Mode().IsRegular():
+			err = copyTo(writer, fs, filename)
+		}
+		return err
+	})
+
+	if err == nil {
+		err = zw.Close()
+	}
+	return err
+}
+
+// copyTo copies the contents of filename to w
+func copyTo(w io.Writer, fs FileSystem, filename string) error {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, f)
+	if closer, ok := f.(io.Closer); ok {
+		closer.Close()
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package vfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteZip(t *testing.T) {
+	fs := NewTempFs()
+	defer fs.Close()
+
+	MkdirAll(fs, "/root/dir", 0750)
+	WriteFile(fs, "/root/one.txt", []byte("one"), 0640)
+	WriteFile(fs, "/root/dir/two.txt", []byte("two"), 0600)
+	WriteFile(fs, "/other.txt", []byte("other"), 0644)
+
+	buf := &bytes.Buffer{}
+	if err := WriteZip(fs, "/root", buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, f := range zr.File {
+		info, _ := fs.Stat("/root/" + f.Name)
+		if f.Mode() != info.Mode() {
+			t.Errorf("%s: wanted mode %v got %v", f.Name, info.Mode(), f.Mode())
+		}
+
+		if f.Modified.Sub(info.ModTime()).Abs() > 2*time.Second {
+			t.Errorf("%s: wanted modtime %v got %v", f.Name, info.ModTime(), f.Modified)
+		}
+
+		if f.Mode()&os.ModeDir == 0 {
+			r, _ := f.Open()
+			data, _ := io.ReadAll(r)
+			got[f.Name] = string(data)
+		} else {
+			got[f.Name] = ""
+		}
+	}
+
+	want := map[string]string{"dir/": "", "dir/two.txt": "two", "one.txt": "one"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %v got %v", want, got)
+	}
+}